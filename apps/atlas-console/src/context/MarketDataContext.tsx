@@ -1,6 +1,7 @@
 import { createContext, useContext, useEffect, useState, useRef, type ReactNode } from 'react'
-import type { ExecutionReport, OrderRow, MarketDataUpdate } from '../types'
+import type { ExecutionReport, OrderRow, MarketDataUpdate, StreamMessage, StreamSnapshot } from '../types'
 import { useMode } from './ModeContext'
+import { useUserContext } from './UserContext'
 import { DemoEngine } from '../demo/engine'
 
 interface MarketDataContextType {
@@ -14,11 +15,14 @@ const MarketDataContext = createContext<MarketDataContextType | undefined>(undef
 
 export function MarketDataProvider({ children }: { children: ReactNode }) {
     const { isDemoMode } = useMode()
+    const { account } = useUserContext()
     const [orders, setOrders] = useState<Record<string, OrderRow>>({})
     const [l2Data, setL2Data] = useState<Record<string, MarketDataUpdate>>({})
     const [trades, setTrades] = useState<MarketDataUpdate[]>([])
     const [isConnected, setIsConnected] = useState(false)
     const ws = useRef<WebSocket | null>(null)
+    // Last sequence applied per channel, used to resume after a reconnect
+    const lastSeq = useRef<Record<string, number>>({})
 
     // Clear state when switching modes
     useEffect(() => {
@@ -48,6 +52,14 @@ export function MarketDataProvider({ children }: { children: ReactNode }) {
             ws.current.onopen = () => {
                 console.log('Connected to Order Gateway WS (Context)')
                 setIsConnected(true)
+                const resuming = Object.keys(lastSeq.current).length > 0
+                ws.current?.send(JSON.stringify(resuming ? {
+                    action: 'resume',
+                    account_id: account,
+                    from_seq: Object.fromEntries(
+                        Object.entries(lastSeq.current).map(([channel, seq]) => [channel, seq + 1])
+                    )
+                } : { action: 'subscribe', account_id: account }))
             }
 
             ws.current.onclose = () => {
@@ -61,7 +73,16 @@ export function MarketDataProvider({ children }: { children: ReactNode }) {
 
             ws.current.onmessage = (event) => {
                 try {
-                    const data = JSON.parse(event.data)
+                    const msg = JSON.parse(event.data) as StreamMessage
+                    if (msg.channel === 'snapshot') {
+                        handleSnapshot(msg.data as StreamSnapshot)
+                        return
+                    }
+                    // Drop replays and anything already covered by the snapshot
+                    if (msg.seq <= (lastSeq.current[msg.channel] ?? 0)) return
+                    lastSeq.current[msg.channel] = msg.seq
+
+                    const data = msg.data as ExecutionReport | MarketDataUpdate
                     if ('order_id' in data) {
                         handleExecutionReport(data as ExecutionReport)
                     } else if ('type' in data && (data.type === 'L2' || data.type === 'TRADE')) {
@@ -78,7 +99,16 @@ export function MarketDataProvider({ children }: { children: ReactNode }) {
                 setIsConnected(false)
             }
         }
-    }, [isDemoMode])
+    }, [isDemoMode, account])
+
+    const handleSnapshot = (snapshot: StreamSnapshot) => {
+        lastSeq.current = { ...snapshot.seqs }
+        setOrders({})
+        for (const report of snapshot.orders ?? []) {
+            handleExecutionReport(report)
+        }
+        setL2Data(snapshot.books)
+    }
 
     const handleMarketData = (update: MarketDataUpdate) => {
         if (update.type === 'L2') {
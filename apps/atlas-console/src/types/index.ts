@@ -1,16 +1,52 @@
 export type OrderSide = 'BUY' | 'SELL'
-export type OrderType = 'MARKET' | 'LIMIT'
-export type OrderStatus = 'NEW' | 'PENDING_SUBMIT' | 'LIVE' | 'PARTIALLY_FILLED' | 'FILLED' | 'CANCEL_PENDING' | 'CANCELED' | 'REPLACE_PENDING' | 'REJECTED'
+export type OrderType = 'MARKET' | 'LIMIT' | 'STOP' | 'STOP_LIMIT'
+export type OrderStatus = 'NEW' | 'PENDING_TRIGGER' | 'PENDING_PARENT' | 'TRIGGERED' | 'PENDING_SUBMIT' | 'LIVE' | 'PARTIALLY_FILLED' | 'PAUSED' | 'FILLED' | 'CANCEL_PENDING' | 'CANCELED' | 'REPLACE_PENDING' | 'REJECTED'
+
+export type ContingencyType = 'OCO' | 'BRACKET'
+
+export interface OrderLeg {
+    order_id?: string
+    order_type: 'LIMIT' | 'STOP' | 'STOP_LIMIT'
+    price?: number
+    stop_price?: number
+}
+
+export type AlgoType = 'TWAP' | 'VWAP' | 'POV' | 'IS'
+
+export interface AlgoParams {
+    type: AlgoType
+    start_time?: string
+    end_time?: string
+    slice_secs?: number
+    participation_pct?: number
+    min_pct?: number
+    max_pct?: number
+    urgency?: number
+}
+
+export type STPMode = 'CANCEL_NEWEST' | 'CANCEL_OLDEST' | 'CANCEL_BOTH' | 'DECREMENT_AND_CANCEL'
 
 export interface OrderCommand {
     command_id?: string
-    type: 'NEW' | 'CANCEL' | 'REPLACE'
+    type: 'NEW' | 'CANCEL' | 'REPLACE' | 'PAUSE' | 'RESUME'
     order_id: string
     client_id: string
     symbol: string
     side: OrderSide
+    order_type?: OrderType
     quantity: number
     price: number
+    stop_price?: number
+    stp_mode?: STPMode
+    post_only?: 'REJECT' | 'REPRICE'
+    display_qty?: number
+    contingency_type?: ContingencyType
+    legs?: OrderLeg[]
+    parent_order_id?: string // set by oms-core; the gateway rejects it
+    reserve_px?: number // set by the gateway; it rejects it from clients
+    algo?: AlgoParams
+    venue?: string // a venue ID, or 'SMART' to split across venues
+    fee_tier?: string // set by the gateway
     timestamp?: string
 }
 
@@ -29,6 +65,17 @@ export interface ExecutionReport {
     leaves_qty: number
     cum_qty: number
     avg_px: number
+    canceled_qty?: number
+    book_px?: number
+    parent_order_id?: string
+    contingency_type?: ContingencyType
+    reserve_px?: number
+    venue?: string
+    liquidity?: 'ADDED' | 'REMOVED'
+    fee?: number // negative for a rebate
+    fee_asset?: string
+    arrival_px?: number
+    slippage_bps?: number
     timestamp: string
     reason?: string
 }
@@ -52,9 +99,44 @@ export interface MarketDataUpdate {
     bids?: PriceLevel[]
     asks?: PriceLevel[]
     trade?: TradeInfo
+    venue?: string
     timestamp: string
 }
 
+// Server-side position and P&L from position-service, in the quote asset
+export interface Position {
+    account_id: string
+    symbol: string
+    method: 'FIFO' | 'AVG_COST'
+    qty: number // negative when short
+    avg_cost: number
+    mark_px?: number
+    realized_pnl: number
+    unrealized_pnl: number
+    fees: number
+    borrow_fees: number
+    net_pnl: number
+    updated_at: string
+}
+
+// Envelope for every message on the gateway /ws stream
+export type StreamChannel = 'executions' | 'market_data' | 'audit' | 'positions' | 'snapshot'
+
+export interface StreamMessage<T = unknown> {
+    channel: StreamChannel
+    seq: number
+    data: T
+}
+
+export interface StreamSnapshot {
+    account_id: string
+    orders: ExecutionReport[] | null
+    balances?: Account
+    positions?: Position[]
+    books: Record<string, MarketDataUpdate>
+    seqs: Record<string, number>
+}
+
 // Flattened Order model for the Blotter
 export interface OrderRow {
     order_id: string
@@ -73,7 +155,87 @@ export interface Balance {
     reserved: number
 }
 
+export interface KillSwitch {
+    engaged: boolean
+    reason?: string
+    actor?: 'self' | 'admin'
+    updated_at: string
+}
+
+// Equity and requirements of a margin account, in USD. A negative balance
+// total is borrowed.
+export interface MarginStatus {
+    state: 'OK' | 'MARGIN_CALL' | 'LIQUIDATING'
+    equity: number
+    exposure: number
+    initial_req: number
+    maintenance_req: number
+    borrowed_usd: number
+    borrowed_btc: number
+    mark_px: number
+    updated_at: string
+}
+
 export interface Account {
+    tier?: string
     usd: Balance
     btc: Balance
+    kill_switch?: KillSwitch
+    margin?: MarginStatus
+    locates?: Record<string, number> // located qty per asset
+}
+
+// Borrow inventory for short selling, from GET /borrow
+export interface BorrowAsset {
+    asset: string
+    status: 'ETB' | 'HTB'
+    available: number
+    rate_bps: number // annual
+}
+
+// Account-level actions broadcast on the 'audit' channel
+export interface AuditEvent {
+    event_id: string
+    type: 'KILL_SWITCH_ENGAGED' | 'KILL_SWITCH_RELEASED' | 'MASS_CANCEL'
+        | 'MARGIN_ENABLED' | 'MARGIN_DISABLED' | 'MARGIN_CALL' | 'MARGIN_CALL_CLEARED'
+        | 'LIQUIDATION_STARTED' | 'LIQUIDATION_ORDER' | 'LIQUIDATION_COMPLETED'
+        | 'LOCATE_GRANTED' | 'LOCATE_RETURNED'
+    account_id: string
+    actor: 'self' | 'admin' | 'system'
+    reason?: string
+    details?: Record<string, unknown>
+    timestamp: string
+}
+
+// An order as indexed by audit-sink, from GET /audit/orders
+export interface AuditOrder {
+    order_id: string
+    account?: string
+    symbol?: string
+    side?: 'BUY' | 'SELL'
+    status?: string // from the latest execution report
+    parent_order_id?: string
+    first_seen: string
+    last_seen: string
+    entry_count: number
+}
+
+// One message in an order's timeline
+export interface TimelineEntry {
+    topic: 'orders.commands' | 'orders.events' | 'exec.reports'
+    partition: number
+    offset: number
+    order_id: string
+    kind: 'COMMAND' | 'EVENT' | 'EXEC_REPORT'
+    type: string
+    id: string // command_id, event_id or exec_id
+    caused_by?: string
+    timestamp: string
+    data: OrderCommand | ExecutionReport | Record<string, unknown> // the message as published
+}
+
+// An order's lifecycle in causal order, from GET /audit/orders/{id}/timeline
+export interface OrderTimeline extends AuditOrder {
+    children?: string[]
+    entries: TimelineEntry[]
 }
@@ -24,6 +24,24 @@ resource "aws_dynamodb_table" "atlas_orders" {
     type = "S"
   }
 
+  attribute {
+    name = "account_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "updated_at"
+    type = "N"
+  }
+
+  # Open orders by account, for WebSocket snapshots.
+  global_secondary_index {
+    name            = "account_id-index"
+    hash_key        = "account_id"
+    range_key       = "updated_at"
+    projection_type = "ALL"
+  }
+
   tags = {
     Environment = var.env
     Project     = "ATLAS"
@@ -50,3 +68,41 @@ resource "aws_dynamodb_table" "atlas_idempotency" {
     Project     = "ATLAS"
   }
 }
+
+resource "aws_dynamodb_table" "atlas_positions" {
+  name           = "atlas_positions"
+  billing_mode   = "PAY_PER_REQUEST"
+  hash_key       = "account_id"
+  range_key      = "symbol"
+
+  attribute {
+    name = "account_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "symbol"
+    type = "S"
+  }
+
+  tags = {
+    Environment = var.env
+    Project     = "ATLAS"
+  }
+}
+
+resource "aws_dynamodb_table" "atlas_borrow" {
+  name           = "atlas_borrow"
+  billing_mode   = "PAY_PER_REQUEST"
+  hash_key       = "asset"
+
+  attribute {
+    name = "asset"
+    type = "S"
+  }
+
+  tags = {
+    Environment = var.env
+    Project     = "ATLAS"
+  }
+}
@@ -29,18 +29,18 @@ echo -e "${YELLOW}[1/4] Checking Gateway health...${NC}"
 if ! curl -s "${GATEWAY_URL}/health" > /dev/null 2>&1; then
     echo -e "${RED}ERROR: Gateway not responding at ${GATEWAY_URL}${NC}"
     echo "Please start services with:"
-    echo "  cd /Users/ujjwal/Atlas/services/order-gateway && go run main.go &"
-    echo "  cd /Users/ujjwal/Atlas/services/oms-core && go run main.go &"
-    echo "  cd /Users/ujjwal/Atlas/services/venue-sim && go run main.go &"
+    echo "  cd /Users/ujjwal/Atlas/services/order-gateway && go run . &"
+    echo "  cd /Users/ujjwal/Atlas/services/oms-core && go run . &"
+    echo "  cd /Users/ujjwal/Atlas/services/venue-sim && go run . &"
     exit 1
 fi
 echo -e "${GREEN}✓ Gateway is healthy${NC}"
 echo ""
 
 # =============================================================================
-# TEST 1: SELL Order at $1 (WAY below market, guaranteed to fill)
+# TEST 1: SELL Order at $45000 (below market, guaranteed to fill)
 # =============================================================================
-echo -e "${YELLOW}[2/4] Submitting SELL order at \$1 (must fill)...${NC}"
+echo -e "${YELLOW}[2/4] Submitting SELL order at \$45000 (must fill)...${NC}"
 SELL_RESPONSE=$(curl -s -X POST "${GATEWAY_URL}/orders" \
     -H "Content-Type: application/json" \
     -d '{
@@ -48,7 +48,7 @@ SELL_RESPONSE=$(curl -s -X POST "${GATEWAY_URL}/orders" \
         "symbol": "'"${SYMBOL}"'",
         "side": "SELL",
         "quantity": 0.001,
-        "price": 1.0,
+        "price": 45000.0,
         "client_id": "ACC_CHILD_1"
     }')
 
@@ -62,9 +62,9 @@ echo -e "${GREEN}✓ SELL order submitted: ${SELL_ORDER_ID}${NC}"
 echo ""
 
 # =============================================================================
-# TEST 2: BUY Order at $999999 (WAY above market, guaranteed to fill)
+# TEST 2: BUY Order at $55000 (above market, guaranteed to fill)
 # =============================================================================
-echo -e "${YELLOW}[3/4] Submitting BUY order at \$999999 (must fill)...${NC}"
+echo -e "${YELLOW}[3/4] Submitting BUY order at \$55000 (must fill)...${NC}"
 BUY_RESPONSE=$(curl -s -X POST "${GATEWAY_URL}/orders" \
     -H "Content-Type: application/json" \
     -d '{
@@ -72,7 +72,7 @@ BUY_RESPONSE=$(curl -s -X POST "${GATEWAY_URL}/orders" \
         "symbol": "'"${SYMBOL}"'",
         "side": "BUY",
         "quantity": 0.001,
-        "price": 999999.0,
+        "price": 55000.0,
         "client_id": "ACC_CHILD_1"
     }')
 
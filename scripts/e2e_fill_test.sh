@@ -14,8 +14,8 @@ ORDER_ID="test-$(date +%s)-$(uuidgen | cut -d'-' -f1)"
 echo "📝 Test Order ID: $ORDER_ID"
 echo ""
 
-# Submit SELL order at price=1 (guaranteed to cross market)
-echo "1️⃣  Submitting SELL order at price=1..."
+# Submit SELL order at price=45000 (well through the market, guaranteed to cross)
+echo "1️⃣  Submitting SELL order at price=45000..."
 RESPONSE=$(curl -s -X POST http://localhost:8001/orders \
   -H "Content-Type: application/json" \
   -d "{
@@ -25,7 +25,7 @@ RESPONSE=$(curl -s -X POST http://localhost:8001/orders \
     \"symbol\": \"BTC-USD\",
     \"side\": \"SELL\",
     \"quantity\": 0.01,
-    \"price\": 1.0
+    \"price\": 45000.0
   }")
 
 echo "Response: $RESPONSE"
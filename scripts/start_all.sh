@@ -22,17 +22,27 @@ echo "2️⃣  Checking services..."
 VENUE_PID=$(pgrep -f "venue-sim" | head -1)
 OMS_PID=$(pgrep -f "oms-core" | head -1)
 GW_PID=$(pgrep -f "order-gateway" | head -1)
+PRETRADE_PID=$(pgrep -f "pretrade-controls" | head -1)
+POLICY_PID=$(pgrep -f "policy-service" | head -1)
+POSITION_PID=$(pgrep -f "position-service" | head -1)
+AUDIT_SINK_PID=$(pgrep -f "audit-sink" | head -1)
 
-if [ -z "$VENUE_PID" ] || [ -z "$OMS_PID" ] || [ -z "$GW_PID" ]; then
+if [ -z "$VENUE_PID" ] || [ -z "$OMS_PID" ] || [ -z "$GW_PID" ] || [ -z "$PRETRADE_PID" ] || [ -z "$POLICY_PID" ] || [ -z "$POSITION_PID" ] || [ -z "$AUDIT_SINK_PID" ]; then
   echo "⚠️  Some services not running. Starting all services..."
   
   # Kill any existing processes
-  pkill -f "venue-sim|oms-core|order-gateway" 2>/dev/null || true
+  pkill -f "venue-sim|oms-core|pretrade-controls|policy-service|position-service|audit-sink|order-gateway" 2>/dev/null || true
   sleep 1
   
   # Start services
   cd services/venue-sim && nohup ./venue-sim > venue.log 2>&1 &
+  cd services/venue-sim && ATLAS_VENUE_ID=ALPHA nohup ./venue-sim > venue-alpha.log 2>&1 &
+  cd services/venue-sim && ATLAS_VENUE_ID=BETA nohup ./venue-sim > venue-beta.log 2>&1 &
   cd ../oms-core && nohup ./oms-core > oms.log 2>&1 &
+  cd ../pretrade-controls && nohup ./pretrade-controls > pretrade.log 2>&1 &
+  cd ../policy-service && nohup ./policy-service > policy.log 2>&1 &
+  cd ../position-service && nohup ./position-service > position.log 2>&1 &
+  cd ../audit-sink && nohup ./audit-sink > audit-sink.log 2>&1 &
   cd ../order-gateway && nohup ./order-gateway > gateway.log 2>&1 &
   cd ../..
   
@@ -42,6 +52,10 @@ else
   echo "✅ All services running"
   echo "   venue-sim: PID $VENUE_PID"
   echo "   oms-core: PID $OMS_PID"
+  echo "   pretrade-controls: PID $PRETRADE_PID"
+  echo "   policy-service: PID $POLICY_PID"
+  echo "   position-service: PID $POSITION_PID"
+  echo "   audit-sink: PID $AUDIT_SINK_PID"
   echo "   order-gateway: PID $GW_PID"
 fi
 echo ""
@@ -69,6 +83,6 @@ echo "  tail -f services/order-gateway/gateway.log"
 echo ""
 echo "To test via UI:"
 echo "1. Open Atlas Console in browser"
-echo "2. Submit SELL order: BTC-USD, Qty=0.01, Price=1"
+echo "2. Submit SELL order: BTC-USD, Qty=0.01, Price=45000"
 echo "3. Watch logs for complete execution flow"
 echo ""
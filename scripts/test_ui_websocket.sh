@@ -11,7 +11,7 @@ echo ""
 echo "1️⃣  Checking if order-gateway is running..."
 if ! lsof -i :8001 > /dev/null 2>&1; then
     echo "❌ order-gateway is not running on port 8001"
-    echo "   Please start it with: cd services/order-gateway && go run main.go"
+    echo "   Please start it with: cd services/order-gateway && go run ."
     exit 1
 fi
 echo "✅ order-gateway is running"
@@ -35,7 +35,7 @@ echo "   - '📨 Exec Report Received:' messages"
 echo ""
 
 # Submit a test order
-echo "4️⃣  Submitting test SELL order at price=\$1..."
+echo "4️⃣  Submitting test SELL order at price=\$45000..."
 ORDER_ID="test-$(date +%s)"
 
 curl -s -X POST http://localhost:8001/orders \
@@ -47,7 +47,7 @@ curl -s -X POST http://localhost:8001/orders \
     \"symbol\": \"BTC-USD\",
     \"side\": \"SELL\",
     \"quantity\": 0.01,
-    \"price\": 1.0
+    \"price\": 45000.0
   }" > /dev/null
 
 echo "✅ Order submitted: $ORDER_ID"
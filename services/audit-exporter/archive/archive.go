@@ -0,0 +1,228 @@
+// Package archive turns runs of Kafka messages into compressed JSONL files
+// for S3, one per batch, each described by a manifest of the offsets it holds.
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is how archive files are compressed.
+type Compression string
+
+const (
+	Gzip Compression = "gzip"
+	Zstd Compression = "zstd"
+)
+
+// ParseCompression checks a compression name.
+func ParseCompression(s string) (Compression, error) {
+	switch c := Compression(s); c {
+	case Gzip, Zstd:
+		return c, nil
+	}
+	return "", fmt.Errorf("unknown compression %q", s)
+}
+
+// Ext is the file extension of a compressed archive.
+func (c Compression) Ext() string {
+	if c == Zstd {
+		return ".jsonl.zst"
+	}
+	return ".jsonl.gz"
+}
+
+// Record is one message in a batch, chained.
+type Record struct {
+	ChainRecord
+	Time time.Time // event time
+}
+
+// EventTime is the time a message's event happened: its JSON timestamp
+// field, or fallback when it has none.
+func EventTime(value []byte, fallback time.Time) time.Time {
+	var event struct {
+		Timestamp time.Time `json:"timestamp"`
+	}
+	if err := json.Unmarshal(value, &event); err == nil && !event.Timestamp.IsZero() {
+		return event.Timestamp.UTC()
+	}
+	return fallback.UTC()
+}
+
+// Day is the dt= partition of an event time.
+func Day(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// Batch is a run of messages from one topic partition whose events all fall
+// on one day.
+type Batch struct {
+	Topic     string
+	Partition int
+	Day       string
+	Records   []Record
+	Bytes     int       // uncompressed
+	Opened    time.Time // when the first record was added
+}
+
+// NewBatch starts an empty batch.
+func NewBatch(topic string, partition int, day string) *Batch {
+	return &Batch{Topic: topic, Partition: partition, Day: day}
+}
+
+// Add appends a record.
+func (b *Batch) Add(r Record) {
+	if len(b.Records) == 0 {
+		b.Opened = time.Now()
+	}
+	b.Records = append(b.Records, r)
+	b.Bytes += len(r.Event) + 1
+}
+
+// Len is the number of records.
+func (b *Batch) Len() int { return len(b.Records) }
+
+// FirstOffset and LastOffset bound the batch's offsets.
+func (b *Batch) FirstOffset() int64 { return b.Records[0].Offset }
+func (b *Batch) LastOffset() int64  { return b.Records[len(b.Records)-1].Offset }
+
+// Key is the batch's S3 key. It is made of the batch's offsets, so writing
+// the same batch again replaces the file instead of duplicating it.
+func (b *Batch) Key(c Compression) string {
+	return fmt.Sprintf("events/dt=%s/topic=%s/p=%d/offsets=%020d-%020d%s",
+		b.Day, b.Topic, b.Partition, b.FirstOffset(), b.LastOffset(), c.Ext())
+}
+
+// Encode is the batch as compressed JSONL, one ChainRecord per line. Events
+// are written byte for byte as they were hashed.
+func (b *Batch) Encode(c Compression) ([]byte, error) {
+	var buf bytes.Buffer
+	var w interface {
+		Write([]byte) (int, error)
+		Close() error
+	}
+	switch c {
+	case Zstd:
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			return nil, err
+		}
+		w = zw
+	default:
+		w = gzip.NewWriter(&buf)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, r := range b.Records {
+		if err := enc.Encode(r.ChainRecord); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode reads the records back out of a compressed archive file.
+func Decode(c Compression, body []byte) ([]ChainRecord, error) {
+	var r io.Reader
+	switch c {
+	case Zstd:
+		zr, err := zstd.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		gr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = gr
+	}
+	var records []ChainRecord
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 64<<20)
+	for sc.Scan() {
+		var rec ChainRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("line %d: %w", len(records)+1, err)
+		}
+		records = append(records, rec)
+	}
+	return records, sc.Err()
+}
+
+// Manifest describes one archive file: where it came from and what is in
+// it. It is written once the file is, so a manifest means its file is
+// complete.
+type Manifest struct {
+	Key             string      `json:"key"`
+	Topic           string      `json:"topic"`
+	Partition       int         `json:"partition"`
+	Day             string      `json:"dt"`
+	FirstOffset     int64       `json:"first_offset"`
+	LastOffset      int64       `json:"last_offset"`
+	Records         int         `json:"records"`
+	FirstEventTime  time.Time   `json:"first_event_time"`
+	LastEventTime   time.Time   `json:"last_event_time"`
+	Compression     Compression `json:"compression"`
+	Bytes           int         `json:"bytes"`
+	CompressedBytes int         `json:"compressed_bytes"`
+	SHA256          string      `json:"sha256"`    // of the compressed file
+	FirstPrevHash   string      `json:"prev_hash"` // chain hash before the first record
+	LastHash        string      `json:"last_hash"` // chain hash of the last record
+	WrittenAt       time.Time   `json:"written_at"`
+}
+
+// Manifest describes the batch written as body under key.
+func (b *Batch) Manifest(c Compression, key string, body []byte) Manifest {
+	first, last := b.Records[0].Time, b.Records[0].Time
+	for _, r := range b.Records[1:] {
+		if r.Time.Before(first) {
+			first = r.Time
+		}
+		if r.Time.After(last) {
+			last = r.Time
+		}
+	}
+	sum := sha256.Sum256(body)
+	return Manifest{
+		Key:             key,
+		Topic:           b.Topic,
+		Partition:       b.Partition,
+		Day:             b.Day,
+		FirstOffset:     b.FirstOffset(),
+		LastOffset:      b.LastOffset(),
+		Records:         b.Len(),
+		FirstEventTime:  first,
+		LastEventTime:   last,
+		Compression:     c,
+		Bytes:           b.Bytes,
+		CompressedBytes: len(body),
+		SHA256:          hex.EncodeToString(sum[:]),
+		FirstPrevHash:   b.Records[0].PrevHash,
+		LastHash:        b.Records[len(b.Records)-1].Hash,
+		WrittenAt:       time.Now().UTC(),
+	}
+}
+
+// ManifestKey is where the manifest goes: under manifests/, partitioned like
+// its file.
+func (m Manifest) ManifestKey() string {
+	return fmt.Sprintf("manifests/dt=%s/topic=%s/p=%d/offsets=%020d-%020d.json",
+		m.Day, m.Topic, m.Partition, m.FirstOffset, m.LastOffset)
+}
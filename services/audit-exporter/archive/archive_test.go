@@ -0,0 +1,91 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	values := []string{`{"type":"NEW","order_id":"O1"}`, `{"html":"<a & b>"}`, `plain text`}
+	h := NewHead()
+	b := NewBatch("orders.commands", 1, "2026-01-05")
+	for i, v := range values {
+		rec, err := h.Link(int64(100+i), []byte(v))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Add(Record{ChainRecord: rec, Time: time.Date(2026, 1, 5, 9, i, 0, 0, time.UTC)})
+	}
+
+	for _, c := range []Compression{Gzip, Zstd} {
+		body, err := b.Encode(c)
+		if err != nil {
+			t.Fatalf("%s: Encode: %v", c, err)
+		}
+		got, err := Decode(c, body)
+		if err != nil {
+			t.Fatalf("%s: Decode: %v", c, err)
+		}
+		if len(got) != len(b.Records) {
+			t.Fatalf("%s: decoded %d records, want %d", c, len(got), len(b.Records))
+		}
+		for i, rec := range got {
+			want := b.Records[i].ChainRecord
+			if rec.Offset != want.Offset || rec.PrevHash != want.PrevHash || rec.Hash != want.Hash || !bytes.Equal(rec.Event, want.Event) {
+				t.Errorf("%s: record %d = %+v, want %+v", c, i, rec, want)
+			}
+		}
+
+		key := b.Key(c)
+		if want := "events/dt=2026-01-05/topic=orders.commands/p=1/offsets=00000000000000000100-00000000000000000102" + c.Ext(); key != want {
+			t.Errorf("%s: Key = %s, want %s", c, key, want)
+		}
+		m := b.Manifest(c, key, body)
+		sum := sha256.Sum256(body)
+		tests := []struct {
+			name      string
+			got, want interface{}
+		}{
+			{"records", m.Records, 3},
+			{"offsets", [2]int64{m.FirstOffset, m.LastOffset}, [2]int64{100, 102}},
+			{"first event", m.FirstEventTime, b.Records[0].Time},
+			{"last event", m.LastEventTime, b.Records[2].Time},
+			{"sha256", m.SHA256, hex.EncodeToString(sum[:])},
+			{"prev hash", m.FirstPrevHash, GenesisHash},
+			{"last hash", m.LastHash, h.Hash},
+			{"manifest key", m.ManifestKey(), "manifests/dt=2026-01-05/topic=orders.commands/p=1/offsets=00000000000000000100-00000000000000000102.json"},
+		}
+		for _, tt := range tests {
+			if tt.got != tt.want {
+				t.Errorf("%s: manifest %s = %v, want %v", c, tt.name, tt.got, tt.want)
+			}
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	if _, err := Decode(Gzip, []byte("not gzip")); err == nil {
+		t.Errorf("Decode accepted a body that is not gzip")
+	}
+	b := NewBatch("t", 0, "2026-01-05")
+	b.Add(Record{ChainRecord: ChainRecord{Offset: 1, Event: []byte(`{}`)}})
+	body, _ := b.Encode(Gzip)
+	if _, err := Decode(Zstd, body); err == nil {
+		t.Errorf("Decode accepted gzip as zstd")
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	for _, s := range []string{"gzip", "zstd"} {
+		if c, err := ParseCompression(s); err != nil || string(c) != s {
+			t.Errorf("ParseCompression(%q) = %q, %v", s, c, err)
+		}
+	}
+	if _, err := ParseCompression("lz4"); err == nil || !strings.Contains(err.Error(), "lz4") {
+		t.Errorf("ParseCompression(lz4) error = %v", err)
+	}
+}
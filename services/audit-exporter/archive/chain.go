@@ -0,0 +1,73 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// Every archived record is chained to the one before it in its partition:
+// its hash covers the previous record's hash, its offset and its event. A
+// record altered, removed or moved breaks the chain from there on.
+
+// GenesisHash is the previous hash of a partition's first record.
+var GenesisHash = hex.EncodeToString(make([]byte, sha256.Size))
+
+// ChainRecord is one line of an archive file.
+type ChainRecord struct {
+	Offset   int64           `json:"offset"`
+	PrevHash string          `json:"prev_hash"`
+	Hash     string          `json:"hash"`
+	Event    json.RawMessage `json:"event"`
+}
+
+// EventJSON is how a message is stored in a record: compact JSON, or a JSON
+// string when the message is not JSON. The record hash covers these bytes.
+func EventJSON(value []byte) json.RawMessage {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, value); err == nil {
+		return buf.Bytes()
+	}
+	raw, _ := json.Marshal(string(value))
+	return raw
+}
+
+// RecordHash is the hash of the record at offset holding event, following
+// the record hashed prev.
+func RecordHash(prev string, offset int64, event []byte) (string, error) {
+	p, err := hex.DecodeString(prev)
+	if err != nil || len(p) != sha256.Size {
+		return "", fmt.Errorf("bad previous hash %q", prev)
+	}
+	h := sha256.New()
+	h.Write(p)
+	binary.Write(h, binary.BigEndian, offset)
+	h.Write(event)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Head is the end of a partition's chain: the last record archived.
+type Head struct {
+	Offset int64  `json:"offset"` // -1 before the first record
+	Hash   string `json:"hash"`
+}
+
+// NewHead is the head of an empty chain.
+func NewHead() Head {
+	return Head{Offset: -1, Hash: GenesisHash}
+}
+
+// Link chains a message onto the head and returns its record.
+func (h *Head) Link(offset int64, value []byte) (ChainRecord, error) {
+	event := EventJSON(value)
+	hash, err := RecordHash(h.Hash, offset, event)
+	if err != nil {
+		return ChainRecord{}, err
+	}
+	rec := ChainRecord{Offset: offset, PrevHash: h.Hash, Hash: hash, Event: event}
+	h.Offset, h.Hash = offset, hash
+	return rec, nil
+}
@@ -0,0 +1,201 @@
+package archive
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// A checkpoint signs, per partition, the Merkle root of the files archived
+// since the previous checkpoint. Each file is a leaf by its last chain hash,
+// which commits to every record before it, and each checkpoint names the
+// digest of the one before, so the checkpoints form a chain of their own.
+
+// Leaf is one archive file in a checkpoint.
+type Leaf struct {
+	Key         string `json:"key"`
+	FirstOffset int64  `json:"first_offset"`
+	LastOffset  int64  `json:"last_offset"`
+	LastHash    string `json:"last_hash"`
+}
+
+// LeafOf is the leaf of the file a manifest describes.
+func LeafOf(m Manifest) Leaf {
+	return Leaf{Key: m.Key, FirstOffset: m.FirstOffset, LastOffset: m.LastOffset, LastHash: m.LastHash}
+}
+
+// MerkleRoot is the root of the tree over leaves, built as in RFC 6962:
+// leaf and node hashes are domain separated and the tree splits at the
+// largest power of two below its size.
+func MerkleRoot(leaves []Leaf) string {
+	if len(leaves) == 0 {
+		return GenesisHash
+	}
+	hashes := make([][]byte, len(leaves))
+	for i, l := range leaves {
+		h := sha256.New()
+		h.Write([]byte{0})
+		h.Write([]byte(l.LastHash))
+		hashes[i] = h.Sum(nil)
+	}
+	return hex.EncodeToString(merkle(hashes))
+}
+
+func merkle(hashes [][]byte) []byte {
+	if len(hashes) == 1 {
+		return hashes[0]
+	}
+	split := 1
+	for split*2 < len(hashes) {
+		split *= 2
+	}
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(merkle(hashes[:split]))
+	h.Write(merkle(hashes[split:]))
+	return h.Sum(nil)
+}
+
+// Checkpoint is a signed statement of what a partition's archive held.
+type Checkpoint struct {
+	Topic          string    `json:"topic"`
+	Partition      int       `json:"partition"`
+	Seq            int64     `json:"seq"`
+	PrevCheckpoint string    `json:"prev_checkpoint"` // Digest of the previous one; GenesisHash for the first
+	FirstOffset    int64     `json:"first_offset"`
+	LastOffset     int64     `json:"last_offset"`
+	Leaves         []Leaf    `json:"leaves"`
+	MerkleRoot     string    `json:"merkle_root"`
+	Head           string    `json:"head"` // chain hash of the last record covered
+	CreatedAt      time.Time `json:"created_at"`
+	PublicKey      string    `json:"public_key"`
+	Signature      string    `json:"signature"`
+}
+
+// Key is where the checkpoint is stored.
+func (c Checkpoint) Key() string {
+	return CheckpointPrefix(c.Topic, c.Partition) + fmt.Sprintf("seq=%010d.json", c.Seq)
+}
+
+// CheckpointPrefix is where a partition's checkpoints are stored.
+func CheckpointPrefix(topic string, partition int) string {
+	return fmt.Sprintf("checkpoints/topic=%s/p=%d/", topic, partition)
+}
+
+// payload is what is signed: the checkpoint without its signature.
+func (c Checkpoint) payload() []byte {
+	c.Signature = ""
+	raw, _ := json.Marshal(c)
+	return raw
+}
+
+// Sign signs the checkpoint with key.
+func (c *Checkpoint) Sign(key ed25519.PrivateKey) {
+	c.PublicKey = hex.EncodeToString(key.Public().(ed25519.PublicKey))
+	c.Signature = hex.EncodeToString(ed25519.Sign(key, c.payload()))
+}
+
+// Verify checks the signature against pub and the Merkle root against the
+// leaves.
+func (c Checkpoint) Verify(pub ed25519.PublicKey) error {
+	sig, err := hex.DecodeString(c.Signature)
+	if err != nil || !ed25519.Verify(pub, c.payload(), sig) {
+		return errors.New("bad signature")
+	}
+	if root := MerkleRoot(c.Leaves); root != c.MerkleRoot {
+		return fmt.Errorf("merkle root %s does not match its leaves (%s)", c.MerkleRoot, root)
+	}
+	return nil
+}
+
+// Digest identifies the checkpoint, signature included, to the next one.
+func (c Checkpoint) Digest() string {
+	raw, _ := json.Marshal(c)
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// State is where a partition's archive has got to. It is stored after every
+// file so that a restarted exporter carries on the same chain.
+type State struct {
+	Head Head `json:"head"`
+	// Pending are the files since the last checkpoint.
+	Pending []Leaf `json:"pending"`
+	// The last checkpoint.
+	CheckpointSeq    int64     `json:"checkpoint_seq"`
+	CheckpointDigest string    `json:"checkpoint_digest"`
+	CheckpointAt     time.Time `json:"checkpoint_at"`
+}
+
+// NewState is the state of a partition with nothing archived.
+func NewState() *State {
+	return &State{Head: NewHead(), CheckpointDigest: GenesisHash, CheckpointAt: time.Now().UTC()}
+}
+
+// StateKey is where a partition's state is stored.
+func StateKey(topic string, partition int) string {
+	return fmt.Sprintf("chain/topic=%s/p=%d/state.json", topic, partition)
+}
+
+// Checkpoint signs the pending files into the next checkpoint and starts a
+// new pending list. It returns nil when nothing is pending.
+func (s *State) Checkpoint(topic string, partition int, key ed25519.PrivateKey) *Checkpoint {
+	if len(s.Pending) == 0 {
+		return nil
+	}
+	c := &Checkpoint{
+		Topic:          topic,
+		Partition:      partition,
+		Seq:            s.CheckpointSeq + 1,
+		PrevCheckpoint: s.CheckpointDigest,
+		FirstOffset:    s.Pending[0].FirstOffset,
+		LastOffset:     s.Pending[len(s.Pending)-1].LastOffset,
+		Leaves:         s.Pending,
+		MerkleRoot:     MerkleRoot(s.Pending),
+		Head:           s.Pending[len(s.Pending)-1].LastHash,
+		CreatedAt:      time.Now().UTC(),
+	}
+	c.Sign(key)
+	s.CheckpointSeq = c.Seq
+	s.CheckpointDigest = c.Digest()
+	s.CheckpointAt = c.CreatedAt
+	s.Pending = nil
+	return c
+}
+
+// ReadKey reads an ed25519 key file: the hex-encoded 32-byte seed.
+func ReadKey(path string) (ed25519.PrivateKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := hex.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("%s: not a hex-encoded ed25519 seed", path)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// LoadOrCreateKey reads the key file at path, creating it with a new key if
+// there is none.
+func LoadOrCreateKey(path string) (ed25519.PrivateKey, bool, error) {
+	key, err := ReadKey(path)
+	if err == nil || !errors.Is(err, os.ErrNotExist) {
+		return key, false, err
+	}
+	_, key, err = ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key.Seed())+"\n"), 0o600); err != nil {
+		return nil, false, err
+	}
+	return key, true, nil
+}
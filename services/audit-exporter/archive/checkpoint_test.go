@@ -0,0 +1,166 @@
+package archive
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func leaves(n int) []Leaf {
+	out := make([]Leaf, n)
+	for i := range out {
+		sum := sha256.Sum256([]byte{byte(i)})
+		out[i] = Leaf{Key: "k" + string(rune('a'+i)), FirstOffset: int64(i * 10), LastOffset: int64(i*10 + 9), LastHash: hex.EncodeToString(sum[:])}
+	}
+	return out
+}
+
+func leafHash(l Leaf) []byte {
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write([]byte(l.LastHash))
+	return h.Sum(nil)
+}
+
+func nodeHash(l, r []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(l)
+	h.Write(r)
+	return h.Sum(nil)
+}
+
+func TestMerkleRoot(t *testing.T) {
+	l := leaves(5)
+	h := make([][]byte, len(l))
+	for i := range l {
+		h[i] = leafHash(l[i])
+	}
+	tests := []struct {
+		n    int
+		want []byte
+	}{
+		{1, h[0]},
+		{2, nodeHash(h[0], h[1])},
+		// Splits at the largest power of two below the size.
+		{3, nodeHash(nodeHash(h[0], h[1]), h[2])},
+		{4, nodeHash(nodeHash(h[0], h[1]), nodeHash(h[2], h[3]))},
+		{5, nodeHash(nodeHash(nodeHash(h[0], h[1]), nodeHash(h[2], h[3])), h[4])},
+	}
+	for _, tt := range tests {
+		if got, want := MerkleRoot(l[:tt.n]), hex.EncodeToString(tt.want); got != want {
+			t.Errorf("MerkleRoot of %d leaves = %s, want %s", tt.n, got, want)
+		}
+	}
+
+	if got := MerkleRoot(nil); got != GenesisHash {
+		t.Errorf("MerkleRoot of no leaves = %s, want genesis", got)
+	}
+	swapped := []Leaf{l[1], l[0]}
+	if MerkleRoot(swapped) == MerkleRoot(l[:2]) {
+		t.Errorf("MerkleRoot does not depend on leaf order")
+	}
+}
+
+func testKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	return ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+}
+
+func TestCheckpointVerify(t *testing.T) {
+	key := testKey(t)
+	pub := key.Public().(ed25519.PublicKey)
+	s := NewState()
+	s.Pending = leaves(3)
+	c := s.Checkpoint("orders.events", 2, key)
+	if err := c.Verify(pub); err != nil {
+		t.Fatalf("fresh checkpoint does not verify: %v", err)
+	}
+
+	_, otherPriv, _ := ed25519.GenerateKey(nil)
+	tests := []struct {
+		name   string
+		tamper func(c *Checkpoint)
+		pub    ed25519.PublicKey
+		want   string
+	}{
+		{"wrong key", func(*Checkpoint) {}, otherPriv.Public().(ed25519.PublicKey), "bad signature"},
+		{"offset changed", func(c *Checkpoint) { c.LastOffset++ }, pub, "bad signature"},
+		{"leaf dropped", func(c *Checkpoint) { c.Leaves = c.Leaves[:2] }, pub, "bad signature"},
+		{"signature garbled", func(c *Checkpoint) { c.Signature = "zz" }, pub, "bad signature"},
+		{"root and leaves re-signed apart", func(c *Checkpoint) {
+			c.Leaves = c.Leaves[:2]
+			c.Sign(key)
+		}, pub, "does not match its leaves"},
+	}
+	for _, tt := range tests {
+		cc := *c
+		cc.Leaves = append([]Leaf(nil), c.Leaves...)
+		tt.tamper(&cc)
+		if err := cc.Verify(tt.pub); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Verify = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestStateCheckpoint(t *testing.T) {
+	key := testKey(t)
+	s := NewState()
+	if c := s.Checkpoint("orders.events", 0, key); c != nil {
+		t.Fatalf("checkpoint with nothing pending: %+v", c)
+	}
+
+	l := leaves(3)
+	s.Pending = l[:2]
+	first := s.Checkpoint("orders.events", 0, key)
+	s.Pending = l[2:]
+	second := s.Checkpoint("orders.events", 0, key)
+
+	tests := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"first seq", first.Seq, int64(1)},
+		{"first prev", first.PrevCheckpoint, GenesisHash},
+		{"first offsets", [2]int64{first.FirstOffset, first.LastOffset}, [2]int64{0, 19}},
+		{"first head", first.Head, l[1].LastHash},
+		{"second seq", second.Seq, int64(2)},
+		{"second prev", second.PrevCheckpoint, first.Digest()},
+		{"second root", second.MerkleRoot, MerkleRoot(l[2:])},
+		{"state seq", s.CheckpointSeq, int64(2)},
+		{"state digest", s.CheckpointDigest, second.Digest()},
+		{"pending", len(s.Pending), 0},
+		{"key", second.Key(), "checkpoints/topic=orders.events/p=0/seq=0000000002.json"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit-signing.key")
+
+	key, created, err := LoadOrCreateKey(path)
+	if err != nil || !created {
+		t.Fatalf("LoadOrCreateKey on a new path = %v, %v", created, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("key file mode = %v, %v; want 0600", info.Mode().Perm(), err)
+	}
+	again, created, err := LoadOrCreateKey(path)
+	if err != nil || created || !again.Equal(key) {
+		t.Errorf("LoadOrCreateKey on an existing key = %v, %v; want the same key", created, err)
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.key")
+	os.WriteFile(bad, []byte("not hex\n"), 0o600)
+	if _, _, err := LoadOrCreateKey(bad); err == nil {
+		t.Errorf("LoadOrCreateKey accepted a corrupt key file")
+	}
+}
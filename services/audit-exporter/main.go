@@ -2,27 +2,82 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
-	"strings"
+	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/atlas/services/audit-exporter/archive"
+	"github.com/atlas/services/audit-exporter/store"
 	"github.com/atlas/services/common/config"
 	"github.com/atlas/services/common/kafka"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	awsconfig "github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
 var (
 	kafkaBrokers = []string{"localhost:19092"}
-	topics       = []string{"orders.events", "exec.reports"}
+	topics       = []string{"orders.commands", "orders.events", "exec.reports", "risk.decisions", "audit.events"}
 	awsCfg       *config.AWSConfig
+
+	// A partition's batch is written once it holds batchBytes of events, or
+	// batchInterval after its first one, whichever comes first.
+	batchBytes    = envInt("ATLAS_AUDIT_BATCH_BYTES", 8<<20)
+	batchInterval = envDuration("ATLAS_AUDIT_BATCH_INTERVAL", time.Minute)
+	compression   = envCompression()
+
+	// Every partition's archived files are signed into a checkpoint at most
+	// checkpointInterval apart, with the key in signingKeyFile.
+	checkpointInterval = envDuration("ATLAS_AUDIT_CHECKPOINT_INTERVAL", 10*time.Minute)
+	signingKeyFile     = envString("ATLAS_AUDIT_SIGNING_KEY", "audit-signing.key")
+	signingKey         ed25519.PrivateKey
 )
 
+func envString(name, fallback string) string {
+	if v, ok := os.LookupEnv(name); ok {
+		return v
+	}
+	return fallback
+}
+
+func envInt(name string, fallback int) int {
+	if v, ok := os.LookupEnv(name); ok {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+		log.Printf("[AUDIT] Invalid %s %q, using %d", name, v, fallback)
+	}
+	return fallback
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	if v, ok := os.LookupEnv(name); ok {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+		log.Printf("[AUDIT] Invalid %s %q, using %s", name, v, fallback)
+	}
+	return fallback
+}
+
+// envCompression reads ATLAS_AUDIT_COMPRESSION, gzip or zstd, default gzip.
+func envCompression() archive.Compression {
+	if v, ok := os.LookupEnv("ATLAS_AUDIT_COMPRESSION"); ok {
+		c, err := archive.ParseCompression(v)
+		if err == nil {
+			return c
+		}
+		log.Printf("[AUDIT] %v, using %s", err, archive.Gzip)
+	}
+	return archive.Gzip
+}
+
 func main() {
 	// Load AWS Config
 	awsCfg = config.LoadAWSConfig("audit-exporter")
@@ -39,54 +94,297 @@ func main() {
 		cancel()
 	}()
 
-	// Initialize S3 Client
-	cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(awsCfg.Region))
+	// Open the archive store
+	st, err := store.Open(ctx, store.ConfigFromEnv(awsCfg))
 	if err != nil {
-		log.Fatalf("unable to load SDK config, %v", err)
+		log.Fatalf("unable to open audit store, %v", err)
 	}
-	s3Client := s3.NewFromConfig(cfg)
+	log.Printf("[AUDIT] Archiving to %s", st)
 
-	log.Printf("Starting audit-exporter. Consuming topics: %v", topics)
+	key, created, err := archive.LoadOrCreateKey(signingKeyFile)
+	if err != nil {
+		log.Fatalf("unable to load signing key %s: %v", signingKeyFile, err)
+	}
+	if created {
+		log.Printf("[AUDIT] Generated signing key %s", signingKeyFile)
+	}
+	signingKey = key
+	log.Printf("[AUDIT] Signing checkpoints with public key %s", hex.EncodeToString(key.Public().(ed25519.PublicKey)))
 
+	log.Printf("Starting audit-exporter. Consuming topics: %v (%s batches of %d bytes or %s)", topics, compression, batchBytes, batchInterval)
+
+	var wg sync.WaitGroup
 	for _, topic := range topics {
-		go consumeAndArchive(ctx, topic, s3Client)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			consumeAndArchive(ctx, topic, st)
+		}()
 	}
 
 	<-ctx.Done()
+	wg.Wait() // open batches are written before exiting
 	log.Println("audit-exporter stopped.")
 }
 
-func consumeAndArchive(ctx context.Context, topic string, s3Client *s3.Client) {
+// archiver rolls one topic's messages into a batch per partition and writes
+// each batch to the store as one compressed file with a manifest. A partition's
+// offsets are committed only once its batch is written, so a crash replays
+// the unwritten messages rather than losing them.
+//
+// Records are hash-chained per partition and the chain's state is kept in the
+// store beside the archive, so a replayed message already archived is skipped and
+// one not yet archived is chained exactly as it was the first time.
+type archiver struct {
+	topic    string
+	store    store.Store
+	consumer *kafka.Consumer
+	batches  map[int]*archive.Batch
+	last     map[int]kafka.Message // the newest message in each batch
+	states   map[int]*archive.State
+}
+
+func consumeAndArchive(ctx context.Context, topic string, st store.Store) {
 	consumer := kafka.NewConsumer(kafkaBrokers, topic, "audit-exporter-group-v2")
 	defer consumer.Close()
 
 	log.Printf("Consumer started for topic: %s", topic)
 
-	err := consumer.Consume(ctx, func(ctx context.Context, msg kafka.Message) error {
-		// Partitioning logic: dt=YYYY-MM-DD/topic=<topic_name>/part-timestamp.jsonl
-		now := time.Now().UTC()
-		dt := now.Format("2006-01-02")
-		// Use partition and offset for idempotency (same message = same filename)
-		filename := fmt.Sprintf("events/dt=%s/topic=%s/p=%d/offset=%d.jsonl",
-			dt, topic, msg.Partition, msg.Offset)
+	msgs := make(chan kafka.Message)
+	go func() {
+		defer close(msgs)
+		for {
+			m, err := consumer.Fetch(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Consumer for topic %s failed: %v", topic, err)
+				}
+				return
+			}
+			select {
+			case msgs <- m:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
 
-		log.Printf("[AUDIT] Archiving event to S3 bucket: %s, key: %s", awsCfg.AuditS3Bucket, filename)
+	a := &archiver{
+		topic:    topic,
+		store:    st,
+		consumer: consumer,
+		batches:  make(map[int]*archive.Batch),
+		last:     make(map[int]kafka.Message),
+		states:   make(map[int]*archive.State),
+	}
+	ticker := time.NewTicker(max(batchInterval/4, time.Second))
+	defer ticker.Stop()
 
-		_, err := s3Client.PutObject(ctx, &s3.PutObjectInput{
-			Bucket: aws.String(awsCfg.AuditS3Bucket),
-			Key:    aws.String(filename),
-			Body:   strings.NewReader(string(msg.Value) + "\n"),
-		})
+	for {
+		select {
+		case m, ok := <-msgs:
+			if !ok {
+				a.flushAll()
+				return
+			}
+			a.add(ctx, m)
+		case <-ticker.C:
+			for p, b := range a.batches {
+				if time.Since(b.Opened) >= batchInterval {
+					a.flush(ctx, p)
+				}
+			}
+			for p, st := range a.states {
+				if a.batches[p] == nil && time.Since(st.CheckpointAt) >= checkpointInterval {
+					a.checkpoint(ctx, p)
+				}
+			}
+		case <-ctx.Done():
+			a.flushAll()
+			return
+		}
+	}
+}
 
-		if err != nil {
-			log.Printf("[ERROR] Failed to upload to S3: %v", err)
-			return err // Kafka will retry based on consumer logic
+// add puts a message in its partition's batch. A batch holds one day of
+// events, so a message from another day starts a new one.
+func (a *archiver) add(ctx context.Context, m kafka.Message) {
+	st, err := a.state(ctx, m.Partition)
+	if err != nil {
+		return // shutting down; the message is redelivered
+	}
+	if m.Offset <= st.Head.Offset {
+		return // archived before a restart
+	}
+	at := archive.EventTime(m.Value, m.Time)
+	day := archive.Day(at)
+	if b := a.batches[m.Partition]; b != nil && b.Day != day {
+		if err := a.flush(ctx, m.Partition); err != nil {
+			return // shutting down; the message is redelivered
 		}
+	}
+	b := a.batches[m.Partition]
+	if b == nil {
+		b = archive.NewBatch(a.topic, m.Partition, day)
+		a.batches[m.Partition] = b
+	}
+	rec, err := st.Head.Link(m.Offset, m.Value)
+	if err != nil {
+		log.Printf("[ERROR] Failed to chain %s p=%d offset %d: %v", a.topic, m.Partition, m.Offset, err)
+		return
+	}
+	b.Add(archive.Record{ChainRecord: rec, Time: at})
+	a.last[m.Partition] = m
 
+	if b.Bytes >= batchBytes {
+		a.flush(ctx, m.Partition)
+	}
+}
+
+// flush writes a partition's batch, checkpoints the partition if one is due
+// and commits its offsets, retrying until it succeeds or ctx is done.
+func (a *archiver) flush(ctx context.Context, partition int) error {
+	b := a.batches[partition]
+	if b == nil || b.Len() == 0 {
 		return nil
+	}
+	what := fmt.Sprintf("archive %s p=%d offsets %d-%d", a.topic, partition, b.FirstOffset(), b.LastOffset())
+	var manifest archive.Manifest
+	err := retry(ctx, what, func() (err error) {
+		manifest, err = a.write(ctx, b)
+		return err
 	})
+	if err != nil {
+		return err
+	}
+
+	st := a.states[partition]
+	st.Pending = append(st.Pending, archive.LeafOf(manifest))
+	if time.Since(st.CheckpointAt) >= checkpointInterval {
+		err = a.checkpoint(ctx, partition)
+	} else {
+		err = retry(ctx, what, func() error { return a.saveState(ctx, partition) })
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := a.consumer.Commit(ctx, a.last[partition]); err != nil {
+		// Written but not committed: the replayed messages are skipped as
+		// already chained.
+		log.Printf("[ERROR] Failed to commit %s p=%d offset %d: %v", a.topic, partition, b.LastOffset(), err)
+	}
+	delete(a.batches, partition)
+	delete(a.last, partition)
+	return nil
+}
+
+// checkpoint signs a partition's files since its last checkpoint and saves
+// its state.
+func (a *archiver) checkpoint(ctx context.Context, partition int) error {
+	st := a.states[partition]
+	c := st.Checkpoint(a.topic, partition, signingKey)
+	if c == nil {
+		st.CheckpointAt = time.Now().UTC()
+		return nil
+	}
+	what := fmt.Sprintf("checkpoint %s p=%d seq %d", a.topic, partition, c.Seq)
+	err := retry(ctx, what, func() error {
+		raw, _ := json.Marshal(c)
+		return a.store.Put(ctx, c.Key(), raw, jsonMeta)
+	})
+	if err != nil {
+		return err
+	}
+	if err := retry(ctx, what, func() error { return a.saveState(ctx, partition) }); err != nil {
+		return err
+	}
+	log.Printf("[AUDIT] Checkpoint %d for %s p=%d: %d files, offsets %d-%d, root %s",
+		c.Seq, a.topic, partition, len(c.Leaves), c.FirstOffset, c.LastOffset, c.MerkleRoot)
+	return nil
+}
+
+// flushAll writes every open batch and checkpoints every partition on
+// shutdown.
+func (a *archiver) flushAll() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for p := range a.batches {
+		a.flush(ctx, p)
+	}
+	for p := range a.states {
+		a.checkpoint(ctx, p)
+	}
+}
 
+// retry calls fn until it succeeds or ctx is done, backing off between tries.
+func retry(ctx context.Context, what string, fn func() error) error {
+	backoff := time.Second
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		log.Printf("[ERROR] Failed to %s, retrying in %s: %v", what, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff = min(backoff*2, 30*time.Second)
+	}
+}
+
+// state is a partition's chain state, read from the store the first time the
+// partition is seen.
+func (a *archiver) state(ctx context.Context, partition int) (*archive.State, error) {
+	if st := a.states[partition]; st != nil {
+		return st, nil
+	}
+	key := archive.StateKey(a.topic, partition)
+	st := archive.NewState()
+	err := retry(ctx, "read "+key, func() error {
+		raw, err := a.store.Get(ctx, key)
+		if errors.Is(err, store.ErrNotFound) {
+			return nil // a new partition
+		}
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(raw, st)
+	})
 	if err != nil {
-		log.Printf("Consumer for topic %s failed: %v", topic, err)
+		return nil, err
 	}
+	a.states[partition] = st
+	return st, nil
+}
+
+var jsonMeta = store.Meta{ContentType: "application/json"}
+
+func (a *archiver) saveState(ctx context.Context, partition int) error {
+	raw, _ := json.Marshal(a.states[partition])
+	return a.store.Put(ctx, archive.StateKey(a.topic, partition), raw, jsonMeta)
+}
+
+// write puts the batch's file and then its manifest in the store.
+func (a *archiver) write(ctx context.Context, b *archive.Batch) (archive.Manifest, error) {
+	body, err := b.Encode(compression)
+	if err != nil {
+		return archive.Manifest{}, fmt.Errorf("encode: %w", err)
+	}
+	key := b.Key(compression)
+	if err := a.store.Put(ctx, key, body, store.Meta{ContentType: "application/x-ndjson", ContentEncoding: string(compression)}); err != nil {
+		return archive.Manifest{}, err
+	}
+
+	manifest := b.Manifest(compression, key, body)
+	raw, _ := json.Marshal(manifest)
+	if err := a.store.Put(ctx, manifest.ManifestKey(), raw, jsonMeta); err != nil {
+		return archive.Manifest{}, fmt.Errorf("manifest: %w", err)
+	}
+
+	log.Printf("[AUDIT] Archived %d events (%d -> %d bytes) to %s, key: %s",
+		b.Len(), b.Bytes, len(body), a.store, key)
+	return manifest, nil
 }
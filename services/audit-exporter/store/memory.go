@@ -0,0 +1,52 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryStore keeps objects in memory, for tests and throwaway runs.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	objects map[string][]byte
+}
+
+// NewMemory is an empty MemoryStore.
+func NewMemory() *MemoryStore {
+	return &MemoryStore{objects: make(map[string][]byte)}
+}
+
+func (s *MemoryStore) Put(_ context.Context, key string, body []byte, _ Meta) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = bytes.Clone(body)
+	return nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	body, ok := s.objects[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return bytes.Clone(body), nil
+}
+
+func (s *MemoryStore) List(_ context.Context, prefix string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var keys []string
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (s *MemoryStore) String() string { return "memory" }
@@ -0,0 +1,95 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// s3Store keeps objects in an S3 bucket.
+type s3Store struct {
+	client   *s3.Client
+	bucket   string
+	endpoint string
+}
+
+// NewS3 is a Store in bucket, using the default AWS credential chain. A
+// non-empty endpoint points it at an S3-compatible server such as MinIO or
+// LocalStack, addressed path-style as they expect.
+func NewS3(ctx context.Context, bucket, region, endpoint string) (Store, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("unable to load SDK config: %w", err)
+	}
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+	})
+	return &s3Store{client: client, bucket: bucket, endpoint: endpoint}, nil
+}
+
+func (s *s3Store) Put(ctx context.Context, key string, body []byte, meta Meta) error {
+	in := &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(body),
+	}
+	if meta.ContentType != "" {
+		in.ContentType = aws.String(meta.ContentType)
+	}
+	if meta.ContentEncoding != "" {
+		in.ContentEncoding = aws.String(meta.ContentEncoding)
+	}
+	_, err := s.client.PutObject(ctx, in)
+	return err
+}
+
+func (s *s3Store) Get(ctx context.Context, key string) ([]byte, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	var missing *types.NoSuchKey
+	if errors.As(err, &missing) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+func (s *s3Store) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	pages := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			keys = append(keys, aws.ToString(obj.Key))
+		}
+	}
+	return keys, nil
+}
+
+func (s *s3Store) String() string {
+	if s.endpoint != "" {
+		return fmt.Sprintf("s3://%s at %s", s.bucket, s.endpoint)
+	}
+	return "s3://" + s.bucket
+}
@@ -0,0 +1,88 @@
+// Package store is where the audit archive is kept: an S3 bucket (AWS, or
+// anything speaking its API such as MinIO or LocalStack), a local directory,
+// or memory. The exporter and the verifier see only Store, so the archive
+// works the same offline as in AWS.
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/atlas/services/common/config"
+)
+
+// ErrNotFound is returned by Get for a key that holds nothing.
+var ErrNotFound = errors.New("not found")
+
+// Store holds objects by key.
+type Store interface {
+	// Put writes body under key, replacing what was there.
+	Put(ctx context.Context, key string, body []byte, meta Meta) error
+	// Get reads what is under key, or ErrNotFound.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// List is every key beginning with prefix, in order.
+	List(ctx context.Context, prefix string) ([]string, error)
+	// String describes where objects go, for logs.
+	String() string
+}
+
+// Meta describes an object's body.
+type Meta struct {
+	ContentType     string
+	ContentEncoding string
+}
+
+// Backend names a Store implementation.
+type Backend string
+
+const (
+	S3     Backend = "s3"
+	FS     Backend = "fs"
+	Memory Backend = "memory"
+)
+
+// Config selects and configures a Store.
+type Config struct {
+	Backend Backend
+	// S3: the bucket, its region and, for MinIO or LocalStack, the endpoint.
+	Bucket   string
+	Region   string
+	Endpoint string
+	// FS: the root directory.
+	Dir string
+}
+
+// ConfigFromEnv reads the store from ATLAS_AUDIT_STORE (s3, fs or memory,
+// default s3) and ATLAS_AUDIT_DIR (default audit-archive), with the bucket,
+// region and endpoint from awsCfg.
+func ConfigFromEnv(awsCfg *config.AWSConfig) Config {
+	cfg := Config{
+		Backend:  S3,
+		Bucket:   awsCfg.AuditS3Bucket,
+		Region:   awsCfg.Region,
+		Endpoint: awsCfg.AuditS3Endpoint,
+		Dir:      "audit-archive",
+	}
+	if v, ok := os.LookupEnv("ATLAS_AUDIT_STORE"); ok {
+		cfg.Backend = Backend(v)
+	}
+	if v, ok := os.LookupEnv("ATLAS_AUDIT_DIR"); ok {
+		cfg.Dir = v
+	}
+	return cfg
+}
+
+// Open opens the configured Store.
+func Open(ctx context.Context, cfg Config) (Store, error) {
+	switch cfg.Backend {
+	case S3:
+		return NewS3(ctx, cfg.Bucket, cfg.Region, cfg.Endpoint)
+	case FS:
+		return NewFS(cfg.Dir)
+	case Memory:
+		return NewMemory(), nil
+	}
+	return nil, fmt.Errorf("unknown audit store %q (want s3, fs or memory)", cfg.Backend)
+}
@@ -0,0 +1,251 @@
+package store
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testStore runs the Store contract against st, which must start empty.
+func testStore(t *testing.T, st Store) {
+	t.Helper()
+	ctx := context.Background()
+	for _, key := range []string{
+		"orders.events/2026/01/05/p0-00000100.jsonl.gz",
+		"orders.events/2026/01/05/p0-00000000.jsonl.gz",
+		"orders.events/2026/01/06/p0-00000200.jsonl.gz",
+		"orders.commands/2026/01/05/p0-00000000.jsonl.gz",
+		"manifests/orders.events.json",
+	} {
+		if err := st.Put(ctx, key, []byte(key), Meta{ContentType: "application/gzip"}); err != nil {
+			t.Fatalf("%s: Put(%s): %v", st, key, err)
+		}
+	}
+	if err := st.Put(ctx, "manifests/orders.events.json", []byte("v2"), Meta{}); err != nil {
+		t.Fatalf("%s: Put over an object: %v", st, err)
+	}
+
+	gets := []struct {
+		key  string
+		want string
+		err  error
+	}{
+		{"orders.events/2026/01/05/p0-00000000.jsonl.gz", "orders.events/2026/01/05/p0-00000000.jsonl.gz", nil},
+		{"manifests/orders.events.json", "v2", nil},
+		{"manifests/orders.commands.json", "", ErrNotFound},
+		{"orders.events/2026/01/05", "", ErrNotFound},
+	}
+	for _, tt := range gets {
+		body, err := st.Get(ctx, tt.key)
+		if !errors.Is(err, tt.err) || string(body) != tt.want {
+			t.Errorf("%s: Get(%s) = %q, %v, want %q, %v", st, tt.key, body, err, tt.want, tt.err)
+		}
+	}
+
+	lists := []struct {
+		prefix string
+		want   []string
+	}{
+		{"orders.events/2026/01/05/", []string{
+			"orders.events/2026/01/05/p0-00000000.jsonl.gz",
+			"orders.events/2026/01/05/p0-00000100.jsonl.gz",
+		}},
+		{"orders.events/", []string{
+			"orders.events/2026/01/05/p0-00000000.jsonl.gz",
+			"orders.events/2026/01/05/p0-00000100.jsonl.gz",
+			"orders.events/2026/01/06/p0-00000200.jsonl.gz",
+		}},
+		{"orders.", []string{
+			"orders.commands/2026/01/05/p0-00000000.jsonl.gz",
+			"orders.events/2026/01/05/p0-00000000.jsonl.gz",
+			"orders.events/2026/01/05/p0-00000100.jsonl.gz",
+			"orders.events/2026/01/06/p0-00000200.jsonl.gz",
+		}},
+		{"exec.reports/", nil},
+	}
+	for _, tt := range lists {
+		got, err := st.List(ctx, tt.prefix)
+		if err != nil || len(got) != len(tt.want) || len(got) > 0 && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: List(%s) = %q, %v, want %q", st, tt.prefix, got, err, tt.want)
+		}
+	}
+}
+
+func TestFS(t *testing.T) {
+	dir := t.TempDir()
+	st, err := NewFS(filepath.Join(dir, "archive"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, st)
+
+	// A put interrupted before its rename leaves only a temporary file.
+	os.WriteFile(filepath.Join(dir, "archive", "manifests", ".put-123"), []byte("half"), 0o644)
+	if keys, _ := st.List(context.Background(), "manifests/"); !reflect.DeepEqual(keys, []string{"manifests/orders.events.json"}) {
+		t.Errorf("List picked up a temporary file: %q", keys)
+	}
+}
+
+func TestFSPath(t *testing.T) {
+	s := &fsStore{root: "/archive"}
+	tests := []struct {
+		key  string
+		want string // "" if refused
+	}{
+		{"manifests/orders.events.json", "/archive/manifests/orders.events.json"},
+		{"a", "/archive/a"},
+		{"", ""},
+		{"/", ""},
+		{"..", ""},
+		{"../outside", ""},
+		{"a/../../outside", ""},
+		{"a/../b", ""},
+		{"/etc/passwd", ""},
+		{"./a", ""},
+		{"a//b", ""},
+		{"a/", ""},
+	}
+	for _, tt := range tests {
+		got, err := s.path(tt.key)
+		if tt.want == "" && err == nil || tt.want != "" && (err != nil || got != filepath.FromSlash(tt.want)) {
+			t.Errorf("path(%q) = %q, %v, want %q", tt.key, got, err, tt.want)
+		}
+	}
+
+	ctx := context.Background()
+	st, _ := NewFS(t.TempDir())
+	if err := st.Put(ctx, "../escaped", []byte("x"), Meta{}); err == nil {
+		t.Errorf("Put(../escaped) succeeded")
+	}
+	if _, err := st.Get(ctx, "../escaped"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(../escaped) = %v, want an invalid key", err)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	st := NewMemory()
+	testStore(t, st)
+
+	// What was put and what was got are copies.
+	ctx := context.Background()
+	body := []byte("abc")
+	st.Put(ctx, "k", body, Meta{})
+	body[0] = 'x'
+	got, _ := st.Get(ctx, "k")
+	got[1] = 'x'
+	if again, _ := st.Get(ctx, "k"); string(again) != "abc" {
+		t.Errorf("stored object changed to %q", again)
+	}
+}
+
+func TestS3(t *testing.T) {
+	srv := httptest.NewServer(newFakeS3("atlas-audit"))
+	defer srv.Close()
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_RESPONSE_CHECKSUM_VALIDATION", "when_required")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "none"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "none"))
+
+	st, err := NewS3(context.Background(), "atlas-audit", "us-east-1", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, st)
+	if got, want := st.String(), "s3://atlas-audit at "+srv.URL; got != want {
+		t.Errorf("String() = %s, want %s", got, want)
+	}
+}
+
+// fakeS3 answers the path-style PutObject, GetObject and ListObjectsV2
+// requests s3Store makes, two keys to a list page.
+type fakeS3 struct {
+	bucket  string
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3(bucket string) *fakeS3 {
+	return &fakeS3{bucket: bucket, objects: make(map[string][]byte)}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		f.error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	switch {
+	case r.Method == http.MethodPut && key != "":
+		body, _ := io.ReadAll(r.Body)
+		f.objects[key] = body
+	case r.Method == http.MethodGet && key != "":
+		body, ok := f.objects[key]
+		if !ok {
+			f.error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Write(body)
+	case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		f.list(w, r.URL.Query().Get("prefix"), r.URL.Query().Get("continuation-token"))
+	default:
+		f.error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, prefix, token string) {
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	start, _ := strconv.Atoi(token)
+	end := min(start+2, len(keys))
+
+	type object struct {
+		Key string
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+		Name                  string
+		Prefix                string
+		KeyCount              int
+		IsTruncated           bool
+		NextContinuationToken string   `xml:",omitempty"`
+		Contents              []object `xml:"Contents"`
+	}{Name: f.bucket, Prefix: prefix, KeyCount: end - start, IsTruncated: end < len(keys)}
+	if result.IsTruncated {
+		result.NextContinuationToken = strconv.Itoa(end)
+	}
+	for _, key := range keys[start:end] {
+		result.Contents = append(result.Contents, object{key})
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+func (f *fakeS3) error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: code})
+}
@@ -0,0 +1,93 @@
+package index
+
+import (
+	"sort"
+
+	"github.com/atlas/services/common/model"
+)
+
+// Causal puts an order's entries in the order they happened. Clocks differ
+// between services, so timestamps alone are not enough:
+//
+//   - Messages about one order are keyed by its ID, so each topic
+//     partition's offsets are the order its producer wrote them in.
+//   - An event follows the command or report it names.
+//   - Nothing about an order comes before the command that placed it.
+//
+// Within those constraints, entries go by timestamp, with a command before
+// the report on it and the report before the event at the same instant.
+func Causal(entries []Entry) []Entry {
+	type stream struct {
+		topic     string
+		partition int
+	}
+	streams := make(map[stream][]Entry)
+	for _, e := range entries {
+		s := stream{e.Topic, e.Partition}
+		streams[s] = append(streams[s], e)
+	}
+	heads := make([][]Entry, 0, len(streams))
+	for _, s := range streams {
+		sort.Slice(s, func(i, j int) bool { return s[i].Offset < s[j].Offset })
+		heads = append(heads, s)
+	}
+
+	present := make(map[string]bool, len(entries))
+	placed := true // whether the NEW command is out, or there is none
+	for _, e := range entries {
+		if e.ID != "" {
+			present[e.ID] = true
+		}
+		if isNew(e) {
+			placed = false
+		}
+	}
+	done := make(map[string]bool, len(entries))
+	ready := func(e Entry) bool {
+		if !placed && !isNew(e) {
+			return false
+		}
+		return e.CausedBy == "" || !present[e.CausedBy] || done[e.CausedBy]
+	}
+	before := func(a, b Entry) bool {
+		if !a.Timestamp.Equal(b.Timestamp) {
+			return a.Timestamp.Before(b.Timestamp)
+		}
+		return a.Kind.rank() < b.Kind.rank()
+	}
+
+	out := make([]Entry, 0, len(entries))
+	for len(out) < len(entries) {
+		// The earliest stream head whose cause is already out; if every
+		// head waits on another (a loop in bad data), the earliest head.
+		best, fallback := -1, -1
+		for i, s := range heads {
+			if len(s) == 0 {
+				continue
+			}
+			if fallback < 0 || before(s[0], heads[fallback][0]) {
+				fallback = i
+			}
+			if ready(s[0]) && (best < 0 || before(s[0], heads[best][0])) {
+				best = i
+			}
+		}
+		if best < 0 {
+			best = fallback
+		}
+		e := heads[best][0]
+		heads[best] = heads[best][1:]
+		out = append(out, e)
+		if isNew(e) {
+			placed = true
+		}
+		if e.ID != "" {
+			done[e.ID] = true
+		}
+	}
+	return out
+}
+
+func isNew(e Entry) bool {
+	return e.Kind == KindCommand && e.Type == string(model.CommandTypeNew)
+}
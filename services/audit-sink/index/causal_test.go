@@ -0,0 +1,127 @@
+package index
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2026, 1, 5, 9, 30, 0, 0, time.UTC)
+
+// entry is a message at offset on partition 0 of the kind's topic, secs
+// after t0.
+func entry(id string, kind Kind, typ string, offset int64, secs int, causedBy string) Entry {
+	topic := map[Kind]string{KindCommand: TopicCommands, KindEvent: TopicEvents, KindExecReport: TopicExecs}[kind]
+	return Entry{
+		Topic:     topic,
+		Offset:    offset,
+		OrderID:   "O1",
+		Kind:      kind,
+		Type:      typ,
+		ID:        id,
+		CausedBy:  causedBy,
+		Timestamp: t0.Add(time.Duration(secs) * time.Second),
+	}
+}
+
+func entryIDs(entries []Entry) []string {
+	out := []string{}
+	for _, e := range entries {
+		out = append(out, e.ID)
+	}
+	return out
+}
+
+func TestCausal(t *testing.T) {
+	newCmd := entry("C1", KindCommand, "NEW", 0, 0, "")
+	tests := []struct {
+		name    string
+		entries []Entry
+		want    []string
+	}{
+		{
+			name:    "by timestamp",
+			entries: []Entry{entry("R1", KindExecReport, "ACK", 0, 2, ""), newCmd, entry("E1", KindEvent, "ACCEPTED", 0, 3, "")},
+			want:    []string{"C1", "R1", "E1"},
+		},
+		{
+			// The producer's clock went back between the two reports.
+			name: "offsets within a partition",
+			entries: []Entry{
+				newCmd,
+				entry("R2", KindExecReport, "FILL", 1, 1, ""),
+				entry("R1", KindExecReport, "ACK", 0, 5, ""),
+			},
+			want: []string{"C1", "R1", "R2"},
+		},
+		{
+			name: "partitions are separate streams",
+			entries: []Entry{
+				newCmd,
+				{Topic: TopicExecs, Partition: 1, Offset: 9, ID: "R1", Kind: KindExecReport, Timestamp: t0.Add(time.Second)},
+				{Topic: TopicExecs, Partition: 0, Offset: 0, ID: "R2", Kind: KindExecReport, Timestamp: t0.Add(2 * time.Second)},
+			},
+			want: []string{"C1", "R1", "R2"},
+		},
+		{
+			// oms-core's clock is behind the venue's.
+			name: "event after the report it names",
+			entries: []Entry{
+				newCmd,
+				entry("R1", KindExecReport, "FILL", 0, 5, ""),
+				entry("E1", KindEvent, "FILLED", 0, 1, "R1"),
+			},
+			want: []string{"C1", "R1", "E1"},
+		},
+		{
+			name: "cause not in the timeline",
+			entries: []Entry{
+				newCmd,
+				entry("E1", KindEvent, "FILLED", 0, 1, "R9"),
+				entry("R1", KindExecReport, "FILL", 0, 2, ""),
+			},
+			want: []string{"C1", "E1", "R1"},
+		},
+		{
+			name: "NEW first",
+			entries: []Entry{
+				entry("R1", KindExecReport, "ACK", 0, -2, ""),
+				entry("E1", KindEvent, "ACCEPTED", 0, -1, ""),
+				entry("C1", KindCommand, "NEW", 0, 0, ""),
+			},
+			want: []string{"C1", "R1", "E1"},
+		},
+		{
+			name: "no NEW",
+			entries: []Entry{
+				entry("E1", KindEvent, "CANCELED", 0, 2, ""),
+				entry("C2", KindCommand, "CANCEL", 0, 1, ""),
+			},
+			want: []string{"C2", "E1"},
+		},
+		{
+			name: "same instant by kind",
+			entries: []Entry{
+				entry("E1", KindEvent, "ACCEPTED", 0, 0, ""),
+				entry("R1", KindExecReport, "ACK", 0, 0, ""),
+				newCmd,
+			},
+			want: []string{"C1", "R1", "E1"},
+		},
+		{
+			// Bad data: each waits on the other, so the earliest goes first.
+			name: "dependency loop",
+			entries: []Entry{
+				newCmd,
+				entry("E1", KindEvent, "FILLED", 0, 2, "R1"),
+				entry("R1", KindExecReport, "FILL", 0, 3, "E1"),
+			},
+			want: []string{"C1", "E1", "R1"},
+		},
+	}
+	for _, tt := range tests {
+		if got := entryIDs(Causal(tt.entries)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Causal = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
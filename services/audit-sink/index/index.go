@@ -0,0 +1,336 @@
+// Package index keeps every order command, order event and execution report
+// in an embedded SQLite database, indexed by order, account, symbol and
+// time, and puts an order's entries back into the order they happened.
+package index
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/atlas/services/common/model"
+
+	_ "modernc.org/sqlite"
+)
+
+// Topics the index reads.
+const (
+	TopicCommands = "orders.commands"
+	TopicEvents   = "orders.events"
+	TopicExecs    = "exec.reports"
+)
+
+// Kind is what an entry is, by the topic it came from.
+type Kind string
+
+const (
+	KindCommand    Kind = "COMMAND"
+	KindEvent      Kind = "EVENT"
+	KindExecReport Kind = "EXEC_REPORT"
+)
+
+// rank orders kinds that happened at the same instant: a command comes
+// before what the venue reported on it, and that before oms-core's event.
+func (k Kind) rank() int {
+	switch k {
+	case KindCommand:
+		return 0
+	case KindExecReport:
+		return 1
+	}
+	return 2
+}
+
+// Entry is one message about an order.
+type Entry struct {
+	Topic     string          `json:"topic"`
+	Partition int             `json:"partition"`
+	Offset    int64           `json:"offset"`
+	OrderID   string          `json:"order_id"`
+	Kind      Kind            `json:"kind"`
+	Type      string          `json:"type"`
+	ID        string          `json:"id"`                  // command_id, event_id or exec_id
+	CausedBy  string          `json:"caused_by,omitempty"` // ID of the entry this one follows from
+	Timestamp time.Time       `json:"timestamp"`
+	Data      json.RawMessage `json:"data"`
+
+	// Summary fields for the order, where the message has them.
+	account, symbol, side, status, parent string
+}
+
+// Parse reads a message from one of the index's topics. ok is false for
+// messages about no order.
+func Parse(topic string, partition int, offset int64, value []byte) (e Entry, ok bool, err error) {
+	e = Entry{Topic: topic, Partition: partition, Offset: offset, Data: value}
+	switch topic {
+	case TopicCommands:
+		var cmd model.OrderCommand
+		if err := json.Unmarshal(value, &cmd); err != nil {
+			return e, false, err
+		}
+		e.Kind, e.Type, e.ID, e.OrderID, e.Timestamp = KindCommand, string(cmd.Type), cmd.CommandID, cmd.OrderID, cmd.Timestamp
+		e.account, e.symbol, e.side, e.parent = cmd.ClientID, cmd.Symbol, string(cmd.Side), cmd.ParentOrderID
+	case TopicEvents:
+		var event struct {
+			model.OrderEvent
+			Payload json.RawMessage `json:"payload"`
+		}
+		if err := json.Unmarshal(value, &event); err != nil {
+			return e, false, err
+		}
+		e.Kind, e.Type, e.ID, e.OrderID, e.Timestamp = KindEvent, event.Type, event.EventID, event.OrderID, event.Timestamp
+		// oms-core's events carry the command or report they came from.
+		var cause struct {
+			CommandID string `json:"command_id"`
+			ExecID    string `json:"exec_id"`
+		}
+		if json.Unmarshal(event.Payload, &cause) == nil {
+			e.CausedBy = cause.ExecID
+			if e.CausedBy == "" {
+				e.CausedBy = cause.CommandID
+			}
+		}
+	case TopicExecs:
+		var report model.ExecutionReport
+		if err := json.Unmarshal(value, &report); err != nil {
+			return e, false, err
+		}
+		e.Kind, e.Type, e.ID, e.OrderID, e.Timestamp = KindExecReport, report.Type, report.ExecID, report.OrderID, report.Timestamp
+		e.account, e.symbol, e.side, e.status, e.parent = report.ClientID, report.Symbol, string(report.Side), string(report.Status), report.ParentOrderID
+	default:
+		return e, false, fmt.Errorf("unknown topic %s", topic)
+	}
+	return e, e.OrderID != "", nil
+}
+
+// Order is what the index knows of an order.
+type Order struct {
+	OrderID       string    `json:"order_id"`
+	Account       string    `json:"account,omitempty"`
+	Symbol        string    `json:"symbol,omitempty"`
+	Side          string    `json:"side,omitempty"`
+	Status        string    `json:"status,omitempty"` // from the latest execution report
+	ParentOrderID string    `json:"parent_order_id,omitempty"`
+	FirstSeen     time.Time `json:"first_seen"`
+	LastSeen      time.Time `json:"last_seen"`
+	Entries       int       `json:"entry_count"`
+}
+
+// Timeline is an order's whole history.
+type Timeline struct {
+	Order
+	Children []string `json:"children,omitempty"` // leg and algo child orders
+	Entries  []Entry  `json:"entries"`
+}
+
+// Index is the database.
+type Index struct {
+	db *sql.DB
+}
+
+const ddl = `
+CREATE TABLE IF NOT EXISTS entries (
+	topic     TEXT    NOT NULL,
+	partition INTEGER NOT NULL,
+	offset    INTEGER NOT NULL,
+	order_id  TEXT    NOT NULL,
+	kind      TEXT    NOT NULL,
+	type      TEXT    NOT NULL,
+	id        TEXT    NOT NULL,
+	caused_by TEXT    NOT NULL,
+	ts        INTEGER NOT NULL,
+	data      TEXT    NOT NULL,
+	PRIMARY KEY (topic, partition, offset)
+);
+CREATE INDEX IF NOT EXISTS entries_order ON entries (order_id, ts);
+
+CREATE TABLE IF NOT EXISTS orders (
+	order_id   TEXT PRIMARY KEY,
+	account    TEXT    NOT NULL,
+	symbol     TEXT    NOT NULL,
+	side       TEXT    NOT NULL,
+	status     TEXT    NOT NULL,
+	status_ts  INTEGER NOT NULL,
+	parent     TEXT    NOT NULL,
+	first_ts   INTEGER NOT NULL,
+	last_ts    INTEGER NOT NULL,
+	entries    INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS orders_account ON orders (account, first_ts);
+CREATE INDEX IF NOT EXISTS orders_symbol  ON orders (symbol, first_ts);
+CREATE INDEX IF NOT EXISTS orders_time    ON orders (first_ts);
+CREATE INDEX IF NOT EXISTS orders_parent  ON orders (parent);
+`
+
+// Open opens the index at path, creating it if need be.
+func Open(path string) (*Index, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	// One writer at a time is all SQLite allows anyway.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(ddl); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create schema: %w", err)
+	}
+	return &Index{db: db}, nil
+}
+
+func (ix *Index) Close() error { return ix.db.Close() }
+
+// Add indexes an entry. An entry already indexed, by its topic, partition
+// and offset, is left as it is, so replaying a topic is harmless.
+func (ix *Index) Add(ctx context.Context, e Entry) (added bool, err error) {
+	tx, err := ix.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	ts := e.Timestamp.UnixNano()
+	res, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO entries
+		(topic, partition, offset, order_id, kind, type, id, caused_by, ts, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Topic, e.Partition, e.Offset, e.OrderID, string(e.Kind), e.Type, e.ID, e.CausedBy, ts, string(e.Data))
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+
+	// Fields are filled in by whichever message has them; the status is
+	// the latest report's.
+	statusTS := int64(0)
+	if e.status != "" {
+		statusTS = ts
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO orders
+		(order_id, account, symbol, side, status, status_ts, parent, first_ts, last_ts, entries)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 1)
+		ON CONFLICT (order_id) DO UPDATE SET
+			account   = CASE WHEN account = '' THEN excluded.account ELSE account END,
+			symbol    = CASE WHEN symbol = '' THEN excluded.symbol ELSE symbol END,
+			side      = CASE WHEN side = '' THEN excluded.side ELSE side END,
+			parent    = CASE WHEN parent = '' THEN excluded.parent ELSE parent END,
+			status    = CASE WHEN excluded.status <> '' AND excluded.status_ts >= status_ts THEN excluded.status ELSE status END,
+			status_ts = CASE WHEN excluded.status <> '' AND excluded.status_ts >= status_ts THEN excluded.status_ts ELSE status_ts END,
+			first_ts  = min(first_ts, excluded.first_ts),
+			last_ts   = max(last_ts, excluded.last_ts),
+			entries   = entries + 1`,
+		e.OrderID, e.account, e.symbol, e.side, e.status, statusTS, e.parent, ts, ts)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+const orderColumns = `order_id, account, symbol, side, status, parent, first_ts, last_ts, entries`
+
+func scanOrder(row interface{ Scan(...any) error }) (Order, error) {
+	var o Order
+	var first, last int64
+	err := row.Scan(&o.OrderID, &o.Account, &o.Symbol, &o.Side, &o.Status, &o.ParentOrderID, &first, &last, &o.Entries)
+	o.FirstSeen, o.LastSeen = time.Unix(0, first).UTC(), time.Unix(0, last).UTC()
+	return o, err
+}
+
+// Timeline is everything indexed about an order, in the order it happened,
+// or nil if nothing is.
+func (ix *Index) Timeline(ctx context.Context, orderID string) (*Timeline, error) {
+	o, err := scanOrder(ix.db.QueryRowContext(ctx, `SELECT `+orderColumns+` FROM orders WHERE order_id = ?`, orderID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	t := &Timeline{Order: o}
+
+	rows, err := ix.db.QueryContext(ctx, `SELECT topic, partition, offset, order_id, kind, type, id, caused_by, ts, data
+		FROM entries WHERE order_id = ?`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []Entry
+	for rows.Next() {
+		var e Entry
+		var ts int64
+		var data string
+		if err := rows.Scan(&e.Topic, &e.Partition, &e.Offset, &e.OrderID, &e.Kind, &e.Type, &e.ID, &e.CausedBy, &ts, &data); err != nil {
+			return nil, err
+		}
+		e.Timestamp, e.Data = time.Unix(0, ts).UTC(), json.RawMessage(data)
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	t.Entries = Causal(entries)
+
+	children, err := ix.db.QueryContext(ctx, `SELECT order_id FROM orders WHERE parent = ? ORDER BY first_ts`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer children.Close()
+	for children.Next() {
+		var id string
+		if err := children.Scan(&id); err != nil {
+			return nil, err
+		}
+		t.Children = append(t.Children, id)
+	}
+	return t, children.Err()
+}
+
+// Query narrows a search for orders. Empty fields match everything.
+type Query struct {
+	Account  string
+	Symbol   string
+	From, To time.Time // on first seen
+	Limit    int
+}
+
+// Orders finds orders, newest first.
+func (ix *Index) Orders(ctx context.Context, q Query) ([]Order, error) {
+	var where []string
+	var args []any
+	if q.Account != "" {
+		where, args = append(where, "account = ?"), append(args, q.Account)
+	}
+	if q.Symbol != "" {
+		where, args = append(where, "symbol = ?"), append(args, q.Symbol)
+	}
+	if !q.From.IsZero() {
+		where, args = append(where, "first_ts >= ?"), append(args, q.From.UnixNano())
+	}
+	if !q.To.IsZero() {
+		where, args = append(where, "first_ts < ?"), append(args, q.To.UnixNano())
+	}
+	stmt := `SELECT ` + orderColumns + ` FROM orders`
+	if len(where) > 0 {
+		stmt += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	stmt += ` ORDER BY first_ts DESC LIMIT ?`
+	args = append(args, q.Limit)
+
+	rows, err := ix.db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	orders := []Order{}
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+	return orders, rows.Err()
+}
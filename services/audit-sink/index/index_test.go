@@ -0,0 +1,89 @@
+package index
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func openMemory(t *testing.T) *Index {
+	t.Helper()
+	ix, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ix.Close() })
+	return ix
+}
+
+func TestAdd(t *testing.T) {
+	ctx := context.Background()
+	ix := openMemory(t)
+
+	cmd := entry("C1", KindCommand, "NEW", 0, 1, "")
+	cmd.account, cmd.symbol, cmd.side = "A1", "BTC-USD", "BUY"
+	fill := entry("R2", KindExecReport, "TRADE", 1, 3, "")
+	fill.status = "PARTIALLY_FILLED"
+	ack := entry("R1", KindExecReport, "NEW", 0, 2, "")
+	ack.account, ack.status = "A2", "NEW"
+	event := entry("E1", KindEvent, "ORDER_ACCEPTED", 0, -1, "C1")
+	child := entry("C9", KindCommand, "NEW", 5, 4, "")
+	child.OrderID, child.account, child.parent = "O1-1", "A1", "O1"
+
+	tests := []struct {
+		name  string
+		entry Entry
+		added bool
+	}{
+		{"command", cmd, true},
+		{"replayed command", cmd, false},
+		{"later report", fill, true},
+		// An older report arriving late does not replace the status, and
+		// fields already known are kept.
+		{"earlier report", ack, true},
+		{"event from a slower clock", event, true},
+		{"child", child, true},
+	}
+	for _, tt := range tests {
+		added, err := ix.Add(ctx, tt.entry)
+		if err != nil || added != tt.added {
+			t.Errorf("%s: Add = %v, %v, want %v", tt.name, added, err, tt.added)
+		}
+	}
+
+	tl, err := ix.Timeline(ctx, "O1")
+	if err != nil || tl == nil {
+		t.Fatalf("Timeline(O1) = %v, %v", tl, err)
+	}
+	want := Order{
+		OrderID:   "O1",
+		Account:   "A1",
+		Symbol:    "BTC-USD",
+		Side:      "BUY",
+		Status:    "PARTIALLY_FILLED",
+		FirstSeen: t0.Add(-time.Second),
+		LastSeen:  t0.Add(3 * time.Second),
+		Entries:   4,
+	}
+	if tl.Order != want {
+		t.Errorf("order = %+v, want %+v", tl.Order, want)
+	}
+	if got := entryIDs(tl.Entries); !reflect.DeepEqual(got, []string{"C1", "E1", "R1", "R2"}) {
+		t.Errorf("entries = %v", got)
+	}
+	if !reflect.DeepEqual(tl.Children, []string{"O1-1"}) {
+		t.Errorf("children = %v", tl.Children)
+	}
+
+	if tl, err := ix.Timeline(ctx, "unknown"); tl != nil || err != nil {
+		t.Errorf("Timeline(unknown) = %v, %v", tl, err)
+	}
+	orders, err := ix.Orders(ctx, Query{Account: "A1", Limit: 10})
+	if err != nil || len(orders) != 2 || orders[0].OrderID != "O1-1" || orders[1].OrderID != "O1" {
+		t.Errorf("Orders(A1) = %+v, %v, want the child then its parent", orders, err)
+	}
+	if orders, _ := ix.Orders(ctx, Query{From: t0, Limit: 10}); len(orders) != 1 {
+		t.Errorf("Orders from t0 = %+v, want the child only", orders)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/atlas/services/audit-exporter/archive"
+	"github.com/atlas/services/audit-exporter/store"
+	"github.com/atlas/services/audit-sink/index"
+	"github.com/atlas/services/common/config"
+	"github.com/atlas/services/common/kafka"
+)
+
+var (
+	kafkaBrokers = []string{"localhost:19092"}
+	topics       = []string{index.TopicCommands, index.TopicEvents, index.TopicExecs}
+
+	// The index lives in dbPath. With backfill set, orders from before the
+	// sink started are indexed from the audit archive first.
+	dbPath   = envString("ATLAS_AUDIT_SINK_DB", "audit-sink.db")
+	backfill = strings.ToLower(os.Getenv("ATLAS_AUDIT_SINK_BACKFILL")) == "true"
+
+	ix *index.Index
+)
+
+func envString(name, fallback string) string {
+	if v, ok := os.LookupEnv(name); ok {
+		return v
+	}
+	return fallback
+}
+
+func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	awsCfg := config.LoadAWSConfig("audit-sink")
+
+	db, err := index.Open(dbPath)
+	if err != nil {
+		log.Fatalf("Failed to open index %s: %v", dbPath, err)
+	}
+	defer db.Close()
+	ix = db
+	log.Printf("[AUDIT-SINK] Index at %s", dbPath)
+
+	if backfill {
+		st, err := store.Open(ctx, store.ConfigFromEnv(awsCfg))
+		if err != nil {
+			log.Fatalf("unable to open audit store, %v", err)
+		}
+		if err := backfillFrom(ctx, st); err != nil {
+			log.Printf("[AUDIT-SINK] ⚠️  Backfill from %s incomplete: %v", st, err)
+		}
+	}
+
+	for _, topic := range topics {
+		go consume(ctx, topic)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/audit/orders", handleOrders)
+	mux.HandleFunc("/audit/orders/{order_id}/timeline", handleTimeline)
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	})
+
+	server := &http.Server{
+		Addr:    ":8005",
+		Handler: mux,
+	}
+
+	go func() {
+		log.Printf("Starting Audit Sink on :8005")
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server error: %v", err)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Println("Shutting down...")
+	cancel()
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelShutdown()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Fatal("Server forced to shutdown:", err)
+	}
+}
+
+func consume(ctx context.Context, topic string) {
+	consumer := kafka.NewConsumer(kafkaBrokers, topic, "audit-sink-group")
+	defer consumer.Close()
+
+	log.Printf("[AUDIT-SINK] Started consumer for %s", topic)
+
+	err := consumer.Consume(ctx, func(ctx context.Context, msg kafka.Message) error {
+		return add(ctx, topic, msg.Partition, msg.Offset, msg.Value)
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Printf("[AUDIT-SINK] Consumer for %s failed: %v", topic, err)
+	}
+}
+
+// add indexes one message. Messages that cannot be read are skipped; a
+// failure to write is returned so the message is not committed.
+func add(ctx context.Context, topic string, partition int, offset int64, value []byte) error {
+	e, ok, err := index.Parse(topic, partition, offset, value)
+	if err != nil {
+		log.Printf("[AUDIT-SINK] Skipping unreadable %s message at p=%d offset %d: %v", topic, partition, offset, err)
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+	if _, err := ix.Add(ctx, e); err != nil {
+		log.Printf("[AUDIT-SINK] ❌ Failed to index %s %s for order %s: %v", e.Kind, e.Type, e.OrderID, err)
+		return err
+	}
+	return nil
+}
+
+// backfillFrom indexes every archived message on the sink's topics. The
+// index ignores messages it already has, so running it again is harmless.
+func backfillFrom(ctx context.Context, st store.Store) error {
+	keys, err := st.List(ctx, "manifests/")
+	if err != nil {
+		return err
+	}
+	files, records := 0, 0
+	for _, key := range keys {
+		raw, err := st.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		var m archive.Manifest
+		if err := json.Unmarshal(raw, &m); err != nil {
+			log.Printf("[AUDIT-SINK] Skipping unreadable manifest %s: %v", key, err)
+			continue
+		}
+		if !wanted(m.Topic) {
+			continue
+		}
+		body, err := st.Get(ctx, m.Key)
+		if errors.Is(err, store.ErrNotFound) {
+			log.Printf("[AUDIT-SINK] ⚠️  Archive file %s missing, skipping", m.Key)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		recs, err := archive.Decode(m.Compression, body)
+		if err != nil {
+			log.Printf("[AUDIT-SINK] Skipping unreadable archive file %s: %v", m.Key, err)
+			continue
+		}
+		for _, rec := range recs {
+			if err := add(ctx, m.Topic, m.Partition, rec.Offset, rec.Event); err != nil {
+				return err
+			}
+		}
+		files++
+		records += len(recs)
+	}
+	log.Printf("[AUDIT-SINK] Backfilled %d messages from %d archive files in %s", records, files, st)
+	return nil
+}
+
+func wanted(topic string) bool {
+	for _, t := range topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// handleTimeline returns an order's whole lifecycle, from the command that
+// placed it to its final report, in causal order.
+//
+//	GET /audit/orders/{order_id}/timeline
+func handleTimeline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	t, err := ix.Timeline(r.Context(), r.PathValue("order_id"))
+	if err != nil {
+		log.Printf("[AUDIT-SINK] Timeline query failed: %v", err)
+		http.Error(w, "Failed to read index", http.StatusInternalServerError)
+		return
+	}
+	if t == nil {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// handleOrders finds orders by account, symbol and the time they were first
+// seen, newest first. from and to are RFC 3339; limit defaults to 100.
+//
+//	GET /audit/orders?account=ACC_CHILD_1&symbol=BTC-USD&from=2026-01-01T00:00:00Z
+func handleOrders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	params := r.URL.Query()
+	q := index.Query{Account: params.Get("account"), Symbol: params.Get("symbol"), Limit: 100}
+	for name, dst := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		if v := params.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, "Invalid "+name+": want RFC 3339", http.StatusBadRequest)
+				return
+			}
+			*dst = t
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1000 {
+			http.Error(w, "Invalid limit: want 1 to 1000", http.StatusBadRequest)
+			return
+		}
+		q.Limit = n
+	}
+
+	orders, err := ix.Orders(r.Context(), q)
+	if err != nil {
+		log.Printf("[AUDIT-SINK] Orders query failed: %v", err)
+		http.Error(w, "Failed to read index", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orders)
+}
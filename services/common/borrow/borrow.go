@@ -0,0 +1,104 @@
+// Package borrow is the borrow inventory: the assets that can be borrowed to
+// sell short, how much of each and at what rate. It is loaded from
+// config/borrow.json.
+package borrow
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/atlas/services/common/config"
+	"github.com/atlas/services/common/decimal"
+)
+
+// Status is how readily an asset can be borrowed.
+type Status string
+
+const (
+	// EasyToBorrow assets are located automatically when an order needs it.
+	EasyToBorrow Status = "ETB"
+	// HardToBorrow assets need a locate requested before the short sale.
+	HardToBorrow Status = "HTB"
+)
+
+var (
+	bps         = decimal.FromInt(10000)
+	daysPerYear = decimal.FromInt(365)
+)
+
+// Asset is the borrow terms for one asset. Available is the inventory the
+// desk starts with; RateBps is the annual borrow rate in basis points of the
+// borrowed quantity's market value.
+type Asset struct {
+	Asset     string          `json:"asset"`
+	Status    Status          `json:"status"`
+	Available decimal.Decimal `json:"available"`
+	RateBps   decimal.Decimal `json:"rate_bps"`
+}
+
+// DailyFee is one day's borrow fee on qty, short, marked at px, in the quote
+// asset.
+func (a Asset) DailyFee(qty, px decimal.Decimal) decimal.Decimal {
+	return qty.Abs().Mul(px).Mul(a.RateBps).Div(bps).Div(daysPerYear)
+}
+
+// File returns the borrow inventory path, ATLAS_BORROW_FILE if set.
+func File() string {
+	return config.RepoPath("ATLAS_BORROW_FILE", "config/borrow.json")
+}
+
+// Inventory holds the borrow terms of every configured asset.
+type Inventory struct {
+	byAsset map[string]Asset
+}
+
+// Load reads and checks the borrow inventory.
+func Load(path string) (*Inventory, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Asset
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	inv := &Inventory{byAsset: make(map[string]Asset, len(list))}
+	for _, a := range list {
+		if a.Asset == "" {
+			return nil, fmt.Errorf("%s: entry without asset", path)
+		}
+		if _, dup := inv.byAsset[a.Asset]; dup {
+			return nil, fmt.Errorf("%s: duplicate asset %s", path, a.Asset)
+		}
+		switch a.Status {
+		case EasyToBorrow, HardToBorrow:
+		default:
+			return nil, fmt.Errorf("%s: %s has unknown status %q", path, a.Asset, a.Status)
+		}
+		if a.Available.IsNegative() || a.RateBps.IsNegative() {
+			return nil, fmt.Errorf("%s: %s must have non-negative available and rate_bps", path, a.Asset)
+		}
+		inv.byAsset[a.Asset] = a
+	}
+	return inv, nil
+}
+
+// Get looks up an asset.
+func (i *Inventory) Get(asset string) (Asset, bool) {
+	a, ok := i.byAsset[asset]
+	return a, ok
+}
+
+// All returns every asset sorted by name.
+func (i *Inventory) All() []Asset {
+	out := make([]Asset, 0, len(i.byAsset))
+	for _, a := range i.byAsset {
+		out = append(out, a)
+	}
+	sort.Slice(out, func(x, y int) bool { return out[x].Asset < out[y].Asset })
+	return out
+}
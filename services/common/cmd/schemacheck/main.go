@@ -0,0 +1,210 @@
+// Command schemacheck reports drift between the JSON Schemas in schemas/ and
+// the Go types in common/model: properties present on only one side, and
+// properties whose schema type does not match the Go field type.
+//
+// Usage (from services/common):
+//
+//	go run ./cmd/schemacheck [-dir ../../schemas]
+//
+// Exits non-zero if any drift is found.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/model"
+	"github.com/atlas/services/common/schema"
+)
+
+// pairs maps each schema to the Go type that is serialized against it.
+var pairs = []struct {
+	schema string
+	typ    reflect.Type
+}{
+	{schema.OrderCommand, reflect.TypeOf(model.OrderCommand{})},
+	{schema.ExecutionReport, reflect.TypeOf(model.ExecutionReport{})},
+	{schema.OrderEvent, reflect.TypeOf(model.OrderEvent{})},
+	{schema.RiskDecision, reflect.TypeOf(model.RiskDecision{})},
+	{schema.AuditEvent, reflect.TypeOf(model.AuditEvent{})},
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	decimalType   = reflect.TypeOf(decimal.Decimal{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+func main() {
+	dir := flag.String("dir", schema.Dir(), "directory containing the JSON Schemas")
+	flag.Parse()
+
+	reg, err := schema.Load(*dir)
+	if err != nil {
+		log.Fatalf("Failed to load schemas: %v", err)
+	}
+
+	var problems []string
+	for _, p := range pairs {
+		s := reg.Get(p.schema)
+		if s == nil {
+			problems = append(problems, fmt.Sprintf("%s: schema file missing", p.schema))
+			continue
+		}
+		problems = append(problems, compare(p.schema, s, p.typ)...)
+	}
+
+	if len(problems) > 0 {
+		for _, msg := range problems {
+			fmt.Println(msg)
+		}
+		os.Exit(1)
+	}
+	fmt.Printf("OK: %d schemas match common/model\n", len(pairs))
+}
+
+func compare(name string, s *schema.Schema, t reflect.Type) []string {
+	var problems []string
+	fields := jsonFields(t)
+
+	for _, prop := range sortedProps(s.Properties) {
+		f, ok := fields[prop]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s.%s: in schema but not in %s", name, prop, t))
+			continue
+		}
+		want := schemaType(f.Type)
+		if want == "" {
+			continue // interface{}: anything goes
+		}
+		sub := s.Properties[prop]
+		got := sub.Type
+		if len(got) > 0 && !contains(got, want) {
+			problems = append(problems, fmt.Sprintf("%s.%s: schema type %s, Go field %s.%s is %s (%s)",
+				name, prop, strings.Join(got, "|"), t, f.Name, f.Type, want))
+			continue
+		}
+		problems = append(problems, compareNested(name+"."+prop, sub, f.Type)...)
+	}
+
+	for _, tag := range sortedFields(fields) {
+		if _, ok := s.Properties[tag]; !ok {
+			problems = append(problems, fmt.Sprintf("%s.%s: in %s.%s but not in schema", name, tag, t, fields[tag].Name))
+		}
+	}
+	return problems
+}
+
+// compareNested checks an object property against its struct, and an array
+// property's items against its element struct.
+func compareNested(name string, s *schema.Schema, t reflect.Type) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		if s.Items == nil {
+			return nil
+		}
+		return compareNested(name+"[]", s.Items, t.Elem())
+	case isPlainStruct(t):
+		if s.Properties == nil {
+			return []string{fmt.Sprintf("%s: %s has fields but the schema lists no properties", name, t)}
+		}
+		return compare(name, s, t)
+	}
+	return nil
+}
+
+// isPlainStruct reports whether t is a struct serialized field by field.
+func isPlainStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != timeType && t != decimalType &&
+		!t.Implements(marshalerType) && !reflect.PointerTo(t).Implements(marshalerType)
+}
+
+// jsonFields returns the exported fields of t keyed by JSON name, skipping
+// fields tagged "-".
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	out := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+		if tag == "" {
+			tag = f.Name
+		}
+		out[tag] = f
+	}
+	return out
+}
+
+// schemaType maps a Go type to the JSON Schema type it serializes as.
+func schemaType(t reflect.Type) string {
+	if t == timeType {
+		return "string"
+	}
+	if t == decimalType {
+		return "number"
+	}
+	if t.Implements(marshalerType) {
+		return "" // custom encoding; trust the type
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	case reflect.Ptr:
+		return schemaType(t.Elem())
+	}
+	return ""
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedProps(m map[string]*schema.Schema) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedFields(m map[string]reflect.StructField) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
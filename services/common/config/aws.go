@@ -7,33 +7,46 @@ import (
 )
 
 type AWSConfig struct {
-	Region           string
-	BalancesTable    string
-	OrdersTable      string
-	IdempotencyTable string
-	AuditS3Bucket    string
-	DynamoDBEndpoint string
-	UseLocalDDB      bool
+	Region             string
+	BalancesTable      string
+	OrdersTable        string
+	OrdersAccountIndex string
+	IdempotencyTable   string
+	PositionsTable     string
+	BorrowTable        string
+	AuditS3Bucket      string
+	AuditS3Endpoint    string
+	DynamoDBEndpoint   string
+	UseLocalDDB        bool
 }
 
 func LoadAWSConfig(serviceName string) *AWSConfig {
 	cfg := &AWSConfig{
-		Region:           getEnv("AWS_REGION", "us-east-1"),
-		BalancesTable:    getEnv("ATLAS_DDB_BALANCES_TABLE", "atlas_balances"),
-		OrdersTable:      getEnv("ATLAS_DDB_ORDERS_TABLE", "atlas_orders"),
-		IdempotencyTable: getEnv("ATLAS_DDB_IDEMPOTENCY_TABLE", "atlas_idempotency"),
-		AuditS3Bucket:    getEnv("ATLAS_AUDIT_S3_BUCKET", "atlas-audit-demo"),
-		DynamoDBEndpoint: os.Getenv("ATLAS_DDB_ENDPOINT"),
-		UseLocalDDB:      strings.ToLower(os.Getenv("ATLAS_USE_DDB_LOCAL")) == "true",
+		Region:             getEnv("AWS_REGION", "us-east-1"),
+		BalancesTable:      getEnv("ATLAS_DDB_BALANCES_TABLE", "atlas_balances"),
+		OrdersTable:        getEnv("ATLAS_DDB_ORDERS_TABLE", "atlas_orders"),
+		OrdersAccountIndex: getEnv("ATLAS_DDB_ORDERS_ACCOUNT_INDEX", "account_id-index"),
+		IdempotencyTable:   getEnv("ATLAS_DDB_IDEMPOTENCY_TABLE", "atlas_idempotency"),
+		PositionsTable:     getEnv("ATLAS_DDB_POSITIONS_TABLE", "atlas_positions"),
+		BorrowTable:        getEnv("ATLAS_DDB_BORROW_TABLE", "atlas_borrow"),
+		AuditS3Bucket:      getEnv("ATLAS_AUDIT_S3_BUCKET", "atlas-audit-demo"),
+		AuditS3Endpoint:    os.Getenv("ATLAS_AUDIT_S3_ENDPOINT"),
+		DynamoDBEndpoint:   os.Getenv("ATLAS_DDB_ENDPOINT"),
+		UseLocalDDB:        strings.ToLower(os.Getenv("ATLAS_USE_DDB_LOCAL")) == "true",
 	}
 
 	// Logging startup info
 	log.Printf("[%s] Starting with AWS Config:", serviceName)
 	log.Printf("[%s]   Region: %s", serviceName, cfg.Region)
 	log.Printf("[%s]   Balances Table: %s", serviceName, cfg.BalancesTable)
-	log.Printf("[%s]   Orders Table: %s", serviceName, cfg.OrdersTable)
+	log.Printf("[%s]   Orders Table: %s (account index %s)", serviceName, cfg.OrdersTable, cfg.OrdersAccountIndex)
 	log.Printf("[%s]   Idempotency Table: %s", serviceName, cfg.IdempotencyTable)
+	log.Printf("[%s]   Positions Table: %s", serviceName, cfg.PositionsTable)
+	log.Printf("[%s]   Borrow Table: %s", serviceName, cfg.BorrowTable)
 	log.Printf("[%s]   Audit S3 Bucket: %s", serviceName, cfg.AuditS3Bucket)
+	if cfg.AuditS3Endpoint != "" {
+		log.Printf("[%s]   Audit S3 Endpoint: %s", serviceName, cfg.AuditS3Endpoint)
+	}
 
 	endpointOverride := "false"
 	if cfg.DynamoDBEndpoint != "" || cfg.UseLocalDDB {
@@ -0,0 +1,13 @@
+package config
+
+import "path/filepath"
+
+// repoRoot is the repository root as seen from a service's directory,
+// which is where services run from.
+const repoRoot = "../.."
+
+// RepoPath returns the path set in the environment variable env, or rel
+// under the repository root if it is unset.
+func RepoPath(env, rel string) string {
+	return getEnv(env, filepath.Join(repoRoot, rel))
+}
@@ -61,6 +61,22 @@ func (d *DynamoClient) UpdateItem(ctx context.Context, input *dynamodb.UpdateIte
 	return d.Client.UpdateItem(ctx, input)
 }
 
+func (d *DynamoClient) DeleteItem(ctx context.Context, input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	return d.Client.DeleteItem(ctx, input)
+}
+
+func (d *DynamoClient) TransactWriteItems(ctx context.Context, input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+	return d.Client.TransactWriteItems(ctx, input)
+}
+
+func (d *DynamoClient) Scan(ctx context.Context, input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	return d.Client.Scan(ctx, input)
+}
+
+func (d *DynamoClient) Query(ctx context.Context, input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+	return d.Client.Query(ctx, input)
+}
+
 func (d *DynamoClient) PutItemConditional(ctx context.Context, input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
 	return d.Client.PutItem(ctx, input)
 }
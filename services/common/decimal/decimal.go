@@ -0,0 +1,462 @@
+// Package decimal is the fixed-point number type used for every price,
+// quantity and balance that crosses a service boundary.
+//
+// A Decimal holds an int64 count of 10^-8 units, so sums and differences are
+// exact and values survive JSON and DynamoDB round trips unchanged. The range
+// is roughly ±92 billion, which comfortably covers demo balances and
+// notionals. Products and quotients are computed exactly and then rounded
+// half away from zero to 8 places.
+//
+// Arithmetic never wraps: a result beyond the range saturates at MaxValue or
+// its negation, so an oversized notional still fails every limit it is
+// checked against. Risk checks that must reject such an order outright use
+// the Checked variants, which also return ErrOverflow.
+package decimal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Places is the number of fractional digits a Decimal carries.
+const Places = 8
+
+const scale = 100000000 // 10^Places
+
+var (
+	bigScale = big.NewInt(scale)
+	bigMax   = big.NewInt(math.MaxInt64)
+	bigMin   = big.NewInt(-math.MaxInt64)
+)
+
+// Decimal is a fixed-point number with Places fractional digits. The zero
+// value is 0.
+type Decimal struct {
+	units int64
+}
+
+var Zero = Decimal{}
+
+// MaxValue is the largest Decimal; MaxValue.Neg() is the smallest.
+var MaxValue = Decimal{units: math.MaxInt64}
+
+// ErrOverflow is returned by the Checked operations when the result is out
+// of range.
+var ErrOverflow = errors.New("decimal: result out of range")
+
+// New returns value * 10^exp, e.g. New(1, -4) is 0.0001.
+func New(value int64, exp int) Decimal {
+	d := Decimal{units: value}
+	for e := exp + Places; e > 0; e-- {
+		d = d.MulInt(10)
+	}
+	for e := exp + Places; e < 0; e++ {
+		d.units = roundDiv(d.units, 10)
+	}
+	return d
+}
+
+// FromInt returns i as a Decimal, saturating beyond the range.
+func FromInt(i int64) Decimal {
+	return Decimal{units: i}.MulInt(scale)
+}
+
+// FromFloat converts f, rounding to Places. Use it only at the edge of
+// float-based code such as the market data simulator.
+func FromFloat(f float64) Decimal {
+	u := math.Round(f * scale)
+	switch {
+	case u >= math.MaxInt64:
+		return MaxValue
+	case u <= -math.MaxInt64:
+		return MaxValue.Neg()
+	}
+	return Decimal{units: int64(u)}
+}
+
+// NewFromString parses a plain decimal literal such as "-12.5" or "0.0001".
+// Exponent notation is accepted as well since JSON encoders may produce it.
+func NewFromString(s string) (Decimal, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Zero, fmt.Errorf("decimal: empty string")
+	}
+	if strings.ContainsAny(s, "eE") {
+		r, ok := new(big.Rat).SetString(s)
+		if !ok {
+			return Zero, fmt.Errorf("decimal: invalid number %q", s)
+		}
+		return fromRat(r)
+	}
+
+	neg := false
+	switch s[0] {
+	case '-':
+		neg = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	intPart, frac, _ := strings.Cut(s, ".")
+	if intPart == "" && frac == "" {
+		return Zero, fmt.Errorf("decimal: invalid number %q", s)
+	}
+	if intPart == "" {
+		intPart = "0"
+	}
+
+	if !digitsOnly(intPart) || !digitsOnly(frac) {
+		return Zero, fmt.Errorf("decimal: invalid number %q", s)
+	}
+
+	// Round anything beyond Places half away from zero.
+	roundUp := false
+	if len(frac) > Places {
+		roundUp = frac[Places] >= '5'
+		frac = frac[:Places]
+	}
+	frac += strings.Repeat("0", Places-len(frac))
+
+	whole, err := strconv.ParseInt(intPart, 10, 64)
+	if err != nil {
+		return Zero, fmt.Errorf("decimal: %q out of range", s)
+	}
+	fracUnits, _ := strconv.ParseInt(frac, 10, 64)
+	if whole > math.MaxInt64/scale-1 {
+		return Zero, fmt.Errorf("decimal: %q out of range", s)
+	}
+
+	units := whole*scale + fracUnits
+	if roundUp {
+		units++
+	}
+	if neg {
+		units = -units
+	}
+	return Decimal{units: units}, nil
+}
+
+// RequireFromString is NewFromString for literals known to be valid.
+func RequireFromString(s string) Decimal {
+	d, err := NewFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func fromRat(r *big.Rat) (Decimal, error) {
+	num := new(big.Int).Mul(r.Num(), bigScale)
+	q := roundQuo(num, r.Denom())
+	if !q.IsInt64() {
+		return Zero, fmt.Errorf("decimal: %s out of range", r.FloatString(Places))
+	}
+	return Decimal{units: q.Int64()}, nil
+}
+
+func (d Decimal) Add(o Decimal) Decimal {
+	r, _ := d.AddChecked(o)
+	return r
+}
+
+func (d Decimal) Sub(o Decimal) Decimal {
+	r, _ := d.SubChecked(o)
+	return r
+}
+
+func (d Decimal) Neg() Decimal { return Decimal{units: -d.units} }
+
+// Mul returns d * o rounded to Places.
+func (d Decimal) Mul(o Decimal) Decimal {
+	r, _ := d.MulChecked(o)
+	return r
+}
+
+// Div returns d / o rounded to Places. Dividing by zero returns zero; callers
+// that care check IsZero first.
+func (d Decimal) Div(o Decimal) Decimal {
+	r, _ := d.DivChecked(o)
+	return r
+}
+
+// MulInt returns d * i.
+func (d Decimal) MulInt(i int64) Decimal {
+	r, _ := d.MulIntChecked(i)
+	return r
+}
+
+// AddChecked is Add, returning ErrOverflow with the saturated sum if it is
+// out of range.
+func (d Decimal) AddChecked(o Decimal) (Decimal, error) {
+	return fromBig(new(big.Int).Add(big.NewInt(d.units), big.NewInt(o.units)))
+}
+
+// SubChecked is Sub, returning ErrOverflow with the saturated difference if
+// it is out of range.
+func (d Decimal) SubChecked(o Decimal) (Decimal, error) {
+	return fromBig(new(big.Int).Sub(big.NewInt(d.units), big.NewInt(o.units)))
+}
+
+// MulChecked is Mul, returning ErrOverflow with the saturated product if it
+// is out of range.
+func (d Decimal) MulChecked(o Decimal) (Decimal, error) {
+	p := new(big.Int).Mul(big.NewInt(d.units), big.NewInt(o.units))
+	return fromBig(roundQuo(p, bigScale))
+}
+
+// DivChecked is Div, returning ErrOverflow with the saturated quotient if it
+// is out of range. Dividing by zero still returns zero.
+func (d Decimal) DivChecked(o Decimal) (Decimal, error) {
+	if o.units == 0 {
+		return Zero, nil
+	}
+	n := new(big.Int).Mul(big.NewInt(d.units), bigScale)
+	return fromBig(roundQuo(n, big.NewInt(o.units)))
+}
+
+// MulIntChecked is MulInt, returning ErrOverflow with the saturated product
+// if it is out of range.
+func (d Decimal) MulIntChecked(i int64) (Decimal, error) {
+	return fromBig(new(big.Int).Mul(big.NewInt(d.units), big.NewInt(i)))
+}
+
+// fromBig converts a count of units, saturating at ±Max when it does not fit.
+func fromBig(u *big.Int) (Decimal, error) {
+	switch {
+	case u.Cmp(bigMax) > 0:
+		return MaxValue, ErrOverflow
+	case u.Cmp(bigMin) < 0:
+		return MaxValue.Neg(), ErrOverflow
+	}
+	return Decimal{units: u.Int64()}, nil
+}
+
+func (d Decimal) Abs() Decimal {
+	if d.units < 0 {
+		return d.Neg()
+	}
+	return d
+}
+
+// Cmp returns -1, 0 or +1 as d is less than, equal to or greater than o.
+func (d Decimal) Cmp(o Decimal) int {
+	switch {
+	case d.units < o.units:
+		return -1
+	case d.units > o.units:
+		return 1
+	}
+	return 0
+}
+
+func (d Decimal) Equal(o Decimal) bool              { return d.units == o.units }
+func (d Decimal) GreaterThan(o Decimal) bool        { return d.units > o.units }
+func (d Decimal) GreaterThanOrEqual(o Decimal) bool { return d.units >= o.units }
+func (d Decimal) LessThan(o Decimal) bool           { return d.units < o.units }
+func (d Decimal) LessThanOrEqual(o Decimal) bool    { return d.units <= o.units }
+func (d Decimal) Sign() int                         { return d.Cmp(Zero) }
+func (d Decimal) IsZero() bool                      { return d.units == 0 }
+func (d Decimal) IsPositive() bool                  { return d.units > 0 }
+func (d Decimal) IsNegative() bool                  { return d.units < 0 }
+
+func Min(a, b Decimal) Decimal {
+	if a.units < b.units {
+		return a
+	}
+	return b
+}
+
+func Max(a, b Decimal) Decimal {
+	if a.units > b.units {
+		return a
+	}
+	return b
+}
+
+// RoundStep rounds d to the nearest multiple of step, half away from zero.
+// A non-positive step returns d unchanged.
+func (d Decimal) RoundStep(step Decimal) Decimal {
+	if step.units <= 0 {
+		return d
+	}
+	return Decimal{units: roundDiv(d.units, step.units) * step.units}
+}
+
+// FloorStep rounds d towards zero to a multiple of step.
+func (d Decimal) FloorStep(step Decimal) Decimal {
+	if step.units <= 0 {
+		return d
+	}
+	return Decimal{units: d.units / step.units * step.units}
+}
+
+// CeilStep rounds d away from zero to a multiple of step.
+func (d Decimal) CeilStep(step Decimal) Decimal {
+	if step.units <= 0 {
+		return d
+	}
+	q := d.units / step.units
+	if d.units%step.units != 0 {
+		if d.units > 0 {
+			q++
+		} else {
+			q--
+		}
+	}
+	return Decimal{units: q * step.units}
+}
+
+// IsMultipleOf reports whether d is a whole number of steps.
+func (d Decimal) IsMultipleOf(step Decimal) bool {
+	return step.units > 0 && d.units%step.units == 0
+}
+
+// Round rounds d to the given number of fractional digits.
+func (d Decimal) Round(places int) Decimal {
+	if places >= Places {
+		return d
+	}
+	return d.RoundStep(New(1, -places))
+}
+
+// Float64 converts d for display or for float-based simulation code.
+func (d Decimal) Float64() float64 {
+	return float64(d.units) / scale
+}
+
+// String renders d without exponent or trailing zeros.
+func (d Decimal) String() string {
+	u := d.units
+	sign := ""
+	if u < 0 {
+		sign = "-"
+	}
+	abs := uint64(u)
+	if u < 0 {
+		abs = uint64(-u)
+	}
+	whole := abs / scale
+	frac := abs % scale
+	if frac == 0 {
+		return sign + strconv.FormatUint(whole, 10)
+	}
+	fs := fmt.Sprintf("%0*d", Places, frac)
+	return sign + strconv.FormatUint(whole, 10) + "." + strings.TrimRight(fs, "0")
+}
+
+// MarshalJSON encodes d as a JSON number so existing consumers keep working.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a quoted decimal string.
+func (d *Decimal) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err == nil {
+		s = n.String()
+	} else {
+		var str string
+		if err := json.Unmarshal(b, &str); err != nil {
+			return fmt.Errorf("decimal: cannot unmarshal %s", b)
+		}
+		s = str
+	}
+	v, err := NewFromString(s)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+// MarshalDynamoDBAttributeValue stores d as a DynamoDB number.
+func (d Decimal) MarshalDynamoDBAttributeValue() (types.AttributeValue, error) {
+	return &types.AttributeValueMemberN{Value: d.String()}, nil
+}
+
+// UnmarshalDynamoDBAttributeValue reads a DynamoDB number (or string).
+func (d *Decimal) UnmarshalDynamoDBAttributeValue(av types.AttributeValue) error {
+	var s string
+	switch v := av.(type) {
+	case *types.AttributeValueMemberN:
+		s = v.Value
+	case *types.AttributeValueMemberS:
+		s = v.Value
+	case *types.AttributeValueMemberNULL:
+		return nil
+	default:
+		return fmt.Errorf("decimal: cannot unmarshal %T", av)
+	}
+	v, err := NewFromString(s)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+// AttributeValue is shorthand for UpdateItem expression values.
+func (d Decimal) AttributeValue() types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: d.String()}
+}
+
+// roundDiv divides a by b rounding half away from zero.
+func roundDiv(a, b int64) int64 {
+	q, r := a/b, a%b
+	if r == 0 {
+		return q
+	}
+	if 2*abs64(r) >= abs64(b) {
+		if (a < 0) != (b < 0) {
+			q--
+		} else {
+			q++
+		}
+	}
+	return q
+}
+
+func roundQuo(n, d *big.Int) *big.Int {
+	q, r := new(big.Int).QuoRem(n, d, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+	r2 := new(big.Int).Abs(r)
+	r2.Lsh(r2, 1)
+	if r2.Cmp(new(big.Int).Abs(d)) >= 0 {
+		if (n.Sign() < 0) != (d.Sign() < 0) {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q
+}
+
+func digitsOnly(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func abs64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,166 @@
+package decimal
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestNewFromString(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "0", want: "0"},
+		{in: "12.5", want: "12.5"},
+		{in: "-12.5", want: "-12.5"},
+		{in: "+3", want: "3"},
+		{in: ".25", want: "0.25"},
+		{in: "7.", want: "7"},
+		{in: " 1.10 ", want: "1.1"},
+		{in: "0.00000001", want: "0.00000001"},
+		{in: "1.5e3", want: "1500"},
+		{in: "-2E-2", want: "-0.02"},
+		// Beyond Places, half away from zero.
+		{in: "0.123456784", want: "0.12345678"},
+		{in: "0.123456785", want: "0.12345679"},
+		{in: "-0.123456785", want: "-0.12345679"},
+		{in: "1e-9", want: "0"},
+		{in: "5e-9", want: "0.00000001"},
+		{in: "92233720367", want: "92233720367"},
+		{in: "92233720368", wantErr: true},
+		{in: "99999999999999999999", wantErr: true},
+		{in: "1e20", wantErr: true},
+		{in: "", wantErr: true},
+		{in: ".", wantErr: true},
+		{in: "-", wantErr: true},
+		{in: "1.2.3", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: "1,000", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NewFromString(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NewFromString(%q) = %s, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewFromString(%q): %v", tt.in, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("NewFromString(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	d := RequireFromString
+	tests := []struct {
+		name string
+		got  Decimal
+		want string
+	}{
+		{"add", d("0.1").Add(d("0.2")), "0.3"},
+		{"sub", d("1").Sub(d("1.00000001")), "-0.00000001"},
+		{"mul", d("65000.5").Mul(d("0.25")), "16250.125"},
+		{"mul rounds up", d("0.00000001").Mul(d("0.5")), "0.00000001"},
+		{"mul rounds down", d("0.00000001").Mul(d("0.49")), "0"},
+		{"mul rounds away from zero", d("-0.00000001").Mul(d("0.5")), "-0.00000001"},
+		{"div", d("1").Div(d("3")), "0.33333333"},
+		{"div rounds up", d("2").Div(d("3")), "0.66666667"},
+		{"div negative", d("-2").Div(d("3")), "-0.66666667"},
+		{"div by zero", d("5").Div(Zero), "0"},
+		{"mul int", d("1.5").MulInt(-4), "-6"},
+		{"new", New(15, -1), "1.5"},
+		{"new rounds", New(15, -9), "0.00000002"},
+		{"from int", FromInt(42), "42"},
+		{"round step", d("65000.37").RoundStep(d("0.5")), "65000.5"},
+		{"floor step", d("-1.27").FloorStep(d("0.1")), "-1.2"},
+		{"ceil step", d("-1.21").CeilStep(d("0.1")), "-1.3"},
+		{"round", d("2.345").Round(2), "2.35"},
+	}
+	for _, tt := range tests {
+		if tt.got.String() != tt.want {
+			t.Errorf("%s = %s, want %s", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	d := RequireFromString
+	big := d("90000000000")
+	tests := []struct {
+		name string
+		op   func() (Decimal, error)
+		want Decimal
+	}{
+		{"add", func() (Decimal, error) { return big.AddChecked(big) }, MaxValue},
+		{"add negative", func() (Decimal, error) { return big.Neg().AddChecked(big.Neg()) }, MaxValue.Neg()},
+		{"sub", func() (Decimal, error) { return big.Neg().SubChecked(big) }, MaxValue.Neg()},
+		{"mul", func() (Decimal, error) { return d("65000").MulChecked(d("2000000")) }, MaxValue},
+		{"mul negative", func() (Decimal, error) { return d("-65000").MulChecked(d("2000000")) }, MaxValue.Neg()},
+		{"div", func() (Decimal, error) { return big.DivChecked(d("0.001")) }, MaxValue},
+		{"mul int", func() (Decimal, error) { return big.MulIntChecked(-2) }, MaxValue.Neg()},
+	}
+	for _, tt := range tests {
+		got, err := tt.op()
+		if !errors.Is(err, ErrOverflow) {
+			t.Errorf("%s: err = %v, want ErrOverflow", tt.name, err)
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("%s = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	// The unchecked forms saturate rather than wrap.
+	if got := d("65000").Mul(d("2000000")); !got.Equal(MaxValue) {
+		t.Errorf("Mul overflow = %s, want %s", got, MaxValue)
+	}
+	if got := FromInt(1 << 62); !got.Equal(MaxValue) {
+		t.Errorf("FromInt overflow = %s, want %s", got, MaxValue)
+	}
+	if got := FromFloat(1e300); !got.Equal(MaxValue) {
+		t.Errorf("FromFloat overflow = %s, want %s", got, MaxValue)
+	}
+
+	// In range, the checked forms agree with the plain ones.
+	if got, err := d("65000").MulChecked(d("2")); err != nil || got.String() != "130000" {
+		t.Errorf("MulChecked in range = %s, %v", got, err)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`1.5`, "1.5"},
+		{`"0.0001"`, "0.0001"},
+		{`1e-4`, "0.0001"},
+		{`null`, "0"},
+	}
+	for _, tt := range tests {
+		var got Decimal
+		if err := json.Unmarshal([]byte(tt.in), &got); err != nil {
+			t.Errorf("Unmarshal(%s): %v", tt.in, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("Unmarshal(%s) = %s, want %s", tt.in, got, tt.want)
+		}
+		out, _ := json.Marshal(got)
+		if string(out) != tt.want {
+			t.Errorf("Marshal(%s) = %s, want %s", got, out, tt.want)
+		}
+	}
+	for _, in := range []string{`"abc"`, `true`, `"1e30"`} {
+		var got Decimal
+		if err := json.Unmarshal([]byte(in), &got); err == nil {
+			t.Errorf("Unmarshal(%s) = %s, want error", in, got)
+		}
+	}
+}
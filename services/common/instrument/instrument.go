@@ -0,0 +1,327 @@
+// Package instrument is the instrument master: the reference data for every
+// tradable symbol, loaded from config/instruments.json.
+package instrument
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/atlas/services/common/config"
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/model"
+	"github.com/atlas/services/common/schema"
+)
+
+type Status string
+
+const (
+	StatusTrading Status = "TRADING"
+	StatusHalted  Status = "HALTED"
+)
+
+// Instrument is the reference data for one symbol. Quantities are in the base
+// asset, prices and notionals in the quote asset.
+type Instrument struct {
+	Symbol         string          `json:"symbol"`
+	BaseAsset      string          `json:"base_asset"`
+	QuoteAsset     string          `json:"quote_asset"`
+	TickSize       decimal.Decimal `json:"tick_size"`
+	LotSize        decimal.Decimal `json:"lot_size"`
+	MinQty         decimal.Decimal `json:"min_qty"`
+	MaxQty         decimal.Decimal `json:"max_qty"`
+	MinNotional    decimal.Decimal `json:"min_notional"`
+	PricePrecision int             `json:"price_precision"`
+	Status         Status          `json:"status"`
+
+	// ReferencePrice seeds venue-sim's book for the symbol.
+	ReferencePrice decimal.Decimal `json:"reference_price,omitzero"`
+
+	// Margin requirements as a percent of the position's marked notional:
+	// equity needed to open it and to keep it. Zero on cash-only symbols.
+	InitialMarginPct     decimal.Decimal `json:"initial_margin_pct,omitzero"`
+	MaintenanceMarginPct decimal.Decimal `json:"maintenance_margin_pct,omitzero"`
+}
+
+// File returns the instrument master path, ATLAS_INSTRUMENTS_FILE if set.
+func File() string {
+	return config.RepoPath("ATLAS_INSTRUMENTS_FILE", "config/instruments.json")
+}
+
+// Master holds every configured instrument keyed by symbol.
+type Master struct {
+	bySymbol map[string]Instrument
+}
+
+// Load reads and checks the instrument master file.
+func Load(path string) (*Master, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Instrument
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	m := &Master{bySymbol: make(map[string]Instrument, len(list))}
+	for _, inst := range list {
+		if inst.Symbol == "" {
+			return nil, fmt.Errorf("%s: instrument without symbol", path)
+		}
+		if !inst.TickSize.IsPositive() || !inst.LotSize.IsPositive() {
+			return nil, fmt.Errorf("%s: %s must have positive tick_size and lot_size", path, inst.Symbol)
+		}
+		if !inst.InitialMarginPct.IsZero() || !inst.MaintenanceMarginPct.IsZero() {
+			if !inst.MaintenanceMarginPct.IsPositive() || inst.MaintenanceMarginPct.GreaterThan(inst.InitialMarginPct) || inst.InitialMarginPct.GreaterThan(decimal.FromInt(100)) {
+				return nil, fmt.Errorf("%s: %s needs 0 < maintenance_margin_pct <= initial_margin_pct <= 100", path, inst.Symbol)
+			}
+		}
+		if _, dup := m.bySymbol[inst.Symbol]; dup {
+			return nil, fmt.Errorf("%s: duplicate symbol %s", path, inst.Symbol)
+		}
+		if inst.Status == "" {
+			inst.Status = StatusTrading
+		}
+		m.bySymbol[inst.Symbol] = inst
+	}
+	return m, nil
+}
+
+// Get looks up a symbol.
+func (m *Master) Get(symbol string) (Instrument, bool) {
+	inst, ok := m.bySymbol[symbol]
+	return inst, ok
+}
+
+// All returns every instrument sorted by symbol.
+func (m *Master) All() []Instrument {
+	out := make([]Instrument, 0, len(m.bySymbol))
+	for _, inst := range m.bySymbol {
+		out = append(out, inst)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Symbol < out[j].Symbol })
+	return out
+}
+
+// ValidateOrder checks a NEW command against the instrument master. Errors use
+// the same field-level shape as schema validation.
+func (m *Master) ValidateOrder(cmd model.OrderCommand) schema.Errors {
+	inst, ok := m.Get(cmd.Symbol)
+	if !ok {
+		return schema.Errors{{Field: "symbol", Message: fmt.Sprintf("unknown instrument %q", cmd.Symbol)}}
+	}
+	if inst.Status != StatusTrading {
+		return schema.Errors{{Field: "symbol", Message: fmt.Sprintf("%s is not trading (%s)", inst.Symbol, inst.Status)}}
+	}
+
+	var errs schema.Errors
+	qty := cmd.QuantityVal
+	if inst.MinQty.IsPositive() && qty.LessThan(inst.MinQty) {
+		errs = append(errs, schema.FieldError{Field: "quantity", Message: fmt.Sprintf("must be >= min qty %s", inst.MinQty)})
+	}
+	if inst.MaxQty.IsPositive() && qty.GreaterThan(inst.MaxQty) {
+		errs = append(errs, schema.FieldError{Field: "quantity", Message: fmt.Sprintf("must be <= max qty %s", inst.MaxQty)})
+	}
+	if !qty.IsMultipleOf(inst.LotSize) {
+		errs = append(errs, schema.FieldError{Field: "quantity", Message: fmt.Sprintf("must be a multiple of lot size %s", inst.LotSize)})
+	}
+	if cmd.Price.IsPositive() {
+		if !cmd.Price.IsMultipleOf(inst.TickSize) {
+			errs = append(errs, schema.FieldError{Field: "price", Message: fmt.Sprintf("must be a multiple of tick size %s", inst.TickSize)})
+		}
+		notional, err := inst.Notional(qty, cmd.Price)
+		switch {
+		case err != nil:
+			errs = append(errs, schema.FieldError{Field: "price", Message: fmt.Sprintf("notional of %s at %s is out of range", qty, cmd.Price)})
+		case inst.MinNotional.IsPositive() && notional.LessThan(inst.MinNotional):
+			errs = append(errs, schema.FieldError{Field: "price", Message: fmt.Sprintf("notional %s is below min notional %s", notional, inst.MinNotional)})
+		}
+	}
+	switch cmd.OrderType {
+	case model.OrderTypeStop, model.OrderTypeStopLimit:
+		if !cmd.StopPrice.IsPositive() {
+			errs = append(errs, schema.FieldError{Field: "stop_price", Message: fmt.Sprintf("required for %s orders", cmd.OrderType)})
+		} else if !cmd.StopPrice.IsMultipleOf(inst.TickSize) {
+			errs = append(errs, schema.FieldError{Field: "stop_price", Message: fmt.Sprintf("must be a multiple of tick size %s", inst.TickSize)})
+		}
+		if cmd.OrderType == model.OrderTypeStopLimit && !cmd.Price.IsPositive() {
+			errs = append(errs, schema.FieldError{Field: "price", Message: "required for STOP_LIMIT orders"})
+		}
+	default:
+		if cmd.StopPrice.IsPositive() {
+			errs = append(errs, schema.FieldError{Field: "stop_price", Message: "only valid on STOP and STOP_LIMIT orders"})
+		}
+	}
+	if cmd.OrderType == model.OrderTypeMarket || cmd.OrderType == model.OrderTypeStop {
+		if cmd.PostOnly != "" {
+			errs = append(errs, schema.FieldError{Field: "post_only", Message: fmt.Sprintf("not valid on %s orders", cmd.OrderType)})
+		}
+		if cmd.DisplayQty.IsPositive() {
+			errs = append(errs, schema.FieldError{Field: "display_qty", Message: fmt.Sprintf("not valid on %s orders", cmd.OrderType)})
+		}
+	}
+	// The gateway prices a market order at its protection price beyond the
+	// last trade, so one without a price has nothing to reserve against.
+	if cmd.OrderType == model.OrderTypeMarket && !cmd.Price.IsPositive() {
+		errs = append(errs, schema.FieldError{Field: "price", Message: "required for MARKET orders on an instrument with no reference price"})
+	}
+	if cmd.PostOnly != "" && !cmd.Price.IsPositive() {
+		errs = append(errs, schema.FieldError{Field: "post_only", Message: "requires a limit price"})
+	}
+	if display := cmd.DisplayQty; display.IsPositive() {
+		if display.GreaterThan(qty) {
+			errs = append(errs, schema.FieldError{Field: "display_qty", Message: "must be <= quantity"})
+		}
+		if !display.IsMultipleOf(inst.LotSize) {
+			errs = append(errs, schema.FieldError{Field: "display_qty", Message: fmt.Sprintf("must be a multiple of lot size %s", inst.LotSize)})
+		}
+		if inst.MinQty.IsPositive() && display.LessThan(inst.MinQty) {
+			errs = append(errs, schema.FieldError{Field: "display_qty", Message: fmt.Sprintf("must be >= min qty %s", inst.MinQty)})
+		}
+	}
+	errs = append(errs, validateAlgo(cmd)...)
+	return append(errs, m.validateLegs(cmd)...)
+}
+
+// validateAlgo checks an algo parent. Its children are LIMIT orders at its
+// price, so it needs one, and it cannot also be a stop or a linked order.
+func validateAlgo(cmd model.OrderCommand) schema.Errors {
+	if cmd.Algo == nil {
+		return nil
+	}
+	var errs schema.Errors
+	if cmd.OrderType != "" && cmd.OrderType != model.OrderTypeLimit {
+		errs = append(errs, schema.FieldError{Field: "order_type", Message: fmt.Sprintf("%s orders must be LIMIT", cmd.Algo.Type)})
+	}
+	if !cmd.Price.IsPositive() {
+		errs = append(errs, schema.FieldError{Field: "price", Message: fmt.Sprintf("required for %s orders", cmd.Algo.Type)})
+	}
+	if cmd.ContingencyType != "" || cmd.ParentOrderID != "" {
+		errs = append(errs, schema.FieldError{Field: "algo", Message: "not valid on linked orders"})
+	}
+	if cmd.PostOnly != "" || cmd.DisplayQty.IsPositive() {
+		errs = append(errs, schema.FieldError{Field: "algo", Message: "not valid with post_only or display_qty"})
+	}
+	start := cmd.Algo.StartTime
+	if start.IsZero() {
+		start = cmd.Timestamp
+	}
+	if end := cmd.Algo.EndTime; end.IsZero() {
+		if cmd.Algo.Type != model.AlgoPOV {
+			errs = append(errs, schema.FieldError{Field: "algo.end_time", Message: fmt.Sprintf("required for %s orders", cmd.Algo.Type)})
+		}
+	} else if !end.After(start) {
+		errs = append(errs, schema.FieldError{Field: "algo.end_time", Message: "must be after the start time"})
+	}
+
+	a := cmd.Algo
+	if a.Type == model.AlgoPOV {
+		hundred := decimal.FromInt(100)
+		pct := a.ParticipationPct
+		if !pct.IsPositive() || pct.GreaterThan(hundred) {
+			errs = append(errs, schema.FieldError{Field: "algo.participation_pct", Message: "must be above 0 and at most 100"})
+		}
+		if a.MinPct.GreaterThan(pct) {
+			errs = append(errs, schema.FieldError{Field: "algo.min_pct", Message: "must be <= participation_pct"})
+		}
+		if a.MaxPct.IsPositive() && (a.MaxPct.LessThan(pct) || a.MaxPct.GreaterThan(hundred)) {
+			errs = append(errs, schema.FieldError{Field: "algo.max_pct", Message: "must be between participation_pct and 100"})
+		}
+	} else if a.ParticipationPct.IsPositive() || a.MinPct.IsPositive() || a.MaxPct.IsPositive() {
+		errs = append(errs, schema.FieldError{Field: "algo.participation_pct", Message: "only valid on POV orders"})
+	}
+	if a.Type != model.AlgoIS && a.Urgency.IsPositive() {
+		errs = append(errs, schema.FieldError{Field: "algo.urgency", Message: "only valid on IS orders"})
+	}
+	return errs
+}
+
+// validateLegs checks the legs of an OCO or bracket, each as an order of its
+// own. STOP legs must already carry their protection price.
+func (m *Master) validateLegs(cmd model.OrderCommand) schema.Errors {
+	if cmd.ContingencyType == "" {
+		if len(cmd.Legs) > 0 {
+			return schema.Errors{{Field: "legs", Message: "only valid on OCO and BRACKET orders"}}
+		}
+		return nil
+	}
+	if len(cmd.Legs) != 2 {
+		return schema.Errors{{Field: "legs", Message: fmt.Sprintf("%s orders need exactly 2 legs", cmd.ContingencyType)}}
+	}
+
+	var errs schema.Errors
+	switch cmd.ContingencyType {
+	case model.ContingencyOCO:
+		if cmd.OrderType != "" || cmd.StopPrice.IsPositive() {
+			errs = append(errs, schema.FieldError{Field: "order_type", Message: "not valid on OCO orders, set it on the legs"})
+		}
+	case model.ContingencyBracket:
+		stops := 0
+		for _, leg := range cmd.Legs {
+			if leg.OrderType == model.OrderTypeStop || leg.OrderType == model.OrderTypeStopLimit {
+				stops++
+			}
+		}
+		if stops != 1 {
+			errs = append(errs, schema.FieldError{Field: "legs", Message: "need one LIMIT take-profit and one STOP or STOP_LIMIT stop-loss"})
+		}
+	}
+	if cmd.Legs[0].OrderID == cmd.Legs[1].OrderID || cmd.Legs[0].OrderID == cmd.OrderID || cmd.Legs[1].OrderID == cmd.OrderID {
+		errs = append(errs, schema.FieldError{Field: "legs", Message: "leg order IDs must be unique"})
+	}
+	for i := range cmd.Legs {
+		for _, e := range m.ValidateOrder(cmd.LegCommand(i, cmd.QuantityVal)) {
+			e.Field = fmt.Sprintf("legs[%d].%s", i, e.Field)
+			errs = append(errs, e)
+		}
+	}
+	return errs
+}
+
+// RoundPrice rounds a price to the nearest tick.
+func (i Instrument) RoundPrice(px decimal.Decimal) decimal.Decimal {
+	return px.RoundStep(i.TickSize)
+}
+
+// PriceFromFloat converts a simulated float price to a valid tick price.
+func (i Instrument) PriceFromFloat(px float64) decimal.Decimal {
+	return i.RoundPrice(decimal.FromFloat(px))
+}
+
+// RoundQty rounds a quantity down to a whole number of lots.
+func (i Instrument) RoundQty(qty decimal.Decimal) decimal.Decimal {
+	return qty.FloorStep(i.LotSize)
+}
+
+// Notional is qty * px in the quote asset. It is deliberately not rounded:
+// with qty on the lot grid and px on the tick grid the product fits in
+// decimal.Places exactly, so reservations, fills and refunds net to zero.
+// An order too large for a Decimal returns decimal.ErrOverflow.
+func (i Instrument) Notional(qty, px decimal.Decimal) (decimal.Decimal, error) {
+	return qty.MulChecked(px)
+}
+
+// Marginable reports whether the symbol can be traded on margin.
+func (i Instrument) Marginable() bool {
+	return i.InitialMarginPct.IsPositive()
+}
+
+// MarginReq is the margin pct percent of a position of qty, long or short,
+// marked at px requires.
+func (i Instrument) MarginReq(qty, px, pct decimal.Decimal) decimal.Decimal {
+	return qty.Abs().Mul(px).Mul(pct).Div(decimal.FromInt(100))
+}
+
+// ProtectionPrice is the worst price a market order may fill at: pct percent
+// through ref in the order's direction, on the tick grid. It is also the
+// price its reservation is made at.
+func (i Instrument) ProtectionPrice(side model.OrderSide, ref, pct decimal.Decimal) decimal.Decimal {
+	offset := ref.Mul(pct).Div(decimal.FromInt(100))
+	if side == model.OrderSideBuy {
+		return ref.Add(offset).CeilStep(i.TickSize)
+	}
+	return ref.Sub(offset).FloorStep(i.TickSize)
+}
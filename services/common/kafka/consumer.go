@@ -48,3 +48,15 @@ func (c *Consumer) Consume(ctx context.Context, handler func(ctx context.Context
 func (c *Consumer) Close() error {
 	return c.reader.Close()
 }
+
+// Fetch returns the next message without committing it, for handlers that
+// commit on their own schedule with Commit. Consume does both.
+func (c *Consumer) Fetch(ctx context.Context) (Message, error) {
+	return c.reader.FetchMessage(ctx)
+}
+
+// Commit marks msgs, and everything before them on their partitions, as
+// handled.
+func (c *Consumer) Commit(ctx context.Context, msgs ...Message) error {
+	return c.reader.CommitMessages(ctx, msgs...)
+}
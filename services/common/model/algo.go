@@ -0,0 +1,58 @@
+package model
+
+import (
+	"time"
+
+	"github.com/atlas/services/common/decimal"
+)
+
+type AlgoType string
+
+const (
+	AlgoTWAP AlgoType = "TWAP" // evenly over the window
+	AlgoVWAP AlgoType = "VWAP" // in proportion to the symbol's usual traded volume
+	AlgoPOV  AlgoType = "POV"  // a share of the volume traded while it works
+	AlgoIS   AlgoType = "IS"   // implementation shortfall: faster as the price moves away from arrival
+)
+
+// AlgoParams are the parameters of an algo parent order.
+type AlgoParams struct {
+	Type      AlgoType  `json:"type"`
+	StartTime time.Time `json:"start_time,omitzero"` // on arrival if unset
+	// EndTime is required except for POV, which runs until filled if unset.
+	EndTime time.Time `json:"end_time,omitzero"`
+	// SliceSecs is how often a child order is sent; 10 if unset.
+	SliceSecs int `json:"slice_secs,omitempty"`
+
+	// POV: the target share of traded volume, in percent. Below MinPct the
+	// children cross at the limit and catch up at MaxPct (ParticipationPct
+	// if unset), the largest share of the volume it ever commits.
+	ParticipationPct decimal.Decimal `json:"participation_pct,omitzero"`
+	MinPct           decimal.Decimal `json:"min_pct,omitzero"`
+	MaxPct           decimal.Decimal `json:"max_pct,omitzero"`
+
+	// IS: how much faster than linear it trades per percent the price has
+	// moved against it since arrival; 1 if unset.
+	Urgency decimal.Decimal `json:"urgency,omitzero"`
+}
+
+// SliceInterval is the time between child orders.
+func (a AlgoParams) SliceInterval() time.Duration {
+	if a.SliceSecs <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(a.SliceSecs) * time.Second
+}
+
+// SlippageBps is how much worse than arrival an order filled on average, in
+// basis points: positive when a buy paid more or a sell got less.
+func SlippageBps(side OrderSide, avgPx, arrivalPx decimal.Decimal) decimal.Decimal {
+	if !arrivalPx.IsPositive() || !avgPx.IsPositive() {
+		return decimal.Zero
+	}
+	diff := avgPx.Sub(arrivalPx)
+	if side == OrderSideSell {
+		diff = diff.Neg()
+	}
+	return diff.Mul(decimal.FromInt(10000)).Div(arrivalPx).Round(2)
+}
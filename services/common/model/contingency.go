@@ -0,0 +1,82 @@
+package model
+
+import "github.com/atlas/services/common/decimal"
+
+// ContingencyType links orders so that what happens to one drives the others.
+type ContingencyType string
+
+const (
+	// ContingencyOCO: the command is a container for two legs on its side;
+	// a fill on one cancels the other.
+	ContingencyOCO ContingencyType = "OCO"
+	// ContingencyBracket: the command is an entry order and its legs are a
+	// take-profit and a stop-loss on the other side, placed as an OCO once
+	// the entry has filled.
+	ContingencyBracket ContingencyType = "BRACKET"
+)
+
+// OrderLeg is one linked order of an OCO or bracket. It trades the command's
+// symbol and quantity; a bracket's exits trade only what the entry filled.
+type OrderLeg struct {
+	OrderID   string          `json:"order_id"`
+	OrderType OrderType       `json:"order_type"`
+	Price     decimal.Decimal `json:"price,omitzero"`
+	StopPrice decimal.Decimal `json:"stop_price,omitzero"`
+}
+
+// LegGroupID is the ID of the OCO container the command's legs belong to:
+// the command itself for an OCO, a derived ID for a bracket's exits.
+func (c OrderCommand) LegGroupID() string {
+	if c.ContingencyType == ContingencyBracket {
+		return c.OrderID + "-EXITS"
+	}
+	return c.OrderID
+}
+
+// LegSide is the side the command's legs trade.
+func (c OrderCommand) LegSide() OrderSide {
+	if c.ContingencyType != ContingencyBracket {
+		return c.Side
+	}
+	if c.Side == OrderSideBuy {
+		return OrderSideSell
+	}
+	return OrderSideBuy
+}
+
+// WorstLegPx is the least favorable price any leg may trade at, which the
+// legs' shared reservation is made at. STOP legs count at their protection
+// price, so it must be set first.
+func (c OrderCommand) WorstLegPx() decimal.Decimal {
+	var worst decimal.Decimal
+	for i, leg := range c.Legs {
+		if i == 0 ||
+			(c.LegSide() == OrderSideBuy && leg.Price.GreaterThan(worst)) ||
+			(c.LegSide() == OrderSideSell && leg.Price.LessThan(worst)) {
+			worst = leg.Price
+		}
+	}
+	return worst
+}
+
+// LegCommand is leg i as a NEW order of its own for qty.
+func (c OrderCommand) LegCommand(i int, qty decimal.Decimal) OrderCommand {
+	leg := c.Legs[i]
+	return OrderCommand{
+		CommandID:     c.CommandID,
+		Type:          CommandTypeNew,
+		OrderID:       leg.OrderID,
+		ClientID:      c.ClientID,
+		Symbol:        c.Symbol,
+		Side:          c.LegSide(),
+		OrderType:     leg.OrderType,
+		QuantityVal:   qty,
+		Price:         leg.Price,
+		StopPrice:     leg.StopPrice,
+		STPMode:       c.STPMode,
+		ParentOrderID: c.LegGroupID(),
+		ReservePx:     c.ReservationPx(),
+		FeeTier:       c.FeeTier,
+		Timestamp:     c.Timestamp,
+	}
+}
@@ -1,6 +1,10 @@
 package model
 
-import "time"
+import (
+	"time"
+
+	"github.com/atlas/services/common/decimal"
+)
 
 type OrderType string
 type OrderSide string
@@ -8,16 +12,22 @@ type OrderStatus string
 type CommandType string
 
 const (
-	OrderTypeLimit  OrderType = "LIMIT"
-	OrderTypeMarket OrderType = "MARKET"
+	OrderTypeLimit     OrderType = "LIMIT"
+	OrderTypeMarket    OrderType = "MARKET"
+	OrderTypeStop      OrderType = "STOP"       // becomes MARKET when triggered
+	OrderTypeStopLimit OrderType = "STOP_LIMIT" // becomes LIMIT when triggered
 
 	OrderSideBuy  OrderSide = "BUY"
 	OrderSideSell OrderSide = "SELL"
 
 	OrderStatusNew             OrderStatus = "NEW"
+	OrderStatusPendingTrigger  OrderStatus = "PENDING_TRIGGER" // stop held by oms-core
+	OrderStatusPendingParent   OrderStatus = "PENDING_PARENT"  // bracket exits waiting for the entry
+	OrderStatusTriggered       OrderStatus = "TRIGGERED"
 	OrderStatusPendingSubmit   OrderStatus = "PENDING_SUBMIT"
 	OrderStatusLive            OrderStatus = "LIVE"
 	OrderStatusPartiallyFilled OrderStatus = "PARTIALLY_FILLED"
+	OrderStatusPaused          OrderStatus = "PAUSED" // algo parent not sending children
 	OrderStatusFilled          OrderStatus = "FILLED"
 	OrderStatusCancelPending   OrderStatus = "CANCEL_PENDING"
 	OrderStatusCanceled        OrderStatus = "CANCELED"
@@ -27,37 +37,126 @@ const (
 	CommandTypeNew     CommandType = "NEW"
 	CommandTypeCancel  CommandType = "CANCEL"
 	CommandTypeReplace CommandType = "REPLACE"
+	CommandTypePause   CommandType = "PAUSE"  // algo parents only
+	CommandTypeResume  CommandType = "RESUME" // algo parents only
+)
+
+// VenueSmart as a command's venue has oms-core split the order across venues.
+const VenueSmart = "SMART"
+
+// STPMode is what the venue does when an order would trade against a resting
+// order from the same client.
+type STPMode string
+
+const (
+	STPCancelNewest       STPMode = "CANCEL_NEWEST"        // cancel the incoming order
+	STPCancelOldest       STPMode = "CANCEL_OLDEST"        // cancel the resting order
+	STPCancelBoth         STPMode = "CANCEL_BOTH"          // cancel both
+	STPDecrementAndCancel STPMode = "DECREMENT_AND_CANCEL" // reduce both by the smaller quantity
+)
+
+// PostOnly is what the venue does with a post-only order that would take
+// liquidity on arrival.
+type PostOnly string
+
+const (
+	PostOnlyReject  PostOnly = "REJECT"  // reject the order
+	PostOnlyReprice PostOnly = "REPRICE" // move it one tick behind the best opposite price
+)
+
+// Liquidity is whether a fill added liquidity to the book (maker) or took it
+// (taker).
+type Liquidity string
+
+const (
+	LiquidityAdded   Liquidity = "ADDED"
+	LiquidityRemoved Liquidity = "REMOVED"
 )
 
 type OrderCommand struct {
-	CommandID   string      `json:"command_id"`
-	Type        CommandType `json:"type"`
-	OrderID     string      `json:"order_id"`
-	ClientID    string      `json:"client_id"`
-	Symbol      string      `json:"symbol,omitempty"`
-	Side        OrderSide   `json:"side,omitempty"`
-	QuantityVal float64     `json:"quantity,omitempty"`
-	Price       float64     `json:"price,omitempty"`
-	Timestamp   time.Time   `json:"timestamp"`
+	CommandID   string          `json:"command_id"`
+	Type        CommandType     `json:"type"`
+	OrderID     string          `json:"order_id"`
+	ClientID    string          `json:"client_id"`
+	Symbol      string          `json:"symbol,omitempty"`
+	Side        OrderSide       `json:"side,omitempty"`
+	OrderType   OrderType       `json:"order_type,omitempty"` // LIMIT if empty
+	QuantityVal decimal.Decimal `json:"quantity,omitzero"`
+	// Price is the limit price. On MARKET and STOP orders it is the
+	// protection price: the worst price the order may fill at.
+	Price     decimal.Decimal `json:"price,omitzero"`
+	StopPrice decimal.Decimal `json:"stop_price,omitzero"` // STOP and STOP_LIMIT trigger
+	STPMode   STPMode         `json:"stp_mode,omitempty"`  // venue default if empty
+	PostOnly  PostOnly        `json:"post_only,omitempty"`
+	// DisplayQty makes the order an iceberg: only this much is shown at a
+	// time, replenished from the rest.
+	DisplayQty decimal.Decimal `json:"display_qty,omitzero"`
+	// ContingencyType and Legs link orders; see OrderLeg.
+	ContingencyType ContingencyType `json:"contingency_type,omitempty"`
+	Legs            []OrderLeg      `json:"legs,omitempty"`
+	// ParentOrderID is set by oms-core on the orders it creates for legs.
+	ParentOrderID string `json:"parent_order_id,omitempty"`
+	// ReservePx is the price the order's reservation was made at, when that
+	// is not Price: legs share their group's reservation.
+	ReservePx decimal.Decimal `json:"reserve_px,omitzero"`
+	// Algo makes the order an algo parent, worked by oms-core through child
+	// orders that never trade beyond its limit Price.
+	Algo *AlgoParams `json:"algo,omitempty"`
+	// Venue is where the order goes: a venue ID, VenueSmart to split it
+	// across venues, or empty for the default venue.
+	Venue string `json:"venue,omitempty"`
+	// FeeTier is the account tier the venue charges fees at, set by the
+	// gateway.
+	FeeTier   string    `json:"fee_tier,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ReservationPx is the price the order's reservation was made at.
+func (c OrderCommand) ReservationPx() decimal.Decimal {
+	if c.ReservePx.IsPositive() {
+		return c.ReservePx
+	}
+	return c.Price
 }
 
 type ExecutionReport struct {
-	ExecID    string      `json:"exec_id"`
-	OrderID   string      `json:"order_id"`
-	ClientID  string      `json:"client_id,omitempty"`
-	Symbol    string      `json:"symbol,omitempty"`
-	Side      OrderSide   `json:"side,omitempty"`
-	OrderQty  float64     `json:"order_qty,omitempty"`
-	Price     float64     `json:"price,omitempty"`
-	Type      string      `json:"type"` // NEW, CANCELED, REPLACED, REJECTED, TRADE, STATUS
-	Status    OrderStatus `json:"status"`
-	LastQty   float64     `json:"last_qty,omitempty"`
-	LastPx    float64     `json:"last_px,omitempty"`
-	LeavesQty float64     `json:"leaves_qty"`
-	CumQty    float64     `json:"cum_qty"`
-	AvgPx     float64     `json:"avg_px"`
-	Timestamp time.Time   `json:"timestamp"`
-	Reason    string      `json:"reason,omitempty"`
+	ExecID    string          `json:"exec_id"`
+	OrderID   string          `json:"order_id"`
+	ClientID  string          `json:"client_id,omitempty"`
+	Symbol    string          `json:"symbol,omitempty"`
+	Side      OrderSide       `json:"side,omitempty"`
+	OrderQty  decimal.Decimal `json:"order_qty,omitzero"`
+	Price     decimal.Decimal `json:"price,omitzero"`
+	Type      string          `json:"type"` // NEW, TRIGGERED, CANCELED, REPLACED, RESTATED, REJECTED, TRADE, STATUS
+	Status    OrderStatus     `json:"status"`
+	LastQty   decimal.Decimal `json:"last_qty,omitzero"`
+	LastPx    decimal.Decimal `json:"last_px,omitzero"`
+	LeavesQty decimal.Decimal `json:"leaves_qty"`
+	CumQty    decimal.Decimal `json:"cum_qty"`
+	AvgPx     decimal.Decimal `json:"avg_px"`
+	// CanceledQty is quantity taken off a working order without trading,
+	// on RESTATED reports.
+	CanceledQty decimal.Decimal `json:"canceled_qty,omitzero"`
+	// BookPx is the price the order works at when the venue moved it from
+	// its limit, e.g. a repriced post-only order.
+	BookPx decimal.Decimal `json:"book_px,omitzero"`
+	// Linked order fields, copied from the order's command.
+	ParentOrderID   string          `json:"parent_order_id,omitempty"`
+	ContingencyType ContingencyType `json:"contingency_type,omitempty"`
+	ReservePx       decimal.Decimal `json:"reserve_px,omitzero"`
+	// Venue is where the order works; empty for orders held in oms-core.
+	Venue string `json:"venue,omitempty"`
+	// TRADE reports: whether the fill added or removed liquidity, and the
+	// fee charged on it in FeeAsset. A negative fee is a rebate.
+	Liquidity Liquidity       `json:"liquidity,omitempty"`
+	Fee       decimal.Decimal `json:"fee,omitzero"`
+	FeeAsset  string          `json:"fee_asset,omitempty"`
+	// Algo parents: the market when the parent arrived, and how much worse
+	// than it the children have filled on average, in basis points.
+	ArrivalPx   decimal.Decimal `json:"arrival_px,omitzero"`
+	SlippageBps decimal.Decimal `json:"slippage_bps,omitzero"`
+	Timestamp   time.Time       `json:"timestamp"`
+	Reason      string          `json:"reason,omitempty"`
 }
 
 type OrderEvent struct {
@@ -69,10 +168,27 @@ type OrderEvent struct {
 }
 
 type RiskDecision struct {
-	DecisionID string `json:"decision_id"`
-	OrderID    string `json:"order_id"`
-	Decision   string `json:"decision"` // APPROVED, REJECTED
-	Reason     string `json:"reason,omitempty"`
+	DecisionID    string       `json:"decision_id"`
+	OrderID       string       `json:"order_id"`
+	Decision      string       `json:"decision"` // APPROVED, REJECTED
+	Reason        string       `json:"reason,omitempty"`
+	ReasonCode    string       `json:"reason_code,omitempty"` // machine-readable, e.g. PRICE_BAND
+	PolicyVersion string       `json:"policy_version,omitempty"`
+	Trace         []RuleResult `json:"trace,omitempty"`
+	Timestamp     time.Time    `json:"timestamp"`
+}
+
+// RuleResult is one policy rule's outcome in a RiskDecision trace. Inputs
+// holds the value of every variable the rule read.
+type RuleResult struct {
+	Policy     string                 `json:"policy"`
+	Version    int                    `json:"version"`
+	RuleID     string                 `json:"rule_id"`
+	Expression string                 `json:"expression"`
+	Action     string                 `json:"action"`
+	Matched    bool                   `json:"matched"`
+	Inputs     map[string]interface{} `json:"inputs,omitempty"`
+	Error      string                 `json:"error,omitempty"`
 }
 
 type MarketDataType string
@@ -88,6 +204,7 @@ type MarketDataUpdate struct {
 	Bids      []PriceLevel   `json:"bids,omitempty"`
 	Asks      []PriceLevel   `json:"asks,omitempty"`
 	Trade     *TradeInfo     `json:"trade,omitempty"`
+	Venue     string         `json:"venue,omitempty"`
 	Timestamp time.Time      `json:"timestamp"`
 }
 
@@ -102,13 +219,96 @@ type TradeInfo struct {
 	Side  string  `json:"side"` // BUY/SELL (taker side)
 }
 
+// Position is an account's holding in one symbol and its P&L in the quote
+// asset, under one cost method. Qty is negative when short.
+type Position struct {
+	AccountID     string          `json:"account_id"`
+	Symbol        string          `json:"symbol"`
+	Method        string          `json:"method"` // FIFO, AVG_COST
+	Qty           decimal.Decimal `json:"qty"`
+	AvgCost       decimal.Decimal `json:"avg_cost"` // per unit of the open qty
+	MarkPx        decimal.Decimal `json:"mark_px,omitzero"`
+	RealizedPnL   decimal.Decimal `json:"realized_pnl"`
+	UnrealizedPnL decimal.Decimal `json:"unrealized_pnl"`
+	Fees          decimal.Decimal `json:"fees"`        // paid, less rebates
+	BorrowFees    decimal.Decimal `json:"borrow_fees"` // accrued on shorts
+	NetPnL        decimal.Decimal `json:"net_pnl"`     // realized + unrealized - fees - borrow fees
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
+
 type Balance struct {
-	Available float64 `json:"available"`
-	Reserved  float64 `json:"reserved"`
+	Available decimal.Decimal `json:"available"`
+	Reserved  decimal.Decimal `json:"reserved"`
 }
 
 type Account struct {
-	USD          Balance         `json:"usd"`
-	BTC          Balance         `json:"btc"`
-	ProcessedIds map[string]bool `json:"-"` // Internal use for idempotency
+	Tier       string        `json:"tier,omitempty"`
+	USD        Balance       `json:"usd"`
+	BTC        Balance       `json:"btc"`
+	KillSwitch *KillSwitch   `json:"kill_switch,omitempty"`
+	Margin     *MarginStatus `json:"margin,omitempty"` // margin accounts only
+	// Locates is the quantity located per asset: how far short the account
+	// may sell it.
+	Locates      map[string]decimal.Decimal `json:"locates,omitempty"`
+	ProcessedIds map[string]bool            `json:"-"` // Internal use for idempotency
+}
+
+// KillSwitch blocks new orders for an account while engaged. Actor is who
+// last changed it: "self" or "admin".
+type KillSwitch struct {
+	Engaged   bool      `json:"engaged"`
+	Reason    string    `json:"reason,omitempty"`
+	Actor     string    `json:"actor,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// MarginState is where a margin account's equity stands against its
+// requirements.
+type MarginState string
+
+const (
+	MarginStateOK          MarginState = "OK"
+	MarginStateCall        MarginState = "MARGIN_CALL" // below initial margin
+	MarginStateLiquidating MarginState = "LIQUIDATING" // below maintenance margin
+)
+
+// MarginStatus is a margin account's equity and requirements in USD, with
+// its BTC balance marked at MarkPx. A negative total balance is borrowed.
+type MarginStatus struct {
+	State          MarginState     `json:"state"`
+	Equity         decimal.Decimal `json:"equity"`
+	Exposure       decimal.Decimal `json:"exposure"` // |BTC| * mark
+	InitialReq     decimal.Decimal `json:"initial_req"`
+	MaintenanceReq decimal.Decimal `json:"maintenance_req"`
+	BorrowedUSD    decimal.Decimal `json:"borrowed_usd"`
+	BorrowedBTC    decimal.Decimal `json:"borrowed_btc"`
+	MarkPx         decimal.Decimal `json:"mark_px"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+const (
+	AuditKillSwitchEngaged   = "KILL_SWITCH_ENGAGED"
+	AuditKillSwitchReleased  = "KILL_SWITCH_RELEASED"
+	AuditMassCancel          = "MASS_CANCEL"
+	AuditMarginEnabled       = "MARGIN_ENABLED"
+	AuditMarginDisabled      = "MARGIN_DISABLED"
+	AuditMarginCall          = "MARGIN_CALL"
+	AuditMarginCallCleared   = "MARGIN_CALL_CLEARED"
+	AuditLiquidationStarted  = "LIQUIDATION_STARTED"
+	AuditLiquidationOrder    = "LIQUIDATION_ORDER"
+	AuditLiquidationComplete = "LIQUIDATION_COMPLETED"
+	AuditLocateGranted       = "LOCATE_GRANTED"
+	AuditLocateReturned      = "LOCATE_RETURNED"
+)
+
+// AuditEvent records an operator or account action that is not itself an
+// order command, e.g. engaging a kill switch.
+type AuditEvent struct {
+	EventID   string                 `json:"event_id"`
+	Type      string                 `json:"type"`
+	AccountID string                 `json:"account_id"`
+	Actor     string                 `json:"actor"` // self, admin, system
+	Reason    string                 `json:"reason,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	Timestamp time.Time              `json:"timestamp"`
 }
@@ -0,0 +1,319 @@
+// Package schema validates messages against the JSON Schemas in the
+// repository's schemas/ directory.
+//
+// Only the subset of draft-07 those files use is supported: type, enum,
+// const, required, properties, additionalProperties, items, format
+// (date-time), minimum/exclusiveMinimum, minLength and if/then/else.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/atlas/services/common/config"
+)
+
+// Schema names, matching the file names under schemas/.
+const (
+	OrderCommand    = "order_command"
+	ExecutionReport = "execution_report"
+	OrderEvent      = "order_event"
+	RiskDecision    = "risk_decision"
+	AuditEvent      = "audit_event"
+)
+
+// Dir returns the schemas directory, ATLAS_SCHEMA_DIR if set.
+func Dir() string {
+	return config.RepoPath("ATLAS_SCHEMA_DIR", "schemas")
+}
+
+// Schema is a parsed JSON Schema node.
+type Schema struct {
+	Title                string             `json:"title,omitempty"`
+	Type                 TypeList           `json:"type,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Const                interface{}        `json:"const,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	If                   *Schema            `json:"if,omitempty"`
+	Then                 *Schema            `json:"then,omitempty"`
+	Else                 *Schema            `json:"else,omitempty"`
+}
+
+// TypeList accepts both "type": "string" and "type": ["string", "null"].
+type TypeList []string
+
+func (t *TypeList) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*t = TypeList{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*t = many
+	return nil
+}
+
+// FieldError describes one violation. Field is a dotted path into the
+// document, e.g. "payload.quantity" or "bids[0].price"; it is empty for
+// problems with the document as a whole.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return e.Field + ": " + e.Message
+}
+
+// Errors joins field errors for logging.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Registry holds the schemas loaded from a directory, keyed by file name
+// without the .json extension.
+type Registry struct {
+	schemas map[string]*Schema
+}
+
+// Load parses every *.json file in dir.
+func Load(dir string) (*Registry, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no schemas found in %s", dir)
+	}
+
+	r := &Registry{schemas: make(map[string]*Schema)}
+	for _, path := range paths {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var s Schema
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		r.schemas[strings.TrimSuffix(filepath.Base(path), ".json")] = &s
+	}
+	return r, nil
+}
+
+// Get returns the named schema, or nil if it was not loaded.
+func (r *Registry) Get(name string) *Schema {
+	return r.schemas[name]
+}
+
+// ValidateJSON decodes raw and validates it against the named schema.
+func (r *Registry) ValidateJSON(name string, raw []byte) Errors {
+	doc, err := Decode(raw)
+	if err != nil {
+		return Errors{{Message: fmt.Sprintf("invalid JSON: %v", err)}}
+	}
+	return r.Validate(name, doc)
+}
+
+// Validate checks an already decoded document (see Decode) against the
+// named schema.
+func (r *Registry) Validate(name string, doc interface{}) Errors {
+	s, ok := r.schemas[name]
+	if !ok {
+		return Errors{{Message: fmt.Sprintf("unknown schema %q", name)}}
+	}
+	var errs Errors
+	s.validate("", doc, &errs)
+	return errs
+}
+
+// Decode parses JSON keeping numbers as json.Number, so integers can be told
+// apart from numbers with a fractional part.
+func Decode(raw []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (s *Schema) validate(path string, v interface{}, errs *Errors) {
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, FieldError{Field: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(s.Type) > 0 && !s.Type.matches(v) {
+		fail("must be of type %s", strings.Join(s.Type, " or "))
+		return
+	}
+
+	if len(s.Enum) > 0 && !containsValue(s.Enum, v) {
+		fail("must be one of %s", formatValues(s.Enum))
+	}
+	if s.Const != nil && !equalValues(s.Const, v) {
+		fail("must be %v", s.Const)
+	}
+
+	switch val := v.(type) {
+	case string:
+		if s.MinLength != nil && len([]rune(val)) < *s.MinLength {
+			fail("must be at least %d characters", *s.MinLength)
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, val); err != nil {
+				fail("must be an RFC 3339 date-time")
+			}
+		}
+
+	case json.Number:
+		f, _ := val.Float64()
+		if s.Minimum != nil && f < *s.Minimum {
+			fail("must be >= %v", *s.Minimum)
+		}
+		if s.ExclusiveMinimum != nil && f <= *s.ExclusiveMinimum {
+			fail("must be > %v", *s.ExclusiveMinimum)
+		}
+
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := val[name]; !ok {
+				*errs = append(*errs, FieldError{Field: join(path, name), Message: "is required"})
+			}
+		}
+		for _, name := range sortedKeys(val) {
+			if prop, ok := s.Properties[name]; ok {
+				prop.validate(join(path, name), val[name], errs)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				*errs = append(*errs, FieldError{Field: join(path, name), Message: "is not allowed"})
+			}
+		}
+
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range val {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, errs)
+			}
+		}
+	}
+
+	if s.If != nil {
+		var probe Errors
+		s.If.validate(path, v, &probe)
+		if len(probe) == 0 && s.Then != nil {
+			s.Then.validate(path, v, errs)
+		} else if len(probe) > 0 && s.Else != nil {
+			s.Else.validate(path, v, errs)
+		}
+	}
+}
+
+func (t TypeList) matches(v interface{}) bool {
+	for _, typ := range t {
+		switch val := v.(type) {
+		case nil:
+			if typ == "null" {
+				return true
+			}
+		case bool:
+			if typ == "boolean" {
+				return true
+			}
+		case string:
+			if typ == "string" {
+				return true
+			}
+		case json.Number:
+			if typ == "number" {
+				return true
+			}
+			if typ == "integer" {
+				f, err := val.Float64()
+				if err == nil && f == math.Trunc(f) {
+					return true
+				}
+			}
+		case map[string]interface{}:
+			if typ == "object" {
+				return true
+			}
+		case []interface{}:
+			if typ == "array" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsValue(values []interface{}, v interface{}) bool {
+	for _, candidate := range values {
+		if equalValues(candidate, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// equalValues compares a schema literal (decoded without UseNumber) with a
+// document value (decoded with it).
+func equalValues(schemaVal, v interface{}) bool {
+	if n, ok := v.(json.Number); ok {
+		f, err := n.Float64()
+		sf, isNum := schemaVal.(float64)
+		return err == nil && isNum && f == sf
+	}
+	return reflect.DeepEqual(schemaVal, v)
+}
+
+func formatValues(values []interface{}) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprint(v)
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,202 @@
+package schema
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// check validates doc against a schema given as JSON and returns the errors
+// as "field: message" strings.
+func check(t *testing.T, schemaJSON, doc string) []string {
+	t.Helper()
+	var s Schema
+	if err := json.Unmarshal([]byte(schemaJSON), &s); err != nil {
+		t.Fatalf("schema %s: %v", schemaJSON, err)
+	}
+	v, err := Decode([]byte(doc))
+	if err != nil {
+		t.Fatalf("doc %s: %v", doc, err)
+	}
+	var errs Errors
+	s.validate("", v, &errs)
+	out := []string{}
+	for _, e := range errs {
+		out = append(out, e.Error())
+	}
+	return out
+}
+
+type keywordTest struct {
+	schema, doc string
+	want        []string
+}
+
+func runKeywordTests(t *testing.T, tests []keywordTest) {
+	t.Helper()
+	for _, tt := range tests {
+		got := check(t, tt.schema, tt.doc)
+		if tt.want == nil {
+			tt.want = []string{}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s against %s = %q, want %q", tt.doc, tt.schema, got, tt.want)
+		}
+	}
+}
+
+func TestType(t *testing.T) {
+	runKeywordTests(t, []keywordTest{
+		{`{"type":"string"}`, `"a"`, nil},
+		{`{"type":"string"}`, `1`, []string{"must be of type string"}},
+		{`{"type":"boolean"}`, `false`, nil},
+		{`{"type":"boolean"}`, `"false"`, []string{"must be of type boolean"}},
+		{`{"type":"object"}`, `{}`, nil},
+		{`{"type":"object"}`, `[]`, []string{"must be of type object"}},
+		{`{"type":"array"}`, `[]`, nil},
+		{`{"type":"null"}`, `null`, nil},
+		{`{"type":["string","null"]}`, `null`, nil},
+		{`{"type":["string","null"]}`, `1`, []string{"must be of type string or null"}},
+
+		// Integers are numbers without a fractional part, however written.
+		{`{"type":"integer"}`, `3`, nil},
+		{`{"type":"integer"}`, `3.0`, nil},
+		{`{"type":"integer"}`, `3.5`, []string{"must be of type integer"}},
+		{`{"type":"integer"}`, `"3"`, []string{"must be of type integer"}},
+		{`{"type":"number"}`, `3`, nil},
+		{`{"type":"number"}`, `3.5`, nil},
+		{`{"type":"number"}`, `"3.5"`, []string{"must be of type number"}},
+		// A type mismatch stops further checks on the value.
+		{`{"type":"integer","minimum":10}`, `"x"`, []string{"must be of type integer"}},
+	})
+}
+
+func TestEnumAndConst(t *testing.T) {
+	runKeywordTests(t, []keywordTest{
+		{`{"enum":["NEW","CANCEL"]}`, `"NEW"`, nil},
+		{`{"enum":["NEW","CANCEL"]}`, `"AMEND"`, []string{"must be one of [NEW, CANCEL]"}},
+		{`{"enum":[1,2]}`, `2.0`, nil},
+		{`{"enum":[1,2]}`, `3`, []string{"must be one of [1, 2]"}},
+		{`{"enum":["1"]}`, `1`, []string{"must be one of [1]"}},
+		{`{"const":"v1"}`, `"v1"`, nil},
+		{`{"const":"v1"}`, `"v2"`, []string{"must be v1"}},
+		{`{"const":1}`, `1.0`, nil},
+		{`{"const":true}`, `false`, []string{"must be true"}},
+	})
+}
+
+func TestRequiredAndProperties(t *testing.T) {
+	nested := `{
+		"type": "object",
+		"required": ["order_id"],
+		"properties": {
+			"order_id": {"type": "string", "minLength": 1},
+			"payload": {
+				"type": "object",
+				"required": ["quantity"],
+				"additionalProperties": false,
+				"properties": {
+					"quantity": {"type": "number", "exclusiveMinimum": 0},
+					"bids": {"type": "array", "items": {
+						"type": "object",
+						"properties": {"price": {"type": "number", "minimum": 1}}
+					}},
+					"at": {"type": "string", "format": "date-time"}
+				}
+			}
+		}
+	}`
+	runKeywordTests(t, []keywordTest{
+		{nested, `{"order_id":"O1","payload":{"quantity":1}}`, nil},
+		{nested, `{}`, []string{"order_id: is required"}},
+		{nested, `{"order_id":"","payload":{}}`, []string{
+			"order_id: must be at least 1 characters",
+			"payload.quantity: is required",
+		}},
+		{nested, `{"order_id":"O1","payload":{"quantity":0,"side":"BUY"}}`, []string{
+			"payload.quantity: must be > 0",
+			"payload.side: is not allowed",
+		}},
+		{nested, `{"order_id":"O1","payload":{"quantity":1,"bids":[{"price":2},{"price":0.5},{"price":"x"}]}}`, []string{
+			"payload.bids[1].price: must be >= 1",
+			"payload.bids[2].price: must be of type number",
+		}},
+		{nested, `{"order_id":"O1","payload":{"quantity":1,"at":"2026-01-05T09:30:00.123Z"}}`, nil},
+		{nested, `{"order_id":"O1","payload":{"quantity":1,"at":"yesterday"}}`, []string{
+			"payload.at: must be an RFC 3339 date-time",
+		}},
+		// Properties not listed are allowed unless additionalProperties is false.
+		{nested, `{"order_id":"O1","extra":1}`, nil},
+	})
+}
+
+func TestIfThenElse(t *testing.T) {
+	cond := `{
+		"type": "object",
+		"properties": {"type": {"type": "string"}, "quantity": {"type": "number"}},
+		"if": {"properties": {"type": {"const": "NEW"}}},
+		"then": {"required": ["quantity"]},
+		"else": {"required": ["order_id"]}
+	}`
+	thenOnly := `{"if": {"required": ["stop_price"]}, "then": {"properties": {"order_type": {"enum": ["STOP"]}}}}`
+	runKeywordTests(t, []keywordTest{
+		{cond, `{"type":"NEW","quantity":1}`, nil},
+		{cond, `{"type":"NEW"}`, []string{"quantity: is required"}},
+		{cond, `{"type":"CANCEL"}`, []string{"order_id: is required"}},
+		{cond, `{"type":"CANCEL","order_id":"O1"}`, nil},
+		// A failed "if" is not itself an error.
+		{thenOnly, `{"order_type":"LIMIT"}`, nil},
+		{thenOnly, `{"stop_price":1,"order_type":"LIMIT"}`, []string{"order_type: must be one of [STOP]"}},
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "thing.json"), []byte(`{"type":"object","required":["id"]}`), 0o644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte(`not a schema`), 0o644)
+
+	r, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Get("thing") == nil || r.Get("notes") != nil {
+		t.Errorf("Load picked up the wrong files")
+	}
+	tests := []struct {
+		name, raw string
+		want      string
+	}{
+		{"thing", `{"id":1}`, ""},
+		{"thing", `{}`, "id: is required"},
+		{"thing", `{"id":`, "invalid JSON"},
+		{"other", `{}`, `unknown schema "other"`},
+	}
+	for _, tt := range tests {
+		errs := r.ValidateJSON(tt.name, []byte(tt.raw))
+		if tt.want == "" && len(errs) > 0 || tt.want != "" && !strings.Contains(errs.Error(), tt.want) {
+			t.Errorf("ValidateJSON(%s, %s) = %v, want %q", tt.name, tt.raw, errs, tt.want)
+		}
+	}
+
+	if _, err := Load(t.TempDir()); err == nil || !strings.Contains(err.Error(), "no schemas found") {
+		t.Errorf("Load of an empty directory: %v", err)
+	}
+	bad := t.TempDir()
+	os.WriteFile(filepath.Join(bad, "broken.json"), []byte(`{"type":`), 0o644)
+	if _, err := Load(bad); err == nil || !strings.Contains(err.Error(), "broken.json") {
+		t.Errorf("Load of a broken schema: %v", err)
+	}
+}
+
+func TestDir(t *testing.T) {
+	if got := Dir(); got != "../../schemas" {
+		t.Errorf("Dir() = %s, want the repository's schemas", got)
+	}
+	t.Setenv("ATLAS_SCHEMA_DIR", "/etc/atlas/schemas")
+	if got := Dir(); got != "/etc/atlas/schemas" {
+		t.Errorf("Dir() with ATLAS_SCHEMA_DIR = %s", got)
+	}
+}
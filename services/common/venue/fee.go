@@ -0,0 +1,110 @@
+package venue
+
+import (
+	"fmt"
+
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/model"
+)
+
+// Fee assets: what a fill's fee is paid in.
+const (
+	FeeAssetQuote    = "QUOTE"    // always the quote asset
+	FeeAssetReceived = "RECEIVED" // what the fill delivers: base on buys, quote on sells
+)
+
+var bps = decimal.FromInt(10000)
+
+// FeeSchedule is what a venue charges per fill, in basis points of notional.
+// A negative maker fee is a rebate. MinFee, in the quote asset, is the least
+// an order pays in total once it trades; rebates are not raised to it.
+type FeeSchedule struct {
+	MakerBps decimal.Decimal `json:"maker_bps"`
+	TakerBps decimal.Decimal `json:"taker_bps"`
+	MinFee   decimal.Decimal `json:"min_fee,omitzero"`
+	Asset    string          `json:"asset,omitempty"` // FeeAssetQuote if unset
+}
+
+func (s FeeSchedule) check() error {
+	switch s.Asset {
+	case FeeAssetQuote, FeeAssetReceived:
+	default:
+		return fmt.Errorf("unknown fee asset %q", s.Asset)
+	}
+	if s.TakerBps.IsNegative() || s.MinFee.IsNegative() {
+		return fmt.Errorf("taker_bps and min_fee must not be negative")
+	}
+	return nil
+}
+
+// PaysInBase reports whether a fill on the side pays its fee in the base
+// asset.
+func (s FeeSchedule) PaysInBase(side model.OrderSide) bool {
+	return s.Asset == FeeAssetReceived && side == model.OrderSideBuy
+}
+
+// Fee is the fee on a fill of qty at px in the quote asset, given what the
+// order has been charged already, also in the quote asset. A fill that pays
+// in the base asset pays Fee / px.
+func (s FeeSchedule) Fee(liq model.Liquidity, qty, px, charged decimal.Decimal) decimal.Decimal {
+	rate := s.TakerBps
+	if liq == model.LiquidityAdded {
+		rate = s.MakerBps
+	}
+	fee := qty.Mul(px).Mul(rate).Div(bps)
+	if !fee.IsNegative() && charged.Add(fee).LessThan(s.MinFee) {
+		fee = s.MinFee.Sub(charged)
+	}
+	return fee
+}
+
+// TakerPx is what taking at px comes to per unit after the taker fee: more
+// for a buy, less for a sell.
+func (s FeeSchedule) TakerPx(side model.OrderSide, px decimal.Decimal) decimal.Decimal {
+	fee := px.Mul(s.TakerBps).Div(bps)
+	if side == model.OrderSideSell {
+		return px.Sub(fee)
+	}
+	return px.Add(fee)
+}
+
+// Fees returns the venue's schedule for an account tier: the tier's own if it
+// has one, otherwise the venue's.
+func (v Venue) Fees(tier string) FeeSchedule {
+	if s, ok := v.TierFees[tier]; ok {
+		return s
+	}
+	return v.FeeSchedule
+}
+
+// FeeReservePx is the price a NEW order reserves at so that its balance
+// covers the taker fees it can be charged in the quote asset, at every venue
+// it can trade on. Orders that pay no fee up front reserve at their price.
+func (d *Directory) FeeReservePx(cmd model.OrderCommand, tier string) decimal.Decimal {
+	px := cmd.Price
+	if cmd.Side != model.OrderSideBuy || !px.IsPositive() || !cmd.QuantityVal.IsPositive() {
+		return px
+	}
+	var perUnit decimal.Decimal
+	for _, v := range d.candidates(cmd) {
+		s := v.Fees(tier)
+		if s.PaysInBase(cmd.Side) {
+			continue
+		}
+		fee := decimal.Max(px.Mul(s.TakerBps).Div(bps), s.MinFee.Div(cmd.QuantityVal))
+		perUnit = decimal.Max(perUnit, fee)
+	}
+	return px.Add(perUnit)
+}
+
+// candidates are the venues an order can trade on: its own, or all of them
+// when it is smart routed.
+func (d *Directory) candidates(cmd model.OrderCommand) []Venue {
+	if cmd.Venue == model.VenueSmart {
+		return d.venues
+	}
+	if v, ok := d.Get(cmd.Venue); ok {
+		return []Venue{v}
+	}
+	return []Venue{d.Default()}
+}
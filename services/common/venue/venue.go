@@ -0,0 +1,149 @@
+// Package venue is the venue directory: every venue orders can be routed to,
+// with its fee schedule and, for venue-sim, its liquidity profile. It is
+// loaded from config/venues.json.
+package venue
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/atlas/services/common/config"
+	"github.com/atlas/services/common/model"
+	"github.com/atlas/services/common/schema"
+)
+
+// Venue is one venue. Its fee schedule applies to account tiers without one
+// of their own in TierFees.
+type Venue struct {
+	ID          string `json:"venue_id"`
+	Default     bool   `json:"default,omitempty"` // where orders without a venue go
+	FeeSchedule `json:"fees"`
+	TierFees    map[string]FeeSchedule `json:"tier_fees,omitempty"`
+
+	// Liquidity profile of the simulated venue: its quoted spread, a
+	// multiplier on its book sizes, and the chance of a market trade each
+	// second.
+	SpreadBps   float64 `json:"spread_bps"`
+	DepthFactor float64 `json:"depth_factor"`
+	TradeRate   float64 `json:"trade_rate"`
+}
+
+// File returns the venue directory path, ATLAS_VENUES_FILE if set.
+func File() string {
+	return config.RepoPath("ATLAS_VENUES_FILE", "config/venues.json")
+}
+
+// Directory holds every configured venue in file order.
+type Directory struct {
+	venues []Venue
+	byID   map[string]int
+}
+
+// Load reads and checks the venue directory. Without a default venue the
+// first one is the default.
+func Load(path string) (*Directory, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Venue
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("%s: no venues", path)
+	}
+
+	d := &Directory{byID: make(map[string]int, len(list))}
+	defaults := 0
+	for i, v := range list {
+		if v.ID == "" || v.ID == model.VenueSmart {
+			return nil, fmt.Errorf("%s: venue %d needs a venue_id other than %s", path, i, model.VenueSmart)
+		}
+		if _, dup := d.byID[v.ID]; dup {
+			return nil, fmt.Errorf("%s: duplicate venue %s", path, v.ID)
+		}
+		if v.Default {
+			defaults++
+		}
+		if v.DepthFactor <= 0 {
+			list[i].DepthFactor = 1
+		}
+		if v.Asset == "" {
+			list[i].Asset = FeeAssetQuote
+		}
+		if err := list[i].FeeSchedule.check(); err != nil {
+			return nil, fmt.Errorf("%s: venue %s: %w", path, v.ID, err)
+		}
+		for tier, s := range v.TierFees {
+			if s.Asset == "" {
+				s.Asset = FeeAssetQuote
+				list[i].TierFees[tier] = s
+			}
+			if err := s.check(); err != nil {
+				return nil, fmt.Errorf("%s: venue %s tier %s: %w", path, v.ID, tier, err)
+			}
+		}
+		d.byID[v.ID] = i
+	}
+	if defaults > 1 {
+		return nil, fmt.Errorf("%s: more than one default venue", path)
+	}
+	if defaults == 0 {
+		list[0].Default = true
+	}
+	d.venues = list
+	return d, nil
+}
+
+// Get looks up a venue.
+func (d *Directory) Get(id string) (Venue, bool) {
+	i, ok := d.byID[id]
+	if !ok {
+		return Venue{}, false
+	}
+	return d.venues[i], true
+}
+
+// All returns every venue in file order.
+func (d *Directory) All() []Venue {
+	return append([]Venue(nil), d.venues...)
+}
+
+// Default is the venue orders without a venue go to.
+func (d *Directory) Default() Venue {
+	for _, v := range d.venues {
+		if v.Default {
+			return v
+		}
+	}
+	return d.venues[0]
+}
+
+// ValidateOrder checks a NEW command's venue. Errors use the same
+// field-level shape as schema validation.
+func (d *Directory) ValidateOrder(cmd model.OrderCommand) schema.Errors {
+	if cmd.Venue == "" {
+		return nil
+	}
+	if cmd.ContingencyType != "" || cmd.Algo != nil {
+		return schema.Errors{{Field: "venue", Message: "not valid on linked or algo orders"}}
+	}
+	if cmd.Venue != model.VenueSmart {
+		if _, ok := d.Get(cmd.Venue); !ok {
+			return schema.Errors{{Field: "venue", Message: fmt.Sprintf("unknown venue %q", cmd.Venue)}}
+		}
+		return nil
+	}
+
+	var errs schema.Errors
+	if cmd.OrderType != "" && cmd.OrderType != model.OrderTypeLimit && cmd.OrderType != model.OrderTypeMarket {
+		errs = append(errs, schema.FieldError{Field: "venue", Message: fmt.Sprintf("%s orders cannot be smart routed", cmd.OrderType)})
+	}
+	if cmd.PostOnly != "" || cmd.DisplayQty.IsPositive() {
+		errs = append(errs, schema.FieldError{Field: "venue", Message: "smart routed orders cannot be post-only or iceberg"})
+	}
+	return errs
+}
@@ -0,0 +1,162 @@
+// Package algo schedules algo parent orders: how much of a parent should have
+// been sent to the venue by a given time, and what its children have done.
+package algo
+
+import (
+	"time"
+
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/model"
+)
+
+// Child is one child order of a parent.
+type Child struct {
+	OrderID string
+	Px      decimal.Decimal
+	Leaves  decimal.Decimal
+	Cum     decimal.Decimal
+	AvgPx   decimal.Decimal
+	Done    bool
+}
+
+// Parent is an algo parent order being worked.
+type Parent struct {
+	Cmd    model.OrderCommand
+	Paused bool
+	// Canceling stops new children; the parent finishes once the working
+	// ones are done. Reason says why, if not on request.
+	Canceling bool
+	Reason    string
+	// Base was done at From; the rest is spread from From to the end time.
+	// Both move on resume so a pause is not made up in one child.
+	Base     decimal.Decimal
+	From     time.Time
+	Next     time.Time // when the next child is due
+	Children map[string]*Child
+	Seq      int // children sent so far
+
+	ArrivalPx decimal.Decimal // the market when the parent arrived
+	Volume    float64         // traded in the symbol since From, for POV
+}
+
+// NewParent starts a parent. Without algo params it is a smart-routed order,
+// split across venues once on arrival.
+func NewParent(cmd model.OrderCommand) *Parent {
+	from := cmd.Timestamp
+	if cmd.Algo != nil && !cmd.Algo.StartTime.IsZero() {
+		from = cmd.Algo.StartTime
+	}
+	return &Parent{Cmd: cmd, From: from, Next: from, Children: make(map[string]*Child)}
+}
+
+// Cum is the quantity the children filled.
+func (p *Parent) Cum() decimal.Decimal {
+	cum := decimal.Zero
+	for _, c := range p.Children {
+		cum = cum.Add(c.Cum)
+	}
+	return cum
+}
+
+// AvgPx is the average fill price across the children.
+func (p *Parent) AvgPx() decimal.Decimal {
+	cum, notional := decimal.Zero, decimal.Zero
+	for _, c := range p.Children {
+		cum = cum.Add(c.Cum)
+		notional = notional.Add(c.Cum.Mul(c.AvgPx))
+	}
+	if cum.IsZero() {
+		return decimal.Zero
+	}
+	return notional.Div(cum)
+}
+
+// Working is the open quantity of children still at the venue.
+func (p *Parent) Working() decimal.Decimal {
+	working := decimal.Zero
+	for _, c := range p.Children {
+		if !c.Done {
+			working = working.Add(c.Leaves)
+		}
+	}
+	return working
+}
+
+// Open reports whether any child is still working.
+func (p *Parent) Open() bool {
+	for _, c := range p.Children {
+		if !c.Done {
+			return true
+		}
+	}
+	return false
+}
+
+// Committed is what the parent has filled or has working.
+func (p *Parent) Committed() decimal.Decimal {
+	return p.Cum().Add(p.Working())
+}
+
+// Passive returns the children working at a better price than the limit.
+func (p *Parent) Passive() []string {
+	var ids []string
+	for id, c := range p.Children {
+		if !c.Done && !c.Px.Equal(p.Cmd.Price) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Filled reports whether the children filled the whole parent.
+func (p *Parent) Filled() bool {
+	return p.Cum().GreaterThanOrEqual(p.Cmd.QuantityVal)
+}
+
+// Target is how much of the parent should be committed at t.
+func (p *Parent) Target(t time.Time, c Curve) decimal.Decimal {
+	end := p.Cmd.Algo.EndTime
+	if !t.Before(end) {
+		return p.Cmd.QuantityVal
+	}
+	frac := c.Fraction(p.Cmd.Symbol, p.From, t, end)
+	rest := p.Cmd.QuantityVal.Sub(p.Base)
+	return p.Base.Add(rest.Mul(decimal.FromFloat(frac)))
+}
+
+// Apply records a child's exec report. It reports whether the child is known.
+func (p *Parent) Apply(report model.ExecutionReport) bool {
+	c, ok := p.Children[report.OrderID]
+	if !ok {
+		return false
+	}
+	c.Cum = report.CumQty
+	c.AvgPx = report.AvgPx
+	switch report.Status {
+	case model.OrderStatusFilled, model.OrderStatusCanceled, model.OrderStatusRejected:
+		c.Done = true
+		c.Leaves = decimal.Zero
+	default:
+		c.Leaves = report.LeavesQty
+	}
+	return true
+}
+
+// Curve is the share of a window [from, end] that should be done by t.
+type Curve interface {
+	Fraction(symbol string, from, t, end time.Time) float64
+}
+
+// Linear spreads evenly over time: TWAP.
+type Linear struct{}
+
+func (Linear) Fraction(_ string, from, t, end time.Time) float64 {
+	total := end.Sub(from)
+	if total <= 0 || !t.Before(end) {
+		return 1
+	}
+	if !t.After(from) {
+		return 0
+	}
+	return float64(t.Sub(from)) / float64(total)
+}
@@ -0,0 +1,104 @@
+package algo
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/atlas/services/common/model"
+)
+
+var t0 = time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+
+func at(secs float64) time.Time {
+	return t0.Add(time.Duration(secs * float64(time.Second)))
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestLinear(t *testing.T) {
+	end := at(100)
+	tests := []struct {
+		t    time.Time
+		want float64
+	}{
+		{at(-10), 0},
+		{at(0), 0},
+		{at(25), 0.25},
+		{at(99), 0.99},
+		{end, 1},
+		{at(200), 1},
+	}
+	for _, tt := range tests {
+		if got := (Linear{}).Fraction("BTC-USD", t0, tt.t, end); !near(got, tt.want) {
+			t.Errorf("Fraction at %s = %v, want %v", tt.t.Sub(t0), got, tt.want)
+		}
+	}
+	if got := (Linear{}).Fraction("BTC-USD", t0, t0, t0); got != 1 {
+		t.Errorf("Fraction of an empty window = %v, want 1", got)
+	}
+}
+
+func TestTarget(t *testing.T) {
+	p := NewParent(model.OrderCommand{
+		QuantityVal: dec("100"),
+		Timestamp:   t0,
+		Algo:        &model.AlgoParams{Type: model.AlgoTWAP, EndTime: at(100)},
+	})
+	tests := []struct {
+		name string
+		base string
+		from time.Time
+		t    time.Time
+		want string
+	}{
+		{"start", "0", t0, t0, "0"},
+		{"a quarter in", "0", t0, at(25), "25"},
+		{"end", "0", t0, at(100), "100"},
+		// After a resume the rest is spread over what is left of the window.
+		{"resumed", "20", at(50), at(75), "60"},
+	}
+	for _, tt := range tests {
+		p.Base, p.From = dec(tt.base), tt.from
+		if got := p.Target(tt.t, Linear{}); !got.Equal(dec(tt.want)) {
+			t.Errorf("%s: Target = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	p := NewParent(model.OrderCommand{QuantityVal: dec("10"), Price: dec("100")})
+	p.Children["A"] = &Child{OrderID: "A", Px: dec("100"), Leaves: dec("4")}
+	p.Children["B"] = &Child{OrderID: "B", Px: dec("99"), Leaves: dec("6")}
+
+	if p.Apply(model.ExecutionReport{OrderID: "X"}) {
+		t.Errorf("Apply accepted an unknown child")
+	}
+	p.Apply(model.ExecutionReport{OrderID: "A", Status: model.OrderStatusFilled, CumQty: dec("4"), AvgPx: dec("100")})
+	p.Apply(model.ExecutionReport{OrderID: "B", Status: model.OrderStatusPartiallyFilled, CumQty: dec("2"), LeavesQty: dec("4"), AvgPx: dec("97")})
+
+	tests := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"cum", p.Cum().String(), "6"},
+		{"avg px", p.AvgPx().String(), "99"},
+		{"working", p.Working().String(), "4"},
+		{"committed", p.Committed().String(), "10"},
+		{"open", p.Open(), true},
+		{"filled", p.Filled(), false},
+		{"passive", len(p.Passive()), 1},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+
+	p.Apply(model.ExecutionReport{OrderID: "B", Status: model.OrderStatusCanceled, CumQty: dec("2"), AvgPx: dec("97")})
+	if p.Open() || !p.Working().IsZero() {
+		t.Errorf("canceled child still working: open=%v working=%s", p.Open(), p.Working())
+	}
+}
@@ -0,0 +1,39 @@
+package algo
+
+import "github.com/atlas/services/common/decimal"
+
+var hundred = decimal.FromInt(100)
+
+// Behind reports whether a POV parent's fills since From are below its
+// minimum share of the volume traded since.
+func (p *Parent) Behind() bool {
+	floor := p.Cmd.Algo.MinPct
+	if !floor.IsPositive() {
+		return false
+	}
+	return p.Cum().Sub(p.Base).LessThan(p.share(floor))
+}
+
+// Participation is how much of a POV parent should be committed: its target
+// share of the volume traded since From, or its maximum share while it is
+// behind.
+func (p *Parent) Participation() decimal.Decimal {
+	pct := p.Cmd.Algo.ParticipationPct
+	if p.Behind() {
+		pct = p.MaxPct()
+	}
+	return decimal.Min(p.Base.Add(p.share(pct)), p.Cmd.QuantityVal)
+}
+
+// MaxPct is the share a POV parent catches up at while it is behind, and so
+// the most of the volume it commits.
+func (p *Parent) MaxPct() decimal.Decimal {
+	if p.Cmd.Algo.MaxPct.IsPositive() {
+		return p.Cmd.Algo.MaxPct
+	}
+	return p.Cmd.Algo.ParticipationPct
+}
+
+func (p *Parent) share(pct decimal.Decimal) decimal.Decimal {
+	return decimal.FromFloat(p.Volume).Mul(pct).Div(hundred)
+}
@@ -0,0 +1,63 @@
+package algo
+
+import (
+	"testing"
+
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/model"
+)
+
+func dec(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+// povParent is a POV parent for 100 that has filled cum of the volume
+// traded since From.
+func povParent(target, min, max string, base, cum string, volume float64) *Parent {
+	p := NewParent(model.OrderCommand{
+		OrderID:     "P1",
+		QuantityVal: dec("100"),
+		Algo:        &model.AlgoParams{Type: model.AlgoPOV, ParticipationPct: dec(target)},
+	})
+	if min != "" {
+		p.Cmd.Algo.MinPct = dec(min)
+	}
+	if max != "" {
+		p.Cmd.Algo.MaxPct = dec(max)
+	}
+	p.Base = dec(base)
+	p.Volume = volume
+	p.Children["C1"] = &Child{OrderID: "C1", Cum: dec(cum), Done: true}
+	return p
+}
+
+func TestParticipation(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       *Parent
+		behind  bool
+		want    string
+		wantMax string
+	}{
+		{"on target", povParent("10", "5", "20", "0", "20", 200), false, "20", "20"},
+		{"at the minimum", povParent("10", "5", "20", "0", "10", 200), false, "20", "20"},
+		// Below 5% of 200 it catches up at 20%.
+		{"behind", povParent("10", "5", "20", "0", "9", 200), true, "40", "20"},
+		{"no minimum", povParent("10", "", "20", "0", "0", 200), false, "20", "20"},
+		{"catches up at the target without a maximum", povParent("10", "5", "", "0", "0", 200), true, "20", "10"},
+		// Only fills since From count against the volume since From.
+		{"behind since resumed", povParent("10", "5", "20", "30", "35", 200), true, "70", "20"},
+		{"never more than the parent", povParent("10", "5", "20", "0", "0", 5000), true, "100", "20"},
+	}
+	for _, tt := range tests {
+		if got := tt.p.Behind(); got != tt.behind {
+			t.Errorf("%s: Behind = %v, want %v", tt.name, got, tt.behind)
+		}
+		if got := tt.p.Participation(); !got.Equal(dec(tt.want)) {
+			t.Errorf("%s: Participation = %s, want %s", tt.name, got, tt.want)
+		}
+		if got := tt.p.MaxPct(); !got.Equal(dec(tt.wantMax)) {
+			t.Errorf("%s: MaxPct = %s, want %s", tt.name, got, tt.wantMax)
+		}
+	}
+}
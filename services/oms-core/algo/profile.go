@@ -0,0 +1,95 @@
+package algo
+
+import (
+	"sync"
+	"time"
+)
+
+const minutesPerDay = 24 * 60
+
+// Profile is the traded volume per symbol and minute of the day (UTC),
+// learned from market trades. As a Curve it spreads a window in proportion
+// to the volume expected in each minute: VWAP. Minutes without any trades
+// yet count at the symbol's average; without any data it is Linear.
+type Profile struct {
+	mu      sync.Mutex
+	volumes map[string]*[minutesPerDay]float64
+}
+
+func NewProfile() *Profile {
+	return &Profile{volumes: make(map[string]*[minutesPerDay]float64)}
+}
+
+// Record adds a trade to the profile.
+func (p *Profile) Record(symbol string, qty float64, at time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	v, ok := p.volumes[symbol]
+	if !ok {
+		v = new([minutesPerDay]float64)
+		p.volumes[symbol] = v
+	}
+	v[minuteOfDay(at)] += qty
+}
+
+func (p *Profile) Fraction(symbol string, from, t, end time.Time) float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	v, ok := p.volumes[symbol]
+	if !ok {
+		return Linear{}.Fraction(symbol, from, t, end)
+	}
+	if !t.Before(end) {
+		return 1
+	}
+	if !t.After(from) {
+		return 0
+	}
+	avg := average(v)
+	total := expected(v, avg, from, end)
+	if total <= 0 {
+		return Linear{}.Fraction(symbol, from, t, end)
+	}
+	return expected(v, avg, from, t) / total
+}
+
+// expected is the volume expected between from and to, counting partial
+// minutes pro rata.
+func expected(v *[minutesPerDay]float64, avg float64, from, to time.Time) float64 {
+	sum := 0.0
+	for m := from.Truncate(time.Minute); m.Before(to); m = m.Add(time.Minute) {
+		start, stop := m, m.Add(time.Minute)
+		if start.Before(from) {
+			start = from
+		}
+		if stop.After(to) {
+			stop = to
+		}
+		vol := v[minuteOfDay(m)]
+		if vol == 0 {
+			vol = avg
+		}
+		sum += vol * float64(stop.Sub(start)) / float64(time.Minute)
+	}
+	return sum
+}
+
+func average(v *[minutesPerDay]float64) float64 {
+	sum, n := 0.0, 0
+	for _, vol := range v {
+		if vol > 0 {
+			sum += vol
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
+
+func minuteOfDay(t time.Time) int {
+	t = t.UTC()
+	return t.Hour()*60 + t.Minute()
+}
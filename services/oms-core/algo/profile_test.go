@@ -0,0 +1,44 @@
+package algo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProfile(t *testing.T) {
+	p := NewProfile()
+	p.Record("BTC-USD", 4, at(10))
+	p.Record("BTC-USD", 6, at(50))
+	p.Record("BTC-USD", 30, at(60))
+	p.Record("ETH-USD", 100, at(120))
+
+	// 09:00 traded 10 and 09:01 traded 30. 09:02 has no trades yet and
+	// counts at the average of the minutes that do, 20.
+	end := at(180)
+	tests := []struct {
+		name string
+		t    time.Time
+		want float64
+	}{
+		{"start", t0, 0},
+		{"first minute", at(60), 10.0 / 60},
+		{"half the second minute", at(90), 25.0 / 60},
+		{"second minute", at(120), 40.0 / 60},
+		{"end", end, 1},
+	}
+	for _, tt := range tests {
+		if got := p.Fraction("BTC-USD", t0, tt.t, end); !near(got, tt.want) {
+			t.Errorf("%s: Fraction = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// A symbol never traded is spread evenly.
+	if got := p.Fraction("SOL-USD", t0, at(60), end); !near(got, 1.0/3) {
+		t.Errorf("Fraction without data = %v, want linear 1/3", got)
+	}
+	// Minute of day, not time: the same minutes a day later weigh the same.
+	day := 24 * time.Hour
+	if got := p.Fraction("BTC-USD", t0.Add(day), at(60).Add(day), end.Add(day)); !near(got, 10.0/60) {
+		t.Errorf("Fraction a day later = %v, want %v", got, 10.0/60)
+	}
+}
@@ -0,0 +1,49 @@
+package algo
+
+import (
+	"time"
+
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/model"
+)
+
+// Shortfall is the implementation-shortfall schedule: linear while the price
+// is at or better than arrival, faster the further it moves against the
+// order.
+type Shortfall struct {
+	Side      model.OrderSide
+	ArrivalPx decimal.Decimal
+	Mark      decimal.Decimal // the market now
+	Urgency   decimal.Decimal
+}
+
+func (s Shortfall) Fraction(symbol string, from, t, end time.Time) float64 {
+	frac := Linear{}.Fraction(symbol, from, t, end)
+	adverse := AdverseMovePct(s.Side, s.ArrivalPx, s.Mark)
+	if !adverse.IsPositive() {
+		return frac
+	}
+	urgency := s.Urgency
+	if !urgency.IsPositive() {
+		urgency = decimal.FromInt(1)
+	}
+	frac *= 1 + urgency.Mul(adverse).Float64()
+	if frac > 1 {
+		return 1
+	}
+	return frac
+}
+
+// AdverseMovePct is how far the market has moved against an order since
+// arrival, in percent: up for a buy, down for a sell. It is negative when the
+// move favours the order.
+func AdverseMovePct(side model.OrderSide, arrivalPx, mark decimal.Decimal) decimal.Decimal {
+	if !arrivalPx.IsPositive() || !mark.IsPositive() {
+		return decimal.Zero
+	}
+	move := mark.Sub(arrivalPx).Mul(hundred).Div(arrivalPx)
+	if side == model.OrderSideSell {
+		return move.Neg()
+	}
+	return move
+}
@@ -0,0 +1,55 @@
+package algo
+
+import (
+	"testing"
+
+	"github.com/atlas/services/common/model"
+)
+
+func TestAdverseMovePct(t *testing.T) {
+	tests := []struct {
+		side          model.OrderSide
+		arrival, mark string
+		want          string
+	}{
+		{model.OrderSideBuy, "100", "102", "2"},
+		{model.OrderSideBuy, "100", "99", "-1"},
+		{model.OrderSideSell, "100", "97", "3"},
+		{model.OrderSideSell, "100", "101", "-1"},
+		{model.OrderSideBuy, "0", "101", "0"},
+		{model.OrderSideBuy, "100", "0", "0"},
+	}
+	for _, tt := range tests {
+		got := AdverseMovePct(tt.side, dec(tt.arrival), dec(tt.mark))
+		if !got.Equal(dec(tt.want)) {
+			t.Errorf("AdverseMovePct(%s, %s -> %s) = %s, want %s", tt.side, tt.arrival, tt.mark, got, tt.want)
+		}
+	}
+}
+
+func TestShortfall(t *testing.T) {
+	end := at(100)
+	tests := []struct {
+		name    string
+		side    model.OrderSide
+		mark    string
+		urgency string
+		t       float64
+		want    float64
+	}{
+		{"at arrival", model.OrderSideBuy, "100", "1", 10, 0.1},
+		{"favourable", model.OrderSideBuy, "98", "1", 10, 0.1},
+		// 2% against at urgency 1 trades three times as fast.
+		{"adverse buy", model.OrderSideBuy, "102", "1", 10, 0.3},
+		{"adverse sell", model.OrderSideSell, "98", "1", 10, 0.3},
+		{"urgency defaults to 1", model.OrderSideBuy, "102", "0", 10, 0.3},
+		{"half urgency", model.OrderSideBuy, "102", "0.5", 10, 0.2},
+		{"never past the whole order", model.OrderSideBuy, "102", "1", 50, 1},
+	}
+	for _, tt := range tests {
+		s := Shortfall{Side: tt.side, ArrivalPx: dec("100"), Mark: dec(tt.mark), Urgency: dec(tt.urgency)}
+		if got := s.Fraction("BTC-USD", t0, at(tt.t), end); !near(got, tt.want) {
+			t.Errorf("%s: Fraction = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
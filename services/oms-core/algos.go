@@ -0,0 +1,649 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/instrument"
+	"github.com/atlas/services/common/kafka"
+	"github.com/atlas/services/common/model"
+	"github.com/atlas/services/common/venue"
+	"github.com/atlas/services/oms-core/algo"
+	"github.com/atlas/services/oms-core/sor"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+// Algo parents. An order with algo params is a parent in atlas_orders that
+// never goes to the venue itself: oms-core works it through LIMIT child
+// orders no worse than the parent's price, sent through the normal
+// ORDER_CREATED path with parent_order_id pointing at it. Like the legs of a
+// container, the children share the parent's reservation, and the parent's
+// CANCELED report releases what they did not fill.
+//
+// Smart-routed orders (venue SMART) are parents too, split across venues by
+// the router once on arrival, with one child per venue.
+//
+// The parent's progress (cum_qty, avg_px, schedule) is kept in atlas_orders
+// so the engine picks up where it left off after a restart.
+
+type algoEngine struct {
+	// io runs the engine's writes one batch at a time, in the order they
+	// were decided. mu guards its state and is never held across I/O; io is
+	// always taken first.
+	io sync.Mutex
+	mu sync.Mutex
+
+	parents      map[string]*algo.Parent
+	instruments  *instrument.Master
+	venues       *venue.Directory
+	profile      *algo.Profile
+	execProducer *kafka.Producer
+
+	// The market per symbol: last trade, and the top of book per venue.
+	lastPx map[string]decimal.Decimal
+	book   *sor.Book
+}
+
+func newAlgoEngine(instruments *instrument.Master, venues *venue.Directory, book *sor.Book, execProducer *kafka.Producer) *algoEngine {
+	return &algoEngine{
+		parents:      make(map[string]*algo.Parent),
+		instruments:  instruments,
+		venues:       venues,
+		profile:      algo.NewProfile(),
+		execProducer: execProducer,
+		lastPx:       make(map[string]decimal.Decimal),
+		book:         book,
+	}
+}
+
+// algoActions is the I/O the engine decided on under its lock, carried out
+// in order once the lock is released.
+type algoActions struct {
+	execProducer *kafka.Producer
+	ops          []func(ctx context.Context)
+}
+
+func (a *algoActions) add(op func(ctx context.Context)) { a.ops = append(a.ops, op) }
+
+func (a *algoActions) run(ctx context.Context) {
+	for _, op := range a.ops {
+		op(ctx)
+	}
+}
+
+// save persists the parent's progress as it is now.
+func (a *algoActions) save(p *algo.Parent, status model.OrderStatus) {
+	progress := progressOf(p, status)
+	a.add(func(ctx context.Context) { saveParent(ctx, progress) })
+}
+
+// publish emits an event on an order and its exec report.
+func (a *algoActions) publish(orderID, eventType string, report model.ExecutionReport) {
+	a.add(func(ctx context.Context) {
+		if err := emitEvent(ctx, orderID, eventType, report); err != nil {
+			log.Printf("[OMS] Failed to produce event: %v", err)
+		}
+		publishExecReport(a.execProducer, report)
+	})
+}
+
+func (a *algoActions) cancel(orderID string) {
+	a.add(func(ctx context.Context) { cancelLinked(ctx, a.execProducer, orderID) })
+}
+
+// do decides under the engine's lock what to do, and does it once the lock
+// is released.
+func (e *algoEngine) do(ctx context.Context, decide func(acts *algoActions)) {
+	e.io.Lock()
+	defer e.io.Unlock()
+	acts := &algoActions{execProducer: e.execProducer}
+	e.mu.Lock()
+	decide(acts)
+	e.mu.Unlock()
+	acts.run(ctx)
+}
+
+// Add starts working a parent that was just accepted, from the market as it
+// is now.
+func (e *algoEngine) Add(ctx context.Context, cmd model.OrderCommand) {
+	e.do(ctx, func(acts *algoActions) {
+		p := algo.NewParent(cmd)
+		p.ArrivalPx = e.mark(cmd.Symbol)
+		e.parents[cmd.OrderID] = p
+		if p.ArrivalPx.IsPositive() {
+			acts.save(p, model.OrderStatusLive)
+		}
+		log.Printf("[OMS] 🧮 Working %s parent %s: %s %s %s px=%s arrival=%s every %s",
+			cmd.Algo.Type, cmd.OrderID, cmd.Side, cmd.QuantityVal, cmd.Symbol, cmd.Price,
+			p.ArrivalPx, cmd.Algo.SliceInterval())
+	})
+}
+
+// Route splits a smart-routed order that was just accepted across venues by
+// the consolidated top of book.
+func (e *algoEngine) Route(ctx context.Context, cmd model.OrderCommand) {
+	e.do(ctx, func(acts *algoActions) {
+		p := algo.NewParent(cmd)
+		p.ArrivalPx = e.mark(cmd.Symbol)
+		e.parents[cmd.OrderID] = p
+
+		inst, ok := e.instruments.Get(cmd.Symbol)
+		if !ok {
+			log.Printf("[OMS] ⚠️  WARNING: no instrument %s for routed order %s", cmd.Symbol, cmd.OrderID)
+			p.Canceling, p.Reason = true, "UNKNOWN_SYMBOL"
+			e.finishIfDone(acts, p)
+			return
+		}
+		allocs := sor.Split(cmd, e.book.Quotes(cmd.Symbol), e.venues, inst)
+		log.Printf("[OMS] 🧭 Routing %s: %s %s %s px=%s across %d venue(s)",
+			cmd.OrderID, cmd.Side, cmd.QuantityVal, cmd.Symbol, cmd.Price, len(allocs))
+		acts.save(p, model.OrderStatusLive)
+		for _, a := range allocs {
+			e.sendChild(acts, p, a.Qty, cmd.Price, a.Venue)
+		}
+	})
+}
+
+// RecordTrade feeds a market trade into the VWAP volume profile, the volume
+// POV parents participate in, and the mark.
+func (e *algoEngine) RecordTrade(update model.MarketDataUpdate) {
+	at := update.Timestamp
+	if at.IsZero() {
+		at = time.Now()
+	}
+	e.profile.Record(update.Symbol, update.Trade.Qty, at)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lastPx[update.Symbol] = decimal.FromFloat(update.Trade.Price)
+	for _, p := range e.parents {
+		if p.Cmd.Symbol != update.Symbol {
+			continue
+		}
+		if p.ArrivalPx.IsZero() {
+			p.ArrivalPx = e.mark(update.Symbol)
+		}
+		if p.Cmd.Algo != nil && p.Cmd.Algo.Type == model.AlgoPOV && !p.Paused && !p.Canceling && !at.Before(p.From) {
+			p.Volume += update.Trade.Qty
+		}
+	}
+}
+
+// mark is the symbol's last trade price, or its mid before any trade.
+func (e *algoEngine) mark(symbol string) decimal.Decimal {
+	if px, ok := e.lastPx[symbol]; ok {
+		return px
+	}
+	bid, ask := e.book.Best(symbol)
+	if bid.IsPositive() && ask.IsPositive() {
+		return bid.Add(ask).Div(decimal.FromInt(2))
+	}
+	return decimal.Zero
+}
+
+// Run sends children as they fall due until ctx is done.
+func (e *algoEngine) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			e.do(ctx, func(acts *algoActions) {
+				for _, p := range e.parents {
+					e.step(acts, p, now.UTC())
+				}
+			})
+		}
+	}
+}
+
+func (e *algoEngine) step(acts *algoActions, p *algo.Parent, now time.Time) {
+	if p.Canceling {
+		e.finishIfDone(acts, p)
+		return
+	}
+	if p.Cmd.Algo == nil || p.Paused || now.Before(p.Next) {
+		return
+	}
+	end := p.Cmd.Algo.EndTime
+	if !end.IsZero() && !now.Before(end) {
+		log.Printf("[OMS] 🧮 %s window ended with %s of %s filled", p.Cmd.OrderID, p.Cum(), p.Cmd.QuantityVal)
+		p.Canceling, p.Reason = true, "ALGO_WINDOW_ENDED"
+		e.cancelChildren(acts, p)
+		e.finishIfDone(acts, p)
+		return
+	}
+
+	inst, ok := e.instruments.Get(p.Cmd.Symbol)
+	if !ok {
+		log.Printf("[OMS] ⚠️  WARNING: no instrument %s for algo parent %s", p.Cmd.Symbol, p.Cmd.OrderID)
+		return
+	}
+	p.Next = now.Add(p.Cmd.Algo.SliceInterval())
+
+	var target decimal.Decimal
+	if p.Cmd.Algo.Type == model.AlgoPOV {
+		target = p.Participation()
+	} else {
+		until := p.Next
+		if until.After(end) {
+			until = end
+		}
+		target = p.Target(until, e.curve(p))
+	}
+
+	px := p.Cmd.Price
+	if e.crossing(p) {
+		// Children resting behind the touch go back out at the limit.
+		for _, id := range p.Passive() {
+			acts.cancel(id)
+		}
+	} else {
+		px = e.passivePx(p, inst)
+	}
+
+	qty := inst.RoundQty(target.Sub(p.Committed()))
+	if !qty.IsPositive() || qty.LessThan(inst.MinQty) {
+		return
+	}
+	e.sendChild(acts, p, qty, px, "")
+}
+
+func (e *algoEngine) curve(p *algo.Parent) algo.Curve {
+	switch p.Cmd.Algo.Type {
+	case model.AlgoVWAP:
+		return e.profile
+	case model.AlgoIS:
+		return algo.Shortfall{Side: p.Cmd.Side, ArrivalPx: p.ArrivalPx, Mark: e.mark(p.Cmd.Symbol), Urgency: p.Cmd.Algo.Urgency}
+	}
+	return algo.Linear{}
+}
+
+// crossing reports whether the parent's children should go out at its limit
+// rather than join the touch: always for TWAP and VWAP, for POV while it is
+// behind its minimum share, and for IS once the price has moved against it.
+func (e *algoEngine) crossing(p *algo.Parent) bool {
+	switch p.Cmd.Algo.Type {
+	case model.AlgoPOV:
+		return p.Behind()
+	case model.AlgoIS:
+		return algo.AdverseMovePct(p.Cmd.Side, p.ArrivalPx, e.mark(p.Cmd.Symbol)).IsPositive()
+	}
+	return true
+}
+
+// passivePx is the best price on the parent's own side of the book, no
+// worse than its limit.
+func (e *algoEngine) passivePx(p *algo.Parent, inst instrument.Instrument) decimal.Decimal {
+	bid, ask := e.book.Best(p.Cmd.Symbol)
+	if p.Cmd.Side == model.OrderSideBuy {
+		if bid.IsPositive() {
+			return decimal.Min(inst.RoundPrice(bid), p.Cmd.Price)
+		}
+	} else if ask.IsPositive() {
+		return decimal.Max(inst.RoundPrice(ask), p.Cmd.Price)
+	}
+	return p.Cmd.Price
+}
+
+// sendChild places a child of the parent: a LIMIT order, or a MARKET order
+// for a smart-routed MARKET parent. It counts as committed from now, so the
+// next step does not send it again.
+func (e *algoEngine) sendChild(acts *algoActions, p *algo.Parent, qty, px decimal.Decimal, venue string) {
+	p.Seq++
+	parent := p.Cmd
+	orderType := model.OrderTypeLimit
+	if parent.Algo == nil && parent.OrderType == model.OrderTypeMarket {
+		orderType = model.OrderTypeMarket
+	}
+	child := model.OrderCommand{
+		CommandID:     uuid.New().String(),
+		Type:          model.CommandTypeNew,
+		OrderID:       fmt.Sprintf("%s-%d", parent.OrderID, p.Seq),
+		ClientID:      parent.ClientID,
+		Symbol:        parent.Symbol,
+		Side:          parent.Side,
+		OrderType:     orderType,
+		QuantityVal:   qty,
+		Price:         px,
+		STPMode:       parent.STPMode,
+		ParentOrderID: parent.OrderID,
+		ReservePx:     parent.ReservationPx(),
+		Venue:         venue,
+		FeeTier:       parent.FeeTier,
+		Timestamp:     time.Now().UTC(),
+	}
+	p.Children[child.OrderID] = &algo.Child{OrderID: child.OrderID, Px: px, Leaves: qty}
+	log.Printf("[OMS] 🧮 %s child %d: %s %s px=%s venue=%q (%s committed of %s)",
+		parent.OrderID, p.Seq, child.Side, qty, child.Price, venue, p.Committed(), parent.QuantityVal)
+	acts.add(func(ctx context.Context) { e.placeChild(ctx, child) })
+}
+
+// placeChild records a child on its parent and places it. A child that
+// could not be recorded is taken off the parent again. The caller holds
+// e.io.
+func (e *algoEngine) placeChild(ctx context.Context, child model.OrderCommand) {
+	if !appendChild(ctx, child.ParentOrderID, child.OrderID) {
+		acts := &algoActions{execProducer: e.execProducer}
+		e.mu.Lock()
+		if p, ok := e.parents[child.ParentOrderID]; ok {
+			delete(p.Children, child.OrderID)
+			e.finishIfDone(acts, p)
+		}
+		e.mu.Unlock()
+		acts.run(ctx)
+		return
+	}
+	if err := acceptOrder(ctx, e.execProducer, child); err != nil {
+		log.Printf("[OMS] Failed to place child %s of %s: %v", child.OrderID, child.ParentOrderID, err)
+	}
+}
+
+// ChildEvent updates a parent from one of its children's lifecycle events.
+// It reports whether the order is a child of a parent being worked.
+func (e *algoEngine) ChildEvent(ctx context.Context, eventType string, report model.ExecutionReport) bool {
+	found := false
+	e.do(ctx, func(acts *algoActions) {
+		p, ok := e.parents[report.ParentOrderID]
+		if !ok || !p.Apply(report) {
+			return
+		}
+		found = true
+
+		switch eventType {
+		case "ORDER_LIVE":
+			// Placed while the parent was being paused or canceled.
+			if p.Paused || p.Canceling {
+				acts.cancel(report.OrderID)
+			}
+		case "ORDER_PARTIALLY_FILLED", "ORDER_FILLED":
+			status := model.OrderStatusPartiallyFilled
+			if p.Paused {
+				status = model.OrderStatusPaused
+			} else if p.Canceling && p.Reason == "" {
+				status = model.OrderStatusCancelPending
+			}
+			acts.save(p, status)
+			acts.publish(p.Cmd.OrderID, "ORDER_PARTIALLY_FILLED", parentReport(p, status))
+		}
+		e.finishIfDone(acts, p)
+	})
+	return found
+}
+
+// Pause stops sending children and cancels the working ones. It reports
+// whether the order is a parent being worked.
+func (e *algoEngine) Pause(ctx context.Context, orderID string) bool {
+	found := false
+	e.do(ctx, func(acts *algoActions) {
+		p, ok := e.parents[orderID]
+		if !ok {
+			return
+		}
+		found = true
+		if p.Cmd.Algo == nil || p.Paused || p.Canceling {
+			log.Printf("[OMS] Cannot pause %s: not a running algo", orderID)
+			return
+		}
+		p.Paused = true
+		e.cancelChildren(acts, p)
+		e.announce(acts, p, model.OrderStatusPaused, "ORDER_PAUSED")
+	})
+	return found
+}
+
+// Resume starts sending children again. What was skipped while paused is
+// spread over the rest of the window rather than sent at once.
+func (e *algoEngine) Resume(ctx context.Context, orderID string) bool {
+	found := false
+	e.do(ctx, func(acts *algoActions) {
+		p, ok := e.parents[orderID]
+		if !ok {
+			return
+		}
+		found = true
+		if !p.Paused || p.Canceling {
+			log.Printf("[OMS] Cannot resume %s: not paused", orderID)
+			return
+		}
+		now := time.Now().UTC()
+		p.Paused = false
+		p.Base, p.From, p.Next, p.Volume = p.Cum(), now, now, 0
+		status := model.OrderStatusLive
+		if p.Cum().IsPositive() {
+			status = model.OrderStatusPartiallyFilled
+		}
+		e.announce(acts, p, status, "ORDER_RESUMED")
+	})
+	return found
+}
+
+// Cancel stops sending children and cancels the working ones; the parent is
+// canceled once they are done. It reports whether the order is a parent
+// being worked.
+func (e *algoEngine) Cancel(ctx context.Context, orderID string) bool {
+	found := false
+	e.do(ctx, func(acts *algoActions) {
+		p, ok := e.parents[orderID]
+		if !ok {
+			return
+		}
+		found = true
+		if p.Canceling {
+			log.Printf("[OMS] Cannot cancel %s: already canceling", orderID)
+			return
+		}
+		p.Canceling = true
+		e.cancelChildren(acts, p)
+		acts.save(p, model.OrderStatusCancelPending)
+		report := parentReport(p, model.OrderStatusCancelPending)
+		report.Type = "PENDING_CANCEL"
+		acts.publish(orderID, "ORDER_CANCEL_REQUESTED", report)
+		e.finishIfDone(acts, p)
+	})
+	return found
+}
+
+func (e *algoEngine) announce(acts *algoActions, p *algo.Parent, status model.OrderStatus, eventType string) {
+	acts.save(p, status)
+	log.Printf("[OMS] ✅ STATE TRANSITION: order_id=%s → %s", p.Cmd.OrderID, status)
+	acts.publish(p.Cmd.OrderID, eventType, parentReport(p, status))
+}
+
+func (e *algoEngine) cancelChildren(acts *algoActions, p *algo.Parent) {
+	for id, c := range p.Children {
+		if !c.Done {
+			acts.cancel(id)
+		}
+	}
+}
+
+// finishIfDone completes a parent that is filled, or being canceled with no
+// children left working, releasing what the children did not fill. A routed
+// order is done when its children are.
+func (e *algoEngine) finishIfDone(acts *algoActions, p *algo.Parent) {
+	if p.Open() || (!p.Filled() && !p.Canceling && p.Cmd.Algo != nil) {
+		return
+	}
+	cum, avgPx := p.Cum(), p.AvgPx()
+	status, execType, eventType := model.OrderStatusCanceled, "CANCELED", "ORDER_CANCELED"
+	if p.Filled() {
+		status, execType, eventType = model.OrderStatusFilled, "STATUS", "ORDER_FILLED"
+	}
+	orderID := p.Cmd.OrderID
+	acts.add(func(ctx context.Context) { updateOrderStatus(ctx, orderID, status, cum, decimal.Zero, avgPx) })
+	delete(e.parents, orderID)
+
+	release := p.Cmd.QuantityVal.Sub(cum)
+	log.Printf("[OMS] 🧮 %s %s: children filled %s at %s, releasing %s", orderID, status, cum, avgPx, release)
+	report := parentReport(p, status)
+	report.Type = execType
+	report.Reason = p.Reason
+	report.LeavesQty = release
+	acts.publish(orderID, eventType, report)
+}
+
+// parentReport is a STATUS report of the parent's progress. LastQty stays
+// zero: the children's own reports settle their fills.
+func parentReport(p *algo.Parent, status model.OrderStatus) model.ExecutionReport {
+	report := newExecReport(p.Cmd, "STATUS", status, "")
+	report.CumQty = p.Cum()
+	report.AvgPx = p.AvgPx()
+	report.LeavesQty = p.Cmd.QuantityVal.Sub(report.CumQty)
+	report.ArrivalPx = p.ArrivalPx
+	report.SlippageBps = model.SlippageBps(p.Cmd.Side, report.AvgPx, p.ArrivalPx)
+	return report
+}
+
+// parentProgress is what is persisted of a parent.
+type parentProgress struct {
+	orderID                        string
+	status                         model.OrderStatus
+	qty, cum, avgPx, base, arrival decimal.Decimal
+	from                           time.Time
+	volume                         float64
+}
+
+func progressOf(p *algo.Parent, status model.OrderStatus) parentProgress {
+	return parentProgress{
+		orderID: p.Cmd.OrderID,
+		status:  status,
+		qty:     p.Cmd.QuantityVal,
+		cum:     p.Cum(),
+		avgPx:   p.AvgPx(),
+		base:    p.Base,
+		arrival: p.ArrivalPx,
+		from:    p.From,
+		volume:  p.Volume,
+	}
+}
+
+// saveParent persists a parent's status, progress and schedule.
+func saveParent(ctx context.Context, p parentProgress) {
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(awsCfg.OrdersTable),
+		Key:       map[string]types.AttributeValue{"order_id": &types.AttributeValueMemberS{Value: p.orderID}},
+		UpdateExpression: aws.String("SET #s = :s, cum_qty = :cq, leaves_qty = :lq, avg_px = :ap, " +
+			"algo_base_qty = :b, algo_from = :f, algo_volume = :v, arrival_px = :ar, updated_at = :u"),
+		ExpressionAttributeNames: map[string]string{"#s": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":s":  &types.AttributeValueMemberS{Value: string(p.status)},
+			":cq": p.cum.AttributeValue(),
+			":lq": p.qty.Sub(p.cum).AttributeValue(),
+			":ap": p.avgPx.AttributeValue(),
+			":b":  p.base.AttributeValue(),
+			":f":  &types.AttributeValueMemberS{Value: p.from.Format(time.RFC3339Nano)},
+			":v":  &types.AttributeValueMemberN{Value: strconv.FormatFloat(p.volume, 'f', -1, 64)},
+			":ar": p.arrival.AttributeValue(),
+			":u":  &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", time.Now().Unix())},
+		},
+	})
+	if err != nil {
+		log.Printf("[DDB-WRITE-ERROR] Table=%s Key=%s Error=%v", awsCfg.OrdersTable, p.orderID, err)
+	} else {
+		log.Printf("[DDB-WRITE-SUCCESS] Table=%s Key=%s (Algo parent %s, cum_qty=%s)", awsCfg.OrdersTable, p.orderID, p.status, p.cum)
+	}
+}
+
+// appendChild records a child on its parent before it is placed, so a
+// restart finds it.
+func appendChild(ctx context.Context, parentID, childID string) bool {
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(awsCfg.OrdersTable),
+		Key:              map[string]types.AttributeValue{"order_id": &types.AttributeValueMemberS{Value: parentID}},
+		UpdateExpression: aws.String("SET child_order_ids = list_append(if_not_exists(child_order_ids, :empty), :c)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":empty": &types.AttributeValueMemberL{Value: []types.AttributeValue{}},
+			":c":     &types.AttributeValueMemberL{Value: []types.AttributeValue{&types.AttributeValueMemberS{Value: childID}}},
+		},
+	})
+	if err != nil {
+		log.Printf("[DDB-WRITE-ERROR] Table=%s Key=%s Error=%v", awsCfg.OrdersTable, parentID, err)
+		return false
+	}
+	return true
+}
+
+// loadAlgos puts the algo parents still being worked back in the engine
+// after a restart, with their children as persisted.
+func (e *algoEngine) loadAlgos(ctx context.Context) error {
+	input := &dynamodb.ScanInput{
+		TableName:                aws.String(awsCfg.OrdersTable),
+		FilterExpression:         aws.String("(attribute_exists(algo) OR venue = :smart) AND #s IN (:lv, :pf, :pa, :cp)"),
+		ExpressionAttributeNames: map[string]string{"#s": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":lv":    &types.AttributeValueMemberS{Value: string(model.OrderStatusLive)},
+			":pf":    &types.AttributeValueMemberS{Value: string(model.OrderStatusPartiallyFilled)},
+			":pa":    &types.AttributeValueMemberS{Value: string(model.OrderStatusPaused)},
+			":cp":    &types.AttributeValueMemberS{Value: string(model.OrderStatusCancelPending)},
+			":smart": &types.AttributeValueMemberS{Value: model.VenueSmart},
+		},
+	}
+
+	parents := make(map[string]*algo.Parent)
+	for {
+		result, err := dynamoClient.Scan(ctx, input)
+		if err != nil {
+			return err
+		}
+		for _, item := range result.Items {
+			var o orderRow
+			if err := attributevalue.UnmarshalMap(item, &o); err != nil {
+				return err
+			}
+			cmd := o.command()
+			if cmd.Algo == nil && cmd.Venue != model.VenueSmart {
+				continue
+			}
+			p := algo.NewParent(cmd)
+			p.Base = o.AlgoBaseQty
+			if !o.AlgoFrom.IsZero() {
+				p.From = o.AlgoFrom
+			}
+			p.Next = time.Now().UTC()
+			p.ArrivalPx, p.Volume = o.ArrivalPx, o.AlgoVolume
+			p.Paused = model.OrderStatus(o.Status) == model.OrderStatusPaused
+			p.Canceling = model.OrderStatus(o.Status) == model.OrderStatusCancelPending
+			p.Seq = len(o.ChildOrderIDs)
+			for _, id := range o.ChildOrderIDs {
+				child, err := loadOrder(ctx, id)
+				if err != nil {
+					// Recorded but never placed.
+					continue
+				}
+				p.Children[id] = &algo.Child{
+					OrderID: id,
+					Px:      child.Price,
+					Leaves:  child.LeavesQty,
+					Cum:     child.CumQty,
+					AvgPx:   child.AvgPx,
+					Done:    isTerminal(model.OrderStatus(child.Status)),
+				}
+			}
+			parents[cmd.OrderID] = p
+		}
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	e.mu.Lock()
+	for id, p := range parents {
+		e.parents[id] = p
+	}
+	e.mu.Unlock()
+	log.Printf("[OMS] Loaded %d algo parent order(s)", len(parents))
+	return nil
+}
@@ -20,12 +20,22 @@ func (sm *StateMachine) Apply(event model.OrderEvent) error {
 	switch event.Type {
 	case "ORDER_CREATED":
 		sm.State = model.OrderStatusPendingSubmit
+	case "ORDER_PENDING_TRIGGER":
+		sm.State = model.OrderStatusPendingTrigger
+	case "ORDER_TRIGGERED":
+		sm.State = model.OrderStatusTriggered
+	case "ORDER_PENDING_PARENT":
+		sm.State = model.OrderStatusPendingParent
 	case "ORDER_ACCEPTED":
 		sm.State = model.OrderStatusLive
 	case "ORDER_FILLED":
 		sm.State = model.OrderStatusFilled
 	case "ORDER_PARTIALLY_FILLED":
 		sm.State = model.OrderStatusPartiallyFilled
+	case "ORDER_PAUSED":
+		sm.State = model.OrderStatusPaused
+	case "ORDER_RESUMED":
+		sm.State = model.OrderStatusLive
 	case "ORDER_REJECTED":
 		sm.State = model.OrderStatusRejected
 	case "ORDER_CANCELED":
@@ -38,6 +48,24 @@ func (sm *StateMachine) CanTransition(to model.OrderStatus) error {
 	// Strict transition rules
 	switch sm.State {
 	case model.OrderStatusNew:
+		if to == model.OrderStatusPendingSubmit || to == model.OrderStatusPendingTrigger || to == model.OrderStatusPendingParent {
+			return nil
+		}
+		// OCO containers and algo parents are live as soon as they are
+		// accepted; their children go to the venue.
+		if to == model.OrderStatusLive {
+			return nil
+		}
+	case model.OrderStatusPendingParent:
+		if to == model.OrderStatusLive || to == model.OrderStatusCanceled {
+			return nil
+		}
+	case model.OrderStatusPendingTrigger:
+		// Stops are held here, so they cancel without going to the venue.
+		if to == model.OrderStatusTriggered || to == model.OrderStatusCanceled || to == model.OrderStatusRejected {
+			return nil
+		}
+	case model.OrderStatusTriggered:
 		if to == model.OrderStatusPendingSubmit {
 			return nil
 		}
@@ -46,11 +74,16 @@ func (sm *StateMachine) CanTransition(to model.OrderStatus) error {
 			return nil
 		}
 	case model.OrderStatusLive:
-		if to == model.OrderStatusFilled || to == model.OrderStatusPartiallyFilled || to == model.OrderStatusCancelPending || to == model.OrderStatusReplacePending {
+		if to == model.OrderStatusFilled || to == model.OrderStatusPartiallyFilled || to == model.OrderStatusCancelPending || to == model.OrderStatusReplacePending || to == model.OrderStatusPaused {
 			return nil
 		}
 	case model.OrderStatusPartiallyFilled:
-		if to == model.OrderStatusFilled || to == model.OrderStatusCancelPending || to == model.OrderStatusReplacePending {
+		if to == model.OrderStatusFilled || to == model.OrderStatusCancelPending || to == model.OrderStatusReplacePending || to == model.OrderStatusPaused {
+			return nil
+		}
+	case model.OrderStatusPaused:
+		// Children already working may still fill while an algo is paused.
+		if to == model.OrderStatusLive || to == model.OrderStatusPartiallyFilled || to == model.OrderStatusFilled || to == model.OrderStatusCancelPending {
 			return nil
 		}
 	case model.OrderStatusCancelPending:
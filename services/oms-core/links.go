@@ -0,0 +1,509 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/kafka"
+	"github.com/atlas/services/common/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+// Linked orders. An OCO is a container order in atlas_orders whose two legs
+// are orders of their own with parent_order_id pointing at it. A bracket is
+// an entry order plus an OCO container for its exits, created PENDING_PARENT
+// and placed for whatever the entry filled once the entry is done.
+//
+// The legs of a container share one reservation, which the container holds:
+// fills on the legs settle against it at the legs' reserve_px, and when
+// every leg is done the container's CANCELED report releases what is left.
+// The coordination is driven by the lifecycle events on orders.events.
+
+// linkAttributes are the atlas_orders attributes that link an order to its
+// parent and children.
+func linkAttributes(cmd model.OrderCommand) map[string]interface{} {
+	attrs := make(map[string]interface{})
+	if cmd.ParentOrderID != "" {
+		attrs["parent_order_id"] = cmd.ParentOrderID
+	}
+	if cmd.ReservePx.IsPositive() {
+		attrs["reserve_px"] = cmd.ReservePx
+	}
+	if cmd.Algo != nil {
+		params, _ := json.Marshal(cmd.Algo)
+		attrs["algo"] = string(params)
+	}
+	if cmd.ContingencyType == "" {
+		return attrs
+	}
+
+	legs, _ := json.Marshal(cmd.Legs)
+	attrs["contingency_type"] = string(cmd.ContingencyType)
+	attrs["legs"] = string(legs)
+	switch cmd.ContingencyType {
+	case model.ContingencyOCO:
+		ids := make([]string, 0, len(cmd.Legs))
+		for _, leg := range cmd.Legs {
+			ids = append(ids, leg.OrderID)
+		}
+		attrs["child_order_ids"] = ids
+		attrs["reserved_qty"] = reservedAtEntry(cmd)
+	case model.ContingencyBracket:
+		attrs["child_order_ids"] = []string{cmd.LegGroupID()}
+	}
+	return attrs
+}
+
+// reservedAtEntry is what the gateway reserved for a container when the
+// order was entered: everything, except for a bracket's selling exits, which
+// are reserved from the entry's fills as they happen.
+func reservedAtEntry(group model.OrderCommand) decimal.Decimal {
+	if group.ParentOrderID != "" && group.Side == model.OrderSideSell {
+		return decimal.Zero
+	}
+	return group.QuantityVal
+}
+
+// exitGroup is the OCO container for a bracket's exits. Buying exits reserve
+// for their fees like the gateway does for any buy.
+func exitGroup(entry model.OrderCommand) model.OrderCommand {
+	group := model.OrderCommand{
+		CommandID:       entry.CommandID,
+		Type:            model.CommandTypeNew,
+		OrderID:         entry.LegGroupID(),
+		ClientID:        entry.ClientID,
+		Symbol:          entry.Symbol,
+		Side:            entry.LegSide(),
+		QuantityVal:     entry.QuantityVal,
+		Price:           entry.WorstLegPx(),
+		STPMode:         entry.STPMode,
+		ContingencyType: model.ContingencyOCO,
+		Legs:            entry.Legs,
+		ParentOrderID:   entry.OrderID,
+		FeeTier:         entry.FeeTier,
+		Timestamp:       entry.Timestamp,
+	}
+	if px := venues.FeeReservePx(group, group.FeeTier); !px.Equal(group.Price) {
+		group.ReservePx = px
+	}
+	return group
+}
+
+// linkOrders places the orders linked to a NEW order that was just accepted.
+func linkOrders(ctx context.Context, execProducer *kafka.Producer, cmd model.OrderCommand) {
+	switch cmd.ContingencyType {
+	case model.ContingencyOCO:
+		placeLegs(ctx, execProducer, cmd)
+	case model.ContingencyBracket:
+		if err := acceptOrder(ctx, execProducer, exitGroup(cmd)); err != nil {
+			log.Printf("[OMS] Failed to create exits for bracket %s: %v", cmd.OrderID, err)
+		}
+	}
+	if cmd.Algo != nil {
+		algos.Add(ctx, cmd)
+	}
+	if cmd.Venue == model.VenueSmart {
+		algos.Route(ctx, cmd)
+	}
+}
+
+func placeLegs(ctx context.Context, execProducer *kafka.Producer, group model.OrderCommand) {
+	for i := range group.Legs {
+		leg := group.LegCommand(i, group.QuantityVal)
+		log.Printf("[OMS] 🔗 Placing leg %s of %s: %s %s %s px=%s stop=%s",
+			leg.OrderID, group.OrderID, leg.OrderType, leg.Side, leg.QuantityVal, leg.Price, leg.StopPrice)
+		if err := acceptOrder(ctx, execProducer, leg); err != nil {
+			log.Printf("[OMS] Failed to place leg %s of %s: %v", leg.OrderID, group.OrderID, err)
+		}
+	}
+}
+
+// orderRow is an atlas_orders item with its link attributes.
+type orderRow struct {
+	OrderID   string          `dynamodbav:"order_id"`
+	AccountID string          `dynamodbav:"account_id"`
+	Symbol    string          `dynamodbav:"symbol"`
+	Side      string          `dynamodbav:"side"`
+	OrderType string          `dynamodbav:"order_type"`
+	Price     decimal.Decimal `dynamodbav:"price"`
+	StopPrice decimal.Decimal `dynamodbav:"stop_price"`
+	STPMode   string          `dynamodbav:"stp_mode"`
+	Venue     string          `dynamodbav:"venue"`
+	FeeTier   string          `dynamodbav:"fee_tier"`
+	OrderQty  decimal.Decimal `dynamodbav:"order_qty"`
+	CumQty    decimal.Decimal `dynamodbav:"cum_qty"`
+	LeavesQty decimal.Decimal `dynamodbav:"leaves_qty"`
+	AvgPx     decimal.Decimal `dynamodbav:"avg_px"`
+	Status    string          `dynamodbav:"status"`
+	CreatedAt int64           `dynamodbav:"created_at"`
+
+	ContingencyType model.ContingencyType `dynamodbav:"contingency_type"`
+	ParentOrderID   string                `dynamodbav:"parent_order_id"`
+	ChildOrderIDs   []string              `dynamodbav:"child_order_ids"`
+	Legs            string                `dynamodbav:"legs"`
+	ReservePx       decimal.Decimal       `dynamodbav:"reserve_px"`
+	ReservedQty     decimal.Decimal       `dynamodbav:"reserved_qty"`
+	FilledLeg       string                `dynamodbav:"filled_leg"`
+	CancelRequested bool                  `dynamodbav:"cancel_requested"`
+
+	Algo        string          `dynamodbav:"algo"`
+	AlgoBaseQty decimal.Decimal `dynamodbav:"algo_base_qty"`
+	AlgoFrom    time.Time       `dynamodbav:"algo_from"`
+	AlgoVolume  float64         `dynamodbav:"algo_volume"`
+	ArrivalPx   decimal.Decimal `dynamodbav:"arrival_px"`
+}
+
+func loadOrder(ctx context.Context, orderID string) (*orderRow, error) {
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(awsCfg.OrdersTable),
+		Key:       map[string]types.AttributeValue{"order_id": &types.AttributeValueMemberS{Value: orderID}},
+	})
+	if err != nil {
+		log.Printf("[DDB-ERROR] GetItem Table=%s Key=%s Error=%v", awsCfg.OrdersTable, orderID, err)
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, errors.New("not found")
+	}
+	var o orderRow
+	if err := attributevalue.UnmarshalMap(result.Item, &o); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// command rebuilds the order's NEW command.
+func (o *orderRow) command() model.OrderCommand {
+	cmd := model.OrderCommand{
+		Type:            model.CommandTypeNew,
+		OrderID:         o.OrderID,
+		ClientID:        o.AccountID,
+		Symbol:          o.Symbol,
+		Side:            model.OrderSide(o.Side),
+		OrderType:       model.OrderType(o.OrderType),
+		QuantityVal:     o.OrderQty,
+		Price:           o.Price,
+		StopPrice:       o.StopPrice,
+		STPMode:         model.STPMode(o.STPMode),
+		Venue:           o.Venue,
+		FeeTier:         o.FeeTier,
+		ContingencyType: o.ContingencyType,
+		ParentOrderID:   o.ParentOrderID,
+		ReservePx:       o.ReservePx,
+		Timestamp:       time.Unix(o.CreatedAt, 0).UTC(),
+	}
+	if o.Legs != "" {
+		json.Unmarshal([]byte(o.Legs), &cmd.Legs)
+	}
+	if o.Algo != "" {
+		cmd.Algo = new(model.AlgoParams)
+		json.Unmarshal([]byte(o.Algo), cmd.Algo)
+	}
+	return cmd
+}
+
+// handleLinkEvent coordinates linked orders from one lifecycle event.
+func handleLinkEvent(ctx context.Context, execProducer *kafka.Producer, event model.OrderEvent) {
+	switch event.Type {
+	case "ORDER_LIVE", "ORDER_PARTIALLY_FILLED", "ORDER_FILLED", "ORDER_RESTATED", "ORDER_CANCELED", "ORDER_REJECTED":
+	default:
+		return
+	}
+	payloadBytes, _ := json.Marshal(event.Payload)
+	var report model.ExecutionReport
+	if err := json.Unmarshal(payloadBytes, &report); err != nil {
+		log.Printf("[OMS] Error unmarshalling %s payload: %v", event.Type, err)
+		return
+	}
+
+	switch {
+	case report.ParentOrderID != "" && algos.ChildEvent(ctx, event.Type, report):
+	case report.ContingencyType == model.ContingencyBracket:
+		entryEvent(ctx, execProducer, event.Type, report)
+	case report.ParentOrderID != "" && report.ContingencyType == "":
+		legEvent(ctx, execProducer, event.Type, report)
+	}
+}
+
+// entryEvent places a bracket's exits for what the entry filled once the
+// entry is done, or cancels them if it filled nothing.
+func entryEvent(ctx context.Context, execProducer *kafka.Producer, eventType string, report model.ExecutionReport) {
+	entry := model.OrderCommand{OrderID: report.OrderID, ContingencyType: model.ContingencyBracket}
+	group, err := loadOrder(ctx, entry.LegGroupID())
+	if err != nil {
+		log.Printf("[OMS] Exits for bracket %s not found: %v", report.OrderID, err)
+		return
+	}
+	if model.OrderStatus(group.Status) != model.OrderStatusPendingParent {
+		return
+	}
+	if eventType == "ORDER_LIVE" {
+		if group.CancelRequested {
+			cancelLinked(ctx, execProducer, report.OrderID)
+		}
+		return
+	}
+	if !isTerminal(report.Status) {
+		return
+	}
+
+	cmd := group.command()
+	filled := report.CumQty
+	reserved := group.ReservedQty
+	if cmd.Side == model.OrderSideSell {
+		reserved = filled // what the entry bought
+	}
+
+	if !filled.IsPositive() || group.CancelRequested {
+		if !setStatusIf(ctx, group.OrderID, model.OrderStatusPendingParent, model.OrderStatusCanceled, "", nil) {
+			return
+		}
+		log.Printf("[OMS] 🔗 Bracket %s done with %s filled, exits %s canceled", report.OrderID, filled, group.OrderID)
+		canceled := newExecReport(cmd, "CANCELED", model.OrderStatusCanceled, "")
+		canceled.LeavesQty = reserved
+		if err := emitEvent(ctx, group.OrderID, "ORDER_CANCELED", canceled); err != nil {
+			log.Printf("[OMS] Failed to produce event: %v", err)
+		}
+		publishExecReport(execProducer, canceled)
+		return
+	}
+
+	ok := setStatusIf(ctx, group.OrderID, model.OrderStatusPendingParent, model.OrderStatusLive,
+		", order_qty = :q, leaves_qty = :q, reserved_qty = :q", map[string]types.AttributeValue{":q": filled.AttributeValue()})
+	if !ok {
+		return
+	}
+	log.Printf("[OMS] 🔗 Bracket %s filled %s, placing exits %s", report.OrderID, filled, group.OrderID)
+	cmd.QuantityVal = filled
+	if excess := reserved.Sub(filled); excess.IsPositive() {
+		// Reserved up front for the whole entry; release what did not fill.
+		restated := newExecReport(cmd, "RESTATED", model.OrderStatusLive, "")
+		restated.CanceledQty = excess
+		publishExecReport(execProducer, restated)
+	}
+	live := newExecReport(cmd, "NEW", model.OrderStatusLive, "")
+	if err := emitEvent(ctx, group.OrderID, "ORDER_LIVE", live); err != nil {
+		log.Printf("[OMS] Failed to produce event: %v", err)
+	}
+	publishExecReport(execProducer, live)
+	placeLegs(ctx, execProducer, cmd)
+}
+
+// legEvent cancels a leg's siblings when it first fills, and completes the
+// container once every leg is done.
+func legEvent(ctx context.Context, execProducer *kafka.Producer, eventType string, report model.ExecutionReport) {
+	group, err := loadOrder(ctx, report.ParentOrderID)
+	if err != nil {
+		log.Printf("[OMS] Container %s of leg %s not found: %v", report.ParentOrderID, report.OrderID, err)
+		return
+	}
+	if group.AccountID != report.ClientID {
+		log.Printf("[OMS] ⚠️  Ignoring leg %s of %s: account %s does not own the container", report.OrderID, group.OrderID, report.ClientID)
+		return
+	}
+	if group.Algo != "" {
+		return // a child of an algo parent that is already done
+	}
+
+	switch eventType {
+	case "ORDER_PARTIALLY_FILLED", "ORDER_FILLED":
+		if claimFill(ctx, group.OrderID, report.OrderID) {
+			log.Printf("[OMS] 🔗 Leg %s of %s filled, canceling the other leg", report.OrderID, group.OrderID)
+			for _, id := range group.ChildOrderIDs {
+				if id != report.OrderID {
+					cancelLinked(ctx, execProducer, id)
+				}
+			}
+		}
+	case "ORDER_LIVE":
+		// Placed while a sibling filled or the group was being canceled.
+		if group.CancelRequested || (group.FilledLeg != "" && group.FilledLeg != report.OrderID) {
+			cancelLinked(ctx, execProducer, report.OrderID)
+		}
+	}
+
+	if isTerminal(report.Status) {
+		completeGroup(ctx, execProducer, group)
+	}
+}
+
+// claimFill records the first leg of a container to fill. It reports whether
+// this call did.
+func claimFill(ctx context.Context, groupID, legID string) bool {
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(awsCfg.OrdersTable),
+		Key:                 map[string]types.AttributeValue{"order_id": &types.AttributeValueMemberS{Value: groupID}},
+		UpdateExpression:    aws.String("SET filled_leg = :leg"),
+		ConditionExpression: aws.String("attribute_not_exists(filled_leg)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":leg": &types.AttributeValueMemberS{Value: legID},
+		},
+	})
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if !errors.As(err, &condErr) {
+			log.Printf("[DDB-WRITE-ERROR] Table=%s Key=%s Error=%v", awsCfg.OrdersTable, groupID, err)
+		}
+		return false
+	}
+	return true
+}
+
+// completeGroup finishes a container when all its legs are done, releasing
+// whatever of its reservation the legs did not fill.
+func completeGroup(ctx context.Context, execProducer *kafka.Producer, group *orderRow) {
+	if model.OrderStatus(group.Status) != model.OrderStatusLive {
+		return
+	}
+	filled := decimal.Zero
+	for _, id := range group.ChildOrderIDs {
+		leg, err := loadOrder(ctx, id)
+		if err != nil {
+			log.Printf("[OMS] Leg %s of %s not found: %v", id, group.OrderID, err)
+			return
+		}
+		if !isTerminal(model.OrderStatus(leg.Status)) {
+			return
+		}
+		filled = filled.Add(leg.CumQty)
+	}
+
+	release := group.ReservedQty.Sub(filled)
+	if release.IsNegative() {
+		log.Printf("[OMS] ⚠️  WARNING: legs of %s filled %s, more than the %s reserved", group.OrderID, filled, group.ReservedQty)
+		release = decimal.Zero
+	}
+	status, eventType := model.OrderStatusCanceled, "ORDER_CANCELED"
+	if filled.GreaterThanOrEqual(group.OrderQty) {
+		status, eventType = model.OrderStatusFilled, "ORDER_FILLED"
+	}
+	if !setStatusIf(ctx, group.OrderID, model.OrderStatusLive, status,
+		", cum_qty = :c, leaves_qty = :z", map[string]types.AttributeValue{":c": filled.AttributeValue(), ":z": decimal.Zero.AttributeValue()}) {
+		return
+	}
+	log.Printf("[OMS] 🔗 %s %s: legs filled %s, releasing %s", group.OrderID, status, filled, release)
+
+	execType := "CANCELED"
+	if status == model.OrderStatusFilled {
+		execType = "STATUS"
+	}
+	report := newExecReport(group.command(), execType, status, "")
+	report.CumQty = filled
+	report.LeavesQty = release
+	if err := emitEvent(ctx, group.OrderID, eventType, report); err != nil {
+		log.Printf("[OMS] Failed to produce event: %v", err)
+	}
+	publishExecReport(execProducer, report)
+}
+
+// cancelGroup cancels a container: its legs, or the bracket entry it is
+// waiting for.
+func cancelGroup(ctx context.Context, execProducer *kafka.Producer, group *orderRow) {
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(awsCfg.OrdersTable),
+		Key:              map[string]types.AttributeValue{"order_id": &types.AttributeValueMemberS{Value: group.OrderID}},
+		UpdateExpression: aws.String("SET cancel_requested = :t"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":t": &types.AttributeValueMemberBOOL{Value: true},
+		},
+	})
+	if err != nil {
+		log.Printf("[DDB-WRITE-ERROR] Table=%s Key=%s Error=%v", awsCfg.OrdersTable, group.OrderID, err)
+		return
+	}
+
+	switch model.OrderStatus(group.Status) {
+	case model.OrderStatusPendingParent:
+		log.Printf("[OMS] 🔗 Canceling %s: canceling bracket entry %s", group.OrderID, group.ParentOrderID)
+		cancelLinked(ctx, execProducer, group.ParentOrderID)
+	case model.OrderStatusLive:
+		log.Printf("[OMS] 🔗 Canceling %s: canceling legs %v", group.OrderID, group.ChildOrderIDs)
+		for _, id := range group.ChildOrderIDs {
+			cancelLinked(ctx, execProducer, id)
+		}
+	default:
+		log.Printf("[OMS] Cannot cancel %s: already %s", group.OrderID, group.Status)
+	}
+}
+
+// cancelLinked cancels an order on behalf of its group. Orders still on
+// their way to the venue are canceled when they are acknowledged.
+func cancelLinked(ctx context.Context, execProducer *kafka.Producer, orderID string) {
+	o, err := loadOrder(ctx, orderID)
+	if err != nil {
+		log.Printf("[OMS] Cannot cancel linked order %s: %v", orderID, err)
+		return
+	}
+
+	switch model.OrderStatus(o.Status) {
+	case model.OrderStatusPendingTrigger:
+		cancelStop(ctx, execProducer, model.OrderCommand{OrderID: orderID})
+	case model.OrderStatusLive, model.OrderStatusPartiallyFilled:
+		requestCancel(ctx, execProducer, o)
+	}
+}
+
+// requestCancel asks the venue to cancel an order. The request is keyed by
+// the order, so the venue sees it after the order itself.
+func requestCancel(ctx context.Context, execProducer *kafka.Producer, o *orderRow) {
+	cancel := model.OrderCommand{
+		CommandID: uuid.New().String(),
+		Type:      model.CommandTypeCancel,
+		OrderID:   o.OrderID,
+		ClientID:  o.AccountID,
+		Symbol:    o.Symbol,
+		Side:      model.OrderSide(o.Side),
+		Timestamp: time.Now().UTC(),
+	}
+	if err := emitEvent(ctx, o.OrderID, "ORDER_CANCEL_REQUESTED", cancel); err != nil {
+		log.Printf("[OMS] Failed to produce event: %v", err)
+		return
+	}
+	sendExecReport(execProducer, cancel, "PENDING_CANCEL", model.OrderStatusCancelPending, "")
+}
+
+// setStatusIf moves an order to a new status, with extra SET clauses, only
+// if it is still in the expected one. It reports whether it did.
+func setStatusIf(ctx context.Context, orderID string, from, to model.OrderStatus, set string, values map[string]types.AttributeValue) bool {
+	if values == nil {
+		values = make(map[string]types.AttributeValue)
+	}
+	values[":from"] = &types.AttributeValueMemberS{Value: string(from)}
+	values[":to"] = &types.AttributeValueMemberS{Value: string(to)}
+	values[":u"] = &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", time.Now().Unix())}
+
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(awsCfg.OrdersTable),
+		Key:                       map[string]types.AttributeValue{"order_id": &types.AttributeValueMemberS{Value: orderID}},
+		UpdateExpression:          aws.String("SET #s = :to, updated_at = :u" + set),
+		ConditionExpression:       aws.String("#s = :from"),
+		ExpressionAttributeNames:  map[string]string{"#s": "status"},
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if !errors.As(err, &condErr) {
+			log.Printf("[DDB-WRITE-ERROR] Table=%s Key=%s Error=%v", awsCfg.OrdersTable, orderID, err)
+		}
+		return false
+	}
+	log.Printf("[DDB-WRITE-SUCCESS] Table=%s Key=%s (Status updated %s → %s)", awsCfg.OrdersTable, orderID, from, to)
+	return true
+}
+
+func isTerminal(status model.OrderStatus) bool {
+	switch status {
+	case model.OrderStatusFilled, model.OrderStatusCanceled, model.OrderStatusRejected:
+		return true
+	}
+	return false
+}
@@ -14,9 +14,15 @@ import (
 
 	"github.com/atlas/services/common/config"
 	"github.com/atlas/services/common/db"
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/instrument"
 	"github.com/atlas/services/common/kafka"
 	"github.com/atlas/services/common/model"
+	"github.com/atlas/services/common/schema"
+	"github.com/atlas/services/common/venue"
 	"github.com/atlas/services/oms-core/fsm"
+	"github.com/atlas/services/oms-core/sor"
+	"github.com/atlas/services/oms-core/stops"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
@@ -29,12 +35,25 @@ var (
 	topicCommands = "orders.commands"
 	topicEvents   = "orders.events"
 	topicExecs    = "exec.reports"
+	topicMD       = "market.data"
 
 	producer *kafka.Producer
 
 	// Persistence
 	dynamoClient *db.DynamoClient
 	awsCfg       *config.AWSConfig
+
+	schemas *schema.Registry
+
+	// Untriggered STOP and STOP_LIMIT orders, watched against market trades.
+	stopBook = stops.New()
+
+	// Algo and smart-routed parents being worked through child orders.
+	algos *algoEngine
+
+	// Best bid and ask per venue, for routing and the algos.
+	topOfBook = sor.NewBook()
+	venues    *venue.Directory
 )
 
 func main() {
@@ -44,6 +63,12 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	reg, err := schema.Load(schema.Dir())
+	if err != nil {
+		log.Fatalf("Failed to load schemas: %v", err)
+	}
+	schemas = reg
+
 	producer = kafka.NewProducer(kafkaBrokers, topicEvents)
 	defer producer.Close()
 
@@ -57,6 +82,16 @@ func main() {
 	execProducer := kafka.NewProducer(kafkaBrokers, topicExecs)
 	defer execProducer.Close()
 
+	master, err := instrument.Load(instrument.File())
+	if err != nil {
+		log.Fatalf("Failed to load instrument master: %v", err)
+	}
+	venues, err = venue.Load(venue.File())
+	if err != nil {
+		log.Fatalf("Failed to load venue directory: %v", err)
+	}
+	algos = newAlgoEngine(master, venues, topOfBook, execProducer)
+
 	consumer := kafka.NewConsumer(kafkaBrokers, topicCommands, "oms-core-group-v6")
 	defer consumer.Close()
 
@@ -64,6 +99,22 @@ func main() {
 	execConsumer := kafka.NewConsumer(kafkaBrokers, topicExecs, "oms-core-exec-group-v6")
 	defer execConsumer.Close()
 
+	// Consumer for Market Data trades (stop triggers)
+	mdConsumer := kafka.NewConsumer(kafkaBrokers, topicMD, "oms-core-md-group")
+	defer mdConsumer.Close()
+
+	// Consumer for Order Events (linked order coordination)
+	linkConsumer := kafka.NewConsumer(kafkaBrokers, topicEvents, "oms-core-links-group")
+	defer linkConsumer.Close()
+
+	if err := loadPendingStops(ctx); err != nil {
+		log.Fatalf("Failed to load pending stop orders: %v", err)
+	}
+	if err := algos.loadAlgos(ctx); err != nil {
+		log.Fatalf("Failed to load algo orders: %v", err)
+	}
+	go algos.Run(ctx)
+
 	log.Println("OMS Core started...")
 
 	// Start Debug HTTP Server
@@ -93,14 +144,23 @@ func main() {
 	go func() {
 		log.Println("[OMS] Starting Exec Reports consumer...")
 		err := execConsumer.Consume(ctx, func(ctx context.Context, msg kafka.Message) error {
+			if errs := schemas.ValidateJSON(schema.ExecutionReport, msg.Value); len(errs) > 0 {
+				log.Printf("[OMS] Exec report rejected by schema, skipping: %v", errs)
+				return nil
+			}
+
 			var report model.ExecutionReport
 			if err := json.Unmarshal(msg.Value, &report); err != nil {
 				log.Printf("[OMS] Error unmarshalling exec report: %v", err)
 				return nil
 			}
 
-			log.Printf("[OMS] Received exec report: order_id=%s status=%s cum_qty=%f avg_px=%f",
+			log.Printf("[OMS] Received exec report: order_id=%s status=%s cum_qty=%s avg_px=%s",
 				report.OrderID, report.Status, report.CumQty, report.AvgPx)
+			if report.Type == "STATUS" {
+				// Our own summary of a container or algo parent, already applied.
+				return nil
+			}
 
 			// Update state based on report in DynamoDB
 			oldStatus, err := getOrderStatus(ctx, report.OrderID)
@@ -118,19 +178,27 @@ func main() {
 					eventType = "ORDER_FILLED"
 				}
 			case model.OrderStatusPartiallyFilled:
-				if sm.State != model.OrderStatusPartiallyFilled {
+				// Every partial fill is a new trade, not just a status change.
+				if sm.State != model.OrderStatusFilled && sm.State != model.OrderStatusCanceled {
 					eventType = "ORDER_PARTIALLY_FILLED"
 				}
 			case model.OrderStatusCanceled:
 				if sm.State != model.OrderStatusCanceled {
 					eventType = "ORDER_CANCELED"
 				}
+			case model.OrderStatusRejected:
+				if sm.State != model.OrderStatusRejected {
+					eventType = "ORDER_REJECTED"
+				}
 			case model.OrderStatusLive:
 				if sm.State != model.OrderStatusLive {
 					eventType = "ORDER_LIVE"
 					sm.State = model.OrderStatusLive
 				}
 			}
+			if report.Type == "RESTATED" {
+				eventType = "ORDER_RESTATED"
+			}
 
 			if eventType != "" {
 				// Update State in DynamoDB
@@ -139,12 +207,21 @@ func main() {
 					newStatus = model.OrderStatusFilled
 				} else if eventType == "ORDER_CANCELED" {
 					newStatus = model.OrderStatusCanceled
+				} else if eventType == "ORDER_REJECTED" {
+					newStatus = model.OrderStatusRejected
 				} else if eventType == "ORDER_LIVE" {
 					newStatus = model.OrderStatusLive
+				} else if eventType == "ORDER_PARTIALLY_FILLED" {
+					newStatus = model.OrderStatusPartiallyFilled
 				}
 
+				// LeavesQty on a CANCELED report is what was released, not what is left.
+				leaves := report.LeavesQty
+				if newStatus == model.OrderStatusCanceled || newStatus == model.OrderStatusRejected {
+					leaves = decimal.Zero
+				}
+				updateOrderStatus(ctx, report.OrderID, newStatus, report.CumQty, leaves, report.AvgPx)
 				if newStatus != oldStatus {
-					updateOrderStatus(ctx, report.OrderID, newStatus, report.CumQty, report.AvgPx)
 					log.Printf("[OMS] ✅ STATE TRANSITION: order_id=%s %s → %s", report.OrderID, oldStatus, newStatus)
 				}
 
@@ -170,16 +247,68 @@ func main() {
 		}
 	}()
 
+	go func() {
+		log.Println("[OMS] Starting Market Data consumer for stop triggers and algos...")
+		err := mdConsumer.Consume(ctx, func(ctx context.Context, msg kafka.Message) error {
+			var update model.MarketDataUpdate
+			if err := json.Unmarshal(msg.Value, &update); err != nil {
+				log.Printf("[OMS] Error unmarshalling market data: %v", err)
+				return nil
+			}
+			if update.Type == model.MarketDataTypeL2 {
+				topOfBook.Update(update)
+				return nil
+			}
+			if update.Type != model.MarketDataTypeTrade || update.Trade == nil {
+				return nil
+			}
+			algos.RecordTrade(update)
+			px := decimal.FromFloat(update.Trade.Price)
+			for _, cmd := range stopBook.Trigger(update.Symbol, px) {
+				triggerStop(ctx, execProducer, cmd, px)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("[OMS] Market data consumer failed: %v", err)
+		}
+	}()
+
+	go func() {
+		log.Println("[OMS] Starting Order Events consumer for linked orders...")
+		err := linkConsumer.Consume(ctx, func(ctx context.Context, msg kafka.Message) error {
+			if errs := schemas.ValidateJSON(schema.OrderEvent, msg.Value); len(errs) > 0 {
+				log.Printf("[OMS] Event rejected by schema, skipping: %v", errs)
+				return nil
+			}
+			var event model.OrderEvent
+			if err := json.Unmarshal(msg.Value, &event); err != nil {
+				log.Printf("[OMS] Error unmarshalling event: %v", err)
+				return nil
+			}
+			handleLinkEvent(ctx, execProducer, event)
+			return nil
+		})
+		if err != nil {
+			log.Printf("[OMS] Order events consumer failed: %v", err)
+		}
+	}()
+
 	// Command consumer - this BLOCKS, so exec consumer must be started before this
 	log.Println("[OMS] Starting Orders Commands consumer...")
 	err = consumer.Consume(ctx, func(ctx context.Context, msg kafka.Message) error {
+		if errs := schemas.ValidateJSON(schema.OrderCommand, msg.Value); len(errs) > 0 {
+			log.Printf("[OMS] Command rejected by schema, skipping: %v", errs)
+			return nil // commit bad message
+		}
+
 		var cmd model.OrderCommand
 		if err := json.Unmarshal(msg.Value, &cmd); err != nil {
 			log.Printf("[OMS] Error unmarshalling command: %v", err)
 			return nil // commit bad message
 		}
 
-		log.Printf("[OMS] Processing command: type=%s order_id=%s symbol=%s side=%s qty=%f px=%f",
+		log.Printf("[OMS] Processing command: type=%s order_id=%s symbol=%s side=%s qty=%s px=%s",
 			cmd.Type, cmd.OrderID, cmd.Symbol, cmd.Side, cmd.QuantityVal, cmd.Price)
 
 		// 1. Load State from DynamoDB
@@ -196,17 +325,41 @@ func main() {
 
 		switch cmd.Type {
 		case model.CommandTypeNew:
-			if err := sm.CanTransition(model.OrderStatusPendingSubmit); err != nil {
+			if err := sm.CanTransition(initialStatus(cmd)); err != nil {
 				log.Printf("[OMS] Invalid transition: %v", err)
 				// Send Reject Exec Report
 				sendExecReport(execProducer, cmd, "REJECTED", model.OrderStatusRejected, err.Error())
 				return nil
 			}
-			eventType = "ORDER_CREATED"
-			execType = "NEW"
-			execStatus = model.OrderStatusPendingSubmit
+			if cmd.ParentOrderID != "" {
+				// Only an order of the same account can be linked to.
+				if parent, err := loadOrder(ctx, cmd.ParentOrderID); err != nil || parent.AccountID != cmd.ClientID {
+					log.Printf("[OMS] Rejecting %s: parent %s is not an order of %s", cmd.OrderID, cmd.ParentOrderID, cmd.ClientID)
+					// Reported unlinked, so whatever was reserved for it is
+					// released like any other rejected order's.
+					cmd.ParentOrderID = ""
+					sendExecReport(execProducer, cmd, "REJECTED", model.OrderStatusRejected, "Parent order not found")
+					return nil
+				}
+			}
+			if err := acceptOrder(ctx, execProducer, cmd); err != nil {
+				return err
+			}
+			linkOrders(ctx, execProducer, cmd)
+			return nil
 
 		case model.CommandTypeCancel:
+			if algos.Cancel(ctx, cmd.OrderID) {
+				return nil
+			}
+			if sm.State == model.OrderStatusPendingTrigger {
+				cancelStop(ctx, execProducer, cmd)
+				return nil
+			}
+			if group, err := loadOrder(ctx, cmd.OrderID); err == nil && group.ContingencyType == model.ContingencyOCO {
+				cancelGroup(ctx, execProducer, group)
+				return nil
+			}
 			if err := sm.CanTransition(model.OrderStatusCanceled); err != nil {
 				if err := sm.CanTransition(model.OrderStatusCancelPending); err != nil {
 					log.Printf("[OMS] Cannot cancel: %v", err)
@@ -216,14 +369,29 @@ func main() {
 			eventType = "ORDER_CANCEL_REQUESTED"
 			execType = "PENDING_CANCEL"
 			execStatus = model.OrderStatusCancelPending
-		}
 
-		if eventType != "" {
-			// Update state in DynamoDB
-			if eventType == "ORDER_CREATED" {
-				createOrder(ctx, cmd)
+		case model.CommandTypePause:
+			if err := sm.CanTransition(model.OrderStatusPaused); err != nil {
+				log.Printf("[OMS] Cannot pause: %v", err)
+				return nil
+			}
+			if !algos.Pause(ctx, cmd.OrderID) {
+				log.Printf("[OMS] Cannot pause %s: not an algo order", cmd.OrderID)
+			}
+			return nil
+
+		case model.CommandTypeResume:
+			if sm.State != model.OrderStatusPaused {
+				log.Printf("[OMS] Cannot resume %s: order is %s", cmd.OrderID, sm.State)
+				return nil
+			}
+			if !algos.Resume(ctx, cmd.OrderID) {
+				log.Printf("[OMS] Cannot resume %s: not an algo order", cmd.OrderID)
 			}
+			return nil
+		}
 
+		if eventType != "" {
 			// Produce Event (Canonical State)
 			event := model.OrderEvent{
 				EventID:   uuid.New().String(),
@@ -294,24 +462,88 @@ func handleDebugDDB(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func createOrder(ctx context.Context, cmd model.OrderCommand) {
+// initialStatus is where a NEW order starts: stops are held here until
+// triggered, OCO containers, algo parents and smart-routed orders work through
+// their children, the rest go to the venue.
+func initialStatus(cmd model.OrderCommand) model.OrderStatus {
+	switch {
+	case cmd.Algo != nil, cmd.Venue == model.VenueSmart:
+		return model.OrderStatusLive
+	case cmd.ContingencyType == model.ContingencyOCO && cmd.ParentOrderID != "":
+		return model.OrderStatusPendingParent
+	case cmd.ContingencyType == model.ContingencyOCO:
+		return model.OrderStatusLive
+	case cmd.OrderType == model.OrderTypeStop || cmd.OrderType == model.OrderTypeStopLimit:
+		return model.OrderStatusPendingTrigger
+	}
+	return model.OrderStatusPendingSubmit
+}
+
+// acceptOrder persists a NEW order and announces it. Orders for the venue are
+// announced as ORDER_CREATED.
+func acceptOrder(ctx context.Context, execProducer *kafka.Producer, cmd model.OrderCommand) error {
+	status := initialStatus(cmd)
+	eventType := "ORDER_CREATED"
+	switch status {
+	case model.OrderStatusPendingTrigger:
+		eventType = "ORDER_PENDING_TRIGGER"
+	case model.OrderStatusPendingParent:
+		eventType = "ORDER_PENDING_PARENT"
+	case model.OrderStatusLive:
+		eventType = "ORDER_LIVE"
+	}
+
+	createOrder(ctx, cmd, status)
+	if status == model.OrderStatusPendingTrigger {
+		stopBook.Add(cmd)
+		log.Printf("[OMS] Holding %s %s order %s until a trade through %s (%d held)",
+			cmd.Symbol, cmd.OrderType, cmd.OrderID, cmd.StopPrice, stopBook.Len())
+	}
+
+	// Produce Event (Canonical State)
+	if err := emitEvent(ctx, cmd.OrderID, eventType, cmd); err != nil {
+		log.Printf("[OMS] Failed to produce event: %v", err)
+		return err
+	}
+
+	// Produce Exec Report (for UI)
+	sendExecReport(execProducer, cmd, "NEW", status, "")
+	return nil
+}
+
+func createOrder(ctx context.Context, cmd model.OrderCommand, status model.OrderStatus) {
 	log.Printf("[OMS] Persisting new order %s to DynamoDB for account %s", cmd.OrderID, cmd.ClientID)
 
-	item, err := attributevalue.MarshalMap(map[string]interface{}{
-		"order_id":   cmd.OrderID,
-		"account_id": cmd.ClientID, // Use ClientID as authoritative account identifier
-		"symbol":     cmd.Symbol,
-		"side":       string(cmd.Side),
-		"price":      cmd.Price,
-		"order_qty":  cmd.QuantityVal,
-		"cum_qty":    0.0,
-		"leaves_qty": cmd.QuantityVal,
-		"avg_px":     0.0,
-		"last_px":    0.0,
-		"status":     string(model.OrderStatusPendingSubmit),
-		"created_at": time.Now().Unix(),
-		"updated_at": time.Now().Unix(),
-	})
+	orderType := cmd.OrderType
+	if orderType == "" && cmd.ContingencyType != model.ContingencyOCO {
+		orderType = model.OrderTypeLimit
+	}
+	attrs := map[string]interface{}{
+		"order_id":    cmd.OrderID,
+		"account_id":  cmd.ClientID, // Use ClientID as authoritative account identifier
+		"symbol":      cmd.Symbol,
+		"side":        string(cmd.Side),
+		"order_type":  string(orderType),
+		"price":       cmd.Price,
+		"stop_price":  cmd.StopPrice,
+		"stp_mode":    string(cmd.STPMode),
+		"post_only":   string(cmd.PostOnly),
+		"display_qty": cmd.DisplayQty,
+		"venue":       cmd.Venue,
+		"fee_tier":    cmd.FeeTier,
+		"order_qty":   cmd.QuantityVal,
+		"cum_qty":     decimal.Zero,
+		"leaves_qty":  cmd.QuantityVal,
+		"avg_px":      decimal.Zero,
+		"last_px":     decimal.Zero,
+		"status":      string(status),
+		"created_at":  time.Now().Unix(),
+		"updated_at":  time.Now().Unix(),
+	}
+	for k, v := range linkAttributes(cmd) {
+		attrs[k] = v
+	}
+	item, err := attributevalue.MarshalMap(attrs)
 	if err != nil {
 		log.Printf("[OMS-ERROR] Failed to marshal order %s: %v", cmd.OrderID, err)
 		return
@@ -328,18 +560,19 @@ func createOrder(ctx context.Context, cmd model.OrderCommand) {
 	}
 }
 
-func updateOrderStatus(ctx context.Context, orderID string, status model.OrderStatus, cumQty float64, avgPrice float64) {
-	log.Printf("[OMS] Updating order %s status to %s (cum_qty=%f, avg_px=%f) in DynamoDB", orderID, status, cumQty, avgPrice)
+func updateOrderStatus(ctx context.Context, orderID string, status model.OrderStatus, cumQty, leavesQty, avgPrice decimal.Decimal) {
+	log.Printf("[OMS] Updating order %s status to %s (cum_qty=%s, leaves_qty=%s, avg_px=%s) in DynamoDB", orderID, status, cumQty, leavesQty, avgPrice)
 
 	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName:                aws.String(awsCfg.OrdersTable),
 		Key:                      map[string]types.AttributeValue{"order_id": &types.AttributeValueMemberS{Value: orderID}},
-		UpdateExpression:         aws.String("SET #s = :s, cum_qty = :cq, avg_px = :ap, updated_at = :u"),
+		UpdateExpression:         aws.String("SET #s = :s, cum_qty = :cq, leaves_qty = :lq, avg_px = :ap, updated_at = :u"),
 		ExpressionAttributeNames: map[string]string{"#s": "status"},
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":s":  &types.AttributeValueMemberS{Value: string(status)},
-			":cq": &types.AttributeValueMemberN{Value: fmt.Sprintf("%f", cumQty)},
-			":ap": &types.AttributeValueMemberN{Value: fmt.Sprintf("%f", avgPrice)},
+			":cq": cumQty.AttributeValue(),
+			":lq": leavesQty.AttributeValue(),
+			":ap": avgPrice.AttributeValue(),
 			":u":  &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", time.Now().Unix())},
 		},
 	})
@@ -351,6 +584,10 @@ func updateOrderStatus(ctx context.Context, orderID string, status model.OrderSt
 }
 
 func sendExecReport(p *kafka.Producer, cmd model.OrderCommand, execType string, status model.OrderStatus, reason string) {
+	publishExecReport(p, newExecReport(cmd, execType, status, reason))
+}
+
+func newExecReport(cmd model.OrderCommand, execType string, status model.OrderStatus, reason string) model.ExecutionReport {
 	report := model.ExecutionReport{
 		ExecID:    uuid.New().String(),
 		OrderID:   cmd.OrderID,
@@ -363,11 +600,22 @@ func sendExecReport(p *kafka.Producer, cmd model.OrderCommand, execType string,
 		Status:    status,
 		Timestamp: time.Now().UTC(),
 		Reason:    reason,
+
+		ParentOrderID:   cmd.ParentOrderID,
+		ContingencyType: cmd.ContingencyType,
+		ReservePx:       cmd.ReservePx,
+		Venue:           cmd.Venue,
 	}
-	if status == model.OrderStatusNew || status == model.OrderStatusPendingSubmit {
+	switch status {
+	case model.OrderStatusNew, model.OrderStatusPendingSubmit, model.OrderStatusPendingTrigger, model.OrderStatusTriggered,
+		model.OrderStatusPendingParent, model.OrderStatusLive, // only OCO containers and algo and routed parents go live here
+		model.OrderStatusCanceled: // only held stops are canceled here, before anything filled
 		report.LeavesQty = cmd.QuantityVal
 	}
+	return report
+}
 
+func publishExecReport(p *kafka.Producer, report model.ExecutionReport) {
 	bytes, _ := json.Marshal(report)
-	p.Produce(context.Background(), []byte(cmd.OrderID), bytes)
+	p.Produce(context.Background(), []byte(report.OrderID), bytes)
 }
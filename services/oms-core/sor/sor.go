@@ -0,0 +1,159 @@
+// Package sor is the smart order router: the consolidated top of book across
+// venues, and how an order is split across them.
+package sor
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/instrument"
+	"github.com/atlas/services/common/model"
+	"github.com/atlas/services/common/venue"
+)
+
+// A quote older than this is from a venue that stopped publishing.
+const staleAfter = 5 * time.Second
+
+// Quote is one venue's best bid and ask.
+type Quote struct {
+	Venue  string
+	Bid    decimal.Decimal
+	BidQty decimal.Decimal
+	Ask    decimal.Decimal
+	AskQty decimal.Decimal
+	At     time.Time
+}
+
+// Book is the consolidated top of book. It is safe for concurrent use.
+type Book struct {
+	mu     sync.Mutex
+	quotes map[string]map[string]Quote // symbol, then venue
+}
+
+func NewBook() *Book {
+	return &Book{quotes: make(map[string]map[string]Quote)}
+}
+
+// Update takes a venue's best levels from an L2 update.
+func (b *Book) Update(update model.MarketDataUpdate) {
+	q := Quote{Venue: update.Venue, At: time.Now()}
+	for _, l := range update.Bids {
+		if px := decimal.FromFloat(l.Price); px.GreaterThan(q.Bid) {
+			q.Bid, q.BidQty = px, decimal.FromFloat(l.Qty)
+		}
+	}
+	for _, l := range update.Asks {
+		if px := decimal.FromFloat(l.Price); q.Ask.IsZero() || px.LessThan(q.Ask) {
+			q.Ask, q.AskQty = px, decimal.FromFloat(l.Qty)
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	venues, ok := b.quotes[update.Symbol]
+	if !ok {
+		venues = make(map[string]Quote)
+		b.quotes[update.Symbol] = venues
+	}
+	venues[update.Venue] = q
+}
+
+// Quotes returns the symbol's current quote from every venue.
+func (b *Book) Quotes(symbol string) []Quote {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []Quote
+	for _, q := range b.quotes[symbol] {
+		if time.Since(q.At) < staleAfter {
+			out = append(out, q)
+		}
+	}
+	return out
+}
+
+// Best is the highest bid and lowest ask across venues; zero if none.
+func (b *Book) Best(symbol string) (bid, ask decimal.Decimal) {
+	for _, q := range b.Quotes(symbol) {
+		if q.Bid.GreaterThan(bid) {
+			bid = q.Bid
+		}
+		if q.Ask.IsPositive() && (ask.IsZero() || q.Ask.LessThan(ask)) {
+			ask = q.Ask
+		}
+	}
+	return bid, ask
+}
+
+// Allocation is the quantity of an order sent to one venue.
+type Allocation struct {
+	Venue string
+	Qty   decimal.Decimal
+}
+
+// Split allocates an order across venues. It takes the size shown at the
+// touch, best price after taker fees first, as far as the order's limit
+// allows; what is left goes to the best venue to rest or sweep deeper, or
+// to the default venue when no venue is quoting.
+func Split(cmd model.OrderCommand, quotes []Quote, venues *venue.Directory, inst instrument.Instrument) []Allocation {
+	type ranked struct {
+		venue string
+		px    decimal.Decimal // after fees
+		qty   decimal.Decimal
+	}
+	var touch []ranked
+	for _, q := range quotes {
+		v, ok := venues.Get(q.Venue)
+		if !ok {
+			continue
+		}
+		px, qty := q.Ask, q.AskQty
+		if cmd.Side == model.OrderSideSell {
+			px, qty = q.Bid, q.BidQty
+		}
+		if !px.IsPositive() {
+			continue
+		}
+		if cmd.Price.IsPositive() &&
+			((cmd.Side == model.OrderSideBuy && px.GreaterThan(cmd.Price)) || (cmd.Side == model.OrderSideSell && px.LessThan(cmd.Price))) {
+			qty = decimal.Zero // not marketable within the limit, but may rest there
+		}
+		touch = append(touch, ranked{venue: v.ID, px: v.Fees(cmd.FeeTier).TakerPx(cmd.Side, px), qty: qty})
+	}
+	sort.Slice(touch, func(i, j int) bool {
+		if !touch[i].px.Equal(touch[j].px) {
+			if cmd.Side == model.OrderSideSell {
+				return touch[i].px.GreaterThan(touch[j].px)
+			}
+			return touch[i].px.LessThan(touch[j].px)
+		}
+		return touch[i].qty.GreaterThan(touch[j].qty)
+	})
+
+	var out []Allocation
+	left := cmd.QuantityVal
+	for _, t := range touch {
+		take := inst.RoundQty(decimal.Min(left, t.qty))
+		if !take.IsPositive() || take.LessThan(inst.MinQty) || (left.Sub(take).IsPositive() && left.Sub(take).LessThan(inst.MinQty)) {
+			continue
+		}
+		out = append(out, Allocation{Venue: t.venue, Qty: take})
+		left = left.Sub(take)
+	}
+	if !left.IsPositive() {
+		return out
+	}
+
+	rest := venues.Default().ID
+	if len(touch) > 0 {
+		rest = touch[0].venue
+	}
+	for i := range out {
+		if out[i].Venue == rest {
+			out[i].Qty = out[i].Qty.Add(left)
+			return out
+		}
+	}
+	return append(out, Allocation{Venue: rest, Qty: left})
+}
@@ -0,0 +1,112 @@
+// Package stops holds STOP and STOP_LIMIT orders until the market trades
+// through their stop price.
+package stops
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/model"
+)
+
+// Book is the set of untriggered stop orders. It is safe for concurrent use.
+type Book struct {
+	mu     sync.Mutex
+	orders map[string]model.OrderCommand
+	// Triggered stops not yet released to the venue, closed once they are.
+	releasing map[string]chan struct{}
+}
+
+func New() *Book {
+	return &Book{
+		orders:    make(map[string]model.OrderCommand),
+		releasing: make(map[string]chan struct{}),
+	}
+}
+
+// Add holds a stop order until it triggers or is canceled.
+func (b *Book) Add(cmd model.OrderCommand) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.orders[cmd.OrderID] = cmd
+}
+
+// Remove takes a stop order out of the book, e.g. to cancel it. It returns
+// false if the order is not held, because it already triggered. A stop
+// still being released to the venue is waited for, so whatever the caller
+// sends about it next follows the release.
+func (b *Book) Remove(orderID string) (model.OrderCommand, bool) {
+	b.mu.Lock()
+	cmd, ok := b.orders[orderID]
+	if ok {
+		delete(b.orders, orderID)
+	}
+	done := b.releasing[orderID]
+	b.mu.Unlock()
+
+	if done != nil {
+		<-done
+	}
+	return cmd, ok
+}
+
+// Released marks a triggered stop as released to the venue. Every stop
+// Trigger returns must be released.
+func (b *Book) Released(orderID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if done, ok := b.releasing[orderID]; ok {
+		close(done)
+		delete(b.releasing, orderID)
+	}
+}
+
+// Trigger removes and returns every stop a trade at px in symbol sets off:
+// buy stops at or below px, sell stops at or above it. They are returned in
+// the order the market reached them, farthest from px first, then by
+// arrival, and must each be released once sent on.
+func (b *Book) Trigger(symbol string, px decimal.Decimal) []model.OrderCommand {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var out []model.OrderCommand
+	for id, cmd := range b.orders {
+		if cmd.Symbol != symbol {
+			continue
+		}
+		if (cmd.Side == model.OrderSideBuy && px.GreaterThanOrEqual(cmd.StopPrice)) ||
+			(cmd.Side == model.OrderSideSell && px.LessThanOrEqual(cmd.StopPrice)) {
+			out = append(out, cmd)
+			delete(b.orders, id)
+			b.releasing[id] = make(chan struct{})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		di := px.Sub(out[i].StopPrice).Abs()
+		dj := px.Sub(out[j].StopPrice).Abs()
+		if !di.Equal(dj) {
+			return di.GreaterThan(dj)
+		}
+		return out[i].Timestamp.Before(out[j].Timestamp)
+	})
+	return out
+}
+
+// Len returns the number of stops held.
+func (b *Book) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.orders)
+}
+
+// Release turns a triggered stop into the order sent to the venue: STOP
+// becomes MARKET (keeping its protection price) and STOP_LIMIT becomes LIMIT.
+func Release(cmd model.OrderCommand) model.OrderCommand {
+	if cmd.OrderType == model.OrderTypeStop {
+		cmd.OrderType = model.OrderTypeMarket
+	} else {
+		cmd.OrderType = model.OrderTypeLimit
+	}
+	return cmd
+}
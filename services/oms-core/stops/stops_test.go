@@ -0,0 +1,121 @@
+package stops
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/model"
+)
+
+var t0 = time.Date(2026, 1, 5, 9, 30, 0, 0, time.UTC)
+
+func stop(id string, side model.OrderSide, stopPx string, arrived int) model.OrderCommand {
+	return model.OrderCommand{
+		OrderID:   id,
+		Symbol:    "BTC-USD",
+		Side:      side,
+		OrderType: model.OrderTypeStop,
+		StopPrice: decimal.RequireFromString(stopPx),
+		Timestamp: t0.Add(time.Duration(arrived) * time.Second),
+	}
+}
+
+func ids(cmds []model.OrderCommand) []string {
+	out := []string{}
+	for _, c := range cmds {
+		out = append(out, c.OrderID)
+	}
+	return out
+}
+
+func TestTrigger(t *testing.T) {
+	b := New()
+	for _, c := range []model.OrderCommand{
+		stop("buy-102", model.OrderSideBuy, "102", 0),
+		stop("buy-108", model.OrderSideBuy, "108", 1),
+		stop("buy-105-late", model.OrderSideBuy, "105", 3),
+		stop("buy-105", model.OrderSideBuy, "105", 2),
+		stop("buy-111", model.OrderSideBuy, "111", 4),
+		stop("sell-98", model.OrderSideSell, "98", 5),
+		stop("sell-92", model.OrderSideSell, "92", 6),
+	} {
+		b.Add(c)
+	}
+	other := stop("eth-buy", model.OrderSideBuy, "1", 7)
+	other.Symbol = "ETH-USD"
+	b.Add(other)
+
+	tests := []struct {
+		name string
+		px   string
+		want []string
+	}{
+		// The market rose through 102 first, so it is released first.
+		{"buy stops at or below", "108", []string{"buy-102", "buy-105", "buy-105-late", "buy-108"}},
+		{"already triggered", "108", []string{}},
+		{"sell stops at or above", "95", []string{"sell-98"}},
+		{"sell stop at its price", "92", []string{"sell-92"}},
+	}
+	for _, tt := range tests {
+		got := ids(b.Trigger("BTC-USD", decimal.RequireFromString(tt.px)))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Trigger(%s) = %v, want %v", tt.name, tt.px, got, tt.want)
+		}
+		for _, id := range got {
+			b.Released(id)
+		}
+	}
+	if n := b.Len(); n != 2 {
+		t.Errorf("Len = %d, want 2 (buy-111 and the ETH stop)", n)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	b := New()
+	b.Add(stop("held", model.OrderSideBuy, "110", 0))
+	b.Add(stop("fired", model.OrderSideBuy, "100", 1))
+
+	if cmd, ok := b.Remove("held"); !ok || cmd.OrderID != "held" {
+		t.Errorf("Remove(held) = %s, %v", cmd.OrderID, ok)
+	}
+	if _, ok := b.Remove("held"); ok {
+		t.Errorf("Remove(held) twice succeeded")
+	}
+	if _, ok := b.Remove("unknown"); ok {
+		t.Errorf("Remove(unknown) succeeded")
+	}
+
+	b.Trigger("BTC-USD", decimal.RequireFromString("100"))
+	removed := make(chan bool)
+	go func() {
+		_, ok := b.Remove("fired")
+		removed <- ok
+	}()
+	select {
+	case <-removed:
+		t.Fatalf("Remove returned before the triggered stop was released")
+	case <-time.After(20 * time.Millisecond):
+	}
+	b.Released("fired")
+	if ok := <-removed; ok {
+		t.Errorf("Remove(fired) succeeded after it triggered")
+	}
+}
+
+func TestRelease(t *testing.T) {
+	tests := []struct {
+		in, want model.OrderType
+	}{
+		{model.OrderTypeStop, model.OrderTypeMarket},
+		{model.OrderTypeStopLimit, model.OrderTypeLimit},
+	}
+	for _, tt := range tests {
+		cmd := model.OrderCommand{OrderType: tt.in, Price: decimal.RequireFromString("101")}
+		got := Release(cmd)
+		if got.OrderType != tt.want || !got.Price.Equal(cmd.Price) {
+			t.Errorf("Release(%s) = %s @ %s, want %s @ %s", tt.in, got.OrderType, got.Price, tt.want, cmd.Price)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/kafka"
+	"github.com/atlas/services/common/model"
+	"github.com/atlas/services/oms-core/stops"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+// triggerStop releases a stop the market traded through: it is marked
+// TRIGGERED, then submitted to the venue as a MARKET (from STOP) or LIMIT
+// (from STOP_LIMIT) order, with an exec report for each step.
+func triggerStop(ctx context.Context, execProducer *kafka.Producer, cmd model.OrderCommand, px decimal.Decimal) {
+	defer stopBook.Released(cmd.OrderID)
+	log.Printf("[OMS] 🎯 STOP TRIGGERED: order_id=%s %s %s stop=%s trade=%s", cmd.OrderID, cmd.Side, cmd.Symbol, cmd.StopPrice, px)
+
+	updateOrderStatus(ctx, cmd.OrderID, model.OrderStatusTriggered, decimal.Zero, cmd.QuantityVal, decimal.Zero)
+	if err := emitEvent(ctx, cmd.OrderID, "ORDER_TRIGGERED", cmd); err != nil {
+		log.Printf("[OMS] Failed to produce event: %v", err)
+	}
+	sendExecReport(execProducer, cmd, "TRIGGERED", model.OrderStatusTriggered, "")
+
+	released := stops.Release(cmd)
+	updateOrderStatus(ctx, cmd.OrderID, model.OrderStatusPendingSubmit, decimal.Zero, cmd.QuantityVal, decimal.Zero)
+	if err := emitEvent(ctx, cmd.OrderID, "ORDER_CREATED", released); err != nil {
+		log.Printf("[OMS] Failed to produce event: %v", err)
+		return
+	}
+	log.Printf("[OMS] Released order %s to the venue as %s px=%s", cmd.OrderID, released.OrderType, released.Price)
+	sendExecReport(execProducer, released, "NEW", model.OrderStatusPendingSubmit, "")
+}
+
+// cancelStop cancels a stop. Until it triggers nothing is at the venue, so
+// it is canceled here rather than requested. A stop that triggered since its
+// state was read has gone to the venue, and its cancel is requested there.
+func cancelStop(ctx context.Context, execProducer *kafka.Producer, cancel model.OrderCommand) {
+	cmd, ok := stopBook.Remove(cancel.OrderID)
+	if !ok {
+		o, err := loadOrder(ctx, cancel.OrderID)
+		if err != nil {
+			log.Printf("[OMS] Cannot cancel triggered stop %s: %v", cancel.OrderID, err)
+			return
+		}
+		if isTerminal(model.OrderStatus(o.Status)) {
+			log.Printf("[OMS] Cannot cancel stop %s: already %s", cancel.OrderID, o.Status)
+			return
+		}
+		log.Printf("[OMS] Stop %s already triggered, canceling it at the venue", cancel.OrderID)
+		requestCancel(ctx, execProducer, o)
+		return
+	}
+
+	updateOrderStatus(ctx, cmd.OrderID, model.OrderStatusCanceled, decimal.Zero, decimal.Zero, decimal.Zero)
+	log.Printf("[OMS] ✅ STATE TRANSITION: order_id=%s %s → %s", cmd.OrderID, model.OrderStatusPendingTrigger, model.OrderStatusCanceled)
+	report := newExecReport(cmd, "CANCELED", model.OrderStatusCanceled, "")
+	if err := emitEvent(ctx, cmd.OrderID, "ORDER_CANCELED", report); err != nil {
+		log.Printf("[OMS] Failed to produce event: %v", err)
+	}
+	publishExecReport(execProducer, report)
+}
+
+func emitEvent(ctx context.Context, orderID, eventType string, payload interface{}) error {
+	event := model.OrderEvent{
+		EventID:   uuid.New().String(),
+		OrderID:   orderID,
+		Type:      eventType,
+		Payload:   payload,
+		Timestamp: time.Now().UTC(),
+	}
+	eventBytes, _ := json.Marshal(event)
+	if err := producer.Produce(ctx, []byte(orderID), eventBytes); err != nil {
+		return err
+	}
+	log.Printf("[OMS] Emitted event: type=%s order_id=%s to topic=%s", eventType, orderID, topicEvents)
+	return nil
+}
+
+// loadPendingStops puts the stops persisted as PENDING_TRIGGER back in the
+// stop book after a restart.
+func loadPendingStops(ctx context.Context) error {
+	input := &dynamodb.ScanInput{
+		TableName:                aws.String(awsCfg.OrdersTable),
+		FilterExpression:         aws.String("#s = :pt"),
+		ExpressionAttributeNames: map[string]string{"#s": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pt": &types.AttributeValueMemberS{Value: string(model.OrderStatusPendingTrigger)},
+		},
+	}
+
+	for {
+		result, err := dynamoClient.Scan(ctx, input)
+		if err != nil {
+			return err
+		}
+		for _, item := range result.Items {
+			var o struct {
+				OrderID    string          `dynamodbav:"order_id"`
+				AccountID  string          `dynamodbav:"account_id"`
+				Symbol     string          `dynamodbav:"symbol"`
+				Side       string          `dynamodbav:"side"`
+				OrderType  string          `dynamodbav:"order_type"`
+				Price      decimal.Decimal `dynamodbav:"price"`
+				StopPrice  decimal.Decimal `dynamodbav:"stop_price"`
+				STPMode    string          `dynamodbav:"stp_mode"`
+				PostOnly   string          `dynamodbav:"post_only"`
+				DisplayQty decimal.Decimal `dynamodbav:"display_qty"`
+				Venue      string          `dynamodbav:"venue"`
+				FeeTier    string          `dynamodbav:"fee_tier"`
+				OrderQty   decimal.Decimal `dynamodbav:"order_qty"`
+				CreatedAt  int64           `dynamodbav:"created_at"`
+
+				ParentOrderID   string          `dynamodbav:"parent_order_id"`
+				ReservePx       decimal.Decimal `dynamodbav:"reserve_px"`
+				ContingencyType string          `dynamodbav:"contingency_type"`
+				Legs            string          `dynamodbav:"legs"`
+			}
+			if err := attributevalue.UnmarshalMap(item, &o); err != nil {
+				return err
+			}
+			cmd := model.OrderCommand{
+				Type:        model.CommandTypeNew,
+				OrderID:     o.OrderID,
+				ClientID:    o.AccountID,
+				Symbol:      o.Symbol,
+				Side:        model.OrderSide(o.Side),
+				OrderType:   model.OrderType(o.OrderType),
+				QuantityVal: o.OrderQty,
+				Price:       o.Price,
+				StopPrice:   o.StopPrice,
+				STPMode:     model.STPMode(o.STPMode),
+				PostOnly:    model.PostOnly(o.PostOnly),
+				DisplayQty:  o.DisplayQty,
+				Venue:       o.Venue,
+				FeeTier:     o.FeeTier,
+				Timestamp:   time.Unix(o.CreatedAt, 0).UTC(),
+
+				ParentOrderID:   o.ParentOrderID,
+				ReservePx:       o.ReservePx,
+				ContingencyType: model.ContingencyType(o.ContingencyType),
+			}
+			if o.Legs != "" {
+				json.Unmarshal([]byte(o.Legs), &cmd.Legs)
+			}
+			stopBook.Add(cmd)
+		}
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+	log.Printf("[OMS] Loaded %d pending stop order(s)", stopBook.Len())
+	return nil
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/atlas/services/common/borrow"
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+// Short selling. A sale beyond what the account holds borrows the rest, and
+// needs a locate for it: a quantity of the asset set aside from the borrow
+// inventory for the account. The located quantity is how far short the
+// account may go. Easy-to-borrow assets are located at order entry as
+// needed; hard-to-borrow ones must be located first through
+// POST /accounts/{account_id}/locates. Locates are held until returned.
+// Borrow fees accrue daily in position-service.
+//
+// Account balances are held in USD and BTC only, so BTC is the one asset an
+// account can go short: a short in any other would be booked against BTC.
+const (
+	shortableAsset = "BTC"
+
+	// Reason codes on short sales rejected for borrow.
+	reasonLocateRequired = "LOCATE_REQUIRED"
+	reasonNoBorrow       = "NO_BORROW"
+)
+
+var (
+	borrowInventory *borrow.Inventory
+
+	errNoBorrow      = errors.New("not enough inventory to borrow")
+	errNotBorrowable = errors.New("asset cannot be borrowed")
+	errLocateInUse   = errors.New("located quantity is covering a short")
+)
+
+type locateRequest struct {
+	Asset    string          `json:"asset"`
+	Quantity decimal.Decimal `json:"quantity"`
+}
+
+// locatedAttr is the balances attribute holding the account's locate for
+// asset.
+func locatedAttr(asset string) string {
+	return "located_" + strings.ToLower(asset)
+}
+
+// readLocates picks the located_* attributes out of a balances item.
+func readLocates(item map[string]types.AttributeValue) map[string]decimal.Decimal {
+	var locates map[string]decimal.Decimal
+	for name, av := range item {
+		asset, ok := strings.CutPrefix(name, "located_")
+		if !ok {
+			continue
+		}
+		var qty decimal.Decimal
+		if err := attributevalue.Unmarshal(av, &qty); err != nil || qty.IsZero() {
+			continue
+		}
+		if locates == nil {
+			locates = make(map[string]decimal.Decimal)
+		}
+		locates[strings.ToUpper(asset)] = qty
+	}
+	return locates
+}
+
+// seedBorrowInventory writes the configured inventory of every asset not in
+// the borrow table yet. What is left of an asset already there is kept.
+func seedBorrowInventory(ctx context.Context) {
+	for _, a := range borrowInventory.All() {
+		item, _ := attributevalue.MarshalMap(map[string]interface{}{
+			"asset":     a.Asset,
+			"status":    string(a.Status),
+			"available": a.Available,
+			"rate_bps":  a.RateBps,
+		})
+		_, err := dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:           aws.String(awsCfg.BorrowTable),
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(asset)"),
+		})
+		var condErr *types.ConditionalCheckFailedException
+		switch {
+		case errors.As(err, &condErr):
+		case err != nil:
+			log.Printf("[DDB-WRITE-ERROR] Table=%s Key=%s Error=%v", awsCfg.BorrowTable, a.Asset, err)
+		default:
+			log.Printf("[DDB-WRITE-SUCCESS] Table=%s Key=%s (Borrow inventory seeded: %s)", awsCfg.BorrowTable, a.Asset, a.Available)
+		}
+	}
+}
+
+// borrowAvailability returns every asset's terms with what is left to
+// borrow.
+func borrowAvailability(ctx context.Context) ([]borrow.Asset, error) {
+	out := borrowInventory.All()
+	for i, a := range out {
+		result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName: aws.String(awsCfg.BorrowTable),
+			Key: map[string]types.AttributeValue{
+				"asset": &types.AttributeValueMemberS{Value: a.Asset},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		var left struct {
+			Available decimal.Decimal `dynamodbav:"available"`
+		}
+		if err := attributevalue.UnmarshalMap(result.Item, &left); err != nil {
+			return nil, err
+		}
+		out[i].Available = left.Available
+	}
+	return out, nil
+}
+
+// adjustBorrow takes qty from the asset's inventory, or returns it when qty
+// is negative.
+func adjustBorrow(ctx context.Context, asset string, qty decimal.Decimal) error {
+	update := &dynamodb.UpdateItemInput{
+		TableName: aws.String(awsCfg.BorrowTable),
+		Key: map[string]types.AttributeValue{
+			"asset": &types.AttributeValueMemberS{Value: asset},
+		},
+		UpdateExpression:    aws.String("SET available = available - :q"),
+		ConditionExpression: aws.String("available >= :q"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":q": qty.AttributeValue(),
+		},
+	}
+	if _, err := dynamoClient.UpdateItem(ctx, update); err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return errNoBorrow
+		}
+		log.Printf("[DDB-WRITE-ERROR] Table=%s Key=%s Error=%v", awsCfg.BorrowTable, asset, err)
+		return err
+	}
+	log.Printf("[DDB-WRITE-SUCCESS] Table=%s Key=%s (Borrow inventory %s)", awsCfg.BorrowTable, asset, qty.Neg())
+	return nil
+}
+
+// locate sets qty of asset aside for the account from the borrow inventory.
+func locate(ctx context.Context, accountID, asset string, qty decimal.Decimal, actor string) error {
+	terms, ok := borrowInventory.Get(asset)
+	if !ok || asset != shortableAsset {
+		return errNotBorrowable
+	}
+	if err := adjustBorrow(ctx, asset, qty); err != nil {
+		return err
+	}
+
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(awsCfg.BalancesTable),
+		Key: map[string]types.AttributeValue{
+			"account_id": &types.AttributeValueMemberS{Value: accountID},
+		},
+		UpdateExpression:         aws.String("SET #loc = if_not_exists(#loc, :zero) + :q"),
+		ExpressionAttributeNames: map[string]string{"#loc": locatedAttr(asset)},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":q":    qty.AttributeValue(),
+			":zero": decimal.Zero.AttributeValue(),
+		},
+	})
+	if err != nil {
+		log.Printf("[DDB-WRITE-ERROR] Table=%s Key=%s Error=%v", awsCfg.BalancesTable, accountID, err)
+		adjustBorrow(ctx, asset, qty.Neg())
+		return err
+	}
+	log.Printf("[DDB-WRITE-SUCCESS] Table=%s Key=%s (Located %s %s)", awsCfg.BalancesTable, accountID, qty, asset)
+
+	publishAudit(ctx, model.AuditEvent{
+		Type:      model.AuditLocateGranted,
+		AccountID: accountID,
+		Actor:     actor,
+		Details: map[string]interface{}{
+			"asset":    asset,
+			"quantity": qty,
+			"status":   terms.Status,
+			"rate_bps": terms.RateBps,
+		},
+	})
+	return nil
+}
+
+// returnLocate gives back the part of the account's locate for asset that
+// no short, open or pending, is using, and reports how much that was.
+func returnLocate(ctx context.Context, accountID, asset string) (decimal.Decimal, error) {
+	acc, err := getAccount(ctx, accountID)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	located := acc.Locates[asset]
+	short := decimal.Max(acc.BTC.Available.Neg(), decimal.Zero)
+	unused := located.Sub(short)
+	if !unused.IsPositive() {
+		return decimal.Zero, errLocateInUse
+	}
+
+	_, err = dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(awsCfg.BalancesTable),
+		Key: map[string]types.AttributeValue{
+			"account_id": &types.AttributeValueMemberS{Value: accountID},
+		},
+		UpdateExpression:         aws.String("SET #loc = #loc - :q"),
+		ConditionExpression:      aws.String("#loc = :located AND btc_available >= :avail"),
+		ExpressionAttributeNames: map[string]string{"#loc": locatedAttr(asset)},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":q":       unused.AttributeValue(),
+			":located": located.AttributeValue(),
+			":avail":   acc.BTC.Available.AttributeValue(),
+		},
+	})
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return decimal.Zero, errLocateInUse
+		}
+		log.Printf("[DDB-WRITE-ERROR] Table=%s Key=%s Error=%v", awsCfg.BalancesTable, accountID, err)
+		return decimal.Zero, err
+	}
+	log.Printf("[DDB-WRITE-SUCCESS] Table=%s Key=%s (Returned locate %s %s)", awsCfg.BalancesTable, accountID, unused, asset)
+
+	if err := adjustBorrow(ctx, asset, unused.Neg()); err != nil {
+		log.Printf("[GATEWAY] Could not return %s %s to the borrow inventory: %v", unused, asset, err)
+	}
+	publishAudit(ctx, model.AuditEvent{
+		Type:      model.AuditLocateReturned,
+		AccountID: accountID,
+		Actor:     actorSelf,
+		Details:   map[string]interface{}{"asset": asset, "quantity": unused},
+	})
+	return unused, nil
+}
+
+// checkLocate makes sure a sale of qty of asset that takes the account short
+// is covered by a locate, locating easy-to-borrow assets as needed. It
+// returns a rejection, or nil if the sale may go ahead.
+func checkLocate(ctx context.Context, accountID string, acc *model.Account, cmd model.OrderCommand, asset string, qty decimal.Decimal) *model.RiskDecision {
+	if asset != shortableAsset {
+		return borrowRejection(cmd, reasonNoBorrow, fmt.Sprintf("%s cannot be sold short: only %s balances are held", asset, shortableAsset))
+	}
+	short := qty.Sub(acc.BTC.Available) // what the account is short after the sale
+	located := acc.Locates[asset]
+	if !located.LessThan(short) {
+		return nil
+	}
+
+	terms, ok := borrowInventory.Get(asset)
+	if !ok {
+		return borrowRejection(cmd, reasonNoBorrow, fmt.Sprintf("%s cannot be borrowed", asset))
+	}
+	if terms.Status == borrow.HardToBorrow {
+		return borrowRejection(cmd, reasonLocateRequired,
+			fmt.Sprintf("%s is hard to borrow: locate %s before selling short (located %s)", asset, short, located))
+	}
+	need := short.Sub(located)
+	if err := locate(ctx, accountID, asset, need, actorSystem); err != nil {
+		log.Printf("[GATEWAY] Auto-locate of %s %s for %s failed: %v", need, asset, accountID, err)
+		return borrowRejection(cmd, reasonNoBorrow, fmt.Sprintf("Could not locate %s %s: %v", need, asset, err))
+	}
+	if acc.Locates == nil {
+		acc.Locates = make(map[string]decimal.Decimal)
+	}
+	acc.Locates[asset] = short
+	return nil
+}
+
+func borrowRejection(cmd model.OrderCommand, code, reason string) *model.RiskDecision {
+	return &model.RiskDecision{
+		DecisionID: uuid.New().String(),
+		OrderID:    cmd.OrderID,
+		Decision:   "REJECTED",
+		Reason:     reason,
+		ReasonCode: code,
+		Timestamp:  time.Now().UTC(),
+	}
+}
+
+// handleBorrow lists the borrow inventory.
+func handleBorrow(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	assets, err := borrowAvailability(r.Context())
+	if err != nil {
+		log.Printf("[GATEWAY] Error reading borrow inventory: %v", err)
+		http.Error(w, "Error reading borrow inventory", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(assets)
+}
+
+// locatesHandler lists (GET), requests (POST) or returns the unused part of
+// (DELETE ?asset=) the account's locates.
+func locatesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	accountID := r.PathValue("account_id")
+
+	switch r.Method {
+	case "GET":
+	case "POST":
+		var req locateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Asset == "" || !req.Quantity.IsPositive() {
+			http.Error(w, "asset and a positive quantity are required", http.StatusBadRequest)
+			return
+		}
+		if _, err := getAccount(ctx, accountID); err != nil {
+			http.Error(w, "Error loading account", http.StatusInternalServerError)
+			return
+		}
+		err := locate(ctx, accountID, req.Asset, req.Quantity, actorSelf)
+		if errors.Is(err, errNoBorrow) || errors.Is(err, errNotBorrowable) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("[GATEWAY] Locate for %s failed: %v", accountID, err)
+			http.Error(w, "Error locating", http.StatusInternalServerError)
+			return
+		}
+	case "DELETE":
+		asset := r.URL.Query().Get("asset")
+		if asset == "" {
+			http.Error(w, "asset is required", http.StatusBadRequest)
+			return
+		}
+		if _, err := returnLocate(ctx, accountID, asset); err != nil {
+			if errors.Is(err, errLocateInUse) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			log.Printf("[GATEWAY] Returning locate for %s failed: %v", accountID, err)
+			http.Error(w, "Error returning locate", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	acc, err := getAccount(ctx, accountID)
+	if err != nil {
+		http.Error(w, "Error loading account", http.StatusInternalServerError)
+		return
+	}
+	locates := acc.Locates
+	if locates == nil {
+		locates = map[string]decimal.Decimal{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(locates)
+}
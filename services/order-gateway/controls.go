@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/atlas/services/common/kafka"
+	"github.com/atlas/services/common/model"
+	"github.com/atlas/services/common/schema"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+// Account controls: mass cancel and the kill switch. Each is available to the
+// account itself under /accounts/{account_id}/ and to operators under
+// /admin/accounts/{account_id}/. A kill switch engaged by an admin can only be
+// released by an admin.
+const (
+	actorSelf  = "self"
+	actorAdmin = "admin"
+
+	// reasonKillSwitch is the reason code on orders rejected while the
+	// account's kill switch is engaged.
+	reasonKillSwitch = "KILL_SWITCH"
+)
+
+var (
+	topicAudit    = "audit.events"
+	auditProducer *kafka.Producer
+
+	// Admin endpoints are disabled unless a token is configured.
+	adminToken = os.Getenv("ATLAS_ADMIN_TOKEN")
+
+	errKillSwitch      = errors.New("kill switch engaged")
+	errAdminKillSwitch = errors.New("kill switch was engaged by an admin and can only be released by an admin")
+)
+
+type killSwitchRequest struct {
+	Engaged bool   `json:"engaged"`
+	Reason  string `json:"reason"`
+	// CancelOpenOrders also mass-cancels every open order when engaging.
+	CancelOpenOrders bool `json:"cancel_open_orders"`
+}
+
+type massCancelRequest struct {
+	Symbol string          `json:"symbol,omitempty"`
+	Side   model.OrderSide `json:"side,omitempty"`
+	Reason string          `json:"reason,omitempty"`
+
+	// Set for cancel-on-disconnect: only the session's own orders.
+	sessionID string
+	orderIDs  map[string]bool
+}
+
+// MassCancelResult lists the orders a mass cancel acted on. Pending orders
+// have not been acknowledged by the venue yet and cannot be canceled.
+type MassCancelResult struct {
+	AccountID string   `json:"account_id"`
+	Symbol    string   `json:"symbol,omitempty"`
+	Side      string   `json:"side,omitempty"`
+	Canceled  []string `json:"canceled"`
+	Pending   []string `json:"pending,omitempty"`
+	Failed    []string `json:"failed,omitempty"`
+}
+
+// requireAdmin only lets requests through that carry the configured admin
+// token in X-Atlas-Admin-Token.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if adminToken == "" {
+			http.Error(w, "Admin endpoints are disabled", http.StatusForbidden)
+			return
+		}
+		token := r.Header.Get("X-Atlas-Admin-Token")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// killSwitchHandler reports (GET) or changes (POST) an account's kill switch.
+func killSwitchHandler(actor string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		accountID := r.PathValue("account_id")
+
+		switch r.Method {
+		case "GET":
+			acc, err := getAccount(ctx, accountID)
+			if err != nil {
+				log.Printf("[GATEWAY] Error loading account %s: %v", accountID, err)
+				http.Error(w, "Error loading account", http.StatusInternalServerError)
+				return
+			}
+			ks := acc.KillSwitch
+			if ks == nil {
+				ks = &model.KillSwitch{}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(ks)
+
+		case "POST":
+			var req killSwitchRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+
+			ks, changed, err := setKillSwitch(ctx, accountID, req.Engaged, actor, req.Reason)
+			if errors.Is(err, errAdminKillSwitch) {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			if err != nil {
+				log.Printf("[GATEWAY] Error updating kill switch for %s: %v", accountID, err)
+				http.Error(w, "Error updating kill switch", http.StatusInternalServerError)
+				return
+			}
+			if changed {
+				eventType := model.AuditKillSwitchReleased
+				if ks.Engaged {
+					eventType = model.AuditKillSwitchEngaged
+				}
+				log.Printf("[GATEWAY] 🛑 %s account=%s actor=%s reason=%q", eventType, accountID, actor, req.Reason)
+				publishAudit(ctx, model.AuditEvent{
+					Type:      eventType,
+					AccountID: accountID,
+					Actor:     actor,
+					Reason:    req.Reason,
+				})
+			}
+
+			resp := map[string]interface{}{"kill_switch": ks}
+			if req.Engaged && req.CancelOpenOrders {
+				result, err := massCancel(ctx, accountID, massCancelRequest{Reason: req.Reason}, actor)
+				if err != nil {
+					log.Printf("[GATEWAY] Mass cancel for %s failed: %v", accountID, err)
+					http.Error(w, "Kill switch engaged, but canceling open orders failed", http.StatusInternalServerError)
+					return
+				}
+				resp["mass_cancel"] = result
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(resp)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// massCancelHandler cancels the account's open orders, optionally only those
+// for one symbol and/or side.
+func massCancelHandler(actor string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		accountID := r.PathValue("account_id")
+
+		var req massCancelRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+		if req.Side != "" && req.Side != model.OrderSideBuy && req.Side != model.OrderSideSell {
+			http.Error(w, "side must be BUY or SELL", http.StatusBadRequest)
+			return
+		}
+
+		result, err := massCancel(r.Context(), accountID, req, actor)
+		if err != nil {
+			log.Printf("[GATEWAY] Mass cancel for %s failed: %v", accountID, err)
+			http.Error(w, "Error canceling orders", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// massCancel sends a CANCEL command through oms-core for every matching open
+// order and records the action as an audit event.
+func massCancel(ctx context.Context, accountID string, req massCancelRequest, actor string) (*MassCancelResult, error) {
+	orders, err := getOpenOrders(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &MassCancelResult{
+		AccountID: accountID,
+		Symbol:    req.Symbol,
+		Side:      string(req.Side),
+		Canceled:  []string{},
+	}
+	for _, o := range orders {
+		if (req.Symbol != "" && o.Symbol != req.Symbol) || (req.Side != "" && o.Side != req.Side) {
+			continue
+		}
+		if req.orderIDs != nil && !req.orderIDs[o.OrderID] {
+			continue
+		}
+		switch o.Status {
+		case model.OrderStatusLive, model.OrderStatusPartiallyFilled, model.OrderStatusPendingTrigger, model.OrderStatusPendingParent, model.OrderStatusPaused:
+		case model.OrderStatusPendingSubmit, model.OrderStatusTriggered:
+			result.Pending = append(result.Pending, o.OrderID)
+			continue
+		default:
+			continue // a cancel or replace is already in flight
+		}
+
+		cmd := model.OrderCommand{
+			CommandID: uuid.New().String(),
+			Type:      model.CommandTypeCancel,
+			OrderID:   o.OrderID,
+			ClientID:  accountID,
+			Symbol:    o.Symbol,
+			Side:      o.Side,
+			Timestamp: time.Now().UTC(),
+		}
+		value, _ := json.Marshal(cmd)
+		if err := producer.Produce(ctx, []byte(cmd.OrderID), value); err != nil {
+			log.Printf("[GATEWAY] Failed to produce CANCEL for order_id=%s: %v", cmd.OrderID, err)
+			result.Failed = append(result.Failed, o.OrderID)
+			continue
+		}
+		result.Canceled = append(result.Canceled, o.OrderID)
+	}
+
+	log.Printf("[GATEWAY] 🧹 MASS_CANCEL account=%s actor=%s symbol=%q side=%q canceled=%d pending=%d failed=%d",
+		accountID, actor, req.Symbol, req.Side, len(result.Canceled), len(result.Pending), len(result.Failed))
+
+	details := map[string]interface{}{
+		"canceled": result.Canceled,
+	}
+	if req.Symbol != "" {
+		details["symbol"] = req.Symbol
+	}
+	if req.Side != "" {
+		details["side"] = req.Side
+	}
+	if req.sessionID != "" {
+		details["session_id"] = req.sessionID
+	}
+	if len(result.Pending) > 0 {
+		details["pending"] = result.Pending
+	}
+	if len(result.Failed) > 0 {
+		details["failed"] = result.Failed
+	}
+	publishAudit(ctx, model.AuditEvent{
+		Type:      model.AuditMassCancel,
+		AccountID: accountID,
+		Actor:     actor,
+		Reason:    req.Reason,
+		Details:   details,
+	})
+	return result, nil
+}
+
+// setKillSwitch engages or releases the account's kill switch and reports
+// whether its state changed. The account itself may not override an admin.
+func setKillSwitch(ctx context.Context, accountID string, engaged bool, actor, reason string) (*model.KillSwitch, bool, error) {
+	// Ensure account exists first
+	if _, err := getAccount(ctx, accountID); err != nil {
+		return nil, false, fmt.Errorf("failed to prepare account: %w", err)
+	}
+
+	ks := &model.KillSwitch{
+		Engaged:   engaged,
+		Reason:    reason,
+		Actor:     actor,
+		UpdatedAt: time.Now().UTC(),
+	}
+	update := &dynamodb.UpdateItemInput{
+		TableName: aws.String(awsCfg.BalancesTable),
+		Key: map[string]types.AttributeValue{
+			"account_id": &types.AttributeValueMemberS{Value: accountID},
+		},
+		UpdateExpression: aws.String("SET kill_switch = :ks, kill_switch_reason = :r, kill_switch_actor = :a, kill_switch_at = :t"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":ks": &types.AttributeValueMemberBOOL{Value: engaged},
+			":r":  &types.AttributeValueMemberS{Value: reason},
+			":a":  &types.AttributeValueMemberS{Value: actor},
+			":t":  &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", ks.UpdatedAt.Unix())},
+		},
+		ReturnValues: types.ReturnValueUpdatedOld,
+	}
+	if actor != actorAdmin {
+		update.ConditionExpression = aws.String("attribute_not_exists(kill_switch) OR kill_switch = :off OR kill_switch_actor <> :admin")
+		update.ExpressionAttributeValues[":off"] = &types.AttributeValueMemberBOOL{Value: false}
+		update.ExpressionAttributeValues[":admin"] = &types.AttributeValueMemberS{Value: actorAdmin}
+	}
+
+	out, err := dynamoClient.UpdateItem(ctx, update)
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return nil, false, errAdminKillSwitch
+		}
+		log.Printf("[DDB-WRITE-ERROR] Table=%s Key=%s Error=%v", awsCfg.BalancesTable, accountID, err)
+		return nil, false, err
+	}
+	log.Printf("[DDB-WRITE-SUCCESS] Table=%s Key=%s (Kill switch engaged=%t by %s)", awsCfg.BalancesTable, accountID, engaged, actor)
+
+	var old struct {
+		KillSwitch bool `dynamodbav:"kill_switch"`
+	}
+	attributevalue.UnmarshalMap(out.Attributes, &old)
+	return ks, old.KillSwitch != engaged, nil
+}
+
+// killSwitchRejection is the decision returned for orders blocked by the
+// account's kill switch.
+func killSwitchRejection(cmd model.OrderCommand, ks *model.KillSwitch) *model.RiskDecision {
+	reason := fmt.Sprintf("Kill switch engaged by %s", ks.Actor)
+	if ks.Reason != "" {
+		reason += ": " + ks.Reason
+	}
+	return &model.RiskDecision{
+		DecisionID: uuid.New().String(),
+		OrderID:    cmd.OrderID,
+		Decision:   "REJECTED",
+		Reason:     reason,
+		ReasonCode: reasonKillSwitch,
+		Timestamp:  time.Now().UTC(),
+	}
+}
+
+func publishAudit(ctx context.Context, event model.AuditEvent) {
+	event.EventID = uuid.New().String()
+	event.Timestamp = time.Now().UTC()
+	value, _ := json.Marshal(event)
+	if err := auditProducer.Produce(ctx, []byte(event.AccountID), value); err != nil {
+		log.Printf("[GATEWAY] ❌ FAILED to publish audit event %s type=%s account=%s: %v", event.EventID, event.Type, event.AccountID, err)
+	}
+}
+
+// startAuditConsumer relays audit events to WebSocket clients.
+func startAuditConsumer() {
+	consumer := kafka.NewConsumer(kafkaBrokers, topicAudit, "order-gateway-audit-group")
+	defer consumer.Close()
+
+	err := consumer.Consume(context.Background(), func(ctx context.Context, msg kafka.Message) error {
+		if errs := schemas.ValidateJSON(schema.AuditEvent, msg.Value); len(errs) > 0 {
+			log.Printf("[GATEWAY] Audit event rejected by schema, skipping: %v", errs)
+			return nil
+		}
+		hub.BroadcastAudit(msg.Value)
+		return nil
+	})
+
+	if err != nil {
+		log.Printf("Audit Consumer failed: %v", err)
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Time allowed to write a single message to a client.
+	writeWait = 10 * time.Second
+
+	// Time allowed to read the next pong from a client.
+	pongWait = 60 * time.Second
+
+	// Pings are sent at this interval; must be shorter than pongWait.
+	pingPeriod = (pongWait * 9) / 10
+
+	// Maximum size of an inbound client message.
+	maxMessageSize = 4096
+
+	// Execution reports and audit events cannot be dropped or conflated. A
+	// client whose queue fills up is disconnected so it reconnects and
+	// resyncs instead.
+	execQueueSize = 256
+
+	// Public trades are not conflatable either, but losing one only degrades
+	// a chart, so the oldest pending trade is dropped when the client is behind.
+	tradeQueueSize = 128
+
+	// Snapshots and resume replays queued for a client.
+	replyQueueSize = 4
+)
+
+// Hub fans messages out to WebSocket clients. Broadcasts never block on a
+// client: each client owns buffered queues drained by its own write pump.
+type Hub struct {
+	mu      sync.RWMutex
+	clients map[*Client]bool
+
+	// Fixed at construction; each stream has its own lock.
+	streams map[string]*stream
+
+	// Latest L2 per symbol, for snapshots.
+	bookMu    sync.RWMutex
+	lastBooks map[string]json.RawMessage
+}
+
+// Client is a single WebSocket connection and its outbound queues.
+type Client struct {
+	hub  *Hub
+	conn *websocket.Conn
+
+	execs   chan []byte
+	replies chan [][]byte
+
+	// Market data pending delivery. L2 snapshots are conflated per symbol
+	// (latest wins); trades are kept in a bounded FIFO.
+	mdMu      sync.Mutex
+	l2        map[string][]byte
+	l2Order   []string
+	trades    [][]byte
+	mdPending chan struct{}
+
+	// Session this connection belongs to, if the client named one.
+	sessionMu sync.Mutex
+	session   string
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		clients: make(map[*Client]bool),
+		streams: map[string]*stream{
+			channelExecutions: {},
+			channelMarketData: {},
+			channelAudit:      {},
+			channelPositions:  {},
+		},
+		lastBooks: make(map[string]json.RawMessage),
+	}
+}
+
+func (h *Hub) register(conn *websocket.Conn) *Client {
+	c := &Client{
+		hub:       h,
+		conn:      conn,
+		execs:     make(chan []byte, execQueueSize),
+		replies:   make(chan [][]byte, replyQueueSize),
+		l2:        make(map[string][]byte),
+		mdPending: make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	h.mu.Lock()
+	h.clients[c] = true
+	h.mu.Unlock()
+	return c
+}
+
+func (h *Hub) unregister(c *Client) {
+	h.mu.Lock()
+	delete(h.clients, c)
+	h.mu.Unlock()
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+
+		c.sessionMu.Lock()
+		if c.session != "" {
+			sessions.Detach(c.session)
+		}
+		c.sessionMu.Unlock()
+	})
+}
+
+// attachSession binds the connection to a session. A connection belongs to
+// at most one session; naming a different one moves it.
+func (c *Client) attachSession(id string, cancelOnDisconnect bool) {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+	select {
+	case <-c.done:
+		return // already disconnected
+	default:
+	}
+	if c.session != "" && c.session != id {
+		sessions.Detach(c.session)
+	}
+	if c.session != id {
+		sessions.Attach(id, cancelOnDisconnect)
+	} else {
+		sessions.Update(id, cancelOnDisconnect)
+	}
+	c.session = id
+}
+
+// BroadcastExecution queues an execution report for every client. Clients
+// that are too far behind to accept it are disconnected.
+func (h *Hub) BroadcastExecution(data []byte) {
+	h.broadcastReliable(channelExecutions, data)
+}
+
+// BroadcastAudit queues an account audit event (kill switch, mass cancel)
+// for every client, with the same delivery guarantee as executions.
+func (h *Hub) BroadcastAudit(data []byte) {
+	h.broadcastReliable(channelAudit, data)
+}
+
+// BroadcastPosition queues a position update for every client. Each update
+// carries the whole position, but they are sequenced like executions so a
+// client can tell it missed one.
+func (h *Hub) BroadcastPosition(data []byte) {
+	h.broadcastReliable(channelPositions, data)
+}
+
+func (h *Hub) broadcastReliable(channel string, data []byte) {
+	var slow []*Client
+
+	s := h.streams[channel]
+	s.mu.Lock()
+	msg := s.next(channel, data)
+
+	h.mu.RLock()
+	for c := range h.clients {
+		select {
+		case c.execs <- msg:
+		default:
+			slow = append(slow, c)
+		}
+	}
+	h.mu.RUnlock()
+	s.mu.Unlock()
+
+	for _, c := range slow {
+		log.Printf("[GATEWAY] WebSocket client %s too slow for %s stream, disconnecting", c.conn.RemoteAddr(), channel)
+		c.closeSlow()
+		h.unregister(c)
+	}
+}
+
+// BroadcastL2 queues an L2 snapshot for every client, replacing any snapshot
+// for the same symbol the client has not been sent yet.
+func (h *Hub) BroadcastL2(symbol string, data []byte) {
+	h.bookMu.Lock()
+	h.lastBooks[symbol] = data
+	h.bookMu.Unlock()
+
+	s := h.streams[channelMarketData]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msg := s.next(channelMarketData, data)
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for c := range h.clients {
+		c.mdMu.Lock()
+		if _, ok := c.l2[symbol]; !ok {
+			c.l2Order = append(c.l2Order, symbol)
+		}
+		c.l2[symbol] = msg
+		c.mdMu.Unlock()
+		c.signalMarketData()
+	}
+}
+
+// BroadcastTrade queues a public trade for every client, dropping the oldest
+// pending trade for clients that are behind.
+func (h *Hub) BroadcastTrade(data []byte) {
+	s := h.streams[channelMarketData]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msg := s.next(channelMarketData, data)
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for c := range h.clients {
+		c.mdMu.Lock()
+		if len(c.trades) >= tradeQueueSize {
+			c.trades = c.trades[1:]
+		}
+		c.trades = append(c.trades, msg)
+		c.mdMu.Unlock()
+		c.signalMarketData()
+	}
+}
+
+// books returns a copy of the latest L2 per symbol.
+func (h *Hub) books() map[string]json.RawMessage {
+	h.bookMu.RLock()
+	defer h.bookMu.RUnlock()
+	out := make(map[string]json.RawMessage, len(h.lastBooks))
+	for sym, book := range h.lastBooks {
+		out[sym] = book
+	}
+	return out
+}
+
+// reply queues messages for this client only. Called from the read pump, so
+// blocking here only holds up this client.
+func (c *Client) reply(msgs ...[]byte) {
+	if len(msgs) == 0 {
+		return
+	}
+	select {
+	case c.replies <- msgs:
+	case <-c.done:
+	}
+}
+
+func (c *Client) signalMarketData() {
+	select {
+	case c.mdPending <- struct{}{}:
+	default:
+	}
+}
+
+// takeMarketData drains the pending market data in delivery order.
+func (c *Client) takeMarketData() [][]byte {
+	c.mdMu.Lock()
+	defer c.mdMu.Unlock()
+
+	out := make([][]byte, 0, len(c.l2Order)+len(c.trades))
+	for _, sym := range c.l2Order {
+		out = append(out, c.l2[sym])
+	}
+	out = append(out, c.trades...)
+
+	c.l2 = make(map[string][]byte)
+	c.l2Order = c.l2Order[:0]
+	c.trades = nil
+	return out
+}
+
+// closeSlow tells the client why it is being dropped. Best effort: the
+// connection is closed right after regardless.
+func (c *Client) closeSlow() {
+	msg := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "slow consumer")
+	c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+}
+
+// writePump is the only goroutine that writes to the connection.
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.hub.unregister(c)
+	}()
+
+	for {
+		// Execution reports and audit events always go out ahead of market data.
+		select {
+		case msg := <-c.execs:
+			if err := c.write(msg); err != nil {
+				return
+			}
+			continue
+		default:
+		}
+
+		select {
+		case <-c.done:
+			return
+		case msg := <-c.execs:
+			if err := c.write(msg); err != nil {
+				return
+			}
+		case msgs := <-c.replies:
+			for _, msg := range msgs {
+				if err := c.write(msg); err != nil {
+					return
+				}
+			}
+		case <-c.mdPending:
+			for _, msg := range c.takeMarketData() {
+				if err := c.write(msg); err != nil {
+					return
+				}
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				log.Printf("Websocket ping error: %v", err)
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) write(msg []byte) error {
+	c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+		log.Printf("Websocket error: %v", err)
+		return err
+	}
+	return nil
+}
+
+// readPump handles client requests, keeps the read deadline alive on pongs
+// and detects disconnects.
+func (c *Client) readPump() {
+	defer c.hub.unregister(c)
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+
+	for {
+		_, raw, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		c.handleRequest(raw)
+	}
+}
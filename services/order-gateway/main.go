@@ -11,14 +11,20 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/atlas/services/common/borrow"
 	"github.com/atlas/services/common/config"
 	"github.com/atlas/services/common/db"
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/instrument"
 	"github.com/atlas/services/common/kafka"
 	"github.com/atlas/services/common/model"
+	"github.com/atlas/services/common/schema"
+	"github.com/atlas/services/common/venue"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
@@ -35,52 +41,139 @@ var (
 	producer        *kafka.Producer
 
 	// WebSocket hub
-	clients   = make(map[*websocket.Conn]bool)
-	broadcast = make(chan []byte)
-	upgrader  = websocket.Upgrader{
+	hub      = NewHub()
+	upgrader = websocket.Upgrader{
 		CheckOrigin: func(r *http.Request) bool {
 			return true // Allow all for local dev
 		},
 	}
-	mu sync.Mutex
 
 	// Persistence
 	dynamoClient *db.DynamoClient
 	awsCfg       *config.AWSConfig
 
+	schemas     *schema.Registry
+	instruments *instrument.Master
+	venues      *venue.Directory
+
 	// Balance Manager State (Default demo values)
-	initialUSD = 1000000.0
-	initialBTC = 50.0
+	initialUSD  = decimal.FromInt(1000000)
+	initialBTC  = decimal.FromInt(50)
+	initialTier = "retail"
+
+	// How far past its stop price a STOP order, or past the last trade a
+	// MARKET order, may fill, in percent.
+	stopProtectionPct = protectionPct()
+
+	// The last trade on each symbol, which prices market orders.
+	lastTrades = &tradePrices{px: make(map[string]decimal.Decimal)}
 )
 
+type tradePrices struct {
+	mu sync.RWMutex
+	px map[string]decimal.Decimal
+}
+
+func (t *tradePrices) Set(symbol string, px decimal.Decimal) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.px[symbol] = px
+}
+
+// Ref is the last trade on the instrument, or its reference price before
+// the first.
+func (t *tradePrices) Ref(inst instrument.Instrument) decimal.Decimal {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if px, ok := t.px[inst.Symbol]; ok {
+		return px
+	}
+	return inst.ReferencePrice
+}
+
+// protectionPct reads ATLAS_STOP_PROTECTION_PCT, default 5.
+func protectionPct() decimal.Decimal {
+	if v, ok := os.LookupEnv("ATLAS_STOP_PROTECTION_PCT"); ok {
+		if pct, err := decimal.NewFromString(v); err == nil && pct.IsPositive() {
+			return pct
+		}
+		log.Printf("[GATEWAY] Invalid ATLAS_STOP_PROTECTION_PCT %q, using default", v)
+	}
+	return decimal.FromInt(5)
+}
+
 func main() {
 	ctx := context.Background()
 
 	// Load AWS Config
 	awsCfg = config.LoadAWSConfig("order-gateway")
 
+	reg, err := schema.Load(schema.Dir())
+	if err != nil {
+		log.Fatalf("Failed to load schemas: %v", err)
+	}
+	schemas = reg
+
+	master, err := instrument.Load(instrument.File())
+	if err != nil {
+		log.Fatalf("Failed to load instrument master: %v", err)
+	}
+	instruments = master
+
+	directory, err := venue.Load(venue.File())
+	if err != nil {
+		log.Fatalf("Failed to load venue directory: %v", err)
+	}
+	venues = directory
+
+	inventory, err := borrow.Load(borrow.File())
+	if err != nil {
+		log.Fatalf("Failed to load borrow inventory: %v", err)
+	}
+	borrowInventory = inventory
+
 	// Initialize Kafka Producer
 	producer = kafka.NewProducer(kafkaBrokers, topicCommands)
 	defer producer.Close()
 
+	auditProducer = kafka.NewProducer(kafkaBrokers, topicAudit)
+	defer auditProducer.Close()
+
 	// Initialize DynamoDB Client
 	dynamo, err := db.NewDynamoClient(ctx, awsCfg.Region, awsCfg.DynamoDBEndpoint)
 	if err != nil {
 		log.Fatalf("Failed to connect to DynamoDB: %v", err)
 	}
 	dynamoClient = dynamo
+	seedBorrowInventory(ctx)
+
+	if inst, ok := instruments.Get(marginSymbol); ok && inst.Marginable() {
+		margin = newMarginEngine(inst)
+		if err := loadMarginAccounts(ctx); err != nil {
+			log.Printf("[GATEWAY] ⚠️  Could not load margin accounts: %v", err)
+		}
+	} else {
+		log.Printf("[GATEWAY] Margin trading disabled: %s is not marginable", marginSymbol)
+	}
 
 	// Start Kafka Consumer for Exec Reports (to broadcast to WS + Update Balances)
 	go startConsumer()
 	go startMarketDataConsumer()
-
-	// Start WebSocket hub
-	go handleMessages()
+	go startAuditConsumer()
+	go startPositionConsumer()
 
 	// HTTP Server
 	mux := http.NewServeMux()
 	mux.HandleFunc("/orders", enableCors(handleOrderEntry))
 	mux.HandleFunc("/balances", enableCors(handleBalances))
+	mux.HandleFunc("/instruments", enableCors(handleInstruments))
+	mux.HandleFunc("/borrow", enableCors(handleBorrow))
+	mux.HandleFunc("/accounts/{account_id}/locates", enableCors(locatesHandler))
+	mux.HandleFunc("/accounts/{account_id}/kill-switch", enableCors(killSwitchHandler(actorSelf)))
+	mux.HandleFunc("/accounts/{account_id}/mass-cancel", enableCors(massCancelHandler(actorSelf)))
+	mux.HandleFunc("/admin/accounts/{account_id}/kill-switch", enableCors(requireAdmin(killSwitchHandler(actorAdmin))))
+	mux.HandleFunc("/admin/accounts/{account_id}/mass-cancel", enableCors(requireAdmin(massCancelHandler(actorAdmin))))
+	mux.HandleFunc("/admin/accounts/{account_id}/margin", enableCors(requireAdmin(marginHandler)))
 	mux.HandleFunc("/ws", handleWebSocket)
 	mux.HandleFunc("/health", enableCors(handleHealth))
 	mux.HandleFunc("/debug/ddb", enableCors(handleDebugDDB))
@@ -128,6 +221,25 @@ func handleBalances(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(acc)
 }
 
+func handleInstruments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if symbol := r.URL.Query().Get("symbol"); symbol != "" {
+		inst, ok := instruments.Get(symbol)
+		if !ok {
+			http.Error(w, "Unknown instrument", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(inst)
+		return
+	}
+	json.NewEncoder(w).Encode(instruments.All())
+}
+
 func getAccount(ctx context.Context, accountID string) (*model.Account, error) {
 	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String(awsCfg.BalancesTable),
@@ -143,11 +255,13 @@ func getAccount(ctx context.Context, accountID string) (*model.Account, error) {
 	if result.Item == nil {
 		log.Printf("[GATEWAY] Initializing new account in DynamoDB: %s", accountID)
 		acc := &model.Account{
-			USD: model.Balance{Available: initialUSD, Reserved: 0.0},
-			BTC: model.Balance{Available: initialBTC, Reserved: 0.0},
+			Tier: initialTier,
+			USD:  model.Balance{Available: initialUSD, Reserved: decimal.Zero},
+			BTC:  model.Balance{Available: initialBTC, Reserved: decimal.Zero},
 		}
 		item, _ := attributevalue.MarshalMap(map[string]interface{}{
 			"account_id":    accountID,
+			"tier":          acc.Tier,
 			"usd_available": acc.USD.Available,
 			"usd_reserved":  acc.USD.Reserved,
 			"btc_available": acc.BTC.Available,
@@ -167,19 +281,129 @@ func getAccount(ctx context.Context, accountID string) (*model.Account, error) {
 	}
 
 	var data struct {
-		USDAvailable float64 `dynamodbav:"usd_available"`
-		USDReserved  float64 `dynamodbav:"usd_reserved"`
-		BTCAvailable float64 `dynamodbav:"btc_available"`
-		BTCReserved  float64 `dynamodbav:"btc_reserved"`
+		Tier         string          `dynamodbav:"tier"`
+		USDAvailable decimal.Decimal `dynamodbav:"usd_available"`
+		USDReserved  decimal.Decimal `dynamodbav:"usd_reserved"`
+		BTCAvailable decimal.Decimal `dynamodbav:"btc_available"`
+		BTCReserved  decimal.Decimal `dynamodbav:"btc_reserved"`
+		KillSwitch   *bool           `dynamodbav:"kill_switch"`
+		KSReason     string          `dynamodbav:"kill_switch_reason"`
+		KSActor      string          `dynamodbav:"kill_switch_actor"`
+		KSAt         int64           `dynamodbav:"kill_switch_at"`
+		Margin       bool            `dynamodbav:"margin"`
+		MarginState  string          `dynamodbav:"margin_state"`
 	}
 	if err := attributevalue.UnmarshalMap(result.Item, &data); err != nil {
 		return nil, err
 	}
 
-	return &model.Account{
-		USD: model.Balance{Available: data.USDAvailable, Reserved: data.USDReserved},
-		BTC: model.Balance{Available: data.BTCAvailable, Reserved: data.BTCReserved},
-	}, nil
+	if data.Tier == "" {
+		data.Tier = initialTier // accounts created before tiers existed
+	}
+	acc := &model.Account{
+		Tier:    data.Tier,
+		USD:     model.Balance{Available: data.USDAvailable, Reserved: data.USDReserved},
+		BTC:     model.Balance{Available: data.BTCAvailable, Reserved: data.BTCReserved},
+		Locates: readLocates(result.Item),
+	}
+	if data.KillSwitch != nil {
+		acc.KillSwitch = &model.KillSwitch{
+			Engaged:   *data.KillSwitch,
+			Reason:    data.KSReason,
+			Actor:     data.KSActor,
+			UpdatedAt: time.Unix(data.KSAt, 0).UTC(),
+		}
+	}
+	if data.Margin && margin != nil {
+		st := margin.Status(accountID, acc, model.MarginState(data.MarginState))
+		acc.Margin = &st
+	}
+	return acc, nil
+}
+
+// getOpenOrders returns the account's working orders as STATUS exec reports,
+// the same shape the console already applies from the live stream. It reads
+// only the account's orders, through the account_id index.
+func getOpenOrders(ctx context.Context, accountID string) ([]model.ExecutionReport, error) {
+	input := &dynamodb.QueryInput{
+		TableName:                aws.String(awsCfg.OrdersTable),
+		IndexName:                aws.String(awsCfg.OrdersAccountIndex),
+		KeyConditionExpression:   aws.String("account_id = :acc"),
+		FilterExpression:         aws.String("#s IN (:pp, :pt, :tr, :ps, :lv, :pf, :pa, :cp, :rp)"),
+		ExpressionAttributeNames: map[string]string{"#s": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":acc": &types.AttributeValueMemberS{Value: accountID},
+			":pp":  &types.AttributeValueMemberS{Value: string(model.OrderStatusPendingParent)},
+			":pt":  &types.AttributeValueMemberS{Value: string(model.OrderStatusPendingTrigger)},
+			":tr":  &types.AttributeValueMemberS{Value: string(model.OrderStatusTriggered)},
+			":ps":  &types.AttributeValueMemberS{Value: string(model.OrderStatusPendingSubmit)},
+			":lv":  &types.AttributeValueMemberS{Value: string(model.OrderStatusLive)},
+			":pf":  &types.AttributeValueMemberS{Value: string(model.OrderStatusPartiallyFilled)},
+			":pa":  &types.AttributeValueMemberS{Value: string(model.OrderStatusPaused)},
+			":cp":  &types.AttributeValueMemberS{Value: string(model.OrderStatusCancelPending)},
+			":rp":  &types.AttributeValueMemberS{Value: string(model.OrderStatusReplacePending)},
+		},
+	}
+
+	var orders []model.ExecutionReport
+	for {
+		result, err := dynamoClient.Query(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range result.Items {
+			var o struct {
+				OrderID   string          `dynamodbav:"order_id"`
+				AccountID string          `dynamodbav:"account_id"`
+				Symbol    string          `dynamodbav:"symbol"`
+				Side      string          `dynamodbav:"side"`
+				Price     decimal.Decimal `dynamodbav:"price"`
+				OrderQty  decimal.Decimal `dynamodbav:"order_qty"`
+				CumQty    decimal.Decimal `dynamodbav:"cum_qty"`
+				LeavesQty decimal.Decimal `dynamodbav:"leaves_qty"`
+				AvgPx     decimal.Decimal `dynamodbav:"avg_px"`
+				Status    string          `dynamodbav:"status"`
+				UpdatedAt int64           `dynamodbav:"updated_at"`
+
+				ParentOrderID   string          `dynamodbav:"parent_order_id"`
+				ContingencyType string          `dynamodbav:"contingency_type"`
+				ReservePx       decimal.Decimal `dynamodbav:"reserve_px"`
+				ArrivalPx       decimal.Decimal `dynamodbav:"arrival_px"`
+				Venue           string          `dynamodbav:"venue"`
+			}
+			if err := attributevalue.UnmarshalMap(item, &o); err != nil {
+				return nil, err
+			}
+			orders = append(orders, model.ExecutionReport{
+				ExecID:    uuid.New().String(),
+				OrderID:   o.OrderID,
+				ClientID:  o.AccountID,
+				Symbol:    o.Symbol,
+				Side:      model.OrderSide(o.Side),
+				OrderQty:  o.OrderQty,
+				Price:     o.Price,
+				Type:      "STATUS",
+				Status:    model.OrderStatus(o.Status),
+				LeavesQty: o.LeavesQty,
+				CumQty:    o.CumQty,
+				AvgPx:     o.AvgPx,
+				Timestamp: time.Unix(o.UpdatedAt, 0).UTC(),
+
+				ParentOrderID:   o.ParentOrderID,
+				ContingencyType: model.ContingencyType(o.ContingencyType),
+				ReservePx:       o.ReservePx,
+				ArrivalPx:       o.ArrivalPx,
+				SlippageBps:     model.SlippageBps(model.OrderSide(o.Side), o.AvgPx, o.ArrivalPx),
+				Venue:           o.Venue,
+			})
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return orders, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
 }
 
 func handleOrderEntry(w http.ResponseWriter, r *http.Request) {
@@ -193,12 +417,51 @@ func handleOrderEntry(w http.ResponseWriter, r *http.Request) {
 	r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 
 	var cmd model.OrderCommand
-	if err := json.NewDecoder(r.Body).Decode(&cmd); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if errs := decodeCommand(bodyBytes, &cmd); len(errs) > 0 {
+		log.Printf("[GATEWAY] Command rejected by schema: %v", errs)
+		writeValidationErrors(w, errs)
 		return
 	}
 
+	if cmd.Type == model.CommandTypeNew {
+		// A stop without a price reserves, and may fill, no worse than its
+		// protection price beyond the stop, and a market order no worse than
+		// its protection price beyond the last trade.
+		if inst, ok := instruments.Get(cmd.Symbol); ok {
+			ref := lastTrades.Ref(inst)
+			switch {
+			case cmd.OrderType == model.OrderTypeStop && cmd.Price.IsZero() && cmd.StopPrice.IsPositive():
+				cmd.Price = inst.ProtectionPrice(cmd.Side, cmd.StopPrice, stopProtectionPct)
+			case cmd.OrderType == model.OrderTypeMarket && cmd.Price.IsZero() && ref.IsPositive():
+				cmd.Price = inst.ProtectionPrice(cmd.Side, ref, stopProtectionPct)
+			}
+			for i, leg := range cmd.Legs {
+				switch {
+				case leg.OrderType == model.OrderTypeStop && leg.Price.IsZero() && leg.StopPrice.IsPositive():
+					cmd.Legs[i].Price = inst.ProtectionPrice(cmd.LegSide(), leg.StopPrice, stopProtectionPct)
+				case leg.OrderType == model.OrderTypeMarket && leg.Price.IsZero() && ref.IsPositive():
+					cmd.Legs[i].Price = inst.ProtectionPrice(cmd.LegSide(), ref, stopProtectionPct)
+				}
+			}
+		}
+		// An OCO container reserves once for both legs, at the worse one.
+		if cmd.ContingencyType == model.ContingencyOCO && len(cmd.Legs) > 0 {
+			cmd.Price = cmd.WorstLegPx()
+		}
+		if errs := instruments.ValidateOrder(cmd); len(errs) > 0 {
+			log.Printf("[GATEWAY] Order %s rejected by instrument master: %v", cmd.OrderID, errs)
+			writeValidationErrors(w, errs)
+			return
+		}
+		if errs := venues.ValidateOrder(cmd); len(errs) > 0 {
+			log.Printf("[GATEWAY] Order %s rejected by venue directory: %v", cmd.OrderID, errs)
+			writeValidationErrors(w, errs)
+			return
+		}
+	}
+
 	// Idempotency Check using CommandID
+	accepted := false
 	if cmd.CommandID != "" {
 		isNew, err := checkIdempotency(ctx, cmd.CommandID)
 		if err != nil {
@@ -212,14 +475,14 @@ func handleOrderEntry(w http.ResponseWriter, r *http.Request) {
 			json.NewEncoder(w).Encode(map[string]string{"status": "duplicate", "command_id": cmd.CommandID})
 			return
 		}
-	}
-
-	// Enrich command
-	if cmd.OrderID == "" {
-		cmd.OrderID = uuid.New().String()
-	}
-	if cmd.Timestamp.IsZero() {
-		cmd.Timestamp = time.Now().UTC()
+		// The key is held while the command is checked, so a concurrent
+		// retry is still a duplicate, and given back if it is not accepted
+		// so the client can retry once the cause is gone.
+		defer func() {
+			if !accepted {
+				releaseIdempotency(context.WithoutCancel(ctx), cmd.CommandID)
+			}
+		}()
 	}
 
 	// PRE-TRADE CHECK & PERSISTENT RESERVATION (DynamoDB)
@@ -227,7 +490,94 @@ func handleOrderEntry(w http.ResponseWriter, r *http.Request) {
 	if accountID == "" {
 		accountID = "ACC_CHILD_1" // Fallback for very old commands
 	}
-	if err := reserveBalances(ctx, accountID, cmd); err != nil {
+	var od overdraft
+	if cmd.Type == model.CommandTypeNew {
+		acc, err := getAccount(ctx, accountID)
+		if err != nil {
+			log.Printf("[GATEWAY] Error loading account %s: %v", accountID, err)
+			http.Error(w, "Error loading account", http.StatusInternalServerError)
+			return
+		}
+		if acc.KillSwitch != nil && acc.KillSwitch.Engaged {
+			log.Printf("[GATEWAY] Order %s rejected: kill switch engaged for %s", cmd.OrderID, accountID)
+			writeRiskRejection(w, killSwitchRejection(cmd, acc.KillSwitch))
+			return
+		}
+
+		// Fees are charged at the account's tier, and a buy reserves for the
+		// worst taker fee it can pay on top of its price.
+		cmd.FeeTier = acc.Tier
+		cmd.ReservePx = decimal.Zero
+		if px := venues.FeeReservePx(cmd, acc.Tier); !px.Equal(cmd.Price) {
+			cmd.ReservePx = px
+		}
+		if _, _, err := checkedReservation(cmd); err != nil {
+			log.Printf("[GATEWAY] Order %s rejected: %v", cmd.OrderID, err)
+			writeValidationErrors(w, schema.Errors{{Field: "quantity", Message: "order value is out of range"}})
+			return
+		}
+
+		// Margin accounts may borrow for the margin symbol if their equity
+		// covers the position the order leaves them with.
+		od.seen = acc
+		if acc.Margin != nil && cmd.Symbol == margin.inst.Symbol {
+			if reason := margin.CheckOrder(accountID, acc, cmd); reason != "" {
+				log.Printf("[GATEWAY] Order %s rejected for %s: %s", cmd.OrderID, accountID, reason)
+				writeRiskRejection(w, marginRejection(cmd, reason))
+				return
+			}
+			od.usd = true
+		}
+
+		decision, err := checkPolicy(ctx, cmd)
+		if err != nil {
+			// Fail closed: no decision, no order.
+			log.Printf("[GATEWAY] Policy check unavailable for order %s: %v", cmd.OrderID, err)
+			http.Error(w, "Policy check unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if decision.Decision != "APPROVED" {
+			log.Printf("[GATEWAY] Order %s rejected by policy %s: %s (%s)", cmd.OrderID, decision.PolicyVersion, decision.ReasonCode, decision.Reason)
+			writeRiskRejection(w, decision)
+			return
+		}
+
+		decision, err = checkPretrade(ctx, cmd)
+		if err != nil {
+			log.Printf("[GATEWAY] Pre-trade check unavailable for order %s: %v", cmd.OrderID, err)
+			http.Error(w, "Pre-trade risk check unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if decision.Decision != "APPROVED" {
+			log.Printf("[GATEWAY] Order %s rejected by pre-trade controls: %s (%s)", cmd.OrderID, decision.ReasonCode, decision.Reason)
+			writeRiskRejection(w, decision)
+			return
+		}
+
+		// Selling more than the account holds is a short sale, and needs a
+		// locate for the rest. It is checked last: it may locate.
+		if _, qty := reservation(cmd); qty.GreaterThan(acc.BTC.Available) {
+			inst, _ := instruments.Get(cmd.Symbol)
+			if rejection := checkLocate(ctx, accountID, acc, cmd, inst.BaseAsset, qty); rejection != nil {
+				log.Printf("[GATEWAY] Short sale %s rejected for %s: %s (%s)", cmd.OrderID, accountID, rejection.ReasonCode, rejection.Reason)
+				writeRiskRejection(w, rejection)
+				return
+			}
+			od.btc = true
+		}
+	}
+	if err := reserveBalances(ctx, accountID, cmd, od); err != nil {
+		if errors.Is(err, errKillSwitch) {
+			// Engaged after the check above.
+			log.Printf("[GATEWAY] Order %s rejected: kill switch engaged for %s", cmd.OrderID, accountID)
+			acc, _ := getAccount(ctx, accountID)
+			ks := &model.KillSwitch{Engaged: true}
+			if acc != nil && acc.KillSwitch != nil {
+				ks = acc.KillSwitch
+			}
+			writeRiskRejection(w, killSwitchRejection(cmd, ks))
+			return
+		}
 		log.Printf("[GATEWAY] Reservation failed for %s: %v", accountID, err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -242,11 +592,77 @@ func handleOrderEntry(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to submit order", http.StatusInternalServerError)
 		return
 	}
+	if sessionID := r.Header.Get("X-Atlas-Session"); sessionID != "" && cmd.Type == model.CommandTypeNew {
+		sessions.Track(sessionID, accountID, cmd.OrderID)
+	}
 
+	accepted = true
 	w.WriteHeader(http.StatusAccepted)
 	json.NewEncoder(w).Encode(map[string]string{"status": "accepted", "order_id": cmd.OrderID, "command_id": cmd.CommandID})
 }
 
+// internalCommandFields are command fields only the platform sets: oms-core
+// links the orders it creates to their parent, and the gateway records the
+// price it reserved at. A client setting them could free its order from the
+// checks and reservation the gateway makes.
+var internalCommandFields = []string{"parent_order_id", "reserve_px"}
+
+// decodeCommand validates an inbound command against the order_command schema
+// and decodes it. order_id and timestamp are assigned by the gateway, so they
+// are filled in before validation when the client leaves them out.
+func decodeCommand(raw []byte, cmd *model.OrderCommand) schema.Errors {
+	doc, err := schema.Decode(raw)
+	if err != nil {
+		return schema.Errors{{Message: fmt.Sprintf("invalid JSON: %v", err)}}
+	}
+	if obj, ok := doc.(map[string]interface{}); ok {
+		var errs schema.Errors
+		for _, field := range internalCommandFields {
+			if _, ok := obj[field]; ok {
+				errs = append(errs, schema.FieldError{Field: field, Message: "is set by the platform, not by clients"})
+			}
+		}
+		if len(errs) > 0 {
+			return errs
+		}
+		if _, ok := obj["order_id"]; !ok {
+			obj["order_id"] = uuid.New().String()
+		}
+		if _, ok := obj["timestamp"]; !ok {
+			obj["timestamp"] = time.Now().UTC().Format(time.RFC3339Nano)
+		}
+		if legs, ok := obj["legs"].([]interface{}); ok {
+			for _, l := range legs {
+				if leg, ok := l.(map[string]interface{}); ok {
+					if _, ok := leg["order_id"]; !ok {
+						leg["order_id"] = uuid.New().String()
+					}
+				}
+			}
+		}
+	}
+
+	if errs := schemas.Validate(schema.OrderCommand, doc); len(errs) > 0 {
+		return errs
+	}
+
+	enriched, _ := json.Marshal(doc)
+	if err := json.Unmarshal(enriched, cmd); err != nil {
+		return schema.Errors{{Message: err.Error()}}
+	}
+	return nil
+}
+
+func writeValidationErrors(w http.ResponseWriter, errs schema.Errors) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "invalid",
+		"message": errs.Error(),
+		"errors":  errs,
+	})
+}
+
 func checkIdempotency(ctx context.Context, commandID string) (bool, error) {
 	_, err := dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
 		TableName:           aws.String(awsCfg.IdempotencyTable),
@@ -265,40 +681,74 @@ func checkIdempotency(ctx context.Context, commandID string) (bool, error) {
 	return true, nil
 }
 
-func reserveBalances(ctx context.Context, accountID string, cmd model.OrderCommand) error {
+// releaseIdempotency gives back a command ID the gateway did not accept.
+func releaseIdempotency(ctx context.Context, commandID string) {
+	_, err := dynamoClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(awsCfg.IdempotencyTable),
+		Key:       map[string]types.AttributeValue{"request_id": &types.AttributeValueMemberS{Value: commandID}},
+	})
+	if err != nil {
+		log.Printf("[DDB-WRITE-ERROR] Table=%s Key=%s Error=%v", awsCfg.IdempotencyTable, commandID, err)
+		return
+	}
+	log.Printf("[DDB-WRITE-SUCCESS] Table=%s Key=%s (Idempotency released)", awsCfg.IdempotencyTable, commandID)
+}
+
+// overdraft lets a reservation take available balances negative: USD for a
+// margin account, BTC for a short sale covered by a locate. It goes no lower
+// than the balances the order was checked against, so concurrent orders
+// cannot both borrow on the same check.
+type overdraft struct {
+	seen     *model.Account
+	usd, btc bool
+}
+
+// reserveBalances moves what the command needs from available to reserved.
+func reserveBalances(ctx context.Context, accountID string, cmd model.OrderCommand, od overdraft) error {
 	// Ensure account exists first
 	_, err := getAccount(ctx, accountID)
 	if err != nil {
 		return fmt.Errorf("failed to prepare account: %w", err)
 	}
 
-	cost := cmd.QuantityVal * cmd.Price
+	cost, qty := reservation(cmd)
 
 	update := &dynamodb.UpdateItemInput{
 		TableName: aws.String(awsCfg.BalancesTable),
 		Key: map[string]types.AttributeValue{
 			"account_id": &types.AttributeValueMemberS{Value: accountID},
 		},
+		UpdateExpression: aws.String("SET usd_available = usd_available - :cost, usd_reserved = usd_reserved + :cost, " +
+			"btc_available = btc_available - :qty, btc_reserved = btc_reserved + :qty"),
+		ConditionExpression: aws.String("usd_available >= :cost AND btc_available >= :qty"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":cost": cost.AttributeValue(),
+			":qty":  qty.AttributeValue(),
+		},
 	}
 
-	if cmd.Side == model.OrderSideBuy {
-		update.UpdateExpression = aws.String("SET usd_available = usd_available - :cost, usd_reserved = usd_reserved + :cost")
-		update.ConditionExpression = aws.String("usd_available >= :cost")
-		update.ExpressionAttributeValues = map[string]types.AttributeValue{
-			":cost": &types.AttributeValueMemberN{Value: fmt.Sprintf("%f", cost)},
-		}
-	} else {
-		update.UpdateExpression = aws.String("SET btc_available = btc_available - :qty, btc_reserved = btc_reserved + :qty")
-		update.ConditionExpression = aws.String("btc_available >= :qty")
-		update.ExpressionAttributeValues = map[string]types.AttributeValue{
-			":qty": &types.AttributeValueMemberN{Value: fmt.Sprintf("%f", cmd.QuantityVal)},
-		}
+	if od.usd {
+		update.ConditionExpression = aws.String("usd_available >= :minusd AND btc_available >= :qty")
+		update.ExpressionAttributeValues[":minusd"] = decimal.Min(cost, od.seen.USD.Available).AttributeValue()
+	}
+	if od.btc {
+		update.ConditionExpression = aws.String(strings.Replace(*update.ConditionExpression, ":qty", ":minbtc", 1))
+		update.ExpressionAttributeValues[":minbtc"] = decimal.Min(qty, od.seen.BTC.Available).AttributeValue()
+	}
+
+	// Cancels must still go through while the kill switch is engaged.
+	if cmd.Type == model.CommandTypeNew {
+		update.ConditionExpression = aws.String(*update.ConditionExpression + " AND (attribute_not_exists(kill_switch) OR kill_switch = :off)")
+		update.ExpressionAttributeValues[":off"] = &types.AttributeValueMemberBOOL{Value: false}
 	}
 
 	_, err = dynamoClient.UpdateItem(ctx, update)
 	if err != nil {
 		var condErr *types.ConditionalCheckFailedException
 		if errors.As(err, &condErr) {
+			if acc, err := getAccount(ctx, accountID); err == nil && acc.KillSwitch != nil && acc.KillSwitch.Engaged {
+				return errKillSwitch
+			}
 			return fmt.Errorf("insufficient funds/inventory")
 		}
 		log.Printf("[DDB-WRITE-ERROR] Table=%s Key=%s Error=%v", awsCfg.BalancesTable, accountID, err)
@@ -308,24 +758,52 @@ func reserveBalances(ctx context.Context, accountID string, cmd model.OrderComma
 	return nil
 }
 
+// reservation is the quote (cost) and base (qty) a NEW command reserves,
+// buys including their worst-case taker fees. A bracket that sells to enter
+// also reserves up front for buying back at its worst exit price; one that
+// buys to enter reserves its exits from the fills.
+func reservation(cmd model.OrderCommand) (cost, qty decimal.Decimal) {
+	cost, qty, _ = checkedReservation(cmd)
+	return cost, qty
+}
+
+// checkedReservation is reservation, failing with decimal.ErrOverflow for an
+// order too large to reserve for. New orders are checked with it on entry,
+// so reservation can be used for them from then on.
+func checkedReservation(cmd model.OrderCommand) (cost, qty decimal.Decimal, err error) {
+	if cmd.Side == model.OrderSideBuy {
+		if cost, err = cmd.QuantityVal.MulChecked(cmd.ReservationPx()); err != nil {
+			return cost, qty, err
+		}
+	} else {
+		qty = cmd.QuantityVal
+	}
+	if cmd.ContingencyType == model.ContingencyBracket && cmd.LegSide() == model.OrderSideBuy {
+		exits := model.OrderCommand{Side: model.OrderSideBuy, QuantityVal: cmd.QuantityVal, Price: cmd.WorstLegPx()}
+		exitCost, err := cmd.QuantityVal.MulChecked(venues.FeeReservePx(exits, cmd.FeeTier))
+		if err != nil {
+			return cost, qty, err
+		}
+		if cost, err = cost.AddChecked(exitCost); err != nil {
+			return cost, qty, err
+		}
+	}
+	return cost, qty, nil
+}
+
 func undoReservation(ctx context.Context, accountID string, cmd model.OrderCommand) {
-	cost := cmd.QuantityVal * cmd.Price
+	cost, qty := reservation(cmd)
 	update := &dynamodb.UpdateItemInput{
 		TableName: aws.String(awsCfg.BalancesTable),
 		Key: map[string]types.AttributeValue{
 			"account_id": &types.AttributeValueMemberS{Value: accountID},
 		},
-	}
-	if cmd.Side == model.OrderSideBuy {
-		update.UpdateExpression = aws.String("SET usd_available = usd_available + :cost, usd_reserved = usd_reserved - :cost")
-		update.ExpressionAttributeValues = map[string]types.AttributeValue{
-			":cost": &types.AttributeValueMemberN{Value: fmt.Sprintf("%f", cost)},
-		}
-	} else {
-		update.UpdateExpression = aws.String("SET btc_available = btc_available + :qty, btc_reserved = btc_reserved - :qty")
-		update.ExpressionAttributeValues = map[string]types.AttributeValue{
-			":qty": &types.AttributeValueMemberN{Value: fmt.Sprintf("%f", cmd.QuantityVal)},
-		}
+		UpdateExpression: aws.String("SET usd_available = usd_available + :cost, usd_reserved = usd_reserved - :cost, " +
+			"btc_available = btc_available + :qty, btc_reserved = btc_reserved - :qty"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":cost": cost.AttributeValue(),
+			":qty":  qty.AttributeValue(),
+		},
 	}
 	_, err := dynamoClient.UpdateItem(ctx, update)
 	if err != nil {
@@ -342,21 +820,11 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	mu.Lock()
-	clients[ws] = true
-	mu.Unlock()
-
+	client := hub.register(ws)
 	log.Println("New WebSocket client connected")
 
-	for {
-		if _, _, err := ws.NextReader(); err != nil {
-			mu.Lock()
-			delete(clients, ws)
-			mu.Unlock()
-			ws.Close()
-			break
-		}
-	}
+	go client.writePump()
+	client.readPump()
 }
 
 func handleHealth(w http.ResponseWriter, r *http.Request) {
@@ -384,22 +852,6 @@ func handleDebugDDB(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func handleMessages() {
-	for {
-		msg := <-broadcast
-		mu.Lock()
-		for client := range clients {
-			err := client.WriteMessage(websocket.TextMessage, msg)
-			if err != nil {
-				log.Printf("Websocket error: %v", err)
-				client.Close()
-				delete(clients, client)
-			}
-		}
-		mu.Unlock()
-	}
-}
-
 func startConsumer() {
 	consumer := kafka.NewConsumer(kafkaBrokers, topicExecs, "order-gateway-group-v6")
 	defer consumer.Close()
@@ -407,12 +859,23 @@ func startConsumer() {
 	log.Println("Started consumer for exec.reports")
 
 	err := consumer.Consume(context.Background(), func(ctx context.Context, msg kafka.Message) error {
+		if errs := schemas.ValidateJSON(schema.ExecutionReport, msg.Value); len(errs) > 0 {
+			log.Printf("[GATEWAY] Exec report rejected by schema, skipping: %v", errs)
+			return nil
+		}
+
 		var report model.ExecutionReport
 		if err := json.Unmarshal(msg.Value, &report); err == nil {
 			updateBalances(report)
+			if margin != nil {
+				margin.OnReport(ctx, report)
+			}
+			if isTerminal(report.Status) {
+				sessions.Done(report.OrderID)
+			}
 		}
 
-		broadcast <- msg.Value
+		hub.BroadcastExecution(msg.Value)
 		return nil
 	})
 
@@ -428,11 +891,13 @@ func updateBalances(report model.ExecutionReport) {
 	}
 	ctx := context.Background()
 
-	if report.Status == model.OrderStatusFilled || report.Status == model.OrderStatusPartiallyFilled {
+	if isSummary(report) {
+		// Nothing to settle: the children's and legs' own reports did.
+	} else if report.Status == model.OrderStatusFilled || report.Status == model.OrderStatusPartiallyFilled {
 		fillQty := report.LastQty
 		fillPx := report.LastPx
-		limitPx := report.Price
-		if limitPx == 0 {
+		limitPx := reservePx(report)
+		if limitPx.IsZero() {
 			limitPx = fillPx
 		}
 
@@ -443,67 +908,122 @@ func updateBalances(report model.ExecutionReport) {
 			},
 		}
 
+		// The fee comes out of what the fill delivers, or out of the quote
+		// reserved for it on a buy.
+		quoteFee, baseFee := report.Fee, decimal.Zero
+		if inst, ok := instruments.Get(report.Symbol); ok && report.FeeAsset != "" && report.FeeAsset == inst.BaseAsset {
+			quoteFee, baseFee = decimal.Zero, report.Fee
+		}
+
 		if report.Side == model.OrderSideBuy {
-			reservedAmount := fillQty * limitPx
-			actualCost := fillQty * fillPx
-			refund := reservedAmount - actualCost
+			reservedAmount := fillQty.Mul(limitPx)
+			actualCost := fillQty.Mul(fillPx).Add(quoteFee)
+			refund := reservedAmount.Sub(actualCost)
 
 			update.UpdateExpression = aws.String("SET usd_reserved = usd_reserved - :res, usd_available = usd_available + :ref, btc_available = btc_available + :qty")
+			received := fillQty.Sub(baseFee)
+			if report.ContingencyType == model.ContingencyBracket {
+				// What a bracket entry buys is the reservation for its exits.
+				update.UpdateExpression = aws.String("SET usd_reserved = usd_reserved - :res, usd_available = usd_available + :ref, btc_reserved = btc_reserved + :qty, btc_available = btc_available - :bfee")
+				received = fillQty
+			}
 			update.ExpressionAttributeValues = map[string]types.AttributeValue{
-				":res": &types.AttributeValueMemberN{Value: fmt.Sprintf("%f", reservedAmount)},
-				":ref": &types.AttributeValueMemberN{Value: fmt.Sprintf("%f", refund)},
-				":qty": &types.AttributeValueMemberN{Value: fmt.Sprintf("%f", fillQty)},
+				":res": reservedAmount.AttributeValue(),
+				":ref": refund.AttributeValue(),
+				":qty": received.AttributeValue(),
+			}
+			if report.ContingencyType == model.ContingencyBracket {
+				update.ExpressionAttributeValues[":bfee"] = baseFee.AttributeValue()
 			}
 		} else {
-			proceeds := fillQty * fillPx
+			proceeds := fillQty.Mul(fillPx).Sub(quoteFee)
 			update.UpdateExpression = aws.String("SET btc_reserved = btc_reserved - :qty, usd_available = usd_available + :proc")
 			update.ExpressionAttributeValues = map[string]types.AttributeValue{
-				":qty":  &types.AttributeValueMemberN{Value: fmt.Sprintf("%f", fillQty)},
-				":proc": &types.AttributeValueMemberN{Value: fmt.Sprintf("%f", proceeds)},
+				":qty":  fillQty.AttributeValue(),
+				":proc": proceeds.AttributeValue(),
+			}
+			if !baseFee.IsZero() {
+				update.UpdateExpression = aws.String(*update.UpdateExpression + ", btc_available = btc_available - :bfee")
+				update.ExpressionAttributeValues[":bfee"] = baseFee.AttributeValue()
 			}
 		}
 		_, err := dynamoClient.UpdateItem(ctx, update)
 		if err != nil {
 			log.Printf("[DDB-WRITE-ERROR] Table=%s Key=%s Error=%v", awsCfg.BalancesTable, accountID, err)
 		} else {
-			log.Printf("[DDB-WRITE-SUCCESS] Table=%s Key=%s (Balances settled for order %s)", awsCfg.BalancesTable, accountID, report.OrderID)
+			log.Printf("[DDB-WRITE-SUCCESS] Table=%s Key=%s (Balances settled for order %s, %s fee %s %s)",
+				awsCfg.BalancesTable, accountID, report.OrderID, report.Liquidity, report.Fee, report.FeeAsset)
 		}
 
+	} else if isChild(report) {
+		// Nothing to release: the parent's report does it for all its children.
 	} else if report.Status == model.OrderStatusCanceled || report.Status == model.OrderStatusRejected {
 		leaves := report.LeavesQty
 		if report.Status == model.OrderStatusRejected {
 			leaves = report.OrderQty
 		}
+		releaseReservation(ctx, accountID, report, leaves)
+	}
 
-		if leaves > 0 {
-			update := &dynamodb.UpdateItemInput{
-				TableName: aws.String(awsCfg.BalancesTable),
-				Key: map[string]types.AttributeValue{
-					"account_id": &types.AttributeValueMemberS{Value: accountID},
-				},
-			}
-			if report.Side == model.OrderSideBuy {
-				limitPx := report.Price
-				amount := leaves * limitPx
-				update.UpdateExpression = aws.String("SET usd_reserved = usd_reserved - :amt, usd_available = usd_available + :amt")
-				update.ExpressionAttributeValues = map[string]types.AttributeValue{
-					":amt": &types.AttributeValueMemberN{Value: fmt.Sprintf("%f", amount)},
-				}
-			} else {
-				update.UpdateExpression = aws.String("SET btc_reserved = btc_reserved - :qty, btc_available = btc_available + :qty")
-				update.ExpressionAttributeValues = map[string]types.AttributeValue{
-					":qty": &types.AttributeValueMemberN{Value: fmt.Sprintf("%f", leaves)},
-				}
-			}
-			update.ConditionExpression = aws.String("usd_reserved >= :amt OR btc_reserved >= :qty") // Safety guard
-			_, err := dynamoClient.UpdateItem(ctx, update)
-			if err != nil {
-				log.Printf("[DDB-WRITE-ERROR] Table=%s Key=%s Error=%v", awsCfg.BalancesTable, accountID, err)
-			} else {
-				log.Printf("[DDB-WRITE-SUCCESS] Table=%s Key=%s (Balances released for order %s, status=%s)", awsCfg.BalancesTable, accountID, report.OrderID, report.Status)
-			}
+	// Quantity taken off a working order, e.g. by self-trade prevention.
+	if report.Type == "RESTATED" && !isChild(report) {
+		releaseReservation(ctx, accountID, report, report.CanceledQty)
+	}
+}
+
+// isChild reports whether the order is a leg of an OCO or a child of an algo
+// parent. Children share one reservation, held and released by their parent.
+func isChild(report model.ExecutionReport) bool {
+	return report.ParentOrderID != "" && report.ContingencyType == ""
+}
+
+// isSummary reports whether the report is oms-core's STATUS summary of an
+// algo parent's or a container's progress, which fills nothing itself.
+func isSummary(report model.ExecutionReport) bool {
+	return report.Type == "STATUS" && report.LastQty.IsZero()
+}
+
+// reservePx is the price the order's reservation was made at.
+func reservePx(report model.ExecutionReport) decimal.Decimal {
+	if report.ReservePx.IsPositive() {
+		return report.ReservePx
+	}
+	return report.Price
+}
+
+// releaseReservation returns the reservation for qty of the order to the
+// account's available balance.
+func releaseReservation(ctx context.Context, accountID string, report model.ExecutionReport, qty decimal.Decimal) {
+	if !qty.IsPositive() {
+		return
+	}
+
+	update := &dynamodb.UpdateItemInput{
+		TableName: aws.String(awsCfg.BalancesTable),
+		Key: map[string]types.AttributeValue{
+			"account_id": &types.AttributeValueMemberS{Value: accountID},
+		},
+	}
+	if report.Side == model.OrderSideBuy {
+		amount := qty.Mul(reservePx(report))
+		update.UpdateExpression = aws.String("SET usd_reserved = usd_reserved - :amt, usd_available = usd_available + :amt")
+		update.ConditionExpression = aws.String("usd_reserved >= :amt") // Safety guard
+		update.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":amt": amount.AttributeValue(),
+		}
+	} else {
+		update.UpdateExpression = aws.String("SET btc_reserved = btc_reserved - :qty, btc_available = btc_available + :qty")
+		update.ConditionExpression = aws.String("btc_reserved >= :qty") // Safety guard
+		update.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":qty": qty.AttributeValue(),
 		}
 	}
+	_, err := dynamoClient.UpdateItem(ctx, update)
+	if err != nil {
+		log.Printf("[DDB-WRITE-ERROR] Table=%s Key=%s Error=%v", awsCfg.BalancesTable, accountID, err)
+	} else {
+		log.Printf("[DDB-WRITE-SUCCESS] Table=%s Key=%s (Balances released for order %s, status=%s)", awsCfg.BalancesTable, accountID, report.OrderID, report.Status)
+	}
 }
 
 func startMarketDataConsumer() {
@@ -511,7 +1031,31 @@ func startMarketDataConsumer() {
 	defer consumer.Close()
 
 	err := consumer.Consume(context.Background(), func(ctx context.Context, msg kafka.Message) error {
-		broadcast <- msg.Value
+		var update model.MarketDataUpdate
+		if err := json.Unmarshal(msg.Value, &update); err != nil {
+			log.Printf("[GATEWAY] Error unmarshalling market data: %v", err)
+			return nil
+		}
+
+		if px, ok := marginMark(update); ok {
+			margin.Mark(ctx, px)
+		}
+		if update.Type == model.MarketDataTypeTrade && update.Trade != nil {
+			if inst, ok := instruments.Get(update.Symbol); ok {
+				lastTrades.Set(update.Symbol, inst.PriceFromFloat(update.Trade.Price))
+			}
+		}
+
+		switch update.Type {
+		case model.MarketDataTypeL2:
+			// The console shows one book per symbol: the default venue's.
+			// Trades from every venue go to the tape.
+			if update.Venue == "" || update.Venue == venues.Default().ID {
+				hub.BroadcastL2(update.Symbol, msg.Value)
+			}
+		case model.MarketDataTypeTrade:
+			hub.BroadcastTrade(msg.Value)
+		}
 		return nil
 	})
 
@@ -524,7 +1068,7 @@ func enableCors(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-Atlas-Admin-Token, X-Atlas-Session")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
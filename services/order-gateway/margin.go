@@ -0,0 +1,613 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/instrument"
+	"github.com/atlas/services/common/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+// Margin accounts borrow against their collateral: their available USD may
+// go negative, as long as an order leaves equity above the initial margin of
+// the position. Going short BTC also needs a locate, see borrow.go. Balances
+// are kept in USD and BTC only, so margin applies to the one symbol trading
+// BTC against USD.
+//
+// The margin engine re-marks every margin account on each market data tick
+// for that symbol. Below initial margin an account is in margin call and may
+// only reduce its position. Below maintenance margin it is liquidated: its
+// open orders are canceled and MARKET orders unwind the position until equity
+// covers initial margin again. Every step is recorded as an audit event.
+const (
+	// actorSystem is the actor on audit events raised by the gateway itself.
+	actorSystem = "system"
+
+	// reasonMargin is the reason code on orders rejected for margin.
+	reasonMargin = "INSUFFICIENT_MARGIN"
+)
+
+var (
+	marginSymbol = marginSymbolFromEnv()
+
+	// margin is nil unless marginSymbol is marginable.
+	margin *marginEngine
+
+	errMarginOff      = errors.New("margin trading is not configured")
+	errMarginBorrowed = errors.New("account has borrowed balances outstanding")
+)
+
+// marginSymbolFromEnv reads ATLAS_MARGIN_SYMBOL, default BTC-USD.
+func marginSymbolFromEnv() string {
+	if v, ok := os.LookupEnv("ATLAS_MARGIN_SYMBOL"); ok && v != "" {
+		return v
+	}
+	return "BTC-USD"
+}
+
+type marginRequest struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason"`
+}
+
+// marginAccount is what the engine keeps per margin account.
+type marginAccount struct {
+	usd, btc    decimal.Decimal // totals: available + reserved
+	state       model.MarginState
+	liquidation string // the liquidation order in flight, if any
+}
+
+// marginAction is what an evaluation found to do, carried out once the
+// engine's lock is released.
+type marginAction struct {
+	accountID string
+	from, to  model.MarginState
+	status    model.MarginStatus
+	// Set when a liquidation order is due.
+	orderID string
+	side    model.OrderSide
+	qty     decimal.Decimal
+}
+
+type marginEngine struct {
+	mu       sync.Mutex
+	inst     instrument.Instrument
+	mark     decimal.Decimal
+	accounts map[string]*marginAccount
+}
+
+func newMarginEngine(inst instrument.Instrument) *marginEngine {
+	return &marginEngine{
+		inst:     inst,
+		mark:     inst.ReferencePrice,
+		accounts: make(map[string]*marginAccount),
+	}
+}
+
+// marginStatus is the status of an account holding usd and btc in total with
+// BTC marked at mark. prev keeps a liquidation going until equity covers
+// initial margin, not just maintenance.
+func marginStatus(inst instrument.Instrument, usd, btc, mark decimal.Decimal, prev model.MarginState) model.MarginStatus {
+	st := model.MarginStatus{
+		State:          model.MarginStateOK,
+		Equity:         usd.Add(btc.Mul(mark)),
+		Exposure:       btc.Abs().Mul(mark),
+		InitialReq:     inst.MarginReq(btc, mark, inst.InitialMarginPct),
+		MaintenanceReq: inst.MarginReq(btc, mark, inst.MaintenanceMarginPct),
+		BorrowedUSD:    decimal.Max(usd.Neg(), decimal.Zero),
+		BorrowedBTC:    decimal.Max(btc.Neg(), decimal.Zero),
+		MarkPx:         mark,
+		UpdatedAt:      time.Now().UTC(),
+	}
+	switch {
+	case btc.IsZero() && st.Equity.IsNegative():
+		st.State = model.MarginStateCall // nothing left to liquidate
+	case st.Equity.LessThan(st.MaintenanceReq):
+		st.State = model.MarginStateLiquidating
+	case st.Equity.LessThan(st.InitialReq):
+		st.State = model.MarginStateCall
+		if prev == model.MarginStateLiquidating {
+			st.State = prev
+		}
+	}
+	return st
+}
+
+func totals(acc *model.Account) (usd, btc decimal.Decimal) {
+	return acc.USD.Available.Add(acc.USD.Reserved), acc.BTC.Available.Add(acc.BTC.Reserved)
+}
+
+// Status is the margin status of an account with the given balances, in the
+// state the engine holds for it, or the persisted one if it is not tracked.
+func (e *marginEngine) Status(accountID string, acc *model.Account, persisted model.MarginState) model.MarginStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	prev := persisted
+	if a, ok := e.accounts[accountID]; ok {
+		prev = a.state
+	}
+	usd, btc := totals(acc)
+	return marginStatus(e.inst, usd, btc, e.mark, prev)
+}
+
+// CheckOrder returns why a NEW order on the margin symbol may not be placed,
+// or "" if it may. The order is assumed to fill in full at its reservation
+// price: it must leave equity above initial margin, or reduce the position.
+// It is checked against available balances only, so what other open orders
+// have reserved counts as already spent and never backs a second order.
+func (e *marginEngine) CheckOrder(accountID string, acc *model.Account, cmd model.OrderCommand) string {
+	e.mu.Lock()
+	mark := e.mark
+	state := model.MarginStateOK
+	if a, ok := e.accounts[accountID]; ok {
+		state = a.state
+	}
+	e.mu.Unlock()
+
+	if state == model.MarginStateLiquidating {
+		return "Account is being liquidated"
+	}
+	usd, btc := acc.USD.Available, acc.BTC.Available
+	afterUSD, afterBTC := usd, btc
+	if cmd.Side == model.OrderSideBuy {
+		cost, _ := reservation(cmd)
+		afterUSD, afterBTC = usd.Sub(cost), btc.Add(cmd.QuantityVal)
+	} else {
+		px := cmd.Price
+		if !px.IsPositive() {
+			px = mark
+		}
+		afterUSD, afterBTC = usd.Add(cmd.QuantityVal.Mul(px)), btc.Sub(cmd.QuantityVal)
+	}
+
+	reduces := afterBTC.Abs().LessThan(btc.Abs()) && afterBTC.Sign() != -btc.Sign()
+	if reduces {
+		return ""
+	}
+	after := marginStatus(e.inst, afterUSD, afterBTC, mark, state)
+	if after.Equity.LessThan(after.InitialReq) {
+		return fmt.Sprintf("Insufficient margin: equity %s would be below initial margin %s", after.Equity, after.InitialReq)
+	}
+	return ""
+}
+
+// Track starts watching a margin account.
+func (e *marginEngine) Track(accountID string, acc *model.Account, state model.MarginState) {
+	usd, btc := totals(acc)
+	if state == "" {
+		state = model.MarginStateOK
+	}
+	e.mu.Lock()
+	e.accounts[accountID] = &marginAccount{usd: usd, btc: btc, state: state}
+	e.mu.Unlock()
+}
+
+// Untrack stops watching an account.
+func (e *marginEngine) Untrack(accountID string) {
+	e.mu.Lock()
+	delete(e.accounts, accountID)
+	e.mu.Unlock()
+}
+
+// Mark re-marks every margin account at px.
+func (e *marginEngine) Mark(ctx context.Context, px decimal.Decimal) {
+	e.mu.Lock()
+	if !px.IsPositive() || px.Equal(e.mark) {
+		e.mu.Unlock()
+		return
+	}
+	e.mark = px
+	var actions []marginAction
+	for id, a := range e.accounts {
+		if act, ok := e.evaluate(id, a); ok {
+			actions = append(actions, act)
+		}
+	}
+	e.mu.Unlock()
+
+	for _, act := range actions {
+		e.apply(ctx, act)
+	}
+}
+
+// OnReport picks up a margin account's balances after an exec report has
+// settled, and notices its liquidation order finishing.
+func (e *marginEngine) OnReport(ctx context.Context, report model.ExecutionReport) {
+	e.mu.Lock()
+	_, ok := e.accounts[report.ClientID]
+	e.mu.Unlock()
+	if !ok {
+		return
+	}
+	acc, err := getAccount(ctx, report.ClientID)
+	if err != nil {
+		log.Printf("[GATEWAY] Margin: error loading account %s: %v", report.ClientID, err)
+		return
+	}
+
+	e.mu.Lock()
+	a, ok := e.accounts[report.ClientID]
+	if !ok {
+		e.mu.Unlock()
+		return
+	}
+	a.usd, a.btc = totals(acc)
+	if a.liquidation == report.OrderID && isTerminal(report.Status) {
+		a.liquidation = ""
+	}
+	act, due := e.evaluate(report.ClientID, a)
+	e.mu.Unlock()
+
+	if due {
+		e.apply(ctx, act)
+	}
+}
+
+// evaluate re-marks one account, moves its state and reports whether there
+// is anything to act on. Callers hold e.mu.
+func (e *marginEngine) evaluate(accountID string, a *marginAccount) (marginAction, bool) {
+	st := marginStatus(e.inst, a.usd, a.btc, e.mark, a.state)
+	act := marginAction{accountID: accountID, from: a.state, to: st.State, status: st}
+	a.state = st.State
+
+	if st.State == model.MarginStateLiquidating && a.liquidation == "" {
+		act.side, act.qty = e.liquidationQty(a, st)
+		if act.qty.IsPositive() {
+			act.orderID = uuid.New().String()
+			a.liquidation = act.orderID
+		}
+	}
+	return act, act.from != act.to || act.orderID != ""
+}
+
+// liquidationQty is the order that brings the position down to what equity
+// covers at initial margin, or closes it when there is no equity left.
+func (e *marginEngine) liquidationQty(a *marginAccount, st model.MarginStatus) (model.OrderSide, decimal.Decimal) {
+	side := model.OrderSideSell
+	if a.btc.IsNegative() {
+		side = model.OrderSideBuy
+	}
+	held := a.btc.Abs()
+
+	var covered decimal.Decimal
+	if st.Equity.IsPositive() && e.mark.IsPositive() {
+		covered = st.Equity.Mul(decimal.FromInt(100)).Div(e.inst.InitialMarginPct.Mul(e.mark))
+	}
+	qty := decimal.Min(held.Sub(covered).CeilStep(e.inst.LotSize), e.inst.RoundQty(held))
+	if e.inst.MaxQty.IsPositive() {
+		qty = decimal.Min(qty, e.inst.MaxQty)
+	}
+	if e.inst.MinQty.IsPositive() && qty.LessThan(e.inst.MinQty) {
+		if held.LessThan(e.inst.MinQty) {
+			return side, decimal.Zero // too small to trade
+		}
+		qty = e.inst.MinQty
+	}
+	return side, qty
+}
+
+// apply persists a state change, records it and starts a liquidation.
+func (e *marginEngine) apply(ctx context.Context, act marginAction) {
+	if act.from != act.to {
+		saveMarginState(ctx, act.accountID, act.to)
+		log.Printf("[GATEWAY] 📉 MARGIN account=%s %s -> %s equity=%s initial=%s maintenance=%s mark=%s",
+			act.accountID, act.from, act.to, act.status.Equity, act.status.InitialReq, act.status.MaintenanceReq, act.status.MarkPx)
+
+		switch {
+		case act.to == model.MarginStateLiquidating:
+			e.audit(ctx, model.AuditLiquidationStarted, act, "Equity below maintenance margin", nil)
+			if _, err := massCancel(ctx, act.accountID, massCancelRequest{Reason: "Liquidation"}, actorSystem); err != nil {
+				log.Printf("[GATEWAY] Liquidation of %s: mass cancel failed: %v", act.accountID, err)
+			}
+		case act.from == model.MarginStateLiquidating:
+			e.audit(ctx, model.AuditLiquidationComplete, act, "", nil)
+		case act.to == model.MarginStateCall:
+			e.audit(ctx, model.AuditMarginCall, act, "Equity below initial margin", nil)
+		case act.from == model.MarginStateCall:
+			e.audit(ctx, model.AuditMarginCallCleared, act, "", nil)
+		}
+	}
+
+	if act.orderID != "" {
+		if err := e.liquidate(ctx, act); err != nil {
+			log.Printf("[GATEWAY] ❌ Liquidation order for %s failed: %v", act.accountID, err)
+			e.mu.Lock()
+			if a, ok := e.accounts[act.accountID]; ok && a.liquidation == act.orderID {
+				a.liquidation = "" // retried on the next tick
+			}
+			e.mu.Unlock()
+		}
+	}
+}
+
+// liquidate submits a liquidation order: MARKET, protected at the stop
+// protection percent through the mark. It bypasses the kill switch and the
+// margin check, and borrows if it must.
+func (e *marginEngine) liquidate(ctx context.Context, act marginAction) error {
+	acc, err := getAccount(ctx, act.accountID)
+	if err != nil {
+		return err
+	}
+	cmd := model.OrderCommand{
+		CommandID:   uuid.New().String(),
+		Type:        model.CommandTypeNew,
+		OrderID:     act.orderID,
+		ClientID:    act.accountID,
+		Symbol:      e.inst.Symbol,
+		Side:        act.side,
+		OrderType:   model.OrderTypeMarket,
+		QuantityVal: act.qty,
+		Price:       e.inst.ProtectionPrice(act.side, act.status.MarkPx, stopProtectionPct),
+		FeeTier:     acc.Tier,
+		Timestamp:   time.Now().UTC(),
+	}
+	if px := venues.FeeReservePx(cmd, acc.Tier); !px.Equal(cmd.Price) {
+		cmd.ReservePx = px
+	}
+
+	if err := reserveLiquidation(ctx, act.accountID, cmd); err != nil {
+		return err
+	}
+	value, _ := json.Marshal(cmd)
+	if err := producer.Produce(ctx, []byte(cmd.OrderID), value); err != nil {
+		undoReservation(ctx, act.accountID, cmd)
+		return err
+	}
+
+	log.Printf("[GATEWAY] 🔻 LIQUIDATION_ORDER account=%s order=%s %s %s %s @ MARKET (protection %s)",
+		act.accountID, cmd.OrderID, cmd.Side, cmd.QuantityVal, cmd.Symbol, cmd.Price)
+	e.audit(ctx, model.AuditLiquidationOrder, act, "", map[string]interface{}{
+		"order_id": cmd.OrderID,
+		"symbol":   cmd.Symbol,
+		"side":     cmd.Side,
+		"quantity": cmd.QuantityVal,
+		"price":    cmd.Price,
+	})
+	return nil
+}
+
+func (e *marginEngine) audit(ctx context.Context, eventType string, act marginAction, reason string, extra map[string]interface{}) {
+	details := map[string]interface{}{
+		"equity":          act.status.Equity,
+		"exposure":        act.status.Exposure,
+		"initial_req":     act.status.InitialReq,
+		"maintenance_req": act.status.MaintenanceReq,
+		"mark_px":         act.status.MarkPx,
+	}
+	for k, v := range extra {
+		details[k] = v
+	}
+	publishAudit(ctx, model.AuditEvent{
+		Type:      eventType,
+		AccountID: act.accountID,
+		Actor:     actorSystem,
+		Reason:    reason,
+		Details:   details,
+	})
+}
+
+// reserveLiquidation reserves for a liquidation order with no balance check.
+func reserveLiquidation(ctx context.Context, accountID string, cmd model.OrderCommand) error {
+	cost, qty := reservation(cmd)
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(awsCfg.BalancesTable),
+		Key: map[string]types.AttributeValue{
+			"account_id": &types.AttributeValueMemberS{Value: accountID},
+		},
+		UpdateExpression: aws.String("SET usd_available = usd_available - :cost, usd_reserved = usd_reserved + :cost, " +
+			"btc_available = btc_available - :qty, btc_reserved = btc_reserved + :qty"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":cost": cost.AttributeValue(),
+			":qty":  qty.AttributeValue(),
+		},
+	})
+	if err != nil {
+		log.Printf("[DDB-WRITE-ERROR] Table=%s Key=%s Error=%v", awsCfg.BalancesTable, accountID, err)
+		return err
+	}
+	log.Printf("[DDB-WRITE-SUCCESS] Table=%s Key=%s (Balances reserved for liquidation order %s)", awsCfg.BalancesTable, accountID, cmd.OrderID)
+	return nil
+}
+
+func saveMarginState(ctx context.Context, accountID string, state model.MarginState) {
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(awsCfg.BalancesTable),
+		Key: map[string]types.AttributeValue{
+			"account_id": &types.AttributeValueMemberS{Value: accountID},
+		},
+		UpdateExpression: aws.String("SET margin_state = :s"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":s": &types.AttributeValueMemberS{Value: string(state)},
+		},
+	})
+	if err != nil {
+		log.Printf("[DDB-WRITE-ERROR] Table=%s Key=%s Error=%v", awsCfg.BalancesTable, accountID, err)
+		return
+	}
+	log.Printf("[DDB-WRITE-SUCCESS] Table=%s Key=%s (Margin state %s)", awsCfg.BalancesTable, accountID, state)
+}
+
+// loadMarginAccounts starts tracking every account with margin enabled.
+func loadMarginAccounts(ctx context.Context) error {
+	input := &dynamodb.ScanInput{
+		TableName:                 aws.String(awsCfg.BalancesTable),
+		FilterExpression:          aws.String("margin = :on"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":on": &types.AttributeValueMemberBOOL{Value: true}},
+	}
+	n := 0
+	for {
+		result, err := dynamoClient.Scan(ctx, input)
+		if err != nil {
+			return err
+		}
+		for _, raw := range result.Items {
+			var item struct {
+				AccountID    string          `dynamodbav:"account_id"`
+				USDAvailable decimal.Decimal `dynamodbav:"usd_available"`
+				USDReserved  decimal.Decimal `dynamodbav:"usd_reserved"`
+				BTCAvailable decimal.Decimal `dynamodbav:"btc_available"`
+				BTCReserved  decimal.Decimal `dynamodbav:"btc_reserved"`
+				MarginState  string          `dynamodbav:"margin_state"`
+			}
+			if err := attributevalue.UnmarshalMap(raw, &item); err != nil {
+				return err
+			}
+			margin.Track(item.AccountID, &model.Account{
+				USD: model.Balance{Available: item.USDAvailable, Reserved: item.USDReserved},
+				BTC: model.Balance{Available: item.BTCAvailable, Reserved: item.BTCReserved},
+			}, model.MarginState(item.MarginState))
+			n++
+		}
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+	log.Printf("[GATEWAY] Margin trading on %s: tracking %d margin accounts", margin.inst.Symbol, n)
+	return nil
+}
+
+// setMargin turns margin on or off for an account. It cannot be turned off
+// while anything is borrowed.
+func setMargin(ctx context.Context, accountID string, enabled bool) error {
+	if margin == nil {
+		return errMarginOff
+	}
+	acc, err := getAccount(ctx, accountID)
+	if err != nil {
+		return fmt.Errorf("failed to prepare account: %w", err)
+	}
+	if usd, btc := totals(acc); !enabled && (usd.IsNegative() || btc.IsNegative()) {
+		return errMarginBorrowed
+	}
+
+	update := &dynamodb.UpdateItemInput{
+		TableName: aws.String(awsCfg.BalancesTable),
+		Key: map[string]types.AttributeValue{
+			"account_id": &types.AttributeValueMemberS{Value: accountID},
+		},
+		UpdateExpression: aws.String("SET margin = :on REMOVE margin_state"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":on": &types.AttributeValueMemberBOOL{Value: enabled},
+		},
+	}
+	if _, err := dynamoClient.UpdateItem(ctx, update); err != nil {
+		log.Printf("[DDB-WRITE-ERROR] Table=%s Key=%s Error=%v", awsCfg.BalancesTable, accountID, err)
+		return err
+	}
+	log.Printf("[DDB-WRITE-SUCCESS] Table=%s Key=%s (Margin enabled=%t)", awsCfg.BalancesTable, accountID, enabled)
+
+	if enabled {
+		margin.Track(accountID, acc, model.MarginStateOK)
+	} else {
+		margin.Untrack(accountID)
+	}
+	return nil
+}
+
+// marginHandler reports (GET) or switches (POST) an account's margin trading.
+func marginHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	accountID := r.PathValue("account_id")
+
+	switch r.Method {
+	case "GET":
+		acc, err := getAccount(ctx, accountID)
+		if err != nil {
+			log.Printf("[GATEWAY] Error loading account %s: %v", accountID, err)
+			http.Error(w, "Error loading account", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"enabled": acc.Margin != nil, "margin": acc.Margin})
+
+	case "POST":
+		var req marginRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		before, err := getAccount(ctx, accountID)
+		if err != nil {
+			log.Printf("[GATEWAY] Error loading account %s: %v", accountID, err)
+			http.Error(w, "Error loading account", http.StatusInternalServerError)
+			return
+		}
+
+		err = setMargin(ctx, accountID, req.Enabled)
+		if errors.Is(err, errMarginOff) || errors.Is(err, errMarginBorrowed) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("[GATEWAY] Error updating margin for %s: %v", accountID, err)
+			http.Error(w, "Error updating margin", http.StatusInternalServerError)
+			return
+		}
+		if (before.Margin != nil) != req.Enabled {
+			eventType := model.AuditMarginDisabled
+			if req.Enabled {
+				eventType = model.AuditMarginEnabled
+			}
+			log.Printf("[GATEWAY] %s account=%s reason=%q", eventType, accountID, req.Reason)
+			publishAudit(ctx, model.AuditEvent{
+				Type:      eventType,
+				AccountID: accountID,
+				Actor:     actorAdmin,
+				Reason:    req.Reason,
+				Details:   map[string]interface{}{"symbol": margin.inst.Symbol},
+			})
+		}
+
+		acc, _ := getAccount(ctx, accountID)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"enabled": req.Enabled, "margin": acc.Margin})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// marginRejection is the decision returned for orders the account's margin
+// does not cover.
+func marginRejection(cmd model.OrderCommand, reason string) *model.RiskDecision {
+	return &model.RiskDecision{
+		DecisionID: uuid.New().String(),
+		OrderID:    cmd.OrderID,
+		Decision:   "REJECTED",
+		Reason:     reason,
+		ReasonCode: reasonMargin,
+		Timestamp:  time.Now().UTC(),
+	}
+}
+
+// marginMark is the price a market data update marks the margin symbol at:
+// the last trade, or the default venue's mid.
+func marginMark(update model.MarketDataUpdate) (decimal.Decimal, bool) {
+	if margin == nil || update.Symbol != margin.inst.Symbol {
+		return decimal.Zero, false
+	}
+	switch {
+	case update.Type == model.MarketDataTypeTrade && update.Trade != nil:
+		return margin.inst.PriceFromFloat(update.Trade.Price), true
+	case update.Type == model.MarketDataTypeL2 && len(update.Bids) > 0 && len(update.Asks) > 0:
+		if update.Venue != "" && update.Venue != venues.Default().ID {
+			return decimal.Zero, false
+		}
+		return margin.inst.PriceFromFloat((update.Bids[0].Price + update.Asks[0].Price) / 2), true
+	}
+	return decimal.Zero, false
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/atlas/services/common/kafka"
+	"github.com/atlas/services/common/model"
+)
+
+// Positions and P&L are kept by position-service. Its updates are relayed to
+// WebSocket clients, and snapshots read the current positions from it.
+var (
+	topicPositions = "positions.updates"
+	positionsURL   = serviceURL("ATLAS_POSITION_URL", "http://localhost:8006") + "/positions"
+)
+
+// getPositions asks position-service for the account's positions.
+func getPositions(ctx context.Context, accountID string) ([]model.Position, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, positionsURL+"?account_id="+url.QueryEscape(accountID), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := riskClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("position-service returned %s", resp.Status)
+	}
+	var positions []model.Position
+	if err := json.NewDecoder(resp.Body).Decode(&positions); err != nil {
+		return nil, fmt.Errorf("decode positions: %w", err)
+	}
+	return positions, nil
+}
+
+// startPositionConsumer relays position updates to WebSocket clients.
+func startPositionConsumer() {
+	consumer := kafka.NewConsumer(kafkaBrokers, topicPositions, "order-gateway-positions-group")
+	defer consumer.Close()
+
+	err := consumer.Consume(context.Background(), func(ctx context.Context, msg kafka.Message) error {
+		var p model.Position
+		if err := json.Unmarshal(msg.Value, &p); err != nil {
+			log.Printf("[GATEWAY] Error unmarshalling position update: %v", err)
+			return nil
+		}
+		hub.BroadcastPosition(msg.Value)
+		return nil
+	})
+
+	if err != nil {
+		log.Printf("Position Consumer failed: %v", err)
+	}
+}
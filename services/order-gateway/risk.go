@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/atlas/services/common/model"
+)
+
+// Both risk services are called synchronously before an order is published.
+// Any failure to get a decision is returned as an error so the caller can
+// fail closed.
+var (
+	policyURL   = serviceURL("ATLAS_POLICY_URL", "http://localhost:8004") + "/evaluate"
+	pretradeURL = serviceURL("ATLAS_PRETRADE_URL", "http://localhost:8003") + "/check"
+	riskClient  = &http.Client{Timeout: 2 * time.Second}
+)
+
+func serviceURL(env, fallback string) string {
+	if url, ok := os.LookupEnv(env); ok {
+		return url
+	}
+	return fallback
+}
+
+// checkPolicy asks policy-service to evaluate the compliance and risk rules.
+func checkPolicy(ctx context.Context, cmd model.OrderCommand) (*model.RiskDecision, error) {
+	return requestDecision(ctx, "policy-service", policyURL, cmd)
+}
+
+// checkPretrade asks pretrade-controls to check the order against limits.
+// Approved orders count towards the account's limits from then on, so it is
+// called last.
+func checkPretrade(ctx context.Context, cmd model.OrderCommand) (*model.RiskDecision, error) {
+	return requestDecision(ctx, "pretrade-controls", pretradeURL, cmd)
+}
+
+func requestDecision(ctx context.Context, service, url string, cmd model.OrderCommand) (*model.RiskDecision, error) {
+	body, _ := json.Marshal(cmd)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := riskClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", service, resp.Status)
+	}
+	var decision model.RiskDecision
+	if err := json.NewDecoder(resp.Body).Decode(&decision); err != nil {
+		return nil, fmt.Errorf("decode %s decision: %w", service, err)
+	}
+	return &decision, nil
+}
+
+func writeRiskRejection(w http.ResponseWriter, decision *model.RiskDecision) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "rejected",
+		"message":  decision.Reason,
+		"decision": decision,
+	})
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/atlas/services/common/model"
+)
+
+// Cancel-on-disconnect. A client names its session with the X-Atlas-Session
+// header on POST /orders and the session_id of its /ws subscribe or resume
+// request. If it opted in with cancel_on_disconnect and every connection for
+// the session is gone for longer than the grace period, the session's open
+// orders are mass-canceled. WebSocket is the only session transport the
+// gateway has today; another transport attaches and detaches the same way.
+
+const (
+	// sessionCancelTimeout bounds each mass cancel run when the grace period
+	// ends.
+	sessionCancelTimeout = 10 * time.Second
+
+	// Orders not yet acknowledged cannot be canceled. They are retried every
+	// sessionRetryInterval until acknowledged or finished, for up to
+	// sessionRetryLimit.
+	sessionRetryInterval = time.Second
+	sessionRetryLimit    = 5 * time.Minute
+)
+
+var sessions = NewSessionRegistry(codGracePeriod())
+
+// codGracePeriod returns how long a disconnected session has to reconnect
+// before its orders are canceled (ATLAS_COD_GRACE, e.g. "5s").
+func codGracePeriod() time.Duration {
+	if v, ok := os.LookupEnv("ATLAS_COD_GRACE"); ok {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d
+		}
+		log.Printf("[GATEWAY] Invalid ATLAS_COD_GRACE %q, using default", v)
+	}
+	return 5 * time.Second
+}
+
+type session struct {
+	id                 string
+	cancelOnDisconnect bool
+	conns              int
+	timer              *time.Timer
+	// Orders placed through the session that may still be open, by order
+	// ID, with their account.
+	orders map[string]string
+}
+
+// SessionRegistry tracks client sessions, their live connections and the
+// orders they placed.
+type SessionRegistry struct {
+	mu       sync.Mutex
+	grace    time.Duration
+	sessions map[string]*session
+	byOrder  map[string]string // order ID -> session ID
+}
+
+func NewSessionRegistry(grace time.Duration) *SessionRegistry {
+	return &SessionRegistry{
+		grace:    grace,
+		sessions: make(map[string]*session),
+		byOrder:  make(map[string]string),
+	}
+}
+
+func (r *SessionRegistry) getLocked(id string) *session {
+	s, ok := r.sessions[id]
+	if !ok {
+		s = &session{id: id, orders: make(map[string]string)}
+		r.sessions[id] = s
+	}
+	return s
+}
+
+// Attach registers a live connection for the session, stopping a pending
+// cancel-on-disconnect. The latest connection's setting wins.
+func (r *SessionRegistry) Attach(id string, cancelOnDisconnect bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.getLocked(id)
+	s.conns++
+	s.cancelOnDisconnect = cancelOnDisconnect
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+		log.Printf("[GATEWAY] Session %s reconnected within grace period, orders kept", id)
+	}
+}
+
+// Update changes the setting of a session the caller is already attached to.
+func (r *SessionRegistry) Update(id string, cancelOnDisconnect bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.getLocked(id).cancelOnDisconnect = cancelOnDisconnect
+}
+
+// Detach drops a connection. When the last one goes and the session opted
+// in, its open orders are canceled after the grace period.
+func (r *SessionRegistry) Detach(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.sessions[id]
+	if !ok {
+		return
+	}
+	if s.conns > 0 {
+		s.conns--
+	}
+	if s.conns > 0 {
+		return
+	}
+	if !s.cancelOnDisconnect {
+		if len(s.orders) == 0 {
+			delete(r.sessions, id)
+		}
+		return
+	}
+
+	log.Printf("[GATEWAY] Session %s disconnected, canceling %d order(s) in %s unless it reconnects", id, len(s.orders), r.grace)
+	s.timer = time.AfterFunc(r.grace, func() { r.expire(id) })
+}
+
+// Track records an order placed through the session.
+func (r *SessionRegistry) Track(id, accountID, orderID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.getLocked(id).orders[orderID] = accountID
+	r.byOrder[orderID] = id
+}
+
+// Done forgets an order that can no longer be canceled.
+func (r *SessionRegistry) Done(orderID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, ok := r.byOrder[orderID]
+	if !ok {
+		return
+	}
+	delete(r.byOrder, orderID)
+	if s, ok := r.sessions[id]; ok {
+		delete(s.orders, orderID)
+		if s.conns == 0 && s.timer == nil && len(s.orders) == 0 {
+			delete(r.sessions, id)
+		}
+	}
+}
+
+// expire runs when the grace period ends without a reconnect.
+func (r *SessionRegistry) expire(id string) {
+	r.mu.Lock()
+	s, ok := r.sessions[id]
+	if !ok || s.conns > 0 || s.timer == nil {
+		r.mu.Unlock()
+		return
+	}
+	byAccount := make(map[string]map[string]bool)
+	for orderID, accountID := range s.orders {
+		if byAccount[accountID] == nil {
+			byAccount[accountID] = make(map[string]bool)
+		}
+		byAccount[accountID][orderID] = true
+	}
+	s.timer = nil
+	r.mu.Unlock()
+
+	log.Printf("[GATEWAY] Session %s did not reconnect, cancel-on-disconnect triggered", id)
+	deadline := time.Now().Add(sessionRetryLimit)
+	for {
+		byAccount = cancelSessionOrders(id, byAccount)
+		if len(byAccount) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			log.Printf("[GATEWAY] ⚠️  Cancel-on-disconnect for session %s gave up on orders still not canceled: %v", id, byAccount)
+			return
+		}
+		time.Sleep(sessionRetryInterval)
+	}
+}
+
+// cancelSessionOrders mass-cancels a session's orders per account. It
+// returns the orders still to cancel: those pending acknowledgement and
+// those of accounts whose mass cancel failed.
+func cancelSessionOrders(id string, byAccount map[string]map[string]bool) map[string]map[string]bool {
+	ctx, cancel := context.WithTimeout(context.Background(), sessionCancelTimeout)
+	defer cancel()
+	retry := make(map[string]map[string]bool)
+	for accountID, orderIDs := range byAccount {
+		req := massCancelRequest{
+			Reason:    "cancel on disconnect",
+			sessionID: id,
+			orderIDs:  orderIDs,
+		}
+		result, err := massCancel(ctx, accountID, req, actorSelf)
+		if err != nil {
+			log.Printf("[GATEWAY] Cancel-on-disconnect for session %s account %s failed: %v", id, accountID, err)
+			retry[accountID] = orderIDs
+			continue
+		}
+		for _, orderID := range result.Pending {
+			if retry[accountID] == nil {
+				retry[accountID] = make(map[string]bool)
+			}
+			retry[accountID][orderID] = true
+		}
+	}
+	return retry
+}
+
+// isTerminal reports whether an order in this status is finished.
+func isTerminal(status model.OrderStatus) bool {
+	switch status {
+	case model.OrderStatusFilled, model.OrderStatusCanceled, model.OrderStatusRejected:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/atlas/services/common/model"
+)
+
+const (
+	channelExecutions = "executions"
+	channelMarketData = "market_data"
+	channelAudit      = "audit"
+	channelPositions  = "positions"
+	channelSnapshot   = "snapshot"
+
+	// Number of sequenced messages kept per channel for resume requests.
+	replayBufferSize = 10000
+
+	snapshotTimeout = 5 * time.Second
+)
+
+// StreamMessage is the envelope for everything sent on /ws. Seq increases by
+// one per message on each channel, so a client can detect gaps and resume.
+// Market data L2 is conflated for slow clients, so gaps on that channel are
+// expected and do not call for a resume.
+type StreamMessage struct {
+	Channel string          `json:"channel"`
+	Seq     uint64          `json:"seq"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Snapshot is the initial state sent on subscribe, or when a resume request
+// is too far behind to be served from the replay buffer. Seqs holds the last
+// sequence per channel already reflected in the snapshot.
+type Snapshot struct {
+	AccountID string                     `json:"account_id"`
+	Orders    []model.ExecutionReport    `json:"orders"`
+	Balances  *model.Account             `json:"balances,omitempty"`
+	Positions []model.Position           `json:"positions,omitempty"`
+	Books     map[string]json.RawMessage `json:"books"`
+	Seqs      map[string]uint64          `json:"seqs"`
+}
+
+// ClientRequest is an inbound /ws message.
+//
+//	{"action":"subscribe","account_id":"ACC_CHILD_1"}
+//	{"action":"resume","account_id":"ACC_CHILD_1","from_seq":{"executions":42}}
+//	{"action":"subscribe","account_id":"MM_1","session_id":"mm-quoter-1","cancel_on_disconnect":true}
+//
+// Resume replays every message with seq >= from_seq on each listed channel.
+// SessionID ties the connection to orders sent with the same X-Atlas-Session
+// header; see session.go for cancel-on-disconnect.
+type ClientRequest struct {
+	Action             string            `json:"action"`
+	AccountID          string            `json:"account_id"`
+	FromSeq            map[string]uint64 `json:"from_seq,omitempty"`
+	SessionID          string            `json:"session_id,omitempty"`
+	CancelOnDisconnect bool              `json:"cancel_on_disconnect,omitempty"`
+}
+
+// stream assigns sequence numbers for one channel and keeps the most recent
+// messages for replay.
+type stream struct {
+	mu    sync.Mutex
+	seq   uint64
+	ring  [][]byte
+	start int
+}
+
+// next wraps data in an envelope with the channel's next sequence number and
+// records it for replay. Callers hold s.mu so fan-out order matches seq order.
+func (s *stream) next(channel string, data []byte) []byte {
+	s.seq++
+	msg, _ := json.Marshal(StreamMessage{Channel: channel, Seq: s.seq, Data: data})
+
+	if len(s.ring) < replayBufferSize {
+		s.ring = append(s.ring, msg)
+	} else {
+		s.ring[s.start] = msg
+		s.start = (s.start + 1) % replayBufferSize
+	}
+	return msg
+}
+
+func (s *stream) lastSeq() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seq
+}
+
+// since returns the buffered messages with seq >= from, or false if some of
+// them have already been evicted.
+func (s *stream) since(from uint64) ([][]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if from > s.seq {
+		return nil, true
+	}
+	oldest := s.seq - uint64(len(s.ring)) + 1
+	if from < oldest {
+		return nil, false
+	}
+
+	out := make([][]byte, 0, s.seq-from+1)
+	for i := from - oldest; i < uint64(len(s.ring)); i++ {
+		out = append(out, s.ring[(s.start+int(i))%len(s.ring)])
+	}
+	return out, true
+}
+
+func (c *Client) handleRequest(raw []byte) {
+	var req ClientRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		log.Printf("[GATEWAY] Ignoring malformed WebSocket request: %v", err)
+		return
+	}
+	if req.AccountID == "" {
+		req.AccountID = "ACC_CHILD_1" // Default for demo
+	}
+	if req.SessionID != "" && (req.Action == "subscribe" || req.Action == "resume") {
+		c.attachSession(req.SessionID, req.CancelOnDisconnect)
+	}
+
+	switch req.Action {
+	case "subscribe":
+		c.sendSnapshot(req.AccountID)
+	case "resume":
+		var replay [][]byte
+		for channel, from := range req.FromSeq {
+			s, ok := c.hub.streams[channel]
+			if !ok {
+				continue
+			}
+			msgs, ok := s.since(from)
+			if !ok {
+				log.Printf("[GATEWAY] Resume from %s seq=%d is too far behind, sending snapshot", channel, from)
+				c.sendSnapshot(req.AccountID)
+				return
+			}
+			replay = append(replay, msgs...)
+		}
+		c.reply(replay...)
+	default:
+		log.Printf("[GATEWAY] Unknown WebSocket action: %q", req.Action)
+	}
+}
+
+func (c *Client) sendSnapshot(accountID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), snapshotTimeout)
+	defer cancel()
+
+	// Capture sequence numbers first: the state read afterwards reflects at
+	// least everything up to them.
+	snap := Snapshot{
+		AccountID: accountID,
+		Seqs:      make(map[string]uint64),
+		Books:     c.hub.books(),
+	}
+	for channel, s := range c.hub.streams {
+		snap.Seqs[channel] = s.lastSeq()
+	}
+
+	orders, err := getOpenOrders(ctx, accountID)
+	if err != nil {
+		log.Printf("[GATEWAY] Snapshot: error loading open orders for %s: %v", accountID, err)
+	}
+	snap.Orders = orders
+
+	acc, err := getAccount(ctx, accountID)
+	if err != nil {
+		log.Printf("[GATEWAY] Snapshot: error loading balances for %s: %v", accountID, err)
+	}
+	snap.Balances = acc
+
+	positions, err := getPositions(ctx, accountID)
+	if err != nil {
+		log.Printf("[GATEWAY] Snapshot: error loading positions for %s: %v", accountID, err)
+	}
+	snap.Positions = positions
+
+	data, _ := json.Marshal(snap)
+	msg, _ := json.Marshal(StreamMessage{Channel: channelSnapshot, Data: data})
+	c.reply(msg)
+}
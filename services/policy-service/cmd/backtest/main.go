@@ -0,0 +1,228 @@
+// Command backtest replays archived orders through a policy set and reports
+// which orders it would have rejected, by rule.
+//
+// It reads the audit archive written by audit-exporter through the same
+// stores: each manifest under manifests/ names an archive file and how it is
+// compressed, and each line of the file is a hash-chain record whose event
+// is the archived message. NEW commands are taken from orders.commands and
+// from ORDER_CREATED events on orders.events, de-duplicated by order ID.
+//
+// Usage (from services/policy-service):
+//
+//	go run ./cmd/backtest [-store s3|fs] [-bucket atlas-audit] [-endpoint url] [-dir audit-archive]
+//	    [-policies ../../config/policies/candidates] [-from 2026-01-01] [-to 2026-01-31]
+//	    [-tier retail] [-accounts tiers.json] [-v] [-json]
+//
+// The store defaults to the exporter's, from the same environment; a local
+// copy of the bucket is read with -store fs -dir <copy>.
+//
+// Balances and market data are not in the archive, so account balances and
+// market.* variables evaluate as 0. now.* uses each order's own timestamp.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/atlas/services/audit-exporter/archive"
+	"github.com/atlas/services/audit-exporter/store"
+	"github.com/atlas/services/common/config"
+	"github.com/atlas/services/common/model"
+	"github.com/atlas/services/policy-service/policy"
+)
+
+const (
+	topicCommands = "orders.commands"
+	topicEvents   = "orders.events"
+)
+
+func main() {
+	storeCfg := store.ConfigFromEnv(config.LoadAWSConfig("policy-service"))
+	backend := flag.String("store", string(storeCfg.Backend), "audit store: s3 or fs")
+	flag.StringVar(&storeCfg.Bucket, "bucket", storeCfg.Bucket, "s3: audit archive bucket")
+	flag.StringVar(&storeCfg.Endpoint, "endpoint", storeCfg.Endpoint, "s3: endpoint of an S3-compatible server such as MinIO")
+	flag.StringVar(&storeCfg.Dir, "dir", storeCfg.Dir, "fs: audit archive directory")
+	dir := flag.String("policies", policy.Dir(), "policy directory to evaluate")
+	from := flag.String("from", "", "first archive day to include (YYYY-MM-DD)")
+	to := flag.String("to", "", "last archive day to include (YYYY-MM-DD)")
+	tier := flag.String("tier", policy.DefaultTier, "tier for accounts not in -accounts")
+	accountsFile := flag.String("accounts", "", "JSON object mapping account_id to tier")
+	verbose := flag.Bool("v", false, "list every rejected order")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	set, err := policy.Load(*dir)
+	if err != nil {
+		log.Fatalf("Failed to load policies: %v", err)
+	}
+	if len(set.Policies) == 0 {
+		log.Fatalf("No policies found in %s", *dir)
+	}
+
+	tiers := map[string]string{}
+	if *accountsFile != "" {
+		raw, err := os.ReadFile(*accountsFile)
+		if err != nil {
+			log.Fatalf("Failed to read accounts: %v", err)
+		}
+		if err := json.Unmarshal(raw, &tiers); err != nil {
+			log.Fatalf("Failed to parse %s: %v", *accountsFile, err)
+		}
+	}
+
+	ctx := context.Background()
+	storeCfg.Backend = store.Backend(*backend)
+	if storeCfg.Backend == store.Memory {
+		log.Fatalf("-store memory starts empty, there is no archive to replay: use s3 or fs")
+	}
+	st, err := store.Open(ctx, storeCfg)
+	if err != nil {
+		log.Fatalf("unable to open audit store, %v", err)
+	}
+	orders, err := readArchive(ctx, st, *from, *to)
+	if err != nil {
+		log.Fatalf("Failed to read archive: %v", err)
+	}
+
+	tally := policy.NewTally()
+	var rejected []model.RiskDecision
+	for _, cmd := range orders {
+		acc := policy.Account{ID: cmd.ClientID, Tier: *tier}
+		if t, ok := tiers[cmd.ClientID]; ok {
+			acc.Tier = t
+		}
+		d := set.Evaluate(policy.Env(cmd, acc, policy.Market{}, cmd.Timestamp))
+		d.OrderID = cmd.OrderID
+		d.Timestamp = cmd.Timestamp
+		tally.Add(d)
+		if d.Decision == policy.DecisionRejected {
+			rejected = append(rejected, d)
+		}
+	}
+
+	if *asJSON {
+		report := map[string]interface{}{
+			"policy_version": set.Version(),
+			"orders":         tally.Orders,
+			"rejected":       tally.Rejected,
+			"rules":          tally.Sorted(),
+		}
+		if *verbose {
+			report["rejections"] = rejected
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+		return
+	}
+
+	fmt.Printf("Policies: %s\n", set.Version())
+	fmt.Printf("Orders:   %d\n", tally.Orders)
+	fmt.Printf("Rejected: %d\n\n", tally.Rejected)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "POLICY\tRULE\tACTION\tMATCHED\tREJECTED\tERRORS")
+	for _, st := range tally.Sorted() {
+		fmt.Fprintf(tw, "%s@%d\t%s\t%s\t%d\t%d\t%d\n", st.Policy, st.Version, st.RuleID, st.Action, st.Matched, st.Rejections, st.Errors)
+	}
+	tw.Flush()
+
+	if *verbose && len(rejected) > 0 {
+		fmt.Println()
+		for _, d := range rejected {
+			fmt.Printf("%s  %s  %s: %s\n", d.Timestamp.Format("2006-01-02T15:04:05Z07:00"), d.OrderID, d.ReasonCode, d.Reason)
+		}
+	}
+}
+
+// readArchive returns the NEW commands in the archive, oldest first. Files
+// are found through their manifests, which say how each is compressed.
+func readArchive(ctx context.Context, st store.Store, from, to string) ([]model.OrderCommand, error) {
+	keys, err := st.List(ctx, "manifests/")
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]model.OrderCommand)
+	for _, key := range keys {
+		raw, err := st.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		var m archive.Manifest
+		if err := json.Unmarshal(raw, &m); err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		if m.Topic != topicCommands && m.Topic != topicEvents {
+			continue
+		}
+		if (from != "" && m.Day < from) || (to != "" && m.Day > to) {
+			continue
+		}
+
+		body, err := st.Get(ctx, m.Key)
+		if errors.Is(err, store.ErrNotFound) {
+			log.Printf("Archive file %s missing, skipping", m.Key)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", m.Key, err)
+		}
+		recs, err := archive.Decode(m.Compression, body)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", m.Key, err)
+		}
+		for _, rec := range recs {
+			cmd, ok := commandFrom(m.Topic, rec.Event)
+			if !ok {
+				continue
+			}
+			if _, seen := byID[cmd.OrderID]; !seen {
+				byID[cmd.OrderID] = cmd
+			}
+		}
+	}
+
+	orders := make([]model.OrderCommand, 0, len(byID))
+	for _, cmd := range byID {
+		orders = append(orders, cmd)
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		if !orders[i].Timestamp.Equal(orders[j].Timestamp) {
+			return orders[i].Timestamp.Before(orders[j].Timestamp)
+		}
+		return orders[i].OrderID < orders[j].OrderID
+	})
+	return orders, nil
+}
+
+// commandFrom extracts a NEW order command from an archived message: the
+// event of a record, byte for byte as it was on the topic.
+func commandFrom(topic string, event []byte) (model.OrderCommand, bool) {
+	var cmd model.OrderCommand
+	switch topic {
+	case topicCommands:
+		if err := json.Unmarshal(event, &cmd); err != nil {
+			return cmd, false
+		}
+	case topicEvents:
+		var e struct {
+			Type    string          `json:"type"`
+			Payload json.RawMessage `json:"payload"`
+		}
+		if err := json.Unmarshal(event, &e); err != nil || e.Type != "ORDER_CREATED" {
+			return cmd, false
+		}
+		if err := json.Unmarshal(e.Payload, &cmd); err != nil {
+			return cmd, false
+		}
+	}
+	return cmd, cmd.Type == model.CommandTypeNew && cmd.OrderID != ""
+}
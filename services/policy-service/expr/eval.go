@@ -0,0 +1,258 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/atlas/services/common/decimal"
+)
+
+// Value is the result of evaluating an expression: decimal.Decimal, string,
+// bool, []Value or nil.
+type Value interface{}
+
+// Env maps top-level names to values. Nested maps are reached with dotted
+// identifiers, so Env{"order": map[string]interface{}{"side": "BUY"}}
+// resolves order.side. Go numbers are converted to decimal.Decimal.
+type Env map[string]interface{}
+
+// Lookup resolves a dotted path.
+func (env Env) Lookup(path string) (Value, bool) {
+	var cur interface{} = map[string]interface{}(env)
+	for _, part := range strings.Split(path, ".") {
+		var m map[string]interface{}
+		switch v := cur.(type) {
+		case map[string]interface{}:
+			m = v
+		case Env:
+			m = v
+		default:
+			return nil, false
+		}
+		next, ok := m[part]
+		if !ok {
+			return nil, false
+		}
+		cur = next
+	}
+	return normalize(cur), true
+}
+
+func normalize(v interface{}) Value {
+	switch n := v.(type) {
+	case int:
+		return decimal.FromInt(int64(n))
+	case int64:
+		return decimal.FromInt(n)
+	case float64:
+		return decimal.FromFloat(n)
+	case []string:
+		out := make([]Value, len(n))
+		for i, s := range n {
+			out[i] = s
+		}
+		return out
+	}
+	return v
+}
+
+// Eval evaluates the expression against env.
+func (e *Expr) Eval(env Env) (Value, error) {
+	return e.root.eval(env)
+}
+
+// EvalBool evaluates an expression that must produce a boolean.
+func (e *Expr) EvalBool(env Env) (bool, error) {
+	v, err := e.Eval(env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression is %s, not a boolean", typeName(v))
+	}
+	return b, nil
+}
+
+func (n *literal) eval(Env) (Value, error) { return n.v, nil }
+
+func (n *ident) eval(env Env) (Value, error) {
+	v, ok := env.Lookup(n.path)
+	if !ok {
+		return nil, fmt.Errorf("unknown variable %s", n.path)
+	}
+	return v, nil
+}
+
+func (n *list) eval(env Env) (Value, error) {
+	out := make([]Value, len(n.items))
+	for i, item := range n.items {
+		v, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func (n *unary) eval(env Env) (Value, error) {
+	x, err := n.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "!":
+		if b, ok := x.(bool); ok {
+			return !b, nil
+		}
+	case "-":
+		if d, ok := x.(decimal.Decimal); ok {
+			return d.Neg(), nil
+		}
+	}
+	return nil, fmt.Errorf("cannot apply %s to %s", n.op, typeName(x))
+}
+
+func (n *binary) eval(env Env) (Value, error) {
+	l, err := n.l.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// Short-circuit the logical operators.
+	if n.op == "&&" || n.op == "||" {
+		lb, ok := l.(bool)
+		if !ok {
+			return nil, fmt.Errorf("left side of %s is %s, not a boolean", n.op, typeName(l))
+		}
+		if (n.op == "&&" && !lb) || (n.op == "||" && lb) {
+			return lb, nil
+		}
+		r, err := n.r.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		rb, ok := r.(bool)
+		if !ok {
+			return nil, fmt.Errorf("right side of %s is %s, not a boolean", n.op, typeName(r))
+		}
+		return rb, nil
+	}
+
+	r, err := n.r.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(l, r), nil
+	case "!=":
+		return !equal(l, r), nil
+	case "in":
+		items, ok := r.([]Value)
+		if !ok {
+			return nil, fmt.Errorf("right side of in is %s, not a list", typeName(r))
+		}
+		for _, item := range items {
+			if equal(l, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "<", "<=", ">", ">=":
+		c, err := compare(l, r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", n.op, err)
+		}
+		switch n.op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	}
+
+	ld, lok := l.(decimal.Decimal)
+	rd, rok := r.(decimal.Decimal)
+	if !lok || !rok {
+		return nil, fmt.Errorf("cannot apply %s to %s and %s", n.op, typeName(l), typeName(r))
+	}
+	var v decimal.Decimal
+	switch n.op {
+	case "+":
+		v, err = ld.AddChecked(rd)
+	case "-":
+		v, err = ld.SubChecked(rd)
+	case "*":
+		v, err = ld.MulChecked(rd)
+	case "/":
+		if rd.IsZero() {
+			return nil, fmt.Errorf("division by zero")
+		}
+		v, err = ld.DivChecked(rd)
+	default:
+		return nil, fmt.Errorf("unknown operator %s", n.op)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s %s %s: %w", ld, n.op, rd, err)
+	}
+	return v, nil
+}
+
+func equal(l, r Value) bool {
+	if ld, ok := l.(decimal.Decimal); ok {
+		rd, ok := r.(decimal.Decimal)
+		return ok && ld.Equal(rd)
+	}
+	switch lv := l.(type) {
+	case nil, string, bool:
+		return l == r
+	case []Value:
+		rv, ok := r.([]Value)
+		if !ok || len(lv) != len(rv) {
+			return false
+		}
+		for i := range lv {
+			if !equal(lv[i], rv[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func compare(l, r Value) (int, error) {
+	switch lv := l.(type) {
+	case decimal.Decimal:
+		if rv, ok := r.(decimal.Decimal); ok {
+			return lv.Cmp(rv), nil
+		}
+	case string:
+		if rv, ok := r.(string); ok {
+			return strings.Compare(lv, rv), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %s with %s", typeName(l), typeName(r))
+}
+
+func typeName(v Value) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case decimal.Decimal:
+		return "number"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case []Value:
+		return "list"
+	}
+	return fmt.Sprintf("%T", v)
+}
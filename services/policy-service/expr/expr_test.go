@@ -0,0 +1,178 @@
+package expr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/atlas/services/common/decimal"
+)
+
+var testEnv = Env{
+	"order": map[string]interface{}{
+		"type":     "LIMIT",
+		"side":     "BUY",
+		"symbol":   "BTC-USD",
+		"quantity": decimal.RequireFromString("2"),
+		"price":    decimal.RequireFromString("65000.5"),
+		"notional": decimal.RequireFromString("130001"),
+		"tags":     []string{"vip", "api"},
+	},
+	"account": map[string]interface{}{"tier": "retail"},
+	"now":     map[string]interface{}{"hour": 9},
+	"huge":    decimal.MaxValue,
+	"nothing": nil,
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		src  string
+		want Value
+	}{
+		// Literals.
+		{`1`, decimal.RequireFromString("1")},
+		{`0.1`, decimal.RequireFromString("0.1")},
+		{`"a b"`, "a b"},
+		{`'it\'s'`, "it's"},
+		{`true`, true},
+		{`null`, nil},
+		{`[]`, []Value{}},
+		{`[1, "x"]`, []Value{decimal.RequireFromString("1"), "x"}},
+
+		// Variables.
+		{`order.side`, "BUY"},
+		{`order.quantity`, decimal.RequireFromString("2")},
+		{`now.hour`, decimal.RequireFromString("9")},
+		{`nothing == null`, true},
+
+		// Arithmetic is exact and binds tighter than comparison.
+		{`0.1 + 0.2 == 0.3`, true},
+		{`order.quantity * order.price`, decimal.RequireFromString("130001")},
+		{`1 + 2 * 3`, decimal.RequireFromString("7")},
+		{`(1 + 2) * 3`, decimal.RequireFromString("9")},
+		{`10 - 4 - 3`, decimal.RequireFromString("3")},
+		{`12 / 4 / 3`, decimal.RequireFromString("1")},
+		{`1 / 3`, decimal.RequireFromString("0.33333333")},
+		{`-order.quantity`, decimal.RequireFromString("-2")},
+		{`--1`, decimal.RequireFromString("1")},
+
+		// Comparison.
+		{`order.notional > 130000`, true},
+		{`order.notional >= 130001`, true},
+		{`order.notional < 130001`, false},
+		{`order.price <= 65000.50`, true},
+		{`order.symbol == "BTC-USD"`, true},
+		{`order.symbol != "BTC-USD"`, false},
+		{`"abc" < "abd"`, true},
+		{`order.side == 1`, false},
+		{`[1, 2] == [1, 2.0]`, true},
+
+		// Membership.
+		{`order.symbol in ["BTC-USD", "ETH-USD"]`, true},
+		{`order.type in ["MARKET", "STOP"]`, false},
+		{`"api" in order.tags`, true},
+		{`2 in [1, 2.00]`, true},
+
+		// Logic, with && binding tighter than ||.
+		{`!true`, false},
+		{`true || false && false`, true},
+		{`(true || false) && false`, false},
+		{`account.tier == "retail" && !(now.hour >= 8 && now.hour < 20)`, false},
+		// Short-circuiting skips the side that would fail.
+		{`false && missing.var > 1`, false},
+		{`true || 1 / 0 > 1`, true},
+	}
+	for _, tt := range tests {
+		e, err := Compile(tt.src)
+		if err != nil {
+			t.Errorf("Compile(%s): %v", tt.src, err)
+			continue
+		}
+		got, err := e.Eval(testEnv)
+		if err != nil {
+			t.Errorf("Eval(%s): %v", tt.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Eval(%s) = %#v, want %#v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{``, "unexpected end of expression"},
+		{`1 +`, "unexpected end of expression"},
+		{`(1`, `expected ")"`},
+		{`1 2`, `unexpected "2"`},
+		{`[1 2]`, `expected "," or "]"`},
+		{`order.`, "invalid identifier"},
+		{`order..side`, "invalid identifier"},
+		{`1.2.3`, "invalid number"},
+		{`"open`, "unterminated string"},
+		{`a # b`, "unexpected character"},
+		{`in [1]`, `unexpected "in"`},
+		{`a = 1`, "unexpected character"},
+	}
+	for _, tt := range tests {
+		_, err := Compile(tt.src)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Compile(%s) error = %v, want %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`missing.var > 1`, "unknown variable missing.var"},
+		{`order.side.more`, "unknown variable"},
+		{`1 / 0`, "division by zero"},
+		{`huge + 1`, "out of range"},
+		{`huge * 2`, "out of range"},
+		{`-huge - 2`, "out of range"},
+		{`order.side + 1`, "cannot apply + to string and number"},
+		{`order.side > 1`, "cannot compare string with number"},
+		{`!1`, "cannot apply ! to number"},
+		{`-"a"`, "cannot apply - to string"},
+		{`1 && true`, "number"},
+		{`1 in 1`, "not a list"},
+	}
+	for _, tt := range tests {
+		e, err := Compile(tt.src)
+		if err != nil {
+			t.Errorf("Compile(%s): %v", tt.src, err)
+			continue
+		}
+		_, err = e.Eval(testEnv)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Eval(%s) error = %v, want %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestEvalBool(t *testing.T) {
+	e, err := Compile(`order.notional`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.EvalBool(testEnv); err == nil || !strings.Contains(err.Error(), "not a boolean") {
+		t.Errorf("EvalBool of a number: error = %v", err)
+	}
+}
+
+func TestVars(t *testing.T) {
+	e, err := Compile(`order.side == "BUY" && order.notional > 1 || order.side == "SELL" && now.hour in [1, 2]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"now.hour", "order.notional", "order.side"}
+	if got := e.Vars(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Vars() = %v, want %v", got, want)
+	}
+}
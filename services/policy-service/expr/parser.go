@@ -0,0 +1,202 @@
+package expr
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/atlas/services/common/decimal"
+)
+
+// node is a parsed expression.
+type node interface {
+	eval(env Env) (Value, error)
+}
+
+type literal struct{ v Value }
+
+type ident struct{ path string }
+
+type list struct{ items []node }
+
+type unary struct {
+	op string
+	x  node
+}
+
+type binary struct {
+	op   string
+	l, r node
+}
+
+// Binary operator precedence, loosest first.
+var precedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3,
+	"<": 4, "<=": 4, ">": 4, ">=": 4, "in": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6,
+}
+
+// Expr is a compiled expression.
+type Expr struct {
+	src  string
+	root node
+	vars []string
+}
+
+// Compile parses src.
+func Compile(src string) (*Expr, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks, vars: make(map[string]bool)}
+	root, err := p.parseExpr(1)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %s at %d", t, t.pos)
+	}
+
+	vars := make([]string, 0, len(p.vars))
+	for v := range p.vars {
+		vars = append(vars, v)
+	}
+	sort.Strings(vars)
+	return &Expr{src: src, root: root, vars: vars}, nil
+}
+
+// String returns the source text.
+func (e *Expr) String() string { return e.src }
+
+// Vars returns the identifiers the expression reads, sorted.
+func (e *Expr) Vars() []string { return e.vars }
+
+type parser struct {
+	toks []token
+	pos  int
+	vars map[string]bool
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(op string) error {
+	if t := p.next(); t.kind != tokOp || t.text != op {
+		return fmt.Errorf("expected %q, got %s at %d", op, t, t.pos)
+	}
+	return nil
+}
+
+// binaryOp returns the operator at the cursor, if any. "in" lexes as an
+// identifier.
+func (p *parser) binaryOp() (string, bool) {
+	t := p.peek()
+	if t.kind == tokOp || (t.kind == tokIdent && t.text == "in") {
+		_, ok := precedence[t.text]
+		return t.text, ok
+	}
+	return "", false
+}
+
+// parseExpr is precedence climbing over the binary operators.
+func (p *parser) parseExpr(minPrec int) (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.binaryOp()
+		if !ok || precedence[op] < minPrec {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseExpr(precedence[op] + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: op, l: left, r: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if t := p.peek(); t.kind == tokOp && (t.text == "!" || t.text == "-") {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unary{op: t.text, x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		d, err := decimal.NewFromString(t.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", t.text, t.pos)
+		}
+		return &literal{d}, nil
+
+	case tokString:
+		return &literal{t.text}, nil
+
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &literal{true}, nil
+		case "false":
+			return &literal{false}, nil
+		case "null":
+			return &literal{nil}, nil
+		case "in":
+			return nil, fmt.Errorf("unexpected \"in\" at %d", t.pos)
+		}
+		p.vars[t.text] = true
+		return &ident{t.text}, nil
+
+	case tokOp:
+		switch t.text {
+		case "(":
+			x, err := p.parseExpr(1)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return x, nil
+		case "[":
+			l := &list{}
+			if n := p.peek(); n.kind == tokOp && n.text == "]" {
+				p.next()
+				return l, nil
+			}
+			for {
+				item, err := p.parseExpr(1)
+				if err != nil {
+					return nil, err
+				}
+				l.items = append(l.items, item)
+				if n := p.next(); n.kind == tokOp && n.text == "]" {
+					return l, nil
+				} else if n.kind != tokOp || n.text != "," {
+					return nil, fmt.Errorf("expected \",\" or \"]\", got %s at %d", n, n.pos)
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("unexpected %s at %d", t, t.pos)
+}
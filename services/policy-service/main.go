@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/atlas/services/common/config"
+	"github.com/atlas/services/common/db"
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/kafka"
+	"github.com/atlas/services/common/model"
+	"github.com/atlas/services/common/schema"
+	"github.com/atlas/services/policy-service/expr"
+	"github.com/atlas/services/policy-service/policy"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+var (
+	kafkaBrokers    = []string{"localhost:19092"}
+	topicDecisions  = "risk.decisions"
+	topicMarketData = "market.data"
+	producer        *kafka.Producer
+
+	// Persistence
+	dynamoClient *db.DynamoClient
+	awsCfg       *config.AWSConfig
+
+	schemas *schema.Registry
+
+	marketMu sync.RWMutex
+	markets  = make(map[string]policy.Market)
+)
+
+func main() {
+	ctx := context.Background()
+
+	awsCfg = config.LoadAWSConfig("policy-service")
+
+	reg, err := schema.Load(schema.Dir())
+	if err != nil {
+		log.Fatalf("Failed to load schemas: %v", err)
+	}
+	schemas = reg
+
+	dir := policy.Dir()
+	set, err := policy.Load(dir)
+	if err != nil {
+		log.Fatalf("Failed to load policies: %v", err)
+	}
+	activePolicies.Store(set)
+	log.Printf("[POLICY] Loaded policies from %s: %s", dir, set.Version())
+	go watchPolicies("active", dir, &activePolicies)
+
+	candidateDir := policy.CandidateDir()
+	candidates, err := policy.Load(candidateDir)
+	if err != nil {
+		log.Fatalf("Failed to load candidate policies: %v", err)
+	}
+	candidatePolicies.Store(candidates)
+	if len(candidates.Policies) > 0 {
+		log.Printf("[POLICY] Shadowing candidate policies from %s: %s", candidateDir, candidates.Version())
+	}
+	go watchPolicies("candidate", candidateDir, &candidatePolicies)
+
+	producer = kafka.NewProducer(kafkaBrokers, topicDecisions)
+	defer producer.Close()
+
+	dynamo, err := db.NewDynamoClient(ctx, awsCfg.Region, awsCfg.DynamoDBEndpoint)
+	if err != nil {
+		log.Fatalf("Failed to connect to DynamoDB: %v", err)
+	}
+	dynamoClient = dynamo
+
+	go startMarketDataConsumer()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/evaluate", handleEvaluate)
+	mux.HandleFunc("/policies", handlePolicies)
+	mux.HandleFunc("/dry-run", handleDryRun)
+	mux.HandleFunc("/shadow", handleShadowStats)
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	})
+
+	server := &http.Server{
+		Addr:    ":8004",
+		Handler: mux,
+	}
+
+	go func() {
+		log.Println("Starting Policy Service on :8004")
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server error: %v", err)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Println("Shutting down...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Fatal("Server forced to shutdown:", err)
+	}
+}
+
+// handleEvaluate runs the active policies against an order command, publishes
+// the decision to risk.decisions and returns it with its trace.
+func handleEvaluate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cmd, env, ok := readOrder(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	now := time.Now().UTC()
+	decision := activePolicies.Load().Evaluate(env)
+	decision.DecisionID = uuid.New().String()
+	decision.OrderID = cmd.OrderID
+	decision.Timestamp = now
+
+	if decision.Decision == policy.DecisionApproved {
+		log.Printf("[POLICY] ✅ APPROVED order_id=%s account=%s policies=%s",
+			cmd.OrderID, cmd.ClientID, decision.PolicyVersion)
+	} else {
+		log.Printf("[POLICY] ❌ REJECTED order_id=%s account=%s rule=%s: %s (policies=%s)",
+			cmd.OrderID, cmd.ClientID, decision.ReasonCode, decision.Reason, decision.PolicyVersion)
+	}
+
+	publishDecision(ctx, decision)
+
+	if candidates := candidatePolicies.Load(); len(candidates.Policies) > 0 {
+		shadowEvaluate(cmd, candidates, env, decision)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(decision)
+}
+
+// readOrder decodes an order command and builds its evaluation environment,
+// writing an error response if either fails.
+func readOrder(w http.ResponseWriter, r *http.Request) (model.OrderCommand, expr.Env, bool) {
+	var cmd model.OrderCommand
+	body, _ := io.ReadAll(r.Body)
+	if errs := schemas.ValidateJSON(schema.OrderCommand, body); len(errs) > 0 {
+		http.Error(w, errs.Error(), http.StatusBadRequest)
+		return cmd, nil, false
+	}
+	if err := json.Unmarshal(body, &cmd); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return cmd, nil, false
+	}
+
+	acc, err := getAccount(r.Context(), cmd.ClientID)
+	if err != nil {
+		// Without the account context the rules cannot be trusted.
+		log.Printf("[POLICY] Error loading account %s: %v", cmd.ClientID, err)
+		http.Error(w, "Error loading account", http.StatusInternalServerError)
+		return cmd, nil, false
+	}
+
+	marketMu.RLock()
+	mkt := markets[cmd.Symbol]
+	marketMu.RUnlock()
+
+	return cmd, policy.Env(cmd, acc, mkt, time.Now()), true
+}
+
+func publishDecision(ctx context.Context, decision model.RiskDecision) {
+	value, _ := json.Marshal(decision)
+	if err := producer.Produce(ctx, []byte(decision.OrderID), value); err != nil {
+		log.Printf("[POLICY] ❌ FAILED to publish decision %s for order_id=%s: %v", decision.DecisionID, decision.OrderID, err)
+	}
+}
+
+// handlePolicies lists the active and candidate policies and their rules.
+func handlePolicies(w http.ResponseWriter, r *http.Request) {
+	set := activePolicies.Load()
+	candidates := candidatePolicies.Load()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"version":           set.Version(),
+		"policies":          set.Policies,
+		"candidate_version": candidates.Version(),
+		"candidates":        candidates.Policies,
+		"variables":         policy.Variables,
+	})
+}
+
+// getAccount reads the account's tier and balances. Accounts the gateway has
+// not created yet evaluate with the default tier and zero balances.
+func getAccount(ctx context.Context, accountID string) (policy.Account, error) {
+	acc := policy.Account{ID: accountID, Tier: policy.DefaultTier}
+
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(awsCfg.BalancesTable),
+		Key: map[string]types.AttributeValue{
+			"account_id": &types.AttributeValueMemberS{Value: accountID},
+		},
+	})
+	if err != nil {
+		return acc, err
+	}
+	if result.Item == nil {
+		return acc, nil
+	}
+
+	var data struct {
+		Tier         string          `dynamodbav:"tier"`
+		USDAvailable decimal.Decimal `dynamodbav:"usd_available"`
+		USDReserved  decimal.Decimal `dynamodbav:"usd_reserved"`
+		BTCAvailable decimal.Decimal `dynamodbav:"btc_available"`
+		BTCReserved  decimal.Decimal `dynamodbav:"btc_reserved"`
+	}
+	if err := attributevalue.UnmarshalMap(result.Item, &data); err != nil {
+		return acc, err
+	}
+	if data.Tier != "" {
+		acc.Tier = data.Tier
+	}
+	acc.Balance = model.Account{
+		Tier: acc.Tier,
+		USD:  model.Balance{Available: data.USDAvailable, Reserved: data.USDReserved},
+		BTC:  model.Balance{Available: data.BTCAvailable, Reserved: data.BTCReserved},
+	}
+	return acc, nil
+}
+
+func startMarketDataConsumer() {
+	consumer := kafka.NewConsumer(kafkaBrokers, topicMarketData, "policy-service-md-group")
+	defer consumer.Close()
+
+	err := consumer.Consume(context.Background(), func(ctx context.Context, msg kafka.Message) error {
+		var update model.MarketDataUpdate
+		if err := json.Unmarshal(msg.Value, &update); err != nil {
+			log.Printf("[POLICY] Error unmarshalling market data: %v", err)
+			return nil
+		}
+
+		marketMu.Lock()
+		defer marketMu.Unlock()
+		mkt := markets[update.Symbol]
+		switch update.Type {
+		case model.MarketDataTypeL2:
+			if len(update.Bids) > 0 {
+				mkt.BestBid = decimal.FromFloat(update.Bids[0].Price)
+			}
+			if len(update.Asks) > 0 {
+				mkt.BestAsk = decimal.FromFloat(update.Asks[0].Price)
+			}
+		case model.MarketDataTypeTrade:
+			if update.Trade != nil {
+				mkt.LastPrice = decimal.FromFloat(update.Trade.Price)
+			}
+		}
+		markets[update.Symbol] = mkt
+		return nil
+	})
+
+	if err != nil {
+		log.Printf("Market Data Consumer failed: %v", err)
+	}
+}
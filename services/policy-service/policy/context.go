@@ -0,0 +1,99 @@
+package policy
+
+import (
+	"time"
+
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/model"
+	"github.com/atlas/services/policy-service/expr"
+)
+
+// Variables lists every name a rule may read.
+var Variables = []string{
+	"order.id", "order.command", "order.type", "order.account_id",
+	"order.symbol", "order.side", "order.quantity", "order.price", "order.notional",
+	"account.id", "account.tier",
+	"account.usd_available", "account.usd_reserved",
+	"account.btc_available", "account.btc_reserved",
+	"market.last_price", "market.best_bid", "market.best_ask", "market.deviation_pct",
+	"now.hour", "now.weekday",
+}
+
+var known = func() map[string]bool {
+	m := make(map[string]bool, len(Variables))
+	for _, v := range Variables {
+		m[v] = true
+	}
+	return m
+}()
+
+func knownVariable(name string) bool { return known[name] }
+
+// DefaultTier applies to accounts without a tier attribute.
+const DefaultTier = "retail"
+
+// Account is the account context of an order.
+type Account struct {
+	ID      string
+	Tier    string
+	Balance model.Account
+}
+
+// Market is the market context of an order's symbol. Zero values mean no
+// data yet.
+type Market struct {
+	LastPrice decimal.Decimal
+	BestBid   decimal.Decimal
+	BestAsk   decimal.Decimal
+}
+
+// Env builds the evaluation environment for an order.
+func Env(cmd model.OrderCommand, acc Account, mkt Market, now time.Time) expr.Env {
+	px := cmd.Price
+	if !px.IsPositive() {
+		px = mkt.LastPrice
+	}
+
+	deviation := decimal.Zero
+	if cmd.Price.IsPositive() && mkt.LastPrice.IsPositive() {
+		deviation = cmd.Price.Sub(mkt.LastPrice).Abs().MulInt(100).Div(mkt.LastPrice)
+	}
+
+	tier := acc.Tier
+	if tier == "" {
+		tier = DefaultTier
+	}
+
+	now = now.UTC()
+	return expr.Env{
+		"order": map[string]interface{}{
+			"id":         cmd.OrderID,
+			"command":    string(cmd.Type),
+			"type":       string(cmd.OrderType),
+			"account_id": cmd.ClientID,
+			"symbol":     cmd.Symbol,
+			"side":       string(cmd.Side),
+			"quantity":   cmd.QuantityVal,
+			"price":      cmd.Price,
+			"notional":   cmd.QuantityVal.Mul(px),
+		},
+		"account": map[string]interface{}{
+			"id":            acc.ID,
+			"tier":          tier,
+			"usd_available": acc.Balance.USD.Available,
+			"usd_reserved":  acc.Balance.USD.Reserved,
+			"btc_available": acc.Balance.BTC.Available,
+			"btc_reserved":  acc.Balance.BTC.Reserved,
+		},
+		"market": map[string]interface{}{
+			"last_price":    mkt.LastPrice,
+			"best_bid":      mkt.BestBid,
+			"best_ask":      mkt.BestAsk,
+			"deviation_pct": deviation,
+		},
+		"now": map[string]interface{}{
+			"hour":    now.Hour(),
+			"weekday": now.Weekday().String(),
+		},
+	}
+}
@@ -0,0 +1,54 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/model"
+	"github.com/atlas/services/policy-service/expr"
+)
+
+func TestEnv(t *testing.T) {
+	cmd := model.OrderCommand{
+		Type:        model.CommandTypeNew,
+		OrderType:   model.OrderTypeMarket,
+		Symbol:      "BTC-USD",
+		Side:        model.OrderSideBuy,
+		QuantityVal: decimal.RequireFromString("2"),
+	}
+	mkt := Market{LastPrice: decimal.RequireFromString("65000")}
+	env := Env(cmd, Account{ID: "ACC_CHILD_1"}, mkt, time.Date(2026, 1, 5, 9, 30, 0, 0, time.UTC))
+
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{`order.type == "MARKET"`, true},
+		{`order.command == "NEW"`, true},
+		// Orders without a price are valued at the last trade.
+		{`order.notional == 130000`, true},
+		{`market.deviation_pct == 0`, true},
+		{`account.tier == "` + DefaultTier + `"`, true},
+		{`now.hour == 9 && now.weekday == "Monday"`, true},
+	}
+	for _, tt := range tests {
+		e, err := expr.Compile(tt.src)
+		if err != nil {
+			t.Fatalf("Compile(%s): %v", tt.src, err)
+		}
+		for _, v := range e.Vars() {
+			if !knownVariable(v) {
+				t.Errorf("%s reads %s, which is not in Variables", tt.src, v)
+			}
+		}
+		got, err := e.EvalBool(env)
+		if err != nil {
+			t.Errorf("Eval(%s): %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Eval(%s) = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
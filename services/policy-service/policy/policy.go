@@ -0,0 +1,236 @@
+// Package policy loads policy files and evaluates their rules against an
+// order.
+//
+// A policy file is a JSON document in the policy directory:
+//
+//	{
+//	  "name": "retail-risk",
+//	  "version": 3,
+//	  "rules": [
+//	    {
+//	      "id": "RETAIL_NOTIONAL_CAP",
+//	      "when": "order.notional > 250000 && account.tier == \"retail\"",
+//	      "action": "REJECT",
+//	      "reason": "Retail orders are capped at 250,000 notional"
+//	    }
+//	  ]
+//	}
+//
+// A rule fires when its expression is true. REJECT rules block the order,
+// WARN rules only show up in the decision trace. The variables a rule may
+// read are listed in Variables.
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/atlas/services/common/config"
+	"github.com/atlas/services/common/model"
+	"github.com/atlas/services/policy-service/expr"
+)
+
+type Action string
+
+const (
+	ActionReject Action = "REJECT"
+	ActionWarn   Action = "WARN"
+)
+
+const (
+	DecisionApproved = "APPROVED"
+	DecisionRejected = "REJECTED"
+
+	// ReasonPolicyError is the reason code when a rule cannot be evaluated.
+	// Such orders are rejected: a broken rule must not let orders through.
+	ReasonPolicyError = "POLICY_ERROR"
+)
+
+type Rule struct {
+	ID          string `json:"id"`
+	Description string `json:"description,omitempty"`
+	When        string `json:"when"`
+	Action      Action `json:"action,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+
+	expr *expr.Expr
+}
+
+type Policy struct {
+	Name        string `json:"name"`
+	Version     int    `json:"version"`
+	Description string `json:"description,omitempty"`
+	Rules       []Rule `json:"rules"`
+
+	File string `json:"file"`
+}
+
+// Set is every policy loaded from a directory.
+type Set struct {
+	Policies []*Policy `json:"policies"`
+}
+
+// Dir returns the policy directory, ATLAS_POLICY_DIR if set.
+func Dir() string {
+	return config.RepoPath("ATLAS_POLICY_DIR", "config/policies")
+}
+
+// CandidateDir returns the directory of candidate policies. Candidates are
+// evaluated in shadow next to the active policies but never enforced; a rule
+// is promoted by moving its file up into Dir.
+func CandidateDir() string {
+	if dir, ok := os.LookupEnv("ATLAS_POLICY_CANDIDATE_DIR"); ok {
+		return dir
+	}
+	return filepath.Join(Dir(), "candidates")
+}
+
+// Load reads and compiles every *.json file in dir. Any invalid file fails
+// the whole load, so a bad edit never half-applies.
+func Load(dir string) (*Set, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	set := &Set{}
+	names := make(map[string]string)
+	for _, path := range paths {
+		p, err := LoadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if other, dup := names[p.Name]; dup {
+			return nil, fmt.Errorf("%s: policy %q is already defined in %s", path, p.Name, other)
+		}
+		names[p.Name] = path
+		set.Policies = append(set.Policies, p)
+	}
+	return set, nil
+}
+
+// LoadFile reads and compiles one policy file.
+func LoadFile(path string) (*Policy, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p Policy
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	p.File = filepath.Base(path)
+	if p.Name == "" {
+		return nil, fmt.Errorf("%s: policy without name", path)
+	}
+	if p.Version <= 0 {
+		return nil, fmt.Errorf("%s: version must be a positive integer", path)
+	}
+
+	ids := make(map[string]bool)
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.ID == "" {
+			return nil, fmt.Errorf("%s: rule %d has no id", path, i)
+		}
+		if ids[r.ID] {
+			return nil, fmt.Errorf("%s: duplicate rule id %s", path, r.ID)
+		}
+		ids[r.ID] = true
+
+		switch r.Action {
+		case "":
+			r.Action = ActionReject
+		case ActionReject, ActionWarn:
+		default:
+			return nil, fmt.Errorf("%s: rule %s: unknown action %q", path, r.ID, r.Action)
+		}
+
+		e, err := expr.Compile(r.When)
+		if err != nil {
+			return nil, fmt.Errorf("%s: rule %s: %w", path, r.ID, err)
+		}
+		for _, v := range e.Vars() {
+			if !knownVariable(v) {
+				return nil, fmt.Errorf("%s: rule %s: unknown variable %s", path, r.ID, v)
+			}
+		}
+		r.expr = e
+	}
+	return &p, nil
+}
+
+// Version identifies the loaded rules, e.g. "compliance@2,retail-risk@3".
+func (s *Set) Version() string {
+	parts := make([]string, len(s.Policies))
+	for i, p := range s.Policies {
+		parts[i] = fmt.Sprintf("%s@%d", p.Name, p.Version)
+	}
+	return strings.Join(parts, ",")
+}
+
+// Evaluate runs every rule against env and returns the decision with a full
+// trace. The decision's ID, order ID and timestamp are left to the caller.
+func (s *Set) Evaluate(env expr.Env) model.RiskDecision {
+	d := model.RiskDecision{
+		Decision:      DecisionApproved,
+		PolicyVersion: s.Version(),
+	}
+
+	for _, p := range s.Policies {
+		for _, r := range p.Rules {
+			res := model.RuleResult{
+				Policy:     p.Name,
+				Version:    p.Version,
+				RuleID:     r.ID,
+				Expression: r.When,
+				Action:     string(r.Action),
+				Inputs:     inputs(r.expr, env),
+			}
+
+			matched, err := r.expr.EvalBool(env)
+			res.Matched = matched
+			if err != nil {
+				res.Error = err.Error()
+			}
+			d.Trace = append(d.Trace, res)
+
+			if d.Decision == DecisionRejected {
+				continue // keep tracing, first rejection wins
+			}
+			switch {
+			case err != nil:
+				d.Decision = DecisionRejected
+				d.ReasonCode = ReasonPolicyError
+				d.Reason = fmt.Sprintf("%s/%s: %v", p.Name, r.ID, err)
+			case matched && r.Action == ActionReject:
+				d.Decision = DecisionRejected
+				d.ReasonCode = r.ID
+				d.Reason = r.Reason
+				if d.Reason == "" {
+					d.Reason = fmt.Sprintf("rejected by %s/%s", p.Name, r.ID)
+				}
+			}
+		}
+	}
+	return d
+}
+
+// inputs records the variables a rule reads, for the trace.
+func inputs(e *expr.Expr, env expr.Env) map[string]interface{} {
+	if len(e.Vars()) == 0 {
+		return nil
+	}
+	out := make(map[string]interface{}, len(e.Vars()))
+	for _, v := range e.Vars() {
+		if val, ok := env.Lookup(v); ok {
+			out[v] = val
+		}
+	}
+	return out
+}
@@ -0,0 +1,81 @@
+package policy
+
+import (
+	"sort"
+
+	"github.com/atlas/services/common/model"
+)
+
+// RuleStats counts one rule's outcomes over many decisions.
+type RuleStats struct {
+	Policy  string `json:"policy"`
+	Version int    `json:"version"`
+	RuleID  string `json:"rule_id"`
+	Action  string `json:"action"`
+	Matched int    `json:"matched"`
+	Errors  int    `json:"errors"`
+	// Rejections counts the decisions this rule rejected, i.e. where it was
+	// the first rule to reject.
+	Rejections int `json:"rejections"`
+}
+
+// Tally aggregates decisions by rule, for shadow statistics and backtests.
+type Tally struct {
+	Orders   int                   `json:"orders"`
+	Rejected int                   `json:"rejected"`
+	Rules    map[string]*RuleStats `json:"-"`
+}
+
+func NewTally() *Tally {
+	return &Tally{Rules: make(map[string]*RuleStats)}
+}
+
+// Add counts one decision from its trace.
+func (t *Tally) Add(d model.RiskDecision) {
+	t.Orders++
+	if d.Decision == DecisionRejected {
+		t.Rejected++
+	}
+
+	decided := false
+	for _, res := range d.Trace {
+		key := res.Policy + "/" + res.RuleID
+		st, ok := t.Rules[key]
+		if !ok {
+			st = &RuleStats{Policy: res.Policy, RuleID: res.RuleID}
+			t.Rules[key] = st
+		}
+		st.Version = res.Version
+		st.Action = res.Action
+
+		if res.Matched {
+			st.Matched++
+		}
+		if res.Error != "" {
+			st.Errors++
+		}
+		if !decided && d.Decision == DecisionRejected &&
+			(res.Error != "" || (res.Matched && res.Action == string(ActionReject))) {
+			st.Rejections++
+			decided = true
+		}
+	}
+}
+
+// Sorted returns the rule statistics, most rejections first.
+func (t *Tally) Sorted() []*RuleStats {
+	out := make([]*RuleStats, 0, len(t.Rules))
+	for _, st := range t.Rules {
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Rejections != out[j].Rejections {
+			return out[i].Rejections > out[j].Rejections
+		}
+		if out[i].Matched != out[j].Matched {
+			return out[i].Matched > out[j].Matched
+		}
+		return out[i].Policy+"/"+out[i].RuleID < out[j].Policy+"/"+out[j].RuleID
+	})
+	return out
+}
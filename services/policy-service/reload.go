@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/atlas/services/policy-service/policy"
+)
+
+// How often the policy directory is checked for edits.
+const reloadInterval = 2 * time.Second
+
+// The active and candidate sets are swapped whole on reload, so an
+// evaluation always sees one consistent version.
+var (
+	activePolicies    atomic.Pointer[policy.Set]
+	candidatePolicies atomic.Pointer[policy.Set]
+)
+
+// watchPolicies reloads a policy directory into target whenever a file is
+// added, removed or modified. A load error keeps the previous rules in force.
+func watchPolicies(label, dir string, target *atomic.Pointer[policy.Set]) {
+	last, _ := fingerprint(dir)
+	for range time.Tick(reloadInterval) {
+		fp, err := fingerprint(dir)
+		if err != nil {
+			log.Printf("[POLICY] Cannot read %s: %v", dir, err)
+			continue
+		}
+		if fp == last {
+			continue
+		}
+		last = fp
+
+		set, err := policy.Load(dir)
+		if err != nil {
+			log.Printf("[POLICY] ❌ Reload of %s policies failed, keeping %q: %v", label, target.Load().Version(), err)
+			continue
+		}
+		old := target.Swap(set)
+		log.Printf("[POLICY] ✅ Reloaded %s policies: %q → %q", label, old.Version(), set.Version())
+	}
+}
+
+// fingerprint summarizes the names, sizes and modification times of the
+// policy files.
+func fingerprint(dir string) (string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(paths)
+
+	var sb strings.Builder
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sb, "%s:%d:%d;", filepath.Base(path), info.Size(), info.ModTime().UnixNano())
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/atlas/services/common/model"
+	"github.com/atlas/services/policy-service/expr"
+	"github.com/atlas/services/policy-service/policy"
+)
+
+// shadowStats accumulates candidate outcomes since startup or since the
+// candidate set last changed.
+var shadowStats = struct {
+	sync.Mutex
+	version string
+	since   time.Time
+	tally   *policy.Tally
+	// Orders the active policies approved and the candidates would reject,
+	// and the other way round.
+	newlyRejected int
+	newlyApproved int
+}{tally: policy.NewTally()}
+
+// shadowEvaluate runs the candidate policies against an order the active
+// policies have already decided. The result is logged and counted only.
+func shadowEvaluate(cmd model.OrderCommand, candidates *policy.Set, env expr.Env, active model.RiskDecision) {
+	shadow := candidates.Evaluate(env)
+
+	switch {
+	case active.Decision == policy.DecisionApproved && shadow.Decision == policy.DecisionRejected:
+		log.Printf("[POLICY] 🔍 SHADOW would REJECT order_id=%s account=%s rule=%s: %s (candidates=%s)",
+			cmd.OrderID, cmd.ClientID, shadow.ReasonCode, shadow.Reason, shadow.PolicyVersion)
+	case active.Decision == policy.DecisionRejected && shadow.Decision == policy.DecisionApproved:
+		log.Printf("[POLICY] 🔍 SHADOW would APPROVE order_id=%s account=%s (candidates=%s)",
+			cmd.OrderID, cmd.ClientID, shadow.PolicyVersion)
+	}
+
+	shadowStats.Lock()
+	defer shadowStats.Unlock()
+	if shadowStats.version != shadow.PolicyVersion {
+		shadowStats.version = shadow.PolicyVersion
+		shadowStats.since = time.Now().UTC()
+		shadowStats.tally = policy.NewTally()
+		shadowStats.newlyRejected, shadowStats.newlyApproved = 0, 0
+	}
+	shadowStats.tally.Add(shadow)
+	if active.Decision != shadow.Decision {
+		if shadow.Decision == policy.DecisionRejected {
+			shadowStats.newlyRejected++
+		} else {
+			shadowStats.newlyApproved++
+		}
+	}
+}
+
+// handleShadowStats reports how the candidate policies would have decided the
+// orders seen so far.
+func handleShadowStats(w http.ResponseWriter, r *http.Request) {
+	shadowStats.Lock()
+	defer shadowStats.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"candidate_version": shadowStats.version,
+		"since":             shadowStats.since,
+		"orders":            shadowStats.tally.Orders,
+		"rejected":          shadowStats.tally.Rejected,
+		"newly_rejected":    shadowStats.newlyRejected,
+		"newly_approved":    shadowStats.newlyApproved,
+		"rules":             shadowStats.tally.Sorted(),
+	})
+}
+
+// handleDryRun evaluates an order against the active and candidate policies
+// without publishing or counting anything.
+func handleDryRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cmd, env, ok := readOrder(w, r)
+	if !ok {
+		return
+	}
+
+	active := activePolicies.Load().Evaluate(env)
+	active.OrderID = cmd.OrderID
+	candidate := candidatePolicies.Load().Evaluate(env)
+	candidate.OrderID = cmd.OrderID
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"active":    active,
+		"candidate": candidate,
+	})
+}
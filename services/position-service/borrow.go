@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/atlas/services/common/kafka"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	dayLayout = "2006-01-02"
+
+	// borrowCursorID is the idempotency table item holding the last day
+	// whose borrow fees were fully accrued.
+	borrowCursorID = "position-service:borrow-accrued-through"
+)
+
+// How long to wait before retrying a day whose fees were not all posted.
+var borrowRetryInterval = time.Minute
+
+// accrueBorrowFees books each day's borrow fees on short positions at the
+// end of the day, UTC. On startup it first catches up every day that ended
+// since the last one accrued, at the positions as they stand now.
+func accrueBorrowFees(producer *kafka.Producer) {
+	ctx := context.Background()
+	last, err := lastBorrowDay(ctx)
+	if err != nil {
+		log.Printf("[POSITION] ⚠️  Could not read the last borrow accrual day, accruing from yesterday: %v", err)
+	}
+	if last.IsZero() {
+		last = time.Now().UTC().Truncate(24 * time.Hour).Add(-48 * time.Hour)
+	}
+
+	for {
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+		wait := today.Add(24 * time.Hour).Sub(time.Now().UTC())
+		for day := last.Add(24 * time.Hour); day.Before(today); day = day.Add(24 * time.Hour) {
+			if !accrueBorrowDay(ctx, producer, day.Format(dayLayout)) {
+				wait = borrowRetryInterval
+				break
+			}
+			last = day
+			saveLastBorrowDay(ctx, last)
+		}
+		time.Sleep(wait)
+	}
+}
+
+// accrueBorrowDay charges a day's borrow fees to each short position and
+// its account's balance. It reports whether every fee was posted.
+func accrueBorrowDay(ctx context.Context, producer *kafka.Producer, day string) bool {
+	fees := book.BorrowFees(day)
+	posted, accrued := 0, 0
+	for _, f := range fees {
+		if !postBorrowFee(ctx, f) {
+			continue
+		}
+		posted++
+		if p := book.AccrueBorrow(f); p != nil {
+			savePosition(ctx, f.key.accountID, f.key.symbol, p)
+			accrued++
+		}
+	}
+	log.Printf("[POSITION] Borrow fees for %s accrued on %d of %d short positions", day, accrued, len(fees))
+	publish(ctx, producer, book.TakeDirty(method))
+	return posted == len(fees)
+}
+
+// postBorrowFee debits a borrow fee from the account's available USD. The
+// debit and a marker for the account, symbol and day are written in one
+// transaction, so a day is charged once however often it is retried. It
+// reports whether the fee is on the balance.
+func postBorrowFee(ctx context.Context, f borrowFee) bool {
+	marker := "borrow:" + f.key.accountID + ":" + f.key.symbol + ":" + f.day
+	_, err := dynamoClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Put: &types.Put{
+				TableName:           aws.String(awsCfg.IdempotencyTable),
+				Item:                map[string]types.AttributeValue{"request_id": &types.AttributeValueMemberS{Value: marker}},
+				ConditionExpression: aws.String("attribute_not_exists(request_id)"),
+			}},
+			{Update: &types.Update{
+				TableName: aws.String(awsCfg.BalancesTable),
+				Key: map[string]types.AttributeValue{
+					"account_id": &types.AttributeValueMemberS{Value: f.key.accountID},
+				},
+				UpdateExpression:    aws.String("SET usd_available = usd_available - :fee"),
+				ConditionExpression: aws.String("attribute_exists(account_id)"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":fee": f.fee.AttributeValue(),
+				},
+			}},
+		},
+	})
+	if err != nil {
+		var canceled *types.TransactionCanceledException
+		if errors.As(err, &canceled) && len(canceled.CancellationReasons) > 0 &&
+			aws.ToString(canceled.CancellationReasons[0].Code) == "ConditionalCheckFailed" {
+			log.Printf("[POSITION] Borrow fee %s already posted", marker)
+			return true
+		}
+		log.Printf("[DDB-WRITE-ERROR] Table=%s Key=%s Error=%v", awsCfg.BalancesTable, f.key.accountID, err)
+		return false
+	}
+	log.Printf("[DDB-WRITE-SUCCESS] Table=%s Key=%s (Borrow fee %s for %s %s)", awsCfg.BalancesTable, f.key.accountID, f.fee, f.key.symbol, f.day)
+	return true
+}
+
+// lastBorrowDay is the last day whose borrow fees were all accrued, or the
+// zero time if none were.
+func lastBorrowDay(ctx context.Context) (time.Time, error) {
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(awsCfg.IdempotencyTable),
+		Key:       map[string]types.AttributeValue{"request_id": &types.AttributeValueMemberS{Value: borrowCursorID}},
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	day, ok := result.Item["day"].(*types.AttributeValueMemberS)
+	if !ok {
+		return time.Time{}, nil
+	}
+	return time.Parse(dayLayout, day.Value)
+}
+
+func saveLastBorrowDay(ctx context.Context, day time.Time) {
+	_, err := dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(awsCfg.IdempotencyTable),
+		Item: map[string]types.AttributeValue{
+			"request_id": &types.AttributeValueMemberS{Value: borrowCursorID},
+			"day":        &types.AttributeValueMemberS{Value: day.Format(dayLayout)},
+		},
+	})
+	if err != nil {
+		log.Printf("[DDB-WRITE-ERROR] Table=%s Key=%s Error=%v", awsCfg.IdempotencyTable, borrowCursorID, err)
+		return
+	}
+	log.Printf("[DDB-WRITE-SUCCESS] Table=%s Key=%s (Borrow fees accrued through %s)", awsCfg.IdempotencyTable, borrowCursorID, day.Format(dayLayout))
+}
@@ -0,0 +1,173 @@
+// Package ledger keeps one account's position in one symbol from its fills,
+// with realized P&L under both FIFO and average cost so either can be
+// reported from the same history.
+package ledger
+
+import (
+	"fmt"
+
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/model"
+)
+
+// Method is how the cost of the open position, and so realized P&L, is
+// worked out.
+type Method string
+
+const (
+	FIFO    Method = "FIFO"     // closes against the oldest open lots first
+	AvgCost Method = "AVG_COST" // closes against the average cost of everything open
+)
+
+// ParseMethod checks a method name.
+func ParseMethod(s string) (Method, error) {
+	switch m := Method(s); m {
+	case FIFO, AvgCost:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown cost method %q", s)
+}
+
+// Fills remembered per position to drop redelivered exec reports.
+const recentFills = 100
+
+// Lot is an open quantity bought or sold at one price; negative when short.
+type Lot struct {
+	Qty decimal.Decimal `json:"qty"`
+	Px  decimal.Decimal `json:"px"`
+}
+
+// Position is the running state. All lots have the sign of Qty.
+type Position struct {
+	Qty          decimal.Decimal `json:"qty"`
+	Lots         []Lot           `json:"lots"`
+	AvgPx        decimal.Decimal `json:"avg_px"` // average cost of the open qty
+	RealizedFIFO decimal.Decimal `json:"realized_fifo"`
+	RealizedAvg  decimal.Decimal `json:"realized_avg"`
+	Fees         decimal.Decimal `json:"fees"`
+	BorrowFees   decimal.Decimal `json:"borrow_fees"` // accrued while short
+	Fills        []string        `json:"fills"`       // recent exec and accrual IDs, oldest first
+}
+
+// Seen reports whether the fill was applied already.
+func (p *Position) Seen(execID string) bool {
+	for _, id := range p.Fills {
+		if id == execID {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Position) remember(id string) {
+	if id == "" {
+		return
+	}
+	p.Fills = append(p.Fills, id)
+	if len(p.Fills) > recentFills {
+		p.Fills = p.Fills[len(p.Fills)-recentFills:]
+	}
+}
+
+// Fill applies a trade of qty at px on side, and its fee in the quote asset.
+func (p *Position) Fill(execID string, side model.OrderSide, qty, px, fee decimal.Decimal) {
+	p.remember(execID)
+	p.Fees = p.Fees.Add(fee)
+
+	signed := qty
+	if side == model.OrderSideSell {
+		signed = qty.Neg()
+	}
+	p.fillAvg(signed, px)
+	p.fillFIFO(signed, px)
+	p.Qty = p.Qty.Add(signed)
+}
+
+// Accrue books a borrow fee in the quote asset under accrual id.
+func (p *Position) Accrue(id string, fee decimal.Decimal) {
+	p.remember(id)
+	p.BorrowFees = p.BorrowFees.Add(fee)
+}
+
+// closing is how much of signed reduces an open position of qty.
+func closing(qty, signed decimal.Decimal) decimal.Decimal {
+	if qty.IsZero() || qty.Sign() == signed.Sign() {
+		return decimal.Zero
+	}
+	return decimal.Min(qty.Abs(), signed.Abs())
+}
+
+// pnl is the P&L of closing qty units opened at open and closed at px, for a
+// position long when long is positive.
+func pnl(long, qty, open, px decimal.Decimal) decimal.Decimal {
+	diff := px.Sub(open)
+	if long.IsNegative() {
+		diff = diff.Neg()
+	}
+	return qty.Mul(diff)
+}
+
+func (p *Position) fillAvg(signed, px decimal.Decimal) {
+	closed := closing(p.Qty, signed)
+	if closed.IsPositive() {
+		p.RealizedAvg = p.RealizedAvg.Add(pnl(p.Qty, closed, p.AvgPx, px))
+	}
+	after := p.Qty.Add(signed)
+	switch {
+	case after.IsZero():
+		p.AvgPx = decimal.Zero
+	case closed.IsZero():
+		// Adding to the position, or opening it.
+		p.AvgPx = p.Qty.Abs().Mul(p.AvgPx).Add(signed.Abs().Mul(px)).Div(after.Abs())
+	case after.Sign() != p.Qty.Sign():
+		p.AvgPx = px // flipped: what is left was opened by this fill
+	}
+}
+
+func (p *Position) fillFIFO(signed, px decimal.Decimal) {
+	left := signed
+	for len(p.Lots) > 0 && !left.IsZero() && p.Lots[0].Qty.Sign() != left.Sign() {
+		lot := &p.Lots[0]
+		closed := decimal.Min(lot.Qty.Abs(), left.Abs())
+		p.RealizedFIFO = p.RealizedFIFO.Add(pnl(lot.Qty, closed, lot.Px, px))
+		if lot.Qty.IsPositive() {
+			lot.Qty = lot.Qty.Sub(closed)
+			left = left.Add(closed)
+		} else {
+			lot.Qty = lot.Qty.Add(closed)
+			left = left.Sub(closed)
+		}
+		if lot.Qty.IsZero() {
+			p.Lots = p.Lots[1:]
+		}
+	}
+	if !left.IsZero() {
+		p.Lots = append(p.Lots, Lot{Qty: left, Px: px})
+	}
+}
+
+// Cost is the average cost of the open qty and the realized P&L under m.
+func (p *Position) Cost(m Method) (avgCost, realized decimal.Decimal) {
+	if m == AvgCost {
+		return p.AvgPx, p.RealizedAvg
+	}
+	var qty, notional decimal.Decimal
+	for _, lot := range p.Lots {
+		qty = qty.Add(lot.Qty)
+		notional = notional.Add(lot.Qty.Mul(lot.Px))
+	}
+	if !qty.IsZero() {
+		avgCost = notional.Div(qty)
+	}
+	return avgCost, p.RealizedFIFO
+}
+
+// Unrealized is the P&L of the open qty marked at mark under m; zero without
+// a mark.
+func (p *Position) Unrealized(m Method, mark decimal.Decimal) decimal.Decimal {
+	if !mark.IsPositive() || p.Qty.IsZero() {
+		return decimal.Zero
+	}
+	avgCost, _ := p.Cost(m)
+	return p.Qty.Mul(mark.Sub(avgCost))
+}
@@ -0,0 +1,191 @@
+package ledger
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/model"
+)
+
+func dec(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+type fill struct {
+	side    model.OrderSide
+	qty, px string
+}
+
+func buy(qty, px string) fill  { return fill{model.OrderSideBuy, qty, px} }
+func sell(qty, px string) fill { return fill{model.OrderSideSell, qty, px} }
+
+func lots(p *Position) []string {
+	out := []string{}
+	for _, l := range p.Lots {
+		out = append(out, fmt.Sprintf("%s@%s", l.Qty, l.Px))
+	}
+	return out
+}
+
+func TestFill(t *testing.T) {
+	tests := []struct {
+		name  string
+		fills []fill
+		qty   string
+		lots  []string // FIFO
+		avgPx string   // average cost
+		// Average cost of the open qty and realized P&L per method.
+		fifoCost, fifoRealized string
+		avgRealized            string
+		// Unrealized at mark, per method.
+		mark                  string
+		fifoUnreal, avgUnreal string
+	}{
+		{
+			name:  "open long",
+			fills: []fill{buy("2", "100")},
+			qty:   "2", lots: []string{"2@100"}, avgPx: "100",
+			fifoCost: "100", fifoRealized: "0", avgRealized: "0",
+			mark: "110", fifoUnreal: "20", avgUnreal: "20",
+		},
+		{
+			name:  "add to long",
+			fills: []fill{buy("2", "100"), buy("2", "110")},
+			qty:   "4", lots: []string{"2@100", "2@110"}, avgPx: "105",
+			fifoCost: "105", fifoRealized: "0", avgRealized: "0",
+			mark: "110", fifoUnreal: "20", avgUnreal: "20",
+		},
+		{
+			// FIFO closes the 100 lot and one of 110; average cost closes
+			// three at 105. What is left is costed differently.
+			name:  "partial close of long",
+			fills: []fill{buy("2", "100"), buy("2", "110"), sell("3", "120")},
+			qty:   "1", lots: []string{"1@110"}, avgPx: "105",
+			fifoCost: "110", fifoRealized: "50", avgRealized: "45",
+			mark: "130", fifoUnreal: "20", avgUnreal: "25",
+		},
+		{
+			// Once flat both methods agree on the total.
+			name:  "full close of long",
+			fills: []fill{buy("2", "100"), buy("2", "110"), sell("3", "120"), sell("1", "100")},
+			qty:   "0", lots: []string{}, avgPx: "0",
+			fifoCost: "0", fifoRealized: "40", avgRealized: "40",
+			mark: "130", fifoUnreal: "0", avgUnreal: "0",
+		},
+		{
+			name:  "flip long to short",
+			fills: []fill{buy("2", "100"), sell("5", "90")},
+			qty:   "-3", lots: []string{"-3@90"}, avgPx: "90",
+			fifoCost: "90", fifoRealized: "-20", avgRealized: "-20",
+			mark: "80", fifoUnreal: "30", avgUnreal: "30",
+		},
+		{
+			name:  "open short",
+			fills: []fill{sell("2", "100")},
+			qty:   "-2", lots: []string{"-2@100"}, avgPx: "100",
+			fifoCost: "100", fifoRealized: "0", avgRealized: "0",
+			mark: "110", fifoUnreal: "-20", avgUnreal: "-20",
+		},
+		{
+			name:  "add to short",
+			fills: []fill{sell("2", "100"), sell("2", "90")},
+			qty:   "-4", lots: []string{"-2@100", "-2@90"}, avgPx: "95",
+			fifoCost: "95", fifoRealized: "0", avgRealized: "0",
+			mark: "95", fifoUnreal: "0", avgUnreal: "0",
+		},
+		{
+			name:  "partial cover of short",
+			fills: []fill{sell("2", "100"), sell("2", "90"), buy("3", "80")},
+			qty:   "-1", lots: []string{"-1@90"}, avgPx: "95",
+			fifoCost: "90", fifoRealized: "50", avgRealized: "45",
+			mark: "85", fifoUnreal: "5", avgUnreal: "10",
+		},
+		{
+			name:  "full cover of short",
+			fills: []fill{sell("2", "100"), sell("2", "90"), buy("3", "80"), buy("1", "100")},
+			qty:   "0", lots: []string{}, avgPx: "0",
+			fifoCost: "0", fifoRealized: "40", avgRealized: "40",
+			mark: "85", fifoUnreal: "0", avgUnreal: "0",
+		},
+		{
+			name:  "flip short to long",
+			fills: []fill{sell("2", "100"), buy("5", "110")},
+			qty:   "3", lots: []string{"3@110"}, avgPx: "110",
+			fifoCost: "110", fifoRealized: "-20", avgRealized: "-20",
+			mark: "120", fifoUnreal: "30", avgUnreal: "30",
+		},
+		{
+			name:  "no mark",
+			fills: []fill{buy("1", "100")},
+			qty:   "1", lots: []string{"1@100"}, avgPx: "100",
+			fifoCost: "100", fifoRealized: "0", avgRealized: "0",
+			mark: "0", fifoUnreal: "0", avgUnreal: "0",
+		},
+	}
+	for _, tt := range tests {
+		var p Position
+		for i, f := range tt.fills {
+			p.Fill(fmt.Sprintf("E%d", i), f.side, dec(f.qty), dec(f.px), dec("0.5"))
+		}
+		fifoCost, fifoRealized := p.Cost(FIFO)
+		avgCost, avgRealized := p.Cost(AvgCost)
+		checks := []struct {
+			what      string
+			got, want decimal.Decimal
+		}{
+			{"qty", p.Qty, dec(tt.qty)},
+			{"avg px", p.AvgPx, dec(tt.avgPx)},
+			{"FIFO cost", fifoCost, dec(tt.fifoCost)},
+			{"FIFO realized", fifoRealized, dec(tt.fifoRealized)},
+			{"average cost", avgCost, dec(tt.avgPx)},
+			{"average realized", avgRealized, dec(tt.avgRealized)},
+			{"FIFO unrealized", p.Unrealized(FIFO, dec(tt.mark)), dec(tt.fifoUnreal)},
+			{"average unrealized", p.Unrealized(AvgCost, dec(tt.mark)), dec(tt.avgUnreal)},
+			{"fees", p.Fees, dec("0.5").MulInt(int64(len(tt.fills)))},
+		}
+		for _, c := range checks {
+			if !c.got.Equal(c.want) {
+				t.Errorf("%s: %s = %s, want %s", tt.name, c.what, c.got, c.want)
+			}
+		}
+		if got := lots(&p); !reflect.DeepEqual(got, tt.lots) {
+			t.Errorf("%s: lots = %q, want %q", tt.name, got, tt.lots)
+		}
+	}
+}
+
+func TestSeen(t *testing.T) {
+	var p Position
+	p.Fill("E1", model.OrderSideBuy, dec("1"), dec("100"), decimal.Zero)
+	p.Accrue("borrow:2026-01-05", dec("0.25"))
+	if !p.Seen("E1") || !p.Seen("borrow:2026-01-05") || p.Seen("E2") {
+		t.Errorf("Seen after a fill and an accrual: fills = %v", p.Fills)
+	}
+	if !p.BorrowFees.Equal(dec("0.25")) {
+		t.Errorf("BorrowFees = %s, want 0.25", p.BorrowFees)
+	}
+
+	for i := 0; i < recentFills; i++ {
+		p.Fill(fmt.Sprintf("F%d", i), model.OrderSideBuy, dec("1"), dec("100"), decimal.Zero)
+	}
+	if len(p.Fills) != recentFills || p.Seen("E1") || !p.Seen("F0") {
+		t.Errorf("kept %d fills, E1 seen %v, F0 seen %v", len(p.Fills), p.Seen("E1"), p.Seen("F0"))
+	}
+	p.Fill("", model.OrderSideBuy, dec("1"), dec("100"), decimal.Zero)
+	if p.Fills[len(p.Fills)-1] == "" {
+		t.Errorf("a fill without an ID was remembered")
+	}
+}
+
+func TestParseMethod(t *testing.T) {
+	for _, s := range []string{"FIFO", "AVG_COST"} {
+		if m, err := ParseMethod(s); err != nil || string(m) != s {
+			t.Errorf("ParseMethod(%s) = %s, %v", s, m, err)
+		}
+	}
+	if _, err := ParseMethod("LIFO"); err == nil {
+		t.Errorf("ParseMethod(LIFO) succeeded")
+	}
+}
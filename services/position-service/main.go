@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/atlas/services/common/borrow"
+	"github.com/atlas/services/common/config"
+	"github.com/atlas/services/common/db"
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/instrument"
+	"github.com/atlas/services/common/kafka"
+	"github.com/atlas/services/common/model"
+	"github.com/atlas/services/common/schema"
+	"github.com/atlas/services/position-service/ledger"
+)
+
+var (
+	kafkaBrokers    = []string{"localhost:19092"}
+	topicExecs      = "exec.reports"
+	topicMarketData = "market.data"
+	topicPositions  = "positions.updates"
+
+	// Persistence
+	dynamoClient *db.DynamoClient
+	awsCfg       *config.AWSConfig
+
+	schemas         *schema.Registry
+	instruments     *instrument.Master
+	borrowInventory *borrow.Inventory
+	book            = NewBook()
+
+	// The cost method positions are reported under unless a request asks
+	// for the other one.
+	method = costMethod()
+
+	// How often positions changed by the market are pushed.
+	publishInterval = time.Second
+)
+
+// costMethod reads ATLAS_POSITION_METHOD, default FIFO.
+func costMethod() ledger.Method {
+	if v, ok := os.LookupEnv("ATLAS_POSITION_METHOD"); ok {
+		m, err := ledger.ParseMethod(v)
+		if err == nil {
+			return m
+		}
+		log.Printf("[POSITION] %v, using %s", err, ledger.FIFO)
+	}
+	return ledger.FIFO
+}
+
+func main() {
+	ctx := context.Background()
+
+	awsCfg = config.LoadAWSConfig("position-service")
+
+	reg, err := schema.Load(schema.Dir())
+	if err != nil {
+		log.Fatalf("Failed to load schemas: %v", err)
+	}
+	schemas = reg
+
+	master, err := instrument.Load(instrument.File())
+	if err != nil {
+		log.Fatalf("Failed to load instrument master: %v", err)
+	}
+	instruments = master
+
+	inventory, err := borrow.Load(borrow.File())
+	if err != nil {
+		log.Fatalf("Failed to load borrow inventory: %v", err)
+	}
+	borrowInventory = inventory
+
+	dynamo, err := db.NewDynamoClient(ctx, awsCfg.Region, awsCfg.DynamoDBEndpoint)
+	if err != nil {
+		log.Fatalf("Failed to connect to DynamoDB: %v", err)
+	}
+	dynamoClient = dynamo
+
+	if err := loadPositions(ctx, book); err != nil {
+		log.Printf("[POSITION] ⚠️  Could not restore positions from %s, starting flat: %v", awsCfg.PositionsTable, err)
+	}
+
+	producer := kafka.NewProducer(kafkaBrokers, topicPositions)
+	defer producer.Close()
+
+	go startExecConsumer(producer)
+	go startMarketDataConsumer()
+	go publishMarks(producer)
+	go accrueBorrowFees(producer)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/positions", handlePositions)
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	})
+
+	server := &http.Server{
+		Addr:    ":8006",
+		Handler: mux,
+	}
+
+	go func() {
+		log.Printf("Starting Position Service on :8006 (%s)", method)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server error: %v", err)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Println("Shutting down...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Fatal("Server forced to shutdown:", err)
+	}
+}
+
+// handlePositions lists positions: one account's with account_id, every
+// account's without. symbol narrows to one symbol and method picks the cost
+// method.
+//
+//	GET /positions?account_id=ACC_CHILD_1&method=AVG_COST
+func handlePositions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	m := method
+	if v := r.URL.Query().Get("method"); v != "" {
+		parsed, err := ledger.ParseMethod(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		m = parsed
+	}
+
+	positions := book.Positions(r.URL.Query().Get("account_id"), r.URL.Query().Get("symbol"), m)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(positions)
+}
+
+func startExecConsumer(producer *kafka.Producer) {
+	consumer := kafka.NewConsumer(kafkaBrokers, topicExecs, "position-service-exec-group")
+	defer consumer.Close()
+
+	log.Println("[POSITION] Started consumer for exec.reports")
+
+	err := consumer.Consume(context.Background(), func(ctx context.Context, msg kafka.Message) error {
+		if errs := schemas.ValidateJSON(schema.ExecutionReport, msg.Value); len(errs) > 0 {
+			log.Printf("[POSITION] Exec report rejected by schema, skipping: %v", errs)
+			return nil
+		}
+
+		var report model.ExecutionReport
+		if err := json.Unmarshal(msg.Value, &report); err != nil {
+			log.Printf("[POSITION] Error unmarshalling exec report: %v", err)
+			return nil
+		}
+		p := book.ApplyFill(report)
+		if p == nil {
+			return nil
+		}
+		log.Printf("[POSITION] 📒 %s %s %s %s @ %s -> qty=%s", report.ClientID, report.Side, report.LastQty, report.Symbol, report.LastPx, p.Qty)
+		savePosition(ctx, report.ClientID, report.Symbol, p)
+		publish(ctx, producer, book.TakeDirty(method))
+		return nil
+	})
+
+	if err != nil {
+		log.Fatal("Exec consumer failed:", err)
+	}
+}
+
+func startMarketDataConsumer() {
+	consumer := kafka.NewConsumer(kafkaBrokers, topicMarketData, "position-service-md-group")
+	defer consumer.Close()
+
+	err := consumer.Consume(context.Background(), func(ctx context.Context, msg kafka.Message) error {
+		var update model.MarketDataUpdate
+		if err := json.Unmarshal(msg.Value, &update); err != nil {
+			log.Printf("[POSITION] Error unmarshalling market data: %v", err)
+			return nil
+		}
+
+		if update.Type == model.MarketDataTypeTrade && update.Trade != nil {
+			book.Mark(update.Symbol, decimal.FromFloat(update.Trade.Price))
+		}
+		return nil
+	})
+
+	if err != nil {
+		log.Printf("Market Data Consumer failed: %v", err)
+	}
+}
+
+// publishMarks pushes the positions the market moved, at most once per
+// interval each. Fills are pushed as they are booked.
+func publishMarks(producer *kafka.Producer) {
+	ticker := time.NewTicker(publishInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		publish(context.Background(), producer, book.TakeDirty(method))
+	}
+}
+
+func publish(ctx context.Context, producer *kafka.Producer, positions []model.Position) {
+	for _, p := range positions {
+		value, _ := json.Marshal(p)
+		if err := producer.Produce(ctx, []byte(p.AccountID), value); err != nil {
+			log.Printf("[POSITION] ❌ FAILED to publish position %s/%s: %v", p.AccountID, p.Symbol, err)
+		}
+	}
+}
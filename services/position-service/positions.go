@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/model"
+	"github.com/atlas/services/position-service/ledger"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+type positionKey struct {
+	accountID string
+	symbol    string
+}
+
+// Book holds every account's positions and the last traded price per
+// symbol they are marked at. It is safe for concurrent use.
+type Book struct {
+	mu        sync.Mutex
+	positions map[positionKey]*ledger.Position
+	updated   map[positionKey]time.Time
+	marks     map[string]decimal.Decimal
+	dirty     map[positionKey]bool // changed since the last publish
+}
+
+func NewBook() *Book {
+	return &Book{
+		positions: make(map[positionKey]*ledger.Position),
+		updated:   make(map[positionKey]time.Time),
+		marks:     make(map[string]decimal.Decimal),
+		dirty:     make(map[positionKey]bool),
+	}
+}
+
+// ApplyFill books a TRADE report's fill. It returns the position to persist,
+// or nil when the report is not a fill or was booked already.
+func (b *Book) ApplyFill(report model.ExecutionReport) *ledger.Position {
+	if report.Type != "TRADE" || !report.LastQty.IsPositive() || report.ClientID == "" {
+		return nil
+	}
+
+	// Fees paid in the base asset count at the fill price.
+	fee := report.Fee
+	if inst, ok := instruments.Get(report.Symbol); ok && report.FeeAsset != "" && report.FeeAsset == inst.BaseAsset {
+		fee = fee.Mul(report.LastPx)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := positionKey{report.ClientID, report.Symbol}
+	p, ok := b.positions[key]
+	if !ok {
+		p = &ledger.Position{}
+		b.positions[key] = p
+	}
+	if p.Seen(report.ExecID) {
+		log.Printf("[POSITION] Duplicate fill %s on %s ignored", report.ExecID, report.OrderID)
+		return nil
+	}
+	p.Fill(report.ExecID, report.Side, report.LastQty, report.LastPx, fee)
+	b.updated[key] = report.Timestamp
+	b.dirty[key] = true
+
+	copied := *p
+	copied.Lots = append([]ledger.Lot(nil), p.Lots...)
+	copied.Fills = append([]string(nil), p.Fills...)
+	return &copied
+}
+
+// Mark records a symbol's last traded price. Every open position in it has
+// changed unrealized P&L.
+func (b *Book) Mark(symbol string, px decimal.Decimal) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.marks[symbol].Equal(px) {
+		return
+	}
+	b.marks[symbol] = px
+	for key, p := range b.positions {
+		if key.symbol == symbol && !p.Qty.IsZero() {
+			b.dirty[key] = true
+		}
+	}
+}
+
+// borrowFee is a day's borrow fee due on one short position.
+type borrowFee struct {
+	key positionKey
+	day string
+	fee decimal.Decimal
+}
+
+// id is the fill ID the fee is booked under on the position.
+func (f borrowFee) id() string {
+	return "borrow:" + f.day
+}
+
+// BorrowFees works out a day's borrow fee on every short position not yet
+// charged for it, at the borrow rate of its base asset and its symbol's
+// mark, or its average cost without one.
+func (b *Book) BorrowFees(day string) []borrowFee {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []borrowFee
+	for key, p := range b.positions {
+		f := borrowFee{key: key, day: day}
+		if !p.Qty.IsNegative() || p.Seen(f.id()) {
+			continue
+		}
+		inst, ok := instruments.Get(key.symbol)
+		if !ok {
+			continue
+		}
+		terms, ok := borrowInventory.Get(inst.BaseAsset)
+		if !ok {
+			log.Printf("[POSITION] ⚠️  %s is short %s %s, which has no borrow terms", key.accountID, p.Qty, inst.BaseAsset)
+			continue
+		}
+		px := b.marks[key.symbol]
+		if !px.IsPositive() {
+			px = p.AvgPx
+		}
+		f.fee = terms.DailyFee(p.Qty, px)
+		log.Printf("[POSITION] 💸 Borrow fee %s for %s on %s short %s %s @ %s (%s bps)", f.fee, day, key.accountID, p.Qty.Abs(), key.symbol, px, terms.RateBps)
+		out = append(out, f)
+	}
+	return out
+}
+
+// AccrueBorrow books a borrow fee on its position, once. It returns the
+// position to persist, or nil if the fee was already booked.
+func (b *Book) AccrueBorrow(f borrowFee) *ledger.Position {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p, ok := b.positions[f.key]
+	if !ok || p.Seen(f.id()) {
+		return nil
+	}
+	p.Accrue(f.id(), f.fee)
+	b.updated[f.key] = time.Now().UTC()
+	b.dirty[f.key] = true
+
+	copied := *p
+	copied.Lots = append([]ledger.Lot(nil), p.Lots...)
+	copied.Fills = append([]string(nil), p.Fills...)
+	return &copied
+}
+
+// view is the position at key under m. Callers hold b.mu.
+func (b *Book) view(key positionKey, m ledger.Method) model.Position {
+	p := b.positions[key]
+	mark := b.marks[key.symbol]
+	avgCost, realized := p.Cost(m)
+	unrealized := p.Unrealized(m, mark)
+	return model.Position{
+		AccountID:     key.accountID,
+		Symbol:        key.symbol,
+		Method:        string(m),
+		Qty:           p.Qty,
+		AvgCost:       avgCost,
+		MarkPx:        mark,
+		RealizedPnL:   realized,
+		UnrealizedPnL: unrealized,
+		Fees:          p.Fees,
+		BorrowFees:    p.BorrowFees,
+		NetPnL:        realized.Add(unrealized).Sub(p.Fees).Sub(p.BorrowFees),
+		UpdatedAt:     b.updated[key],
+	}
+}
+
+// Positions returns the positions of one account, or of every account when
+// accountID is empty, optionally for one symbol.
+func (b *Book) Positions(accountID, symbol string, m ledger.Method) []model.Position {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := []model.Position{}
+	for key := range b.positions {
+		if (accountID != "" && key.accountID != accountID) || (symbol != "" && key.symbol != symbol) {
+			continue
+		}
+		out = append(out, b.view(key, m))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].AccountID != out[j].AccountID {
+			return out[i].AccountID < out[j].AccountID
+		}
+		return out[i].Symbol < out[j].Symbol
+	})
+	return out
+}
+
+// TakeDirty returns the positions changed since the last call.
+func (b *Book) TakeDirty(m ledger.Method) []model.Position {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []model.Position
+	for key := range b.dirty {
+		out = append(out, b.view(key, m))
+	}
+	b.dirty = make(map[positionKey]bool)
+	return out
+}
+
+// positionItem is an atlas_positions item.
+type positionItem struct {
+	AccountID string `dynamodbav:"account_id"`
+	Symbol    string `dynamodbav:"symbol"`
+	State     string `dynamodbav:"state"` // ledger.Position as JSON
+	UpdatedAt int64  `dynamodbav:"updated_at"`
+}
+
+func savePosition(ctx context.Context, accountID, symbol string, p *ledger.Position) {
+	state, _ := json.Marshal(p)
+	item, _ := attributevalue.MarshalMap(positionItem{
+		AccountID: accountID,
+		Symbol:    symbol,
+		State:     string(state),
+		UpdatedAt: time.Now().Unix(),
+	})
+	_, err := dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(awsCfg.PositionsTable),
+		Item:      item,
+	})
+	if err != nil {
+		log.Printf("[DDB-WRITE-ERROR] Table=%s Key=%s/%s Error=%v", awsCfg.PositionsTable, accountID, symbol, err)
+		return
+	}
+	log.Printf("[DDB-WRITE-SUCCESS] Table=%s Key=%s/%s (Position qty=%s)", awsCfg.PositionsTable, accountID, symbol, p.Qty)
+}
+
+// loadPositions restores the book from the positions table.
+func loadPositions(ctx context.Context, b *Book) error {
+	input := &dynamodb.ScanInput{TableName: aws.String(awsCfg.PositionsTable)}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for {
+		result, err := dynamoClient.Scan(ctx, input)
+		if err != nil {
+			return err
+		}
+		for _, raw := range result.Items {
+			var item positionItem
+			if err := attributevalue.UnmarshalMap(raw, &item); err != nil {
+				return err
+			}
+			var p ledger.Position
+			if err := json.Unmarshal([]byte(item.State), &p); err != nil {
+				log.Printf("[POSITION] ⚠️  Skipping unreadable position %s/%s: %v", item.AccountID, item.Symbol, err)
+				continue
+			}
+			key := positionKey{item.AccountID, item.Symbol}
+			b.positions[key] = &p
+			b.updated[key] = time.Unix(item.UpdatedAt, 0).UTC()
+		}
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+	log.Printf("[POSITION] Restored %d positions from %s", len(b.positions), awsCfg.PositionsTable)
+	return nil
+}
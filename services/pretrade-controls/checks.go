@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/instrument"
+	"github.com/atlas/services/common/model"
+	"github.com/google/uuid"
+)
+
+const (
+	DecisionApproved = "APPROVED"
+	DecisionRejected = "REJECTED"
+)
+
+// Reason codes set on rejected decisions.
+const (
+	ReasonUnknownSymbol    = "UNKNOWN_SYMBOL"
+	ReasonMaxOrderQty      = "MAX_ORDER_QTY"
+	ReasonMaxOrderNotional = "MAX_ORDER_NOTIONAL"
+	ReasonPriceBand        = "PRICE_BAND"
+	ReasonMaxOpenOrders    = "MAX_OPEN_ORDERS"
+	ReasonMaxGrossPosition = "MAX_GROSS_POSITION"
+	ReasonMaxNetPosition   = "MAX_NET_POSITION"
+	ReasonMaxDailyNotional = "MAX_DAILY_NOTIONAL"
+)
+
+var hundred = decimal.FromInt(100)
+
+// rejection is the first failed check.
+type rejection struct {
+	code   string
+	reason string
+}
+
+func reject(code, format string, args ...interface{}) *rejection {
+	return &rejection{code: code, reason: fmt.Sprintf(format, args...)}
+}
+
+// Check runs every pre-trade check for a NEW order. An approved order is
+// counted as open straight away, so two orders racing each other cannot both
+// use the last of a limit.
+func (s *State) Check(cmd model.OrderCommand, inst instrument.Instrument, found bool, lim Limits) model.RiskDecision {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	s.housekeepLocked(now)
+
+	decision := model.RiskDecision{
+		DecisionID: uuid.New().String(),
+		OrderID:    cmd.OrderID,
+		Decision:   DecisionApproved,
+		Timestamp:  now,
+	}
+
+	var rej *rejection
+	var notional decimal.Decimal
+	if !found {
+		rej = reject(ReasonUnknownSymbol, "unknown instrument %q", cmd.Symbol)
+	} else {
+		notional, rej = s.evaluateLocked(cmd, inst, lim)
+	}
+
+	if rej != nil {
+		decision.Decision = DecisionRejected
+		decision.ReasonCode = rej.code
+		decision.Reason = rej.reason
+		return decision
+	}
+
+	s.orders[cmd.OrderID] = &openOrder{
+		AccountID: cmd.ClientID,
+		Symbol:    cmd.Symbol,
+		Side:      cmd.Side,
+		Leaves:    cmd.QuantityVal,
+		Notional:  notional,
+		Day:       s.day,
+		expires:   now.Add(pendingTTL),
+	}
+	s.daily[cmd.ClientID] = s.daily[cmd.ClientID].Add(notional)
+	return decision
+}
+
+// evaluateLocked returns the order's notional and the first limit it breaks.
+func (s *State) evaluateLocked(cmd model.OrderCommand, inst instrument.Instrument, lim Limits) (decimal.Decimal, *rejection) {
+	qty := cmd.QuantityVal
+
+	ref, ok := s.lastTrade[cmd.Symbol]
+	if !ok {
+		ref = inst.ReferencePrice
+	}
+
+	// Orders without a limit price are valued at the last trade.
+	px := cmd.Price
+	if !px.IsPositive() {
+		px = ref
+	}
+	notional, err := inst.Notional(qty, px)
+	if err != nil {
+		return notional, reject(ReasonMaxOrderNotional, "notional of %s at %s is out of range", qty, px)
+	}
+
+	if enabled(lim.MaxOrderQty) && qty.GreaterThan(*lim.MaxOrderQty) {
+		return notional, reject(ReasonMaxOrderQty, "quantity %s exceeds max order qty %s", qty, *lim.MaxOrderQty)
+	}
+	if enabled(lim.MaxOrderNotional) && notional.GreaterThan(*lim.MaxOrderNotional) {
+		return notional, reject(ReasonMaxOrderNotional, "notional %s exceeds max order notional %s", notional, *lim.MaxOrderNotional)
+	}
+	if enabled(lim.PriceBandPct) && cmd.Price.IsPositive() && ref.IsPositive() {
+		deviation := cmd.Price.Sub(ref).Abs().Mul(hundred).Div(ref)
+		if deviation.GreaterThan(*lim.PriceBandPct) {
+			return notional, reject(ReasonPriceBand, "price %s is %s%% away from last trade %s (band %s%%)",
+				cmd.Price, deviation.Round(2), ref, *lim.PriceBandPct)
+		}
+	}
+
+	e := s.exposureLocked(cmd.ClientID, cmd.Symbol)
+
+	if lim.MaxOpenOrders != nil && *lim.MaxOpenOrders > 0 && e.openOrders >= *lim.MaxOpenOrders {
+		return notional, reject(ReasonMaxOpenOrders, "account has %d open orders (max %d)", e.openOrders, *lim.MaxOpenOrders)
+	}
+
+	if enabled(lim.MaxGrossPosition) {
+		gross := e.position.Abs().Add(e.openBuy).Add(e.openSell).Add(qty)
+		if gross.GreaterThan(*lim.MaxGrossPosition) {
+			return notional, reject(ReasonMaxGrossPosition, "gross position %s would exceed %s", gross, *lim.MaxGrossPosition)
+		}
+	}
+	if enabled(lim.MaxNetPosition) {
+		// Worst case on the order's side: every open order on that side fills.
+		net := e.position.Add(e.openBuy).Add(qty)
+		if cmd.Side == model.OrderSideSell {
+			net = e.position.Sub(e.openSell).Sub(qty)
+		}
+		if net.Abs().GreaterThan(*lim.MaxNetPosition) {
+			return notional, reject(ReasonMaxNetPosition, "net position %s would exceed %s", net, *lim.MaxNetPosition)
+		}
+	}
+
+	if enabled(lim.MaxDailyNotional) {
+		if total := e.daily.Add(notional); total.GreaterThan(*lim.MaxDailyNotional) {
+			return notional, reject(ReasonMaxDailyNotional, "daily notional %s would exceed %s", total, *lim.MaxDailyNotional)
+		}
+	}
+	return notional, nil
+}
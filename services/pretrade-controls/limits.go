@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/atlas/services/common/config"
+	"github.com/atlas/services/common/decimal"
+)
+
+// Limits is one layer of pre-trade limits. A nil field inherits the value of
+// the layer below it; a field that is still nil (or zero) after resolving
+// turns the check off.
+//
+// Quantities and positions are in the instrument's base asset, notionals in
+// its quote asset, so position limits only make sense at symbol level.
+type Limits struct {
+	MaxOrderQty      *decimal.Decimal `json:"max_order_qty,omitempty"`
+	MaxOrderNotional *decimal.Decimal `json:"max_order_notional,omitempty"`
+	PriceBandPct     *decimal.Decimal `json:"price_band_pct,omitempty"` // max % away from the last trade
+	MaxOpenOrders    *int             `json:"max_open_orders,omitempty"`
+	MaxGrossPosition *decimal.Decimal `json:"max_gross_position,omitempty"` // |position| + all open qty
+	MaxNetPosition   *decimal.Decimal `json:"max_net_position,omitempty"`   // |position| if every open order on the order's side fills
+	MaxDailyNotional *decimal.Decimal `json:"max_daily_notional,omitempty"` // per account, across symbols, reset at 00:00 UTC
+}
+
+// AccountLimits overrides the global limits for one account, optionally per
+// symbol.
+type AccountLimits struct {
+	Limits  Limits            `json:"limits"`
+	Symbols map[string]Limits `json:"symbols,omitempty"`
+}
+
+// LimitsConfig is the layout of config/pretrade_limits.json. Limits resolve
+// in the order default < symbols[symbol] < accounts[account].limits <
+// accounts[account].symbols[symbol].
+type LimitsConfig struct {
+	Default  Limits                   `json:"default"`
+	Symbols  map[string]Limits        `json:"symbols,omitempty"`
+	Accounts map[string]AccountLimits `json:"accounts,omitempty"`
+}
+
+// limitsFile returns the limits config path, ATLAS_PRETRADE_LIMITS_FILE if
+// set.
+func limitsFile() string {
+	return config.RepoPath("ATLAS_PRETRADE_LIMITS_FILE", "config/pretrade_limits.json")
+}
+
+func loadLimits(path string) (*LimitsConfig, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg LimitsConfig
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// Resolve returns the effective limits for an order by account and symbol.
+func (c *LimitsConfig) Resolve(accountID, symbol string) Limits {
+	lim := c.Default
+	lim.merge(c.Symbols[symbol])
+	if acc, ok := c.Accounts[accountID]; ok {
+		lim.merge(acc.Limits)
+		lim.merge(acc.Symbols[symbol])
+	}
+	return lim
+}
+
+// merge overlays every field set in o.
+func (l *Limits) merge(o Limits) {
+	if o.MaxOrderQty != nil {
+		l.MaxOrderQty = o.MaxOrderQty
+	}
+	if o.MaxOrderNotional != nil {
+		l.MaxOrderNotional = o.MaxOrderNotional
+	}
+	if o.PriceBandPct != nil {
+		l.PriceBandPct = o.PriceBandPct
+	}
+	if o.MaxOpenOrders != nil {
+		l.MaxOpenOrders = o.MaxOpenOrders
+	}
+	if o.MaxGrossPosition != nil {
+		l.MaxGrossPosition = o.MaxGrossPosition
+	}
+	if o.MaxNetPosition != nil {
+		l.MaxNetPosition = o.MaxNetPosition
+	}
+	if o.MaxDailyNotional != nil {
+		l.MaxDailyNotional = o.MaxDailyNotional
+	}
+}
+
+// enabled reports whether a decimal limit is set to something positive.
+func enabled(limit *decimal.Decimal) bool {
+	return limit != nil && limit.IsPositive()
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/atlas/services/common/config"
+	"github.com/atlas/services/common/db"
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/instrument"
+	"github.com/atlas/services/common/kafka"
+	"github.com/atlas/services/common/model"
+	"github.com/atlas/services/common/schema"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+var (
+	kafkaBrokers    = []string{"localhost:19092"}
+	topicExecs      = "exec.reports"
+	topicMarketData = "market.data"
+
+	// Persistence
+	dynamoClient *db.DynamoClient
+	awsCfg       *config.AWSConfig
+
+	schemas     *schema.Registry
+	instruments *instrument.Master
+	limits      *LimitsConfig
+	state       = NewState()
+)
+
+func main() {
+	ctx := context.Background()
+
+	awsCfg = config.LoadAWSConfig("pretrade-controls")
+
+	reg, err := schema.Load(schema.Dir())
+	if err != nil {
+		log.Fatalf("Failed to load schemas: %v", err)
+	}
+	schemas = reg
+
+	master, err := instrument.Load(instrument.File())
+	if err != nil {
+		log.Fatalf("Failed to load instrument master: %v", err)
+	}
+	instruments = master
+
+	cfg, err := loadLimits(limitsFile())
+	if err != nil {
+		log.Fatalf("Failed to load pre-trade limits: %v", err)
+	}
+	limits = cfg
+
+	dynamo, err := db.NewDynamoClient(ctx, awsCfg.Region, awsCfg.DynamoDBEndpoint)
+	if err != nil {
+		log.Fatalf("Failed to connect to DynamoDB: %v", err)
+	}
+	dynamoClient = dynamo
+
+	if err := loadState(ctx); err != nil {
+		log.Printf("[PRETRADE] ⚠️  Could not rebuild state from %s, starting empty: %v", awsCfg.OrdersTable, err)
+	}
+
+	go startExecConsumer()
+	go startMarketDataConsumer()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/check", handleCheck)
+	mux.HandleFunc("/limits", handleLimits)
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	})
+
+	server := &http.Server{
+		Addr:    ":8003",
+		Handler: mux,
+	}
+
+	go func() {
+		log.Println("Starting Pre-Trade Controls on :8003")
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server error: %v", err)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Println("Shutting down...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Fatal("Server forced to shutdown:", err)
+	}
+}
+
+// handleCheck runs the pre-trade checks for a NEW order command and answers
+// with a RiskDecision. Rejections are still 200: the decision is the result.
+func handleCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	if errs := schemas.ValidateJSON(schema.OrderCommand, body); len(errs) > 0 {
+		http.Error(w, errs.Error(), http.StatusBadRequest)
+		return
+	}
+	var cmd model.OrderCommand
+	if err := json.Unmarshal(body, &cmd); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if cmd.Type != model.CommandTypeNew {
+		http.Error(w, "Only NEW commands are checked", http.StatusBadRequest)
+		return
+	}
+
+	inst, found := instruments.Get(cmd.Symbol)
+	decision := state.Check(cmd, inst, found, limits.Resolve(cmd.ClientID, cmd.Symbol))
+
+	if decision.Decision == DecisionApproved {
+		log.Printf("[PRETRADE] ✅ APPROVED order_id=%s account=%s %s %s %s @ %s",
+			cmd.OrderID, cmd.ClientID, cmd.Side, cmd.QuantityVal, cmd.Symbol, cmd.Price)
+	} else {
+		log.Printf("[PRETRADE] ❌ REJECTED order_id=%s account=%s reason=%s: %s",
+			cmd.OrderID, cmd.ClientID, decision.ReasonCode, decision.Reason)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(decision)
+}
+
+// handleLimits shows the limits that apply to an account and symbol.
+func handleLimits(w http.ResponseWriter, r *http.Request) {
+	accountID := r.URL.Query().Get("account_id")
+	if accountID == "" {
+		accountID = "ACC_CHILD_1" // Default for demo
+	}
+	symbol := r.URL.Query().Get("symbol")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(limits.Resolve(accountID, symbol))
+}
+
+func startExecConsumer() {
+	consumer := kafka.NewConsumer(kafkaBrokers, topicExecs, "pretrade-controls-exec-group")
+	defer consumer.Close()
+
+	log.Println("[PRETRADE] Started consumer for exec.reports")
+
+	err := consumer.Consume(context.Background(), func(ctx context.Context, msg kafka.Message) error {
+		if errs := schemas.ValidateJSON(schema.ExecutionReport, msg.Value); len(errs) > 0 {
+			log.Printf("[PRETRADE] Exec report rejected by schema, skipping: %v", errs)
+			return nil
+		}
+
+		var report model.ExecutionReport
+		if err := json.Unmarshal(msg.Value, &report); err != nil {
+			log.Printf("[PRETRADE] Error unmarshalling exec report: %v", err)
+			return nil
+		}
+		state.ApplyReport(report)
+		return nil
+	})
+
+	if err != nil {
+		log.Fatal("Exec consumer failed:", err)
+	}
+}
+
+func startMarketDataConsumer() {
+	consumer := kafka.NewConsumer(kafkaBrokers, topicMarketData, "pretrade-controls-md-group")
+	defer consumer.Close()
+
+	err := consumer.Consume(context.Background(), func(ctx context.Context, msg kafka.Message) error {
+		var update model.MarketDataUpdate
+		if err := json.Unmarshal(msg.Value, &update); err != nil {
+			log.Printf("[PRETRADE] Error unmarshalling market data: %v", err)
+			return nil
+		}
+
+		if update.Type == model.MarketDataTypeTrade && update.Trade != nil {
+			state.OnTrade(update.Symbol, decimal.FromFloat(update.Trade.Price))
+		}
+		return nil
+	})
+
+	if err != nil {
+		log.Printf("Market Data Consumer failed: %v", err)
+	}
+}
+
+// loadState rebuilds open orders, positions and today's notional from the
+// orders table, so a restart does not reset every limit to zero. Reports the
+// exec consumer replays from before the rebuild are then skipped by cum_qty.
+func loadState(ctx context.Context) error {
+	input := &dynamodb.ScanInput{TableName: aws.String(awsCfg.OrdersTable)}
+	today := tradingDay(time.Now())
+	loaded := 0
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	for {
+		result, err := dynamoClient.Scan(ctx, input)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range result.Items {
+			var o struct {
+				OrderID   string          `dynamodbav:"order_id"`
+				AccountID string          `dynamodbav:"account_id"`
+				Symbol    string          `dynamodbav:"symbol"`
+				Side      string          `dynamodbav:"side"`
+				Price     decimal.Decimal `dynamodbav:"price"`
+				OrderQty  decimal.Decimal `dynamodbav:"order_qty"`
+				CumQty    decimal.Decimal `dynamodbav:"cum_qty"`
+				Status    string          `dynamodbav:"status"`
+				CreatedAt int64           `dynamodbav:"created_at"`
+			}
+			if err := attributevalue.UnmarshalMap(item, &o); err != nil {
+				return err
+			}
+			loaded++
+
+			key := positionKey{o.AccountID, o.Symbol}
+			if model.OrderSide(o.Side) == model.OrderSideBuy {
+				state.positions[key] = state.positions[key].Add(o.CumQty)
+			} else {
+				state.positions[key] = state.positions[key].Sub(o.CumQty)
+			}
+
+			status := model.OrderStatus(o.Status)
+			done := status == model.OrderStatusFilled || status == model.OrderStatusCanceled || status == model.OrderStatusRejected
+			state.snapshot[o.OrderID] = snapshotOrder{cum: o.CumQty, done: done}
+			if status == model.OrderStatusRejected {
+				continue
+			}
+			notional := o.OrderQty.Mul(o.Price)
+			day := tradingDay(time.Unix(o.CreatedAt, 0))
+			if day == today {
+				state.daily[o.AccountID] = state.daily[o.AccountID].Add(notional)
+			}
+			if !done {
+				state.orders[o.OrderID] = &openOrder{
+					AccountID: o.AccountID,
+					Symbol:    o.Symbol,
+					Side:      model.OrderSide(o.Side),
+					Leaves:    o.OrderQty.Sub(o.CumQty),
+					Notional:  notional,
+					Day:       day,
+					confirmed: true,
+				}
+			}
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	log.Printf("[PRETRADE] Rebuilt state from %d orders (%d open)", loaded, len(state.orders))
+	return nil
+}
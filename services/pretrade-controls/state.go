@@ -0,0 +1,184 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/model"
+)
+
+// An approved order that never shows up on exec.reports (for example because
+// the gateway then failed to reserve funds) stops counting after this long.
+const pendingTTL = 30 * time.Second
+
+// openOrder is an order counted towards open-order, position and daily limits.
+type openOrder struct {
+	AccountID string
+	Symbol    string
+	Side      model.OrderSide
+	Leaves    decimal.Decimal
+	Notional  decimal.Decimal // amount added to the account's daily notional
+	Day       string          // trading day Notional was counted in
+
+	confirmed bool      // seen on exec.reports
+	expires   time.Time // for unconfirmed orders
+}
+
+// snapshotOrder is what the orders table said of an order on startup.
+type snapshotOrder struct {
+	cum  decimal.Decimal // fills already counted in positions
+	done bool            // filled, canceled or rejected
+}
+
+type positionKey struct {
+	accountID string
+	symbol    string
+}
+
+// State is the exposure picture the checks run against. It is rebuilt from
+// the orders table on startup and kept current from exec.reports and
+// market.data.
+type State struct {
+	mu        sync.Mutex
+	lastTrade map[string]decimal.Decimal
+	orders    map[string]*openOrder
+	positions map[positionKey]decimal.Decimal
+	daily     map[string]decimal.Decimal
+	day       string
+
+	// Orders as rebuilt from the orders table. exec.reports is consumed
+	// from the committed offset, so it may replay what the table has.
+	snapshot map[string]snapshotOrder
+}
+
+func NewState() *State {
+	return &State{
+		lastTrade: make(map[string]decimal.Decimal),
+		orders:    make(map[string]*openOrder),
+		positions: make(map[positionKey]decimal.Decimal),
+		daily:     make(map[string]decimal.Decimal),
+		day:       tradingDay(time.Now()),
+		snapshot:  make(map[string]snapshotOrder),
+	}
+}
+
+func tradingDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// OnTrade records the last traded price for the price band check.
+func (s *State) OnTrade(symbol string, px decimal.Decimal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastTrade[symbol] = px
+}
+
+// ApplyReport updates open orders and positions from an execution report.
+// What the orders table already had on startup is not counted again.
+func (s *State) ApplyReport(r model.ExecutionReport) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fill := r.LastQty
+	if snap, ok := s.snapshot[r.OrderID]; ok {
+		if snap.done || r.CumQty.LessThan(snap.cum) {
+			return
+		}
+		// Caught up: this report's fills past the snapshot, and every later
+		// report, are new.
+		fill = decimal.Min(fill, r.CumQty.Sub(snap.cum))
+		delete(s.snapshot, r.OrderID)
+	}
+
+	o, known := s.orders[r.OrderID]
+	if !known && r.ClientID != "" && r.Symbol != "" {
+		// Placed before this process started, or approved by another instance.
+		o = &openOrder{AccountID: r.ClientID, Symbol: r.Symbol, Side: r.Side, Leaves: r.LeavesQty}
+	}
+	if o == nil {
+		return
+	}
+
+	if fill.IsPositive() {
+		key := positionKey{o.AccountID, o.Symbol}
+		if o.Side == model.OrderSideBuy {
+			s.positions[key] = s.positions[key].Add(fill)
+		} else {
+			s.positions[key] = s.positions[key].Sub(fill)
+		}
+	}
+
+	switch r.Status {
+	case model.OrderStatusFilled, model.OrderStatusCanceled:
+		delete(s.orders, r.OrderID)
+	case model.OrderStatusRejected:
+		// A rejected order never reached the market, so it gives back its
+		// share of the daily notional.
+		if known {
+			s.releaseDailyLocked(o)
+		}
+		delete(s.orders, r.OrderID)
+	default:
+		o.confirmed = true
+		if r.LeavesQty.IsPositive() {
+			o.Leaves = r.LeavesQty
+		}
+		s.orders[r.OrderID] = o
+	}
+}
+
+// exposure is an account's open orders and position in one symbol.
+type exposure struct {
+	openOrders int // across all symbols
+	openBuy    decimal.Decimal
+	openSell   decimal.Decimal
+	position   decimal.Decimal
+	daily      decimal.Decimal
+}
+
+// exposureLocked sums the account's open orders. s.mu must be held.
+func (s *State) exposureLocked(accountID, symbol string) exposure {
+	e := exposure{
+		position: s.positions[positionKey{accountID, symbol}],
+		daily:    s.daily[accountID],
+	}
+	for _, o := range s.orders {
+		if o.AccountID != accountID {
+			continue
+		}
+		e.openOrders++
+		if o.Symbol != symbol {
+			continue
+		}
+		if o.Side == model.OrderSideBuy {
+			e.openBuy = e.openBuy.Add(o.Leaves)
+		} else {
+			e.openSell = e.openSell.Add(o.Leaves)
+		}
+	}
+	return e
+}
+
+// housekeepLocked resets daily totals at the UTC day boundary and drops
+// approvals that were never confirmed. s.mu must be held.
+func (s *State) housekeepLocked(now time.Time) {
+	if day := tradingDay(now); day != s.day {
+		s.day = day
+		s.daily = make(map[string]decimal.Decimal)
+	}
+	for id, o := range s.orders {
+		if !o.confirmed && now.After(o.expires) {
+			s.releaseDailyLocked(o)
+			delete(s.orders, id)
+		}
+	}
+}
+
+// releaseDailyLocked takes an order's notional back out of the daily total,
+// unless it was counted on a day that has since rolled over.
+func (s *State) releaseDailyLocked(o *openOrder) {
+	if o.Day == s.day {
+		s.daily[o.AccountID] = s.daily[o.AccountID].Sub(o.Notional)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/model"
+)
+
+func fillReport(orderID string, status model.OrderStatus, last, cum, leaves string) model.ExecutionReport {
+	return model.ExecutionReport{
+		OrderID:   orderID,
+		ClientID:  "A1",
+		Symbol:    "BTC-USD",
+		Side:      model.OrderSideBuy,
+		Type:      "TRADE",
+		Status:    status,
+		LastQty:   decimal.RequireFromString(last),
+		CumQty:    decimal.RequireFromString(cum),
+		LeavesQty: decimal.RequireFromString(leaves),
+	}
+}
+
+// TestApplyReportAfterSnapshot replays exec reports over state rebuilt from
+// the orders table, as the consumer does after a restart.
+func TestApplyReportAfterSnapshot(t *testing.T) {
+	s := NewState()
+	key := positionKey{"A1", "BTC-USD"}
+	// O1 was filled 2 of 5, O2 filled 3 of 3, when the table was read.
+	s.positions[key] = decimal.FromInt(5)
+	s.orders["O1"] = &openOrder{AccountID: "A1", Symbol: "BTC-USD", Side: model.OrderSideBuy, Leaves: decimal.FromInt(3), confirmed: true}
+	s.snapshot["O1"] = snapshotOrder{cum: decimal.FromInt(2)}
+	s.snapshot["O2"] = snapshotOrder{cum: decimal.FromInt(3), done: true}
+
+	tests := []struct {
+		name     string
+		report   model.ExecutionReport
+		position string
+		open     bool // whether O1 is open after
+	}{
+		{"replayed fill of a finished order", fillReport("O2", model.OrderStatusPartiallyFilled, "1", "1", "2"), "5", true},
+		{"replayed fill in the snapshot", fillReport("O1", model.OrderStatusPartiallyFilled, "1", "1", "4"), "5", true},
+		{"fill straddling the snapshot", fillReport("O1", model.OrderStatusPartiallyFilled, "2", "3", "2"), "6", true},
+		{"new fill", fillReport("O1", model.OrderStatusPartiallyFilled, "1", "4", "1"), "7", true},
+		{"last fill", fillReport("O1", model.OrderStatusFilled, "1", "5", "0"), "8", false},
+	}
+	for _, tt := range tests {
+		s.ApplyReport(tt.report)
+		if got := s.positions[key]; !got.Equal(decimal.RequireFromString(tt.position)) {
+			t.Errorf("%s: position = %s, want %s", tt.name, got, tt.position)
+		}
+		if _, open := s.orders["O1"]; open != tt.open {
+			t.Errorf("%s: O1 open = %v, want %v", tt.name, open, tt.open)
+		}
+		if _, open := s.orders["O2"]; open {
+			t.Errorf("%s: O2 was reopened", tt.name)
+		}
+	}
+}
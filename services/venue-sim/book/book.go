@@ -0,0 +1,346 @@
+// Package book is the venue's limit order book: resting participant orders
+// per symbol in price-time priority, matched against incoming orders with
+// self-trade prevention. Iceberg orders show only their display quantity and
+// go to the back of their price level each time it is replenished.
+package book
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/model"
+)
+
+// Reason codes on exec reports for orders canceled or reduced by self-trade
+// prevention.
+const (
+	ReasonSTPCancelNewest = "STP_CANCEL_NEWEST"
+	ReasonSTPCancelOldest = "STP_CANCEL_OLDEST"
+	ReasonSTPCancelBoth   = "STP_CANCEL_BOTH"
+	ReasonSTPDecrement    = "STP_DECREMENT"
+)
+
+// Order is an order at the venue and how much of it is left.
+type Order struct {
+	Cmd    model.OrderCommand
+	Leaves decimal.Decimal
+	Cum    decimal.Decimal
+	// Px is the price the order works at: its limit, unless the venue
+	// repriced it.
+	Px decimal.Decimal
+	// Display is the iceberg display quantity, zero for a fully shown order.
+	Display decimal.Decimal
+	// Fees is what the order has been charged so far, in the quote asset.
+	Fees decimal.Decimal
+
+	shown    decimal.Decimal // displayed part of Leaves, icebergs only
+	notional decimal.Decimal // sum of fill qty * px, for the average price
+	seq      uint64
+}
+
+func NewOrder(cmd model.OrderCommand) *Order {
+	return &Order{Cmd: cmd, Leaves: cmd.QuantityVal, Px: cmd.Price, Display: cmd.DisplayQty}
+}
+
+func (o *Order) iceberg() bool { return o.Display.IsPositive() }
+
+// Visible is the quantity shown in the book and available to trade against.
+func (o *Order) Visible() decimal.Decimal {
+	if o.iceberg() {
+		return o.shown
+	}
+	return o.Leaves
+}
+
+// Fill records an execution of qty at px.
+func (o *Order) Fill(qty, px decimal.Decimal) {
+	o.Leaves = o.Leaves.Sub(qty)
+	o.Cum = o.Cum.Add(qty)
+	o.notional = o.notional.Add(qty.Mul(px))
+}
+
+func (o *Order) AvgPx() decimal.Decimal {
+	if o.Cum.IsZero() {
+		return decimal.Zero
+	}
+	return o.notional.Div(o.Cum)
+}
+
+// Status is the order's status while it is still working.
+func (o *Order) Status() model.OrderStatus {
+	switch {
+	case o.Leaves.IsZero():
+		return model.OrderStatusFilled
+	case o.Cum.IsPositive():
+		return model.OrderStatusPartiallyFilled
+	}
+	return model.OrderStatusLive
+}
+
+type EventKind int
+
+const (
+	// EventFill: Order traded Qty at Px.
+	EventFill EventKind = iota
+	// EventCancel: Order was canceled with Qty still open.
+	EventCancel
+	// EventDecrement: Order's open quantity was reduced by Qty without
+	// trading; it keeps working with the rest.
+	EventDecrement
+)
+
+// Event is one outcome of matching, to be reported by the caller.
+type Event struct {
+	Kind      EventKind
+	Order     *Order
+	Qty       decimal.Decimal
+	Px        decimal.Decimal
+	Liquidity model.Liquidity // fills only: ADDED for the resting order
+	Reason    string
+}
+
+// Book holds resting orders. It is safe for concurrent use.
+type Book struct {
+	mu     sync.Mutex
+	seq    uint64
+	orders map[string]*Order
+	bids   map[string][]*Order // by symbol, best first
+	asks   map[string][]*Order
+}
+
+func New() *Book {
+	return &Book{
+		orders: make(map[string]*Order),
+		bids:   make(map[string][]*Order),
+		asks:   make(map[string][]*Order),
+	}
+}
+
+// Match executes an incoming order against the resting orders on the other
+// side, best price first and oldest first within a price. Trades happen at
+// the resting order's price. When both orders belong to the same client the
+// incoming order's STP mode decides what happens instead of a trade.
+//
+// The incoming order is not added to the book; rest whatever is left of it
+// with Add. Match returns the events in the order they happened.
+func (b *Book) Match(taker *Order, mode model.STPMode) []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var events []Event
+	for taker.Leaves.IsPositive() {
+		side := b.opposite(taker.Cmd)
+		if len(side) == 0 || !crosses(taker, side[0].Px) {
+			break
+		}
+		maker := side[0]
+
+		if maker.Cmd.ClientID != taker.Cmd.ClientID {
+			qty := decimal.Min(taker.Leaves, maker.Visible())
+			px := maker.Px
+			taker.Fill(qty, px)
+			maker.Fill(qty, px)
+			events = append(events,
+				Event{Kind: EventFill, Order: maker, Qty: qty, Px: px, Liquidity: model.LiquidityAdded},
+				Event{Kind: EventFill, Order: taker, Qty: qty, Px: px, Liquidity: model.LiquidityRemoved})
+			switch {
+			case maker.Leaves.IsZero():
+				b.removeLocked(maker)
+			case maker.iceberg():
+				maker.shown = maker.shown.Sub(qty)
+				if maker.shown.IsZero() {
+					// Replenish from the reserve, behind everyone at the price.
+					b.removeLocked(maker)
+					b.addLocked(maker)
+				}
+			}
+			continue
+		}
+
+		switch mode {
+		case model.STPCancelOldest:
+			events = append(events, b.cancelLocked(maker, ReasonSTPCancelOldest))
+		case model.STPCancelBoth:
+			events = append(events, b.cancelLocked(maker, ReasonSTPCancelBoth), cancelTaker(taker, ReasonSTPCancelBoth))
+		case model.STPDecrementAndCancel:
+			qty := decimal.Min(taker.Leaves, maker.Leaves)
+			for _, o := range []*Order{maker, taker} {
+				if o.Leaves.Equal(qty) {
+					if o == maker {
+						events = append(events, b.cancelLocked(o, ReasonSTPDecrement))
+					} else {
+						events = append(events, cancelTaker(o, ReasonSTPDecrement))
+					}
+					continue
+				}
+				o.Leaves = o.Leaves.Sub(qty)
+				if o.iceberg() {
+					o.shown = decimal.Min(o.shown, o.Leaves)
+				}
+				events = append(events, Event{Kind: EventDecrement, Order: o, Qty: qty, Reason: ReasonSTPDecrement})
+			}
+		default: // model.STPCancelNewest
+			events = append(events, cancelTaker(taker, ReasonSTPCancelNewest))
+		}
+	}
+	return events
+}
+
+func cancelTaker(o *Order, reason string) Event {
+	ev := Event{Kind: EventCancel, Order: o, Qty: o.Leaves, Reason: reason}
+	o.Leaves = decimal.Zero
+	return ev
+}
+
+func (b *Book) cancelLocked(o *Order, reason string) Event {
+	ev := Event{Kind: EventCancel, Order: o, Qty: o.Leaves, Reason: reason}
+	b.removeLocked(o)
+	o.Leaves = decimal.Zero
+	return ev
+}
+
+// crosses reports whether an incoming order trades at a resting price. A zero
+// price is a market order and crosses any price.
+func crosses(o *Order, restingPx decimal.Decimal) bool {
+	if o.Px.IsZero() {
+		return true
+	}
+	if o.Cmd.Side == model.OrderSideBuy {
+		return o.Px.GreaterThanOrEqual(restingPx)
+	}
+	return o.Px.LessThanOrEqual(restingPx)
+}
+
+// BestOpposite returns the best resting price an incoming order would trade
+// against, if there is one.
+func (b *Book) BestOpposite(cmd model.OrderCommand) (decimal.Decimal, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	side := b.opposite(cmd)
+	if len(side) == 0 {
+		return decimal.Zero, false
+	}
+	return side[0].Px, true
+}
+
+// PostOnly keeps a post-only order from taking liquidity. market is the best
+// opposite price outside the book; a better resting order takes its place.
+// An order that would trade there is rejected, or for REPRICE moved one tick
+// behind it. PostOnly returns the price the order would have taken at and
+// false if it must be rejected.
+func (b *Book) PostOnly(o *Order, market, tick decimal.Decimal) (decimal.Decimal, bool) {
+	buy := o.Cmd.Side == model.OrderSideBuy
+	opposite := market
+	if px, ok := b.BestOpposite(o.Cmd); ok && ((buy && px.LessThan(opposite)) || (!buy && px.GreaterThan(opposite))) {
+		opposite = px
+	}
+	if !crosses(o, opposite) {
+		return opposite, true
+	}
+	repriced := opposite.Sub(tick)
+	if !buy {
+		repriced = opposite.Add(tick)
+	}
+	if o.Cmd.PostOnly == model.PostOnlyReject || !repriced.IsPositive() {
+		return opposite, false
+	}
+	o.Px = repriced
+	return opposite, true
+}
+
+// Level is the displayed quantity at one price.
+type Level struct {
+	Px  decimal.Decimal
+	Qty decimal.Decimal
+}
+
+// Depth returns the displayed size per price for a symbol, best first.
+// Iceberg reserves are not included.
+func (b *Book) Depth(symbol string) (bids, asks []Level) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return depth(b.bids[symbol]), depth(b.asks[symbol])
+}
+
+func depth(side []*Order) []Level {
+	var out []Level
+	for _, o := range side {
+		if n := len(out); n > 0 && out[n-1].Px.Equal(o.Px) {
+			out[n-1].Qty = out[n-1].Qty.Add(o.Visible())
+			continue
+		}
+		out = append(out, Level{Px: o.Px, Qty: o.Visible()})
+	}
+	return out
+}
+
+func (b *Book) opposite(cmd model.OrderCommand) []*Order {
+	if cmd.Side == model.OrderSideBuy {
+		return b.asks[cmd.Symbol]
+	}
+	return b.bids[cmd.Symbol]
+}
+
+// Add rests what is left of an order behind every order at the same price.
+func (b *Book) Add(o *Order) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.addLocked(o)
+}
+
+func (b *Book) addLocked(o *Order) {
+	if o.iceberg() {
+		o.shown = decimal.Min(o.Display, o.Leaves)
+	}
+	b.seq++
+	o.seq = b.seq
+	b.orders[o.Cmd.OrderID] = o
+
+	levels := b.asks
+	better := func(a, c *Order) bool { return a.Px.LessThan(c.Px) }
+	if o.Cmd.Side == model.OrderSideBuy {
+		levels = b.bids
+		better = func(a, c *Order) bool { return a.Px.GreaterThan(c.Px) }
+	}
+	side := levels[o.Cmd.Symbol]
+	i := sort.Search(len(side), func(i int) bool { return better(o, side[i]) })
+	side = append(side, nil)
+	copy(side[i+1:], side[i:])
+	side[i] = o
+	levels[o.Cmd.Symbol] = side
+}
+
+// Remove takes an order out of the book. It returns false if the order is
+// not resting, e.g. because it already filled.
+func (b *Book) Remove(orderID string) (*Order, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	o, ok := b.orders[orderID]
+	if ok {
+		b.removeLocked(o)
+	}
+	return o, ok
+}
+
+func (b *Book) removeLocked(o *Order) {
+	delete(b.orders, o.Cmd.OrderID)
+	levels := b.asks
+	if o.Cmd.Side == model.OrderSideBuy {
+		levels = b.bids
+	}
+	side := levels[o.Cmd.Symbol]
+	for i, r := range side {
+		if r == o {
+			levels[o.Cmd.Symbol] = append(side[:i:i], side[i+1:]...)
+			return
+		}
+	}
+}
+
+// Len returns the number of resting orders.
+func (b *Book) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.orders)
+}
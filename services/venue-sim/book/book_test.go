@@ -0,0 +1,308 @@
+package book
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/atlas/services/common/decimal"
+	"github.com/atlas/services/common/model"
+)
+
+var t0 = time.Date(2026, 1, 5, 9, 30, 0, 0, time.UTC)
+
+func dec(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+func order(id, client string, side model.OrderSide, qty, px string) *Order {
+	return NewOrder(model.OrderCommand{
+		OrderID:     id,
+		ClientID:    client,
+		Symbol:      "BTC-USD",
+		Side:        side,
+		OrderType:   model.OrderTypeLimit,
+		QuantityVal: dec(qty),
+		Price:       dec(px),
+		Timestamp:   t0,
+	})
+}
+
+// describe renders events as "fill M1 3@100 ADDED", "cancel T 3
+// STP_CANCEL_NEWEST" or "decrement M1 3 STP_DECREMENT".
+func describe(events []Event) []string {
+	out := []string{}
+	for _, ev := range events {
+		switch ev.Kind {
+		case EventFill:
+			out = append(out, fmt.Sprintf("fill %s %s@%s %s", ev.Order.Cmd.OrderID, ev.Qty, ev.Px, ev.Liquidity))
+		case EventCancel:
+			out = append(out, fmt.Sprintf("cancel %s %s %s", ev.Order.Cmd.OrderID, ev.Qty, ev.Reason))
+		case EventDecrement:
+			out = append(out, fmt.Sprintf("decrement %s %s %s", ev.Order.Cmd.OrderID, ev.Qty, ev.Reason))
+		}
+	}
+	return out
+}
+
+// resting renders one side of the book as "id leaves@px" in priority order.
+func resting(b *Book, side model.OrderSide) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	levels := b.asks
+	if side == model.OrderSideBuy {
+		levels = b.bids
+	}
+	out := []string{}
+	for _, o := range levels["BTC-USD"] {
+		out = append(out, fmt.Sprintf("%s %s@%s", o.Cmd.OrderID, o.Leaves, o.Px))
+	}
+	return out
+}
+
+func TestMatch(t *testing.T) {
+	b := New()
+	b.Add(order("S2", "B", model.OrderSideSell, "2", "101"))
+	b.Add(order("S1", "B", model.OrderSideSell, "1", "100"))
+	b.Add(order("S3", "C", model.OrderSideSell, "4", "101"))
+
+	taker := order("T", "A", model.OrderSideBuy, "5", "101")
+	got := describe(b.Match(taker, model.STPCancelNewest))
+	want := []string{
+		"fill S1 1@100 ADDED", "fill T 1@100 REMOVED",
+		"fill S2 2@101 ADDED", "fill T 2@101 REMOVED",
+		"fill S3 2@101 ADDED", "fill T 2@101 REMOVED",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+	if !taker.Leaves.IsZero() || !taker.AvgPx().Equal(dec("100.8")) || taker.Status() != model.OrderStatusFilled {
+		t.Errorf("taker leaves=%s avg=%s status=%s", taker.Leaves, taker.AvgPx(), taker.Status())
+	}
+	if got := resting(b, model.OrderSideSell); !reflect.DeepEqual(got, []string{"S3 2@101"}) {
+		t.Errorf("asks = %q", got)
+	}
+
+	// Nothing crosses a limit below the best ask; a market order takes any.
+	low := order("L", "A", model.OrderSideBuy, "1", "100")
+	if ev := b.Match(low, model.STPCancelNewest); len(ev) != 0 {
+		t.Errorf("limit below the ask traded: %q", describe(ev))
+	}
+	market := order("M", "A", model.OrderSideBuy, "1", "0")
+	if got := describe(b.Match(market, model.STPCancelNewest)); len(got) != 2 {
+		t.Errorf("market order events = %q", got)
+	}
+}
+
+func TestSelfTradePrevention(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        model.STPMode
+		qty         string
+		want        []string
+		takerLeaves string
+		asks        []string
+	}{
+		{
+			name:        "cancel newest",
+			mode:        model.STPCancelNewest,
+			qty:         "3",
+			want:        []string{"cancel T 3 STP_CANCEL_NEWEST"},
+			takerLeaves: "0",
+			asks:        []string{"OWN 5@100", "OTHER 5@101"},
+		},
+		{
+			name: "cancel oldest",
+			mode: model.STPCancelOldest,
+			qty:  "8",
+			// The taker goes on to trade with the next client's order.
+			want:        []string{"cancel OWN 5 STP_CANCEL_OLDEST", "fill OTHER 5@101 ADDED", "fill T 5@101 REMOVED"},
+			takerLeaves: "3",
+			asks:        []string{},
+		},
+		{
+			name:        "cancel both",
+			mode:        model.STPCancelBoth,
+			qty:         "3",
+			want:        []string{"cancel OWN 5 STP_CANCEL_BOTH", "cancel T 3 STP_CANCEL_BOTH"},
+			takerLeaves: "0",
+			asks:        []string{"OTHER 5@101"},
+		},
+		{
+			name:        "decrement the larger resting order",
+			mode:        model.STPDecrementAndCancel,
+			qty:         "3",
+			want:        []string{"decrement OWN 3 STP_DECREMENT", "cancel T 3 STP_DECREMENT"},
+			takerLeaves: "0",
+			asks:        []string{"OWN 2@100", "OTHER 5@101"},
+		},
+		{
+			name:        "decrement the larger taker",
+			mode:        model.STPDecrementAndCancel,
+			qty:         "8",
+			want:        []string{"cancel OWN 5 STP_DECREMENT", "decrement T 5 STP_DECREMENT", "fill OTHER 3@101 ADDED", "fill T 3@101 REMOVED"},
+			takerLeaves: "0",
+			asks:        []string{"OTHER 2@101"},
+		},
+		{
+			name:        "decrement equal orders",
+			mode:        model.STPDecrementAndCancel,
+			qty:         "5",
+			want:        []string{"cancel OWN 5 STP_DECREMENT", "cancel T 5 STP_DECREMENT"},
+			takerLeaves: "0",
+			asks:        []string{"OTHER 5@101"},
+		},
+		{
+			name:        "unset mode cancels newest",
+			mode:        "",
+			qty:         "3",
+			want:        []string{"cancel T 3 STP_CANCEL_NEWEST"},
+			takerLeaves: "0",
+			asks:        []string{"OWN 5@100", "OTHER 5@101"},
+		},
+	}
+	for _, tt := range tests {
+		b := New()
+		b.Add(order("OWN", "A", model.OrderSideSell, "5", "100"))
+		b.Add(order("OTHER", "B", model.OrderSideSell, "5", "101"))
+		taker := order("T", "A", model.OrderSideBuy, tt.qty, "101")
+
+		if got := describe(b.Match(taker, tt.mode)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: events = %q, want %q", tt.name, got, tt.want)
+		}
+		if !taker.Leaves.Equal(dec(tt.takerLeaves)) {
+			t.Errorf("%s: taker leaves = %s, want %s", tt.name, taker.Leaves, tt.takerLeaves)
+		}
+		if got := resting(b, model.OrderSideSell); !reflect.DeepEqual(got, tt.asks) {
+			t.Errorf("%s: asks = %q, want %q", tt.name, got, tt.asks)
+		}
+	}
+}
+
+func TestRemove(t *testing.T) {
+	b := New()
+	b.Add(order("B1", "A", model.OrderSideBuy, "1", "99"))
+	if o, ok := b.Remove("B1"); !ok || o.Cmd.OrderID != "B1" || b.Len() != 0 {
+		t.Errorf("Remove(B1) = %v, %v; Len = %d", o, ok, b.Len())
+	}
+	if _, ok := b.Remove("B1"); ok {
+		t.Errorf("Remove(B1) twice succeeded")
+	}
+}
+
+func iceberg(id, client string, side model.OrderSide, qty, display, px string) *Order {
+	o := order(id, client, side, qty, px)
+	o.Cmd.DisplayQty = dec(display)
+	o.Display = o.Cmd.DisplayQty
+	return o
+}
+
+func asks(b *Book) []string {
+	_, levels := b.Depth("BTC-USD")
+	out := []string{}
+	for _, l := range levels {
+		out = append(out, fmt.Sprintf("%s@%s", l.Qty, l.Px))
+	}
+	return out
+}
+
+func TestIceberg(t *testing.T) {
+	b := New()
+	b.Add(iceberg("ICE", "B", model.OrderSideSell, "10", "3", "100"))
+	b.Add(order("X", "C", model.OrderSideSell, "2", "100"))
+
+	// Only the shown part of the iceberg is in the depth.
+	if got, want := asks(b), []string{"5@100"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("depth = %q, want %q", got, want)
+	}
+
+	steps := []struct {
+		qty     string
+		events  []string
+		resting []string
+		depth   []string
+	}{
+		// Taking the shown 3 refills it from the reserve behind X.
+		{"3", []string{"fill ICE 3@100 ADDED", "fill T 3@100 REMOVED"}, []string{"X 2@100", "ICE 7@100"}, []string{"5@100"}},
+		{"4", []string{"fill X 2@100 ADDED", "fill T 2@100 REMOVED", "fill ICE 2@100 ADDED", "fill T 2@100 REMOVED"}, []string{"ICE 5@100"}, []string{"1@100"}},
+		// A taker larger than the shown size takes one refill at a time.
+		{"4", []string{"fill ICE 1@100 ADDED", "fill T 1@100 REMOVED", "fill ICE 3@100 ADDED", "fill T 3@100 REMOVED"}, []string{"ICE 1@100"}, []string{"1@100"}},
+		{"5", []string{"fill ICE 1@100 ADDED", "fill T 1@100 REMOVED"}, []string{}, []string{}},
+	}
+	for i, st := range steps {
+		got := describe(b.Match(order("T", "A", model.OrderSideBuy, st.qty, "100"), model.STPCancelNewest))
+		if !reflect.DeepEqual(got, st.events) {
+			t.Errorf("step %d: events = %q, want %q", i, got, st.events)
+		}
+		if got := resting(b, model.OrderSideSell); !reflect.DeepEqual(got, st.resting) {
+			t.Errorf("step %d: resting = %q, want %q", i, got, st.resting)
+		}
+		if got := asks(b); !reflect.DeepEqual(got, st.depth) {
+			t.Errorf("step %d: depth = %q, want %q", i, got, st.depth)
+		}
+	}
+}
+
+func TestIcebergDepth(t *testing.T) {
+	b := New()
+	b.Add(iceberg("ICE", "B", model.OrderSideSell, "50", "5", "101"))
+	b.Add(order("S", "C", model.OrderSideSell, "1", "100"))
+	// Shown less than the display size once the reserve runs short.
+	b.Add(iceberg("TAIL", "B", model.OrderSideSell, "2", "5", "102"))
+	b.Add(iceberg("BID", "B", model.OrderSideBuy, "9", "4", "99"))
+
+	bids, _ := b.Depth("BTC-USD")
+	if len(bids) != 1 || !bids[0].Qty.Equal(dec("4")) {
+		t.Errorf("bids = %v, want 4@99", bids)
+	}
+	if got, want := asks(b), []string{"1@100", "5@101", "2@102"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("asks = %q, want %q", got, want)
+	}
+}
+
+func TestPostOnly(t *testing.T) {
+	tick := dec("0.5")
+	tests := []struct {
+		name     string
+		side     model.OrderSide
+		mode     model.PostOnly
+		px       string
+		market   string
+		resting  string // a resting opposite order of another client, if any
+		ok       bool
+		wantPx   string
+		takingAt string
+	}{
+		{"reject passive", model.OrderSideBuy, model.PostOnlyReject, "100", "101", "", true, "100", "101"},
+		{"reject at the touch", model.OrderSideBuy, model.PostOnlyReject, "101", "101", "", false, "101", "101"},
+		{"reject through the touch", model.OrderSideSell, model.PostOnlyReject, "98", "99", "", false, "98", "99"},
+		{"reprice buy", model.OrderSideBuy, model.PostOnlyReprice, "102", "101", "", true, "100.5", "101"},
+		{"reprice sell", model.OrderSideSell, model.PostOnlyReprice, "98", "99", "", true, "99.5", "99"},
+		// A resting order better than the market is what it would take.
+		{"reprice behind a resting order", model.OrderSideBuy, model.PostOnlyReprice, "100.2", "101", "100", true, "99.5", "100"},
+		{"reject at a resting order", model.OrderSideBuy, model.PostOnlyReject, "100", "101", "100", false, "100", "100"},
+		{"resting order behind the market", model.OrderSideBuy, model.PostOnlyReject, "100", "101", "102", true, "100", "101"},
+		{"nothing to reprice to", model.OrderSideBuy, model.PostOnlyReprice, "1", "0.5", "", false, "1", "0.5"},
+	}
+	for _, tt := range tests {
+		b := New()
+		if tt.resting != "" {
+			other := model.OrderSideSell
+			if tt.side == model.OrderSideSell {
+				other = model.OrderSideBuy
+			}
+			b.Add(order("R", "B", other, "1", tt.resting))
+		}
+		o := order("P", "A", tt.side, "1", tt.px)
+		o.Cmd.PostOnly = tt.mode
+
+		at, ok := b.PostOnly(o, dec(tt.market), tick)
+		if ok != tt.ok || !o.Px.Equal(dec(tt.wantPx)) || !at.Equal(dec(tt.takingAt)) {
+			t.Errorf("%s: PostOnly = %s, %v with px %s; want %s, %v with px %s", tt.name, at, ok, o.Px, tt.takingAt, tt.ok, tt.wantPx)
+		}
+		if !o.Cmd.Price.Equal(dec(tt.px)) {
+			t.Errorf("%s: PostOnly changed the order's limit to %s", tt.name, o.Cmd.Price)
+		}
+	}
+}
@@ -7,12 +7,17 @@ import (
 	"math/rand"
 	"os"
 	"os/signal"
+	"sort"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/atlas/services/common/instrument"
 	"github.com/atlas/services/common/kafka"
 	"github.com/atlas/services/common/model"
+	"github.com/atlas/services/common/schema"
+	"github.com/atlas/services/common/venue"
+	"github.com/atlas/services/venue-sim/book"
 	"github.com/google/uuid"
 )
 
@@ -21,33 +26,112 @@ var (
 	topicEvents     = "orders.events"
 	topicExecs      = "exec.reports"
 	topicMarketData = "market.data"
+
+	// Price levels per side in published L2.
+	l2Depth = 5
+
+	// Self-trade prevention for orders that do not set their own mode.
+	stpMode = defaultSTPMode()
+
+	// The venue this instance runs as: ATLAS_VENUE_ID, or the default venue.
+	thisVenue venue.Venue
+
+	instruments *instrument.Master
 )
 
+func defaultSTPMode() model.STPMode {
+	if mode, ok := os.LookupEnv("ATLAS_VENUE_STP_MODE"); ok {
+		switch m := model.STPMode(mode); m {
+		case model.STPCancelNewest, model.STPCancelOldest, model.STPCancelBoth, model.STPDecrementAndCancel:
+			return m
+		}
+		log.Printf("[VENUE] Unknown ATLAS_VENUE_STP_MODE %q, using %s", mode, model.STPCancelNewest)
+	}
+	return model.STPCancelNewest
+}
+
+// selectVenue picks this instance's venue from the directory.
+func selectVenue(venues *venue.Directory) venue.Venue {
+	id, ok := os.LookupEnv("ATLAS_VENUE_ID")
+	if !ok {
+		return venues.Default()
+	}
+	v, ok := venues.Get(id)
+	if !ok {
+		log.Fatalf("Unknown ATLAS_VENUE_ID %q", id)
+	}
+	return v
+}
+
+// routedHere reports whether an order is for this venue. Orders without a
+// venue go to the default venue.
+func routedHere(cmd model.OrderCommand) bool {
+	if cmd.Venue == "" {
+		return thisVenue.Default
+	}
+	return cmd.Venue == thisVenue.ID
+}
+
 // MarketState holds the current market price for symbols
 type MarketState struct {
 	sync.RWMutex
-	Prices map[string]float64
+	Prices      map[string]float64
+	Instruments *instrument.Master
+	Book        *book.Book
 }
 
 func main() {
+	schemas, err := schema.Load(schema.Dir())
+	if err != nil {
+		log.Fatalf("Failed to load schemas: %v", err)
+	}
+
+	instruments, err = instrument.Load(instrument.File())
+	if err != nil {
+		log.Fatalf("Failed to load instrument master: %v", err)
+	}
+
+	venues, err := venue.Load(venue.File())
+	if err != nil {
+		log.Fatalf("Failed to load venue directory: %v", err)
+	}
+	thisVenue = selectVenue(venues)
+
 	producer := kafka.NewProducer(kafkaBrokers, topicExecs)
 	defer producer.Close()
 
 	mdProducer := kafka.NewProducer(kafkaBrokers, topicMarketData)
 	defer mdProducer.Close()
 
-	consumer := kafka.NewConsumer(kafkaBrokers, topicEvents, "venue-sim-group-v6")
+	// Every instance sees every order event, so each venue has its own group.
+	group := "venue-sim-group-v6"
+	if !thisVenue.Default {
+		group += "-" + thisVenue.ID
+	}
+	consumer := kafka.NewConsumer(kafkaBrokers, topicEvents, group)
 	defer consumer.Close()
 
-	log.Println("Venue Sim started...")
+	log.Printf("Venue Sim started as %s (maker=%sbps taker=%sbps min_fee=%s %s, spread=%gbps depth=x%g trades=%g/s)...",
+		thisVenue.ID, thisVenue.MakerBps, thisVenue.TakerBps, thisVenue.MinFee, thisVenue.Asset,
+		thisVenue.SpreadBps, thisVenue.DepthFactor, thisVenue.TradeRate)
+
+	// Resting participant orders: matched by later orders, available to cancel
+	resting := book.New()
 
-	// Initialize Market State
+	// Initialize Market State: one book per instrument, seeded at its reference price
 	marketState := &MarketState{
-		Prices: map[string]float64{
-			"BTC-USD": 50000.0,
-			"ETH-USD": 3000.0,
-			"SOL-USD": 100.0,
-		},
+		Prices:      make(map[string]float64),
+		Instruments: instruments,
+		Book:        resting,
+	}
+	for _, inst := range instruments.All() {
+		if !inst.ReferencePrice.IsPositive() {
+			log.Printf("[VENUE] %s has no reference price, not quoting it", inst.Symbol)
+			continue
+		}
+		marketState.Prices[inst.Symbol] = inst.ReferencePrice.Float64()
+		log.Printf("[VENUE] Book configured: %s tick=%s lot=%s status=%s ref=%s",
+			inst.Symbol, inst.TickSize, inst.LotSize, inst.Status, inst.ReferencePrice)
 	}
 
 	// Handle graceful shutdown
@@ -68,7 +152,12 @@ func main() {
 	// Start Market Data Simulator
 	go simulateMarketData(mdProducer, marketState)
 
-	err := consumer.Consume(ctx, func(ctx context.Context, msg kafka.Message) error {
+	err = consumer.Consume(ctx, func(ctx context.Context, msg kafka.Message) error {
+		if errs := schemas.ValidateJSON(schema.OrderEvent, msg.Value); len(errs) > 0 {
+			log.Printf("[VENUE] Event rejected by schema, skipping: %v", errs)
+			return nil
+		}
+
 		var event model.OrderEvent
 		if err := json.Unmarshal(msg.Value, &event); err != nil {
 			log.Printf("Error unmarshalling event: %v", err)
@@ -83,6 +172,9 @@ func main() {
 				log.Printf("Unmarshall error: %v", err)
 				return nil
 			}
+			if !routedHere(cmd) {
+				return nil
+			}
 
 			// DEDUPLICATION
 			processedMu.Lock()
@@ -95,66 +187,141 @@ func main() {
 			processedMu.Unlock()
 
 			// 0. Log received order
-			log.Printf("[VENUE] Received Order: ID=%s Side=%s Qty=%f Px=%f Symbol=%s Account=%s",
+			log.Printf("[VENUE] Received Order: ID=%s Side=%s Qty=%s Px=%s Symbol=%s Account=%s",
 				cmd.OrderID, cmd.Side, cmd.QuantityVal, cmd.Price, cmd.Symbol, cmd.ClientID)
 
-			// 1. Send Accepted (LIVE) immediately
-			sendExec(producer, cmd, "NEW", model.OrderStatusLive, 0, 0)
-
-			// 2. Check for Immediate Match against current market
+			// The gateway rejects these already; never let one rest here.
+			inst, ok := instruments.Get(cmd.Symbol)
 			marketState.RLock()
-			currentPrice, ok := marketState.Prices[cmd.Symbol]
+			currentPrice, quoted := marketState.Prices[cmd.Symbol]
 			marketState.RUnlock()
-
-			if !ok {
-				log.Printf("[VENUE] Unknown symbol %s, ignoring match", cmd.Symbol)
+			if !ok || !quoted || inst.Status != instrument.StatusTrading {
+				log.Printf("[VENUE] No tradable book for %s, rejecting order %s", cmd.Symbol, cmd.OrderID)
+				sendReject(producer, cmd, "UNKNOWN_SYMBOL")
 				return nil
 			}
 
 			// Generate Spread for Matching Context
-			spread := currentPrice * 0.0002
-			bestAsk := currentPrice + spread
-			bestBid := currentPrice - spread
+			spread := currentPrice * thisVenue.SpreadBps / 10000
+			bestAsk := inst.PriceFromFloat(currentPrice + spread)
+			bestBid := inst.PriceFromFloat(currentPrice - spread)
+
+			// Post-only orders must not take liquidity, from participants or the market.
+			order := book.NewOrder(cmd)
+			if cmd.PostOnly != "" {
+				market := bestAsk
+				if cmd.Side == model.OrderSideSell {
+					market = bestBid
+				}
+				opposite, ok := resting.PostOnly(order, market, inst.TickSize)
+				if !ok {
+					log.Printf("[VENUE] Post-only order %s at %s would take liquidity at %s, rejecting", cmd.OrderID, cmd.Price, opposite)
+					sendReject(producer, cmd, "POST_ONLY_WOULD_TAKE")
+					return nil
+				}
+				if !order.Px.Equal(cmd.Price) {
+					log.Printf("[VENUE] Post-only order %s at %s would take liquidity at %s, repriced to %s", cmd.OrderID, cmd.Price, opposite, order.Px)
+				}
+			}
+
+			// 1. Send Accepted (LIVE) immediately
+			ack := execReport(order, "NEW", model.OrderStatusLive)
+			if !order.Px.Equal(cmd.Price) {
+				ack.Reason = "POST_ONLY_REPRICED"
+			}
+			publishExec(producer, ack)
 
-			log.Printf("[VENUE] MATCH CHECK: %s. OrderPx: %f. Market: Bid=%f, Ask=%f",
-				cmd.Symbol, cmd.Price, bestBid, bestAsk)
+			// 2. Match against resting participant orders first
+			mode := cmd.STPMode
+			if mode == "" {
+				mode = stpMode
+			}
+			for _, ev := range resting.Match(order, mode) {
+				reportEvent(producer, ev)
+			}
+			if order.Leaves.IsZero() {
+				return nil // filled, or canceled by self-trade prevention
+			}
+
+			// 3. Check what is left for an immediate match against current market
+			log.Printf("[VENUE] MATCH CHECK: %s. OrderPx: %s. Market: Bid=%s, Ask=%s",
+				cmd.Symbol, order.Px, bestBid, bestAsk)
 
 			// Matching Logic
 			matched := false
-			fillPrice := currentPrice // Default fallback
+			fillPrice := inst.PriceFromFloat(currentPrice) // Default fallback
 
+			// A market order with no protection price takes any price.
+			unprotected := order.Px.IsZero()
 			if cmd.Side == model.OrderSideBuy {
 				// BUY fills if Price >= BestAsk
 				// Fill at BestAsk (Market Price)
-				if cmd.Price >= bestAsk {
+				if unprotected || order.Px.GreaterThanOrEqual(bestAsk) {
 					matched = true
 					fillPrice = bestAsk
-					log.Printf("[VENUE] BUY MATCHED! %f >= %f. Fill @ %f", cmd.Price, bestAsk, fillPrice)
+					log.Printf("[VENUE] BUY MATCHED! %s >= %s. Fill @ %s", order.Px, bestAsk, fillPrice)
 				} else {
-					log.Printf("[VENUE] BUY RESTING. %f < %f", cmd.Price, bestAsk)
+					log.Printf("[VENUE] BUY RESTING. %s < %s", order.Px, bestAsk)
 				}
 			} else {
 				// SELL fills if Price <= BestBid
 				// Fill at BestBid (Market Price)
-				if cmd.Price <= bestBid {
+				if unprotected || order.Px.LessThanOrEqual(bestBid) {
 					matched = true
 					fillPrice = bestBid
-					log.Printf("[VENUE] SELL MATCHED! %f <= %f. Fill @ %f", cmd.Price, bestBid, fillPrice)
+					log.Printf("[VENUE] SELL MATCHED! %s <= %s. Fill @ %s", order.Px, bestBid, fillPrice)
 				} else {
-					log.Printf("[VENUE] SELL RESTING. %f > %f", cmd.Price, bestBid)
+					log.Printf("[VENUE] SELL RESTING. %s > %s", order.Px, bestBid)
 				}
 			}
 
 			if matched {
-				log.Printf("Order %s MATCHED! Limit: %f, Market: %f. Filling...", cmd.OrderID, cmd.Price, fillPrice)
+				log.Printf("Order %s MATCHED! Limit: %s, Market: %s. Filling...", cmd.OrderID, cmd.Price, fillPrice)
 				// Simulate latency
 				time.Sleep(time.Duration(rand.Intn(200)+50) * time.Millisecond)
 
-				// Send Filled
-				sendExec(producer, cmd, "TRADE", model.OrderStatusFilled, cmd.QuantityVal, fillPrice)
+				// Fill the remainder
+				qty := order.Leaves
+				order.Fill(qty, fillPrice)
+				report := execReport(order, "TRADE", order.Status())
+				report.LastQty = qty
+				report.LastPx = fillPrice
+				chargeFee(&report, order, model.LiquidityRemoved)
+				publishExec(producer, report)
+			} else if cmd.OrderType == model.OrderTypeMarket {
+				// Market orders never rest: the market is beyond the protection price.
+				log.Printf("[VENUE] Market order %s not filled within protection price %s, canceling %s", cmd.OrderID, order.Px, order.Leaves)
+				report := execReport(order, "CANCELED", model.OrderStatusCanceled)
+				report.Reason = "MARKET_PROTECTION"
+				publishExec(producer, report)
 			} else {
-				log.Printf("Order %s resting in book. Limit: %f, Market: %f", cmd.OrderID, cmd.Price, currentPrice)
+				resting.Add(order)
+				log.Printf("Order %s resting in book. Px: %s, Market: %f (%d resting)", cmd.OrderID, order.Px, currentPrice, resting.Len())
+			}
+		}
+
+		if event.Type == "ORDER_CANCEL_REQUESTED" {
+			payloadBytes, _ := json.Marshal(event.Payload)
+			var cmd model.OrderCommand
+			if err := json.Unmarshal(payloadBytes, &cmd); err != nil {
+				log.Printf("Unmarshall error: %v", err)
+				return nil
+			}
+			processedMu.Lock()
+			ours := processedOrders[cmd.OrderID]
+			processedMu.Unlock()
+			if !ours {
+				return nil // sent to another venue
+			}
+
+			order, ok := resting.Remove(cmd.OrderID)
+			if !ok {
+				log.Printf("[VENUE] Cancel for %s ignored: order is not resting (too late to cancel)", cmd.OrderID)
+				return nil
 			}
+			log.Printf("[VENUE] Canceled resting order %s (%s %s of %s %s @ %s)",
+				cmd.OrderID, order.Cmd.Side, order.Leaves, order.Cmd.QuantityVal, order.Cmd.Symbol, order.Cmd.Price)
+			publishExec(producer, execReport(order, "CANCELED", model.OrderStatusCanceled))
 		}
 
 		return nil
@@ -165,35 +332,82 @@ func main() {
 	}
 }
 
-func sendExec(p *kafka.Producer, cmd model.OrderCommand, execType string, status model.OrderStatus, fillQty float64, fillPx float64) {
+// execReport describes the order's current state. LeavesQty on a CANCELED
+// report is the quantity that was still open when it was canceled.
+func execReport(o *book.Order, execType string, status model.OrderStatus) model.ExecutionReport {
 	report := model.ExecutionReport{
 		ExecID:    uuid.New().String(),
-		OrderID:   cmd.OrderID,
-		ClientID:  cmd.ClientID,
-		Symbol:    cmd.Symbol,
-		Side:      cmd.Side,
-		OrderQty:  cmd.QuantityVal,
-		Price:     cmd.Price,
+		OrderID:   o.Cmd.OrderID,
+		ClientID:  o.Cmd.ClientID,
+		Symbol:    o.Cmd.Symbol,
+		Side:      o.Cmd.Side,
+		OrderQty:  o.Cmd.QuantityVal,
+		Price:     o.Cmd.Price,
 		Type:      execType,
 		Status:    status,
+		LeavesQty: o.Leaves,
+		CumQty:    o.Cum,
+		AvgPx:     o.AvgPx(),
 		Timestamp: time.Now().UTC(),
+
+		ParentOrderID:   o.Cmd.ParentOrderID,
+		ContingencyType: o.Cmd.ContingencyType,
+		ReservePx:       o.Cmd.ReservePx,
+		Venue:           thisVenue.ID,
+	}
+	if !o.Px.Equal(o.Cmd.Price) {
+		report.BookPx = o.Px
 	}
+	return report
+}
 
-	if status == model.OrderStatusFilled {
-		report.LastQty = fillQty
-		report.CumQty = fillQty
-		report.LeavesQty = 0
-		report.LastPx = fillPx
-		report.AvgPx = fillPx
-	} else if status == model.OrderStatusLive {
-		report.LeavesQty = cmd.QuantityVal
+// reportEvent publishes the exec report for one matching outcome.
+func reportEvent(p *kafka.Producer, ev book.Event) {
+	var report model.ExecutionReport
+	switch ev.Kind {
+	case book.EventFill:
+		report = execReport(ev.Order, "TRADE", ev.Order.Status())
+		report.LastQty = ev.Qty
+		report.LastPx = ev.Px
+		chargeFee(&report, ev.Order, ev.Liquidity)
+	case book.EventCancel:
+		log.Printf("[VENUE] 🚫 Self-trade prevented: canceled order %s (%s open) reason=%s", ev.Order.Cmd.OrderID, ev.Qty, ev.Reason)
+		report = execReport(ev.Order, "CANCELED", model.OrderStatusCanceled)
+		report.LeavesQty = ev.Qty
+	case book.EventDecrement:
+		log.Printf("[VENUE] 🚫 Self-trade prevented: order %s reduced by %s reason=%s", ev.Order.Cmd.OrderID, ev.Qty, ev.Reason)
+		report = execReport(ev.Order, "RESTATED", ev.Order.Status())
+		report.CanceledQty = ev.Qty
 	}
+	report.Reason = ev.Reason
+	publishExec(p, report)
+}
 
+// chargeFee sets the fill's liquidity indicator and the fee for it under the
+// order's tier at this venue.
+func chargeFee(report *model.ExecutionReport, o *book.Order, liq model.Liquidity) {
+	schedule := thisVenue.Fees(o.Cmd.FeeTier)
+	fee := schedule.Fee(liq, report.LastQty, report.LastPx, o.Fees)
+	o.Fees = o.Fees.Add(fee)
+
+	report.Liquidity = liq
+	report.Fee = fee
+	inst, _ := instruments.Get(o.Cmd.Symbol)
+	report.FeeAsset = inst.QuoteAsset
+	if schedule.PaysInBase(o.Cmd.Side) {
+		report.Fee = fee.Div(report.LastPx)
+		report.FeeAsset = inst.BaseAsset
+	}
+	log.Printf("[VENUE] 💸 Order %s %s %s @ %s: fee %s %s (tier %q)",
+		o.Cmd.OrderID, liq, report.LastQty, report.LastPx, report.Fee, report.FeeAsset, o.Cmd.FeeTier)
+}
+
+func publishExec(p *kafka.Producer, report model.ExecutionReport) {
 	bytes, _ := json.Marshal(report)
-	log.Printf("[VENUE] Publishing exec report: order_id=%s status=%s cum_qty=%f avg_px=%f to topic=%s",
+	log.Printf("[VENUE] Publishing exec report: order_id=%s status=%s cum_qty=%s avg_px=%s to topic=%s",
 		report.OrderID, report.Status, report.CumQty, report.AvgPx, topicExecs)
 
-	if err := p.Produce(context.Background(), []byte(cmd.OrderID), bytes); err != nil {
+	if err := p.Produce(context.Background(), []byte(report.OrderID), bytes); err != nil {
 		log.Printf("[VENUE] ❌ FAILED to publish exec report: order_id=%s error=%v", report.OrderID, err)
 	} else {
 		log.Printf("[VENUE] ✅ EXEC REPORT EMITTED: order_id=%s status=%s to topic=%s",
@@ -201,14 +415,52 @@ func sendExec(p *kafka.Producer, cmd model.OrderCommand, execType string, status
 	}
 }
 
+func sendReject(p *kafka.Producer, cmd model.OrderCommand, reason string) {
+	report := model.ExecutionReport{
+		ExecID:    uuid.New().String(),
+		OrderID:   cmd.OrderID,
+		ClientID:  cmd.ClientID,
+		Symbol:    cmd.Symbol,
+		Side:      cmd.Side,
+		OrderQty:  cmd.QuantityVal,
+		Price:     cmd.Price,
+		Type:      "REJECTED",
+		Status:    model.OrderStatusRejected,
+		Timestamp: time.Now().UTC(),
+		Reason:    reason,
+
+		ParentOrderID:   cmd.ParentOrderID,
+		ContingencyType: cmd.ContingencyType,
+		ReservePx:       cmd.ReservePx,
+		Venue:           thisVenue.ID,
+	}
+
+	bytes, _ := json.Marshal(report)
+	if err := p.Produce(context.Background(), []byte(cmd.OrderID), bytes); err != nil {
+		log.Printf("[VENUE] ❌ FAILED to publish reject: order_id=%s error=%v", report.OrderID, err)
+	}
+}
+
 func simulateMarketData(p *kafka.Producer, state *MarketState) {
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
-	symbols := []string{"BTC-USD", "ETH-USD", "SOL-USD"}
+	var symbols []string
+	state.RLock()
+	for _, inst := range state.Instruments.All() {
+		if _, ok := state.Prices[inst.Symbol]; ok {
+			symbols = append(symbols, inst.Symbol)
+		}
+	}
+	state.RUnlock()
 
 	for range ticker.C {
 		for _, sym := range symbols {
+			inst, _ := state.Instruments.Get(sym)
+			if inst.Status != instrument.StatusTrading {
+				continue
+			}
+
 			state.Lock()
 			base := state.Prices[sym]
 			// 1. Random Walk
@@ -218,30 +470,36 @@ func simulateMarketData(p *kafka.Producer, state *MarketState) {
 			currentPrice := base
 			state.Unlock()
 
-			// Generate L2 (Spread around current price)
-			spread := currentPrice * 0.0002
-			bestAsk := currentPrice + spread
-			bestBid := currentPrice - spread
+			// Generate L2 (Spread around current price, sized by the venue's depth)
+			spread := currentPrice * thisVenue.SpreadBps / 10000
+			bestAsk := inst.PriceFromFloat(currentPrice + spread).Float64()
+			bestBid := inst.PriceFromFloat(currentPrice - spread).Float64()
+			depth := thisVenue.DepthFactor
 
 			l2 := model.MarketDataUpdate{
 				Type:      model.MarketDataTypeL2,
 				Symbol:    sym,
+				Venue:     thisVenue.ID,
 				Timestamp: time.Now().UTC(),
 				Bids: []model.PriceLevel{
-					{Price: bestBid, Qty: rand.Float64() * 5},
-					{Price: bestBid - (currentPrice * 0.0005), Qty: rand.Float64() * 10},
-					{Price: bestBid - (currentPrice * 0.0010), Qty: rand.Float64() * 20},
+					{Price: bestBid, Qty: rand.Float64() * 5 * depth},
+					{Price: inst.PriceFromFloat(bestBid - (currentPrice * 0.0005)).Float64(), Qty: rand.Float64() * 10 * depth},
+					{Price: inst.PriceFromFloat(bestBid - (currentPrice * 0.0010)).Float64(), Qty: rand.Float64() * 20 * depth},
 				},
 				Asks: []model.PriceLevel{
-					{Price: bestAsk, Qty: rand.Float64() * 5},
-					{Price: bestAsk + (currentPrice * 0.0005), Qty: rand.Float64() * 10},
-					{Price: bestAsk + (currentPrice * 0.0010), Qty: rand.Float64() * 20},
+					{Price: bestAsk, Qty: rand.Float64() * 5 * depth},
+					{Price: inst.PriceFromFloat(bestAsk + (currentPrice * 0.0005)).Float64(), Qty: rand.Float64() * 10 * depth},
+					{Price: inst.PriceFromFloat(bestAsk + (currentPrice * 0.0010)).Float64(), Qty: rand.Float64() * 20 * depth},
 				},
 			}
+			// Participant orders show with their displayed size only.
+			bids, asks := state.Book.Depth(sym)
+			l2.Bids = mergeLevels(l2.Bids, bids, true)
+			l2.Asks = mergeLevels(l2.Asks, asks, false)
 			sendMarketData(p, l2)
 
 			// 2. Randomly Generate Trade (noise)
-			if rand.Float64() > 0.7 {
+			if rand.Float64() < thisVenue.TradeRate {
 				side := "BUY"
 				tradePx := bestAsk
 				if rand.Float64() > 0.5 {
@@ -251,10 +509,11 @@ func simulateMarketData(p *kafka.Producer, state *MarketState) {
 				trade := model.MarketDataUpdate{
 					Type:      model.MarketDataTypeTrade,
 					Symbol:    sym,
+					Venue:     thisVenue.ID,
 					Timestamp: time.Now().UTC(),
 					Trade: &model.TradeInfo{
 						Price: tradePx,
-						Qty:   rand.Float64() * 2,
+						Qty:   rand.Float64() * 2 * depth,
 						Side:  side,
 					},
 				}
@@ -264,6 +523,35 @@ func simulateMarketData(p *kafka.Producer, state *MarketState) {
 	}
 }
 
+// mergeLevels adds resting participant size to the simulated levels, best
+// price first, keeping at most l2Depth levels.
+func mergeLevels(simulated []model.PriceLevel, resting []book.Level, bids bool) []model.PriceLevel {
+	byPx := make(map[float64]int, len(simulated))
+	out := append([]model.PriceLevel(nil), simulated...)
+	for i, lvl := range out {
+		byPx[lvl.Price] = i
+	}
+	for _, lvl := range resting {
+		px := lvl.Px.Float64()
+		if i, ok := byPx[px]; ok {
+			out[i].Qty += lvl.Qty.Float64()
+			continue
+		}
+		byPx[px] = len(out)
+		out = append(out, model.PriceLevel{Price: px, Qty: lvl.Qty.Float64()})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if bids {
+			return out[i].Price > out[j].Price
+		}
+		return out[i].Price < out[j].Price
+	})
+	if len(out) > l2Depth {
+		out = out[:l2Depth]
+	}
+	return out
+}
+
 func sendMarketData(p *kafka.Producer, data model.MarketDataUpdate) {
 	bytes, _ := json.Marshal(data)
 	// Key by symbol to ensure ordering if partitioned